@@ -0,0 +1,305 @@
+package cmds
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/copier"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type CopyCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory sql2.DBConnectionFactory
+	repositories        []*repositories.Repository
+	queryObservers      []sqleton_cmds.QueryObserver
+}
+
+var _ cmds.GlazeCommand = (*CopyCommand)(nil)
+
+type CopySettings struct {
+	Table         string   `glazed:"table"`
+	Query         string   `glazed:"query"`
+	Command       string   `glazed:"command"`
+	Params        []string `glazed:"param"`
+	SourceProfile string   `glazed:"source-profile"`
+	TargetProfile string   `glazed:"target-profile"`
+	TargetSqlite  string   `glazed:"target-sqlite"`
+	TargetTable   string   `glazed:"target-table"`
+	BatchSize     int      `glazed:"batch-size"`
+	UpsertKey     []string `glazed:"upsert-key"`
+}
+
+// NewCopyCommand creates the copy command. The repositories are used to look up the
+// command given by --command.
+func NewCopyCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	repositories_ []*repositories.Repository,
+	queryObservers []sqleton_cmds.QueryObserver,
+	options ...cmds.CommandDescriptionOption,
+) (*CopyCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Copy the rows of a table, a query or a command into a table of another database"),
+		cmds.WithLong(`Copy the rows of a table (--table), a query (--query) or any sqleton
+command (--command, with --param name=value) into a table of another database.
+
+The source is read with the connection of --source-profile, or with the connection
+flags of this command. The target is the database of --target-profile, or the
+sqlite file --target-sqlite, which is created if it doesn't exist. For example:
+
+  sqleton copy --source-profile production --command reports/monthly-revenue \
+      --param month=2024-05 --target-sqlite reports.db --upsert-key month
+
+The target table is created if it doesn't exist, with column types inferred from
+the first batch of rows. Rows are inserted in batches of --batch-size rows, each
+in its own transaction. With --upsert-key, rows whose key already exists in the
+target table are updated instead.`),
+		cmds.WithFlags(
+			fields.New("table", fields.TypeString,
+				fields.WithHelp("Source table to copy")),
+			fields.New("query", fields.TypeString,
+				fields.WithHelp("Source query to copy the results of")),
+			fields.New("command", fields.TypeString,
+				fields.WithHelp("Source sqleton command to copy the results of (e.g. mysql/ps)")),
+			fields.New("param", fields.TypeStringList,
+				fields.WithHelp("Parameter of --command, as name=value")),
+			fields.New("source-profile", fields.TypeString,
+				fields.WithHelp("Profile of the source database (default: the connection flags)")),
+			fields.New("target-profile", fields.TypeString,
+				fields.WithHelp("Profile of the target database")),
+			fields.New("target-sqlite", fields.TypeString,
+				fields.WithHelp("Sqlite file to copy into, instead of --target-profile")),
+			fields.New("target-table", fields.TypeString,
+				fields.WithHelp("Table to copy into (default: the source table or command name)")),
+			fields.New("batch-size", fields.TypeInteger,
+				fields.WithHelp("Number of rows inserted per transaction"),
+				fields.WithDefault(copier.DefaultBatchSize)),
+			fields.New("upsert-key", fields.TypeStringList,
+				fields.WithHelp("Columns identifying a row, to update existing rows instead of inserting them")),
+		),
+		cmds.WithSections(glazedSection),
+	}, options...)
+
+	return &CopyCommand{
+		CommandDescription:  cmds.NewCommandDescription("copy", options_...),
+		dbConnectionFactory: dbConnectionFactory,
+		repositories:        repositories_,
+		queryObservers:      queryObservers,
+	}, nil
+}
+
+func (c *CopyCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &CopySettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	sources := 0
+	for _, source := range []string{s.Table, s.Query, s.Command} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("pass exactly one of --table, --query and --command")
+	}
+	if len(s.Params) > 0 && s.Command == "" {
+		return errors.New("--param can only be used with --command")
+	}
+
+	targetTable := s.TargetTable
+	if targetTable == "" {
+		switch {
+		case s.Table != "":
+			targetTable = s.Table
+			if _, name, ok := strings.Cut(s.Table, "."); ok {
+				targetTable = name
+			}
+		case s.Command != "":
+			targetTable = strings.ReplaceAll(path.Base(strings.Trim(s.Command, "/")), "-", "_")
+		default:
+			return errors.New("--target-table is required with --query")
+		}
+	}
+
+	sourceValues := parsedValues
+	if s.SourceProfile != "" {
+		var err error
+		sourceValues, err = sqleton_cmds.CommandProfileValues(c.Schema, parsedValues, s.SourceProfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var targetValues *values.Values
+	var err error
+	switch {
+	case s.TargetProfile != "" && s.TargetSqlite != "":
+		return errors.New("--target-profile and --target-sqlite can't be used together")
+	case s.TargetProfile != "":
+		targetValues, err = sqleton_cmds.CommandProfileValues(c.Schema, parsedValues, s.TargetProfile)
+	case s.TargetSqlite != "":
+		targetValues, err = sqleton_cmds.SqliteValues(c.Schema, s.TargetSqlite)
+	default:
+		return errors.New("no target given, pass --target-profile or --target-sqlite")
+	}
+	if err != nil {
+		return err
+	}
+
+	target, err := c.dbConnectionFactory(ctx, targetValues)
+	if err != nil {
+		return errors.Wrap(err, "could not connect to the target database")
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(target)
+	if err := target.PingContext(ctx); err != nil {
+		return errors.Wrap(err, "could not connect to the target database")
+	}
+
+	copier_, err := copier.New(ctx, target, copier.Options{
+		Table:       targetTable,
+		CreateTable: true,
+		BatchSize:   s.BatchSize,
+		UpsertKey:   s.UpsertKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	source := s.Command
+	if s.Command != "" {
+		err = c.runCommand(ctx, sourceValues, s.Command, s.Params, copier_)
+	} else {
+		source, err = c.runQuery(ctx, sourceValues, s, copier_)
+	}
+	if err != nil {
+		return err
+	}
+	if err := copier_.Close(ctx); err != nil {
+		return err
+	}
+
+	return gp.AddRow(ctx, types.NewRow(
+		types.MRP("source", source),
+		types.MRP("target_table", targetTable),
+		types.MRP("rows", copier_.Rows()),
+		types.MRP("created", copier_.Created()),
+	))
+}
+
+// runQuery copies the source table or query, and returns it for the summary row.
+func (c *CopyCommand) runQuery(
+	ctx context.Context,
+	sourceValues *values.Values,
+	s *CopySettings,
+	gp middlewares.Processor,
+) (string, error) {
+	db, err := c.dbConnectionFactory(ctx, sourceValues)
+	if err != nil {
+		return "", errors.Wrap(err, "could not connect to the source database")
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	if err := db.PingContext(ctx); err != nil {
+		return "", errors.Wrap(err, "could not connect to the source database")
+	}
+
+	source, query := s.Query, s.Query
+	if s.Table != "" {
+		catalog_, err := catalog.New(db)
+		if err != nil {
+			return "", err
+		}
+		table, err := catalog_.Table(ctx, s.Table)
+		if err != nil {
+			return "", err
+		}
+		source = table.QualifiedName()
+		query = "SELECT * FROM " + catalog.QuoteTable(catalog_.Dialect(), source)
+	}
+
+	execution := sqleton_cmds.NewQueryExecution(c.FullPath(), sourceValues)
+	execution.Query = query
+	if s.Table != "" {
+		execution.Parameters["table"] = s.Table
+	}
+	counter := sqleton_cmds.NewRowCountingProcessor(gp)
+
+	err = sql2.RunQueryIntoGlaze(ctx, db, query, nil, counter)
+	execution.Finish(db, counter.Rows(), err)
+	sqleton_cmds.NotifyQueryObservers(ctx, c.queryObservers, execution)
+	if err != nil {
+		return "", err
+	}
+	return source, nil
+}
+
+// runCommand runs the repository command at path with the given name=value
+// parameters and the source connection, streaming its rows into gp.
+func (c *CopyCommand) runCommand(
+	ctx context.Context,
+	sourceValues *values.Values,
+	path string,
+	params []string,
+	gp middlewares.Processor,
+) error {
+	command, ok := sqleton_cmds.FindRepositoryCommand(c.repositories, path)
+	if !ok {
+		return errors.Errorf("command %s not found", path)
+	}
+	glazeCommand, ok := command.(cmds.GlazeCommand)
+	if !ok {
+		return errors.Errorf("command %s does not produce rows", path)
+	}
+
+	defaultSection, hasDefaultSection := command.Description().GetDefaultSection()
+	parameters := map[string]interface{}{}
+	for _, param := range params {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return errors.Errorf("invalid --param %s, expected name=value", param)
+		}
+		if !hasDefaultSection {
+			return errors.Errorf("command %s has no parameter %s", path, name)
+		}
+		if _, ok := defaultSection.GetDefinitions().Get(name); !ok {
+			return errors.Errorf("command %s has no parameter %s", path, name)
+		}
+		// string values are parsed according to the type of the parameter
+		parameters[name] = value
+	}
+
+	commandValues, err := sqleton_cmds.RepositoryCommandValues(command, parameters, sourceValues)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse parameters for %s", path)
+	}
+	if err := glazeCommand.RunIntoGlazeProcessor(ctx, commandValues, gp); err != nil {
+		return errors.Wrapf(err, "could not run %s", path)
+	}
+	return nil
+}
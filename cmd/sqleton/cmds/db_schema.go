@@ -0,0 +1,434 @@
+package cmds
+
+import (
+	"context"
+	"strings"
+
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// AddDbSchemaCommands adds the schema introspection commands (tables, columns, indexes,
+// fks, describe, schema-dump and schema-diff) to DbCmd. The options are applied to every command, and usually
+// carry the connection sections.
+func AddDbSchemaCommands(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) error {
+	constructors := []func() (cmds.Command, error){
+		func() (cmds.Command, error) { return NewDbTablesCommand(dbConnectionFactory, options...) },
+		func() (cmds.Command, error) { return NewDbColumnsCommand(dbConnectionFactory, options...) },
+		func() (cmds.Command, error) { return NewDbIndexesCommand(dbConnectionFactory, options...) },
+		func() (cmds.Command, error) { return NewDbForeignKeysCommand(dbConnectionFactory, options...) },
+		func() (cmds.Command, error) { return NewDbDescribeCommand(dbConnectionFactory, options...) },
+		func() (cmds.Command, error) { return NewDbSchemaDumpCommand(dbConnectionFactory, options...) },
+		func() (cmds.Command, error) { return NewDbSchemaDiffCommand(dbConnectionFactory, options...) },
+	}
+	for _, constructor := range constructors {
+		command, err := constructor()
+		if err != nil {
+			return err
+		}
+		cobraCommand, err := sqleton_cmds.BuildCobraCommandWithSqletonMiddlewares(command)
+		if err != nil {
+			return err
+		}
+		DbCmd.AddCommand(cobraCommand)
+	}
+	return nil
+}
+
+// dbSchemaCommand is embedded by the schema introspection commands.
+type dbSchemaCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory sql2.DBConnectionFactory
+}
+
+type DbSchemaTableSettings struct {
+	Table string `glazed:"table"`
+}
+
+func newDbSchemaCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	name string,
+	commandOptions []cmds.CommandDescriptionOption,
+	options []cmds.CommandDescriptionOption,
+) (*dbSchemaCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	options_ := append(commandOptions, cmds.WithSections(glazedSection))
+	options_ = append(options_, options...)
+	return &dbSchemaCommand{
+		CommandDescription:  cmds.NewCommandDescription(name, options_...),
+		dbConnectionFactory: dbConnectionFactory,
+	}, nil
+}
+
+// withCatalog connects to the database and calls f with a catalog of it.
+func (c *dbSchemaCommand) withCatalog(
+	ctx context.Context,
+	parsedValues *values.Values,
+	f func(c *catalog.Catalog) error,
+) error {
+	db, err := c.dbConnectionFactory(ctx, parsedValues)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	catalog_, err := catalog.New(db)
+	if err != nil {
+		return err
+	}
+	return f(catalog_)
+}
+
+// tableNames returns the tables to introspect: name, or all tables (but not views)
+// when name is empty.
+func tableNames(ctx context.Context, c *catalog.Catalog, name string) ([]string, error) {
+	if name != "" {
+		return []string{name}, nil
+	}
+	tables, err := c.Tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, table := range tables {
+		if table.Type == catalog.TableTypeTable {
+			names = append(names, table.QualifiedName())
+		}
+	}
+	return names, nil
+}
+
+func tableArgument(required bool, help string) cmds.CommandDescriptionOption {
+	return cmds.WithArguments(
+		fields.New(
+			"table",
+			fields.TypeString,
+			fields.WithHelp(help),
+			fields.WithRequired(required),
+		),
+	)
+}
+
+type DbTablesCommand struct {
+	*dbSchemaCommand
+}
+
+var _ cmds.GlazeCommand = (*DbTablesCommand)(nil)
+
+func NewDbTablesCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*DbTablesCommand, error) {
+	command, err := newDbSchemaCommand(dbConnectionFactory, "tables", []cmds.CommandDescriptionOption{
+		cmds.WithShort("List the tables and views of the database"),
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return &DbTablesCommand{command}, nil
+}
+
+func (c *DbTablesCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	return c.withCatalog(ctx, parsedValues, func(c *catalog.Catalog) error {
+		tables, err := c.Tables(ctx)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if err := gp.AddRow(ctx, tableRow(table)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func tableRow(table catalog.Table) types.Row {
+	row := types.NewRow()
+	if table.Schema != "" {
+		row.Set("schema", table.Schema)
+	}
+	row.Set("name", table.Name)
+	row.Set("type", table.Type)
+	return row
+}
+
+type DbColumnsCommand struct {
+	*dbSchemaCommand
+}
+
+var _ cmds.GlazeCommand = (*DbColumnsCommand)(nil)
+
+func NewDbColumnsCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*DbColumnsCommand, error) {
+	command, err := newDbSchemaCommand(dbConnectionFactory, "columns", []cmds.CommandDescriptionOption{
+		cmds.WithShort("List the columns of a table"),
+		tableArgument(true, "The table, optionally qualified with its schema"),
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return &DbColumnsCommand{command}, nil
+}
+
+func (c *DbColumnsCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &DbSchemaTableSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	return c.withCatalog(ctx, parsedValues, func(c *catalog.Catalog) error {
+		_, columns, err := c.Columns(ctx, s.Table)
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if err := gp.AddRow(ctx, columnRow(column)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func columnRow(column catalog.Column) types.Row {
+	var default_ interface{}
+	if column.Default != nil {
+		default_ = *column.Default
+	}
+	return types.NewRow(
+		types.MRP("position", column.Position),
+		types.MRP("name", column.Name),
+		types.MRP("type", column.Type),
+		types.MRP("nullable", column.Nullable),
+		types.MRP("default", default_),
+		types.MRP("primary_key", column.PrimaryKey),
+	)
+}
+
+type DbIndexesCommand struct {
+	*dbSchemaCommand
+}
+
+var _ cmds.GlazeCommand = (*DbIndexesCommand)(nil)
+
+func NewDbIndexesCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*DbIndexesCommand, error) {
+	command, err := newDbSchemaCommand(dbConnectionFactory, "indexes", []cmds.CommandDescriptionOption{
+		cmds.WithShort("List the indexes of a table, or of all tables"),
+		tableArgument(false, "The table, optionally qualified with its schema (default: all tables)"),
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return &DbIndexesCommand{command}, nil
+}
+
+func (c *DbIndexesCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &DbSchemaTableSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	return c.withCatalog(ctx, parsedValues, func(c *catalog.Catalog) error {
+		names, err := tableNames(ctx, c, s.Table)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			table, indexes, err := c.Indexes(ctx, name)
+			if err != nil {
+				return err
+			}
+			for _, index := range indexes {
+				row := types.NewRow(
+					types.MRP("table", table.QualifiedName()),
+					types.MRP("name", index.Name),
+					types.MRP("columns", strings.Join(index.Columns, ", ")),
+					types.MRP("unique", index.Unique),
+					types.MRP("primary", index.Primary),
+				)
+				if err := gp.AddRow(ctx, row); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+type DbForeignKeysCommand struct {
+	*dbSchemaCommand
+}
+
+var _ cmds.GlazeCommand = (*DbForeignKeysCommand)(nil)
+
+func NewDbForeignKeysCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*DbForeignKeysCommand, error) {
+	command, err := newDbSchemaCommand(dbConnectionFactory, "fks", []cmds.CommandDescriptionOption{
+		cmds.WithShort("List the foreign keys of a table, or of all tables"),
+		tableArgument(false, "The table, optionally qualified with its schema (default: all tables)"),
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return &DbForeignKeysCommand{command}, nil
+}
+
+func (c *DbForeignKeysCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &DbSchemaTableSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	return c.withCatalog(ctx, parsedValues, func(c *catalog.Catalog) error {
+		names, err := tableNames(ctx, c, s.Table)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			table, foreignKeys, err := c.ForeignKeys(ctx, name)
+			if err != nil {
+				return err
+			}
+			for _, foreignKey := range foreignKeys {
+				row := types.NewRow(
+					types.MRP("table", table.QualifiedName()),
+					types.MRP("name", foreignKey.Name),
+					types.MRP("columns", strings.Join(foreignKey.Columns, ", ")),
+					types.MRP("referenced_table", foreignKey.ReferencedQualifiedName()),
+					types.MRP("referenced_columns", strings.Join(foreignKey.ReferencedColumns, ", ")),
+					types.MRP("on_update", foreignKey.OnUpdate),
+					types.MRP("on_delete", foreignKey.OnDelete),
+				)
+				if err := gp.AddRow(ctx, row); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+type DbDescribeCommand struct {
+	*dbSchemaCommand
+}
+
+var _ cmds.GlazeCommand = (*DbDescribeCommand)(nil)
+
+func NewDbDescribeCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*DbDescribeCommand, error) {
+	command, err := newDbSchemaCommand(dbConnectionFactory, "describe", []cmds.CommandDescriptionOption{
+		cmds.WithShort("Describe the columns of a table with their indexes and references"),
+		cmds.WithLong(`Describe the columns of a table with their indexes and references.
+
+Each row is a column of the table. The indexes column lists the indexes the
+column is part of, and references the columns it points to through a foreign key,
+as table(column).`),
+		tableArgument(true, "The table, optionally qualified with its schema"),
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return &DbDescribeCommand{command}, nil
+}
+
+func (c *DbDescribeCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &DbSchemaTableSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	return c.withCatalog(ctx, parsedValues, func(c *catalog.Catalog) error {
+		_, columns, err := c.Columns(ctx, s.Table)
+		if err != nil {
+			return err
+		}
+		_, indexes, err := c.Indexes(ctx, s.Table)
+		if err != nil {
+			return err
+		}
+		_, foreignKeys, err := c.ForeignKeys(ctx, s.Table)
+		if err != nil {
+			return err
+		}
+
+		columnIndexes := map[string][]string{}
+		for _, index := range indexes {
+			for _, column := range index.Columns {
+				columnIndexes[column] = append(columnIndexes[column], index.Name)
+			}
+		}
+		references := map[string][]string{}
+		for _, foreignKey := range foreignKeys {
+			for i, column := range foreignKey.Columns {
+				if i < len(foreignKey.ReferencedColumns) {
+					references[column] = append(references[column],
+						foreignKey.ReferencedQualifiedName()+"("+foreignKey.ReferencedColumns[i]+")")
+				}
+			}
+		}
+
+		for _, column := range columns {
+			row := columnRow(column)
+			row.Set("indexes", strings.Join(columnIndexes[column.Name], ", "))
+			row.Set("references", strings.Join(references[column.Name], ", "))
+			if err := gp.AddRow(ctx, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
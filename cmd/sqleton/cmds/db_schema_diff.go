@@ -0,0 +1,240 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/pkg/errors"
+)
+
+type DbSchemaDumpCommand struct {
+	*dbSchemaCommand
+}
+
+var _ cmds.BareCommand = (*DbSchemaDumpCommand)(nil)
+
+type DbSchemaDumpSettings struct {
+	Format     string `glazed:"format"`
+	OutputFile string `glazed:"output-file"`
+}
+
+func NewDbSchemaDumpCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*DbSchemaDumpCommand, error) {
+	description := cmds.NewCommandDescription("schema-dump",
+		append([]cmds.CommandDescriptionOption{
+			cmds.WithShort("Dump the tables, columns, indexes and foreign keys of the database"),
+			cmds.WithLong(`Dump the tables, columns, indexes and foreign keys of the database.
+
+The dump is a dialect-neutral model of the schema: column types are normalized
+(int4 and int(11) are both integer, character varying is varchar, ...), so that
+dumps of different databases can be compared with db schema-diff --from-file.`),
+			cmds.WithFlags(
+				fields.New(
+					"format",
+					fields.TypeChoice,
+					fields.WithHelp("Output format"),
+					fields.WithChoices("yaml", "json"),
+					fields.WithDefault("yaml"),
+				),
+				fields.New(
+					"output-file",
+					fields.TypeString,
+					fields.WithHelp("Write the dump to this file instead of stdout"),
+				),
+			),
+		}, options...)...)
+
+	return &DbSchemaDumpCommand{
+		dbSchemaCommand: &dbSchemaCommand{
+			CommandDescription:  description,
+			dbConnectionFactory: dbConnectionFactory,
+		},
+	}, nil
+}
+
+func (c *DbSchemaDumpCommand) Run(ctx context.Context, parsedValues *values.Values) error {
+	s := &DbSchemaDumpSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	var dump *catalog.Schema
+	err := c.withCatalog(ctx, parsedValues, func(c *catalog.Catalog) error {
+		var err error
+		dump, err = c.Dump(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := dump.Marshal(s.Format)
+	if err != nil {
+		return err
+	}
+	if s.OutputFile != "" {
+		return os.WriteFile(s.OutputFile, data, 0o644)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+type DbSchemaDiffCommand struct {
+	*dbSchemaCommand
+}
+
+var _ cmds.GlazeCommand = (*DbSchemaDiffCommand)(nil)
+
+type DbSchemaDiffSettings struct {
+	FromProfile string `glazed:"from-profile"`
+	ToProfile   string `glazed:"to-profile"`
+	FromFile    string `glazed:"from-file"`
+	ToFile      string `glazed:"to-file"`
+	DDL         bool   `glazed:"ddl"`
+	Dialect     string `glazed:"dialect"`
+}
+
+func NewDbSchemaDiffCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*DbSchemaDiffCommand, error) {
+	command, err := newDbSchemaCommand(dbConnectionFactory, "schema-diff", []cmds.CommandDescriptionOption{
+		cmds.WithShort("Compare the schemas of two databases"),
+		cmds.WithLong(`Compare the schemas of two databases.
+
+Each side is given by a profile (--from-profile, --to-profile), by a file written
+by db schema-dump (--from-file, --to-file), or, when neither is set, by the
+connection flags of this command. For example, to compare staging to production:
+
+  sqleton db schema-diff --from-profile production --to-profile staging
+
+Each row is a change to apply to the first schema to get the second one. With
+--ddl, the changes are printed as a migration script for the first database
+instead.`),
+		cmds.WithFlags(
+			fields.New("from-profile", fields.TypeString,
+				fields.WithHelp("Profile of the database to compare from")),
+			fields.New("to-profile", fields.TypeString,
+				fields.WithHelp("Profile of the database to compare to")),
+			fields.New("from-file", fields.TypeString,
+				fields.WithHelp("Schema dump to compare from")),
+			fields.New("to-file", fields.TypeString,
+				fields.WithHelp("Schema dump to compare to")),
+			fields.New("ddl", fields.TypeBool,
+				fields.WithHelp("Print a migration script instead of rows"),
+				fields.WithDefault(false)),
+			fields.New("dialect", fields.TypeChoice,
+				fields.WithHelp("Dialect of the migration script (default: the dialect of the first schema)"),
+				fields.WithChoices(catalog.DialectSqlite, catalog.DialectMysql, catalog.DialectPostgres, catalog.DialectDuckdb)),
+		),
+	}, options)
+	if err != nil {
+		return nil, err
+	}
+	return &DbSchemaDiffCommand{command}, nil
+}
+
+func (c *DbSchemaDiffCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &DbSchemaDiffSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	if s.FromProfile == "" && s.FromFile == "" && s.ToProfile == "" && s.ToFile == "" {
+		return errors.New("nothing to compare, pass --from-profile or --from-file, and --to-profile or --to-file")
+	}
+
+	from, err := c.loadSchema(ctx, parsedValues, "from", s.FromProfile, s.FromFile)
+	if err != nil {
+		return err
+	}
+	to, err := c.loadSchema(ctx, parsedValues, "to", s.ToProfile, s.ToFile)
+	if err != nil {
+		return err
+	}
+
+	changes := catalog.DiffSchemas(from, to)
+
+	if s.DDL {
+		dialect := s.Dialect
+		if dialect == "" {
+			dialect = from.Dialect
+		}
+		script, err := catalog.MigrationDDL(dialect, changes)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprint(os.Stdout, script); err != nil {
+			return err
+		}
+		// the script is the output, don't let glazed print an empty table after it
+		return &cmds.ExitWithoutGlazeError{}
+	}
+
+	for _, change := range changes {
+		row := types.NewRow(
+			types.MRP("change", string(change.Kind)),
+			types.MRP("object", string(change.Object)),
+			types.MRP("table", change.Table),
+			types.MRP("name", change.Name),
+			types.MRP("from", change.From),
+			types.MRP("to", change.To),
+		)
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSchema returns one side of the comparison: the dump in file, the database of
+// profile, or the database of the connection flags.
+func (c *DbSchemaDiffCommand) loadSchema(
+	ctx context.Context,
+	parsedValues *values.Values,
+	side string,
+	profile string,
+	file string,
+) (*catalog.Schema, error) {
+	if profile != "" && file != "" {
+		return nil, errors.Errorf("--%s-profile and --%s-file can't be used together", side, side)
+	}
+	if file != "" {
+		return catalog.LoadSchema(file)
+	}
+
+	connectionValues := parsedValues
+	if profile != "" {
+		var err error
+		connectionValues, err = sqleton_cmds.CommandProfileValues(c.Schema, parsedValues, profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ret *catalog.Schema
+	err := c.withCatalog(ctx, connectionValues, func(c *catalog.Catalog) error {
+		var err error
+		ret, err = c.Dump(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read the %s schema", side)
+	}
+	return ret, nil
+}
@@ -0,0 +1,158 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/sqlfmt"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type FmtCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.BareCommand = (*FmtCommand)(nil)
+
+type FmtSettings struct {
+	Paths []string `glazed:"paths"`
+	Check bool     `glazed:"check"`
+	SQL   bool     `glazed:"sql"`
+}
+
+func NewFmtCommand() (*FmtCommand, error) {
+	return &FmtCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"fmt",
+			cmds.WithShort("Format the preamble, and optionally the query, of .sql commands"),
+			cmds.WithLong(`Format the preamble, and optionally the query, of .sql commands.
+
+Each .sql command of the given files and directories is rewritten with its
+preamble in canonical order and indentation. With --sql, the query is laid out as
+well: clauses on lines of their own, one column and one condition per line, and
+keywords in upper case. Template actions and the whitespace around them are kept,
+so that the query renders the same.
+
+The files that are rewritten are listed. With --check, the files are left alone,
+and the command fails if any of them is not formatted:
+
+  sqleton fmt --check cmd/sqleton/queries`),
+			cmds.WithFlags(
+				fields.New(
+					"check",
+					fields.TypeBool,
+					fields.WithHelp("List the files that are not formatted, and fail if there are any, instead of rewriting them"),
+					fields.WithDefault(false),
+				),
+				fields.New(
+					"sql",
+					fields.TypeBool,
+					fields.WithHelp("Lay out the query of the commands as well"),
+					fields.WithDefault(false),
+				),
+			),
+			cmds.WithArguments(
+				fields.New(
+					"paths",
+					fields.TypeStringList,
+					fields.WithHelp("The .sql files, and directories of .sql files, to format"),
+					fields.WithRequired(true),
+				),
+			),
+		),
+	}, nil
+}
+
+func (c *FmtCommand) Run(ctx context.Context, parsedValues *values.Values) error {
+	s := &FmtSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	paths, err := sqlCommandFiles(s.Paths)
+	if err != nil {
+		return err
+	}
+
+	failed, unformatted := 0, 0
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !sqleton_cmds.LooksLikeSqletonSQLCommand(contents) {
+			log.Debug().Str("path", path).Msg("Skipping .sql file without sqleton preamble")
+			continue
+		}
+
+		formatted, err := sqlfmt.FormatFile(path, contents, sqlfmt.Options{Query: s.SQL})
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed++
+			continue
+		}
+		if bytes.Equal(contents, formatted) {
+			continue
+		}
+
+		unformatted++
+		if !s.Check {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, formatted, info.Mode().Perm()); err != nil {
+				return errors.Wrapf(err, "could not write %s", path)
+			}
+		}
+		fmt.Println(path)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("could not format %d files", failed)
+	}
+	if s.Check && unformatted > 0 {
+		return errors.Errorf("%d files are not formatted, run sqleton fmt to format them", unformatted)
+	}
+	return nil
+}
+
+// sqlCommandFiles returns the given files, and the .sql files of the given
+// directories.
+func sqlCommandFiles(paths []string) ([]string, error) {
+	ret := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			ret = append(ret, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".sql") {
+				ret = append(ret, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,529 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/go-go-golems/sqleton/pkg/promote"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// maxHistoryQueryLength is the length above which ls and search cut the queries.
+const maxHistoryQueryLength = 80
+
+// NewHistoryCommand creates the history command group, reading the history stored
+// at historyPath. The repositories are used to run repository commands again from
+// their parameters, and queries are saved as commands to one of repositoryPaths.
+func NewHistoryCommand(
+	historyPath string,
+	dbConnectionFactory sql.DBConnectionFactory,
+	repositories_ []*repositories.Repository,
+	repositoryPaths []string,
+	queryObservers []sqleton_cmds.QueryObserver,
+	options ...cmds.CommandDescriptionOption,
+) (*cobra.Command, error) {
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "List, search and run again the queries run by sqleton",
+	}
+
+	listCommand, err := NewHistoryListCommand(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	searchCommand, err := NewHistorySearchCommand(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	showCommand, err := NewHistoryShowCommand(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	rerunCommand, err := NewHistoryRerunCommand(historyPath, dbConnectionFactory, repositories_, queryObservers, options...)
+	if err != nil {
+		return nil, err
+	}
+	saveCommand, err := NewHistorySaveCommand(historyPath, repositoryPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, command := range []cmds.Command{listCommand, searchCommand, showCommand, rerunCommand, saveCommand} {
+		cobraCommand, err := sqleton_cmds.BuildCobraCommandWithSqletonMiddlewares(command)
+		if err != nil {
+			return nil, err
+		}
+		historyCmd.AddCommand(cobraCommand)
+	}
+
+	return historyCmd, nil
+}
+
+type HistoryListCommand struct {
+	*cmds.CommandDescription
+	historyPath string
+}
+
+var _ cmds.GlazeCommand = (*HistoryListCommand)(nil)
+
+type HistoryListSettings struct {
+	Text    string `glazed:"text"`
+	Command string `glazed:"command"`
+	Limit   int    `glazed:"limit"`
+}
+
+func historyListFlags() []*fields.Definition {
+	return []*fields.Definition{
+		fields.New(
+			"command",
+			fields.TypeString,
+			fields.WithHelp("Only list the queries of this command, e.g. mysql/ps or query"),
+		),
+		fields.New(
+			"limit",
+			fields.TypeInteger,
+			fields.WithHelp("Maximum number of queries to list, 0 lists all of them"),
+			fields.WithDefault(20),
+		),
+	}
+}
+
+func NewHistoryListCommand(historyPath string) (*HistoryListCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	return &HistoryListCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"ls",
+			cmds.WithShort("List the latest queries, newest first"),
+			cmds.WithFlags(historyListFlags()...),
+			cmds.WithSections(glazedSection),
+		),
+		historyPath: historyPath,
+	}, nil
+}
+
+func (c *HistoryListCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &HistoryListSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	return listHistory(ctx, c.historyPath, history.ListOptions{Command: s.Command, Limit: s.Limit}, gp)
+}
+
+type HistorySearchCommand struct {
+	*cmds.CommandDescription
+	historyPath string
+}
+
+var _ cmds.GlazeCommand = (*HistorySearchCommand)(nil)
+
+func NewHistorySearchCommand(historyPath string) (*HistorySearchCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	return &HistorySearchCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"search",
+			cmds.WithShort("List the queries containing a text, newest first"),
+			cmds.WithLong(`List the queries containing a text, newest first.
+
+The text is looked up in the query, the command and the parameters of each
+entry, ignoring case.`),
+			cmds.WithArguments(
+				fields.New(
+					"text",
+					fields.TypeString,
+					fields.WithHelp("The text to look for"),
+					fields.WithRequired(true),
+				),
+			),
+			cmds.WithFlags(historyListFlags()...),
+			cmds.WithSections(glazedSection),
+		),
+		historyPath: historyPath,
+	}, nil
+}
+
+func (c *HistorySearchCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &HistoryListSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	return listHistory(ctx, c.historyPath, history.ListOptions{Command: s.Command, Search: s.Text, Limit: s.Limit}, gp)
+}
+
+func listHistory(ctx context.Context, historyPath string, options history.ListOptions, gp middlewares.Processor) error {
+	store, err := history.Open(historyPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	entries, err := store.List(ctx, options)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		row := types.NewRow(
+			types.MRP("id", entry.ID),
+			types.MRP("timestamp", entry.Timestamp.Local().Format(time.DateTime)),
+			types.MRP("command", entry.Command),
+			types.MRP("profile", entry.Profile),
+			types.MRP("rows", entry.Rows),
+			types.MRP("duration_ms", entry.DurationMs),
+			types.MRP("query", summarizeQuery(entry.Query)),
+			types.MRP("error", entry.Error),
+		)
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summarizeQuery puts query on a single line, cut to maxHistoryQueryLength.
+func summarizeQuery(query string) string {
+	runes := []rune(strings.Join(strings.Fields(query), " "))
+	if len(runes) > maxHistoryQueryLength {
+		return string(runes[:maxHistoryQueryLength-1]) + "…"
+	}
+	return string(runes)
+}
+
+type HistoryShowCommand struct {
+	*cmds.CommandDescription
+	historyPath string
+}
+
+var _ cmds.GlazeCommand = (*HistoryShowCommand)(nil)
+
+type HistoryEntrySettings struct {
+	ID int `glazed:"id"`
+}
+
+func historyEntryArgument() *fields.Definition {
+	return fields.New(
+		"id",
+		fields.TypeInteger,
+		fields.WithHelp("The id of the query, as listed by history ls"),
+		fields.WithRequired(true),
+	)
+}
+
+func NewHistoryShowCommand(historyPath string) (*HistoryShowCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	return &HistoryShowCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"show",
+			cmds.WithShort("Show a query of the history with its parameters"),
+			cmds.WithLong(`Show a query of the history with its parameters.
+
+The entry has long fields, and is easier to read with --output yaml.`),
+			cmds.WithArguments(historyEntryArgument()),
+			cmds.WithSections(glazedSection),
+		),
+		historyPath: historyPath,
+	}, nil
+}
+
+func (c *HistoryShowCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &HistoryEntrySettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	entry, err := getHistoryEntry(ctx, c.historyPath, s.ID)
+	if err != nil {
+		return err
+	}
+	return gp.AddRow(ctx, types.NewRow(
+		types.MRP("id", entry.ID),
+		types.MRP("timestamp", entry.Timestamp.Local()),
+		types.MRP("command", entry.Command),
+		types.MRP("profile", entry.Profile),
+		types.MRP("connection", entry.Connection),
+		types.MRP("parameters", entry.Parameters),
+		types.MRP("query", entry.Query),
+		types.MRP("rows", entry.Rows),
+		types.MRP("duration_ms", entry.DurationMs),
+		types.MRP("error", entry.Error),
+	))
+}
+
+func getHistoryEntry(ctx context.Context, historyPath string, id int) (*history.Entry, error) {
+	store, err := history.Open(historyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+	return store.Get(ctx, int64(id))
+}
+
+type HistoryRerunCommand struct {
+	*cmds.CommandDescription
+	historyPath         string
+	dbConnectionFactory sql.DBConnectionFactory
+	repositories        []*repositories.Repository
+	queryObservers      []sqleton_cmds.QueryObserver
+}
+
+var _ cmds.GlazeCommand = (*HistoryRerunCommand)(nil)
+
+func NewHistoryRerunCommand(
+	historyPath string,
+	dbConnectionFactory sql.DBConnectionFactory,
+	repositories_ []*repositories.Repository,
+	queryObservers []sqleton_cmds.QueryObserver,
+	options ...cmds.CommandDescriptionOption,
+) (*HistoryRerunCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+	sqlAttachSection, err := flags.NewSqlAttachParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Run a query of the history again"),
+		cmds.WithLong(`Run a query of the history again.
+
+Repository commands are run again with the parameters they were given, so that
+their query is rendered anew. Other queries, such as those of sqleton query or
+sqleton shell, are run as they were recorded.
+
+The query runs on the profile it was recorded with. Pass --profile to run it on
+another profile.`),
+		cmds.WithArguments(historyEntryArgument()),
+		cmds.WithSections(glazedSection, sqlAttachSection),
+	}, options...)
+
+	return &HistoryRerunCommand{
+		CommandDescription:  cmds.NewCommandDescription("rerun", options_...),
+		historyPath:         historyPath,
+		dbConnectionFactory: dbConnectionFactory,
+		repositories:        repositories_,
+		queryObservers:      queryObservers,
+	}, nil
+}
+
+func (c *HistoryRerunCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &HistoryEntrySettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	entry, err := getHistoryEntry(ctx, c.historyPath, s.ID)
+	if err != nil {
+		return err
+	}
+
+	connectionValues, profile, err := c.connectionValues(parsedValues, entry)
+	if err != nil {
+		return err
+	}
+
+	if command, ok := sqleton_cmds.FindRepositoryCommand(c.repositories, entry.Command); ok {
+		return c.rerunCommand(ctx, command, connectionValues, entry, gp)
+	}
+	return c.rerunQuery(ctx, connectionValues, profile, entry, gp)
+}
+
+// connectionValues returns the values to connect with, and the profile they come
+// from: those of the profile of the entry, unless --profile was given.
+func (c *HistoryRerunCommand) connectionValues(
+	parsedValues *values.Values,
+	entry *history.Entry,
+) (*values.Values, string, error) {
+	profileSettings := &cli.ProfileSettings{}
+	if _, ok := parsedValues.Get(cli.ProfileSettingsSlug); ok {
+		if err := parsedValues.DecodeSectionInto(cli.ProfileSettingsSlug, profileSettings); err != nil {
+			return nil, "", err
+		}
+	}
+	if profileSettings.Profile != "" || entry.Profile == "" {
+		return parsedValues, profileSettings.Profile, nil
+	}
+
+	connectionValues, err := sqleton_cmds.CommandProfileValues(c.Schema, parsedValues, entry.Profile)
+	if err != nil {
+		return nil, "", err
+	}
+	return connectionValues, entry.Profile, nil
+}
+
+// rerunCommand runs the repository command of the entry with the parameters it was
+// given.
+func (c *HistoryRerunCommand) rerunCommand(
+	ctx context.Context,
+	command cmds.Command,
+	connectionValues *values.Values,
+	entry *history.Entry,
+	gp middlewares.Processor,
+) error {
+	glazeCommand, ok := command.(cmds.GlazeCommand)
+	if !ok {
+		return errors.Errorf("command %s does not produce rows", entry.Command)
+	}
+	for name, value := range entry.Parameters {
+		if value == sqleton_cmds.RedactedValue {
+			return errors.Errorf("the %s parameter of history entry %d was not recorded, run %s with it again",
+				name, entry.ID, strings.ReplaceAll(entry.Command, "/", " "))
+		}
+	}
+
+	commandValues, err := sqleton_cmds.RepositoryCommandValues(command, entry.Parameters, connectionValues)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the parameters of history entry %d", entry.ID)
+	}
+	return glazeCommand.RunIntoGlazeProcessor(ctx, commandValues, gp)
+}
+
+// rerunQuery runs the recorded query of the entry, and records it under the same
+// command.
+func (c *HistoryRerunCommand) rerunQuery(
+	ctx context.Context,
+	connectionValues *values.Values,
+	profile string,
+	entry *history.Entry,
+	gp middlewares.Processor,
+) error {
+	if entry.Query == "" {
+		return errors.Errorf("history entry %d has no query to run", entry.ID)
+	}
+
+	db, err := c.dbConnectionFactory(ctx, connectionValues)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	execution := sqleton_cmds.NewQueryExecution(entry.Command, connectionValues)
+	execution.Profile = profile
+	execution.Parameters = entry.Parameters
+	execution.Query = entry.Query
+	counter := sqleton_cmds.NewRowCountingProcessor(gp)
+
+	err = sql.RunQueryIntoGlaze(ctx, db, entry.Query, nil, counter)
+	execution.Finish(db, counter.Rows(), err)
+	observers := append(append([]sqleton_cmds.QueryObserver{}, c.queryObservers...), sqleton_cmds.QueryObserversFromContext(ctx)...)
+	sqleton_cmds.NotifyQueryObservers(ctx, observers, execution)
+	return err
+}
+
+type HistorySaveCommand struct {
+	*cmds.CommandDescription
+	historyPath     string
+	repositoryPaths []string
+}
+
+var _ cmds.BareCommand = (*HistorySaveCommand)(nil)
+
+func NewHistorySaveCommand(historyPath string, repositoryPaths []string) (*HistorySaveCommand, error) {
+	sqlSaveAsSection, err := flags.NewSqlSaveAsParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+
+	return &HistorySaveCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"save",
+			cmds.WithShort("Save a query of the history as a command of a repository"),
+			cmds.WithLong(`Save a query of the history as a command of a repository.
+
+The recorded query, as it was rendered, is saved as the command given by --save-as,
+with the description given by --short. --parameterize turns the literals compared
+to columns into flags defaulting to them:
+
+  sqleton history save 12 --save-as mysql/open-orders --short "List open orders" --parameterize`),
+			cmds.WithArguments(historyEntryArgument()),
+			cmds.WithSections(sqlSaveAsSection),
+		),
+		historyPath:     historyPath,
+		repositoryPaths: repositoryPaths,
+	}, nil
+}
+
+func (c *HistorySaveCommand) Run(ctx context.Context, parsedValues *values.Values) error {
+	s := &HistoryEntrySettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	saveAs := &flags.SqlSaveAsSettings{}
+	if err := parsedValues.DecodeSectionInto(flags.SqlSaveAsSlug, saveAs); err != nil {
+		return err
+	}
+	if saveAs.SaveAs == "" {
+		return errors.New("pass the name of the command to save, e.g. --save-as mysql/new-report")
+	}
+
+	entry, err := getHistoryEntry(ctx, c.historyPath, s.ID)
+	if err != nil {
+		return err
+	}
+	if entry.Query == "" {
+		return errors.Errorf("history entry %d has no query to save", entry.ID)
+	}
+
+	path, err := promote.Save(c.repositoryPaths, entry.Query, saveAs)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Saved %s to %s\n", saveAs.SaveAs, path)
+	return nil
+}
@@ -0,0 +1,177 @@
+package cmds
+
+import (
+	"context"
+	"encoding/json"
+
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	"github.com/go-go-golems/sqleton/pkg/copier"
+	"github.com/go-go-golems/sqleton/pkg/loader"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type LoadCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory sql2.DBConnectionFactory
+}
+
+var _ cmds.GlazeCommand = (*LoadCommand)(nil)
+
+type LoadSettings struct {
+	Files        []string `glazed:"files"`
+	Table        string   `glazed:"table"`
+	Format       string   `glazed:"format"`
+	Create       bool     `glazed:"create"`
+	InferRows    int      `glazed:"infer-rows"`
+	BatchSize    int      `glazed:"batch-size"`
+	MaxRejected  int      `glazed:"max-rejected"`
+	ShowRejected bool     `glazed:"show-rejected"`
+}
+
+func NewLoadCommand(
+	dbConnectionFactory sql2.DBConnectionFactory,
+	options ...cmds.CommandDescriptionOption,
+) (*LoadCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Load CSV, JSON or Parquet files into a table"),
+		cmds.WithLong(`Load CSV, JSON or Parquet files into a table.
+
+The format is detected from the file extension (.csv, .tsv, .json, .jsonl,
+.ndjson, .parquet), or given by --format. CSV files start with a header line,
+JSON files hold an array of objects or one object per line.
+
+With --create, a missing table is created with column types inferred from the
+first --infer-rows records. Rows are written with COPY on postgres, and with
+multi-row INSERT statements on the other databases, in batches of --batch-size.
+
+Records that can't be loaded are rejected and counted, and the load goes on: lines
+with the wrong number of fields, values that don't match the type of their column,
+and rows the database refuses (constraint violations, ...). Pass --show-rejected to
+list them with their line and the reason instead of the summary:
+
+  sqleton load --table events --create events.csv --show-rejected`),
+		cmds.WithFlags(
+			fields.New("table", fields.TypeString,
+				fields.WithHelp("Table to load the files into"),
+				fields.WithRequired(true)),
+			fields.New("format", fields.TypeChoice,
+				fields.WithHelp("Format of the files (default: from the file extension)"),
+				fields.WithChoices(loader.FormatCSV, loader.FormatTSV, loader.FormatJSON, loader.FormatParquet)),
+			fields.New("create", fields.TypeBool,
+				fields.WithHelp("Create the table if it doesn't exist"),
+				fields.WithDefault(false)),
+			fields.New("infer-rows", fields.TypeInteger,
+				fields.WithHelp("Number of records read to infer the column types of a created table"),
+				fields.WithDefault(loader.DefaultInferRows)),
+			fields.New("batch-size", fields.TypeInteger,
+				fields.WithHelp("Number of rows inserted per transaction"),
+				fields.WithDefault(copier.DefaultBatchSize)),
+			fields.New("max-rejected", fields.TypeInteger,
+				fields.WithHelp("Stop once more records were rejected (0: no limit)"),
+				fields.WithDefault(0)),
+			fields.New("show-rejected", fields.TypeBool,
+				fields.WithHelp("List the rejected records instead of the summary"),
+				fields.WithDefault(false)),
+		),
+		cmds.WithArguments(
+			fields.New("files", fields.TypeStringList,
+				fields.WithHelp("Files to load"),
+				fields.WithRequired(true)),
+		),
+		cmds.WithSections(glazedSection),
+	}, options...)
+
+	return &LoadCommand{
+		CommandDescription:  cmds.NewCommandDescription("load", options_...),
+		dbConnectionFactory: dbConnectionFactory,
+	}, nil
+}
+
+func (c *LoadCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &LoadSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	db, err := c.dbConnectionFactory(ctx, parsedValues)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	for _, file := range s.Files {
+		onReject := func(rejection loader.Rejection) error {
+			if !s.ShowRejected {
+				return nil
+			}
+			record := ""
+			if rejection.Row != nil {
+				data, err := json.Marshal(rejection.Row)
+				if err != nil {
+					return err
+				}
+				record = string(data)
+			}
+			return gp.AddRow(ctx, types.NewRow(
+				types.MRP("file", file),
+				types.MRP("position", rejection.Position),
+				types.MRP("reason", rejection.Reason),
+				types.MRP("record", record),
+			))
+		}
+
+		result, err := loader.Load(ctx, db, file, loader.Options{
+			Format:      s.Format,
+			Table:       s.Table,
+			CreateTable: s.Create,
+			InferRows:   s.InferRows,
+			BatchSize:   s.BatchSize,
+			MaxRejected: s.MaxRejected,
+		}, onReject)
+		var notFound *catalog.TableNotFoundError
+		if errors.As(err, &notFound) {
+			return errors.Errorf("table %s not found, pass --create to create it", s.Table)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "could not load %s", file)
+		}
+
+		if s.ShowRejected {
+			continue
+		}
+		err = gp.AddRow(ctx, types.NewRow(
+			types.MRP("file", file),
+			types.MRP("table", s.Table),
+			types.MRP("rows", result.Rows),
+			types.MRP("rejected", result.Rejected),
+			types.MRP("created", result.Created),
+		))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
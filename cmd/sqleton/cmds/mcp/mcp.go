@@ -9,30 +9,46 @@ import (
 	"os"
 
 	"github.com/go-go-golems/clay/pkg/repositories"
-	"github.com/go-go-golems/clay/pkg/repositories/mcp"
 	"github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cli"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	"github.com/go-go-golems/glazed/pkg/cmds/fields"
-	"github.com/go-go-golems/glazed/pkg/cmds/runner"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/settings"
 	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/audit"
 	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
 	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/mcpserver"
 	"github.com/spf13/cobra"
 )
 
 type McpCommands struct {
-	repositories []*repositories.Repository
+	repositories   []*repositories.Repository
+	version        string
+	queryObservers []sqleton_cmds.QueryObserver
+	// toolsConfig is the app.mcp.tools config, selecting the commands exposed as tools
+	toolsConfig *mcpserver.ToolsConfig
+	// serveOptions are applied to the serve command, to add the connection sections
+	serveOptions []cmds.CommandDescriptionOption
 }
 
-func NewMcpCommands(repositories []*repositories.Repository) *McpCommands {
+func NewMcpCommands(
+	repositories []*repositories.Repository,
+	version string,
+	queryObservers []sqleton_cmds.QueryObserver,
+	toolsConfig *mcpserver.ToolsConfig,
+	serveOptions ...cmds.CommandDescriptionOption,
+) *McpCommands {
 	return &McpCommands{
-		repositories: repositories,
+		repositories:   repositories,
+		version:        version,
+		queryObservers: queryObservers,
+		toolsConfig:    toolsConfig,
+		serveOptions:   serveOptions,
 	}
 }
 
@@ -44,9 +60,13 @@ var McpCmd = &cobra.Command{
 type ListToolsCommand struct {
 	*cmds.CommandDescription
 	repositories []*repositories.Repository
+	toolsConfig  *mcpserver.ToolsConfig
 }
 
-func NewListToolsCommand(repositories []*repositories.Repository) (*ListToolsCommand, error) {
+func NewListToolsCommand(
+	repositories []*repositories.Repository,
+	toolsConfig *mcpserver.ToolsConfig,
+) (*ListToolsCommand, error) {
 	glazedSection, err := settings.NewGlazedSection()
 	if err != nil {
 		return nil, err
@@ -57,16 +77,19 @@ func NewListToolsCommand(repositories []*repositories.Repository) (*ListToolsCom
 			"list",
 			cmds.WithShort("List all available tools"),
 			cmds.WithFlags(
-				fields.New(
-					"repository",
-					fields.TypeString,
-					fields.WithHelp("Filter tools by repository name"),
-					fields.WithDefault(""),
-				),
+				append([]*fields.Definition{
+					fields.New(
+						"repository",
+						fields.TypeString,
+						fields.WithHelp("Filter tools by repository name"),
+						fields.WithDefault(""),
+					),
+				}, toolFilterFlags()...)...,
 			),
 			cmds.WithSections(glazedSection),
 		),
 		repositories: repositories,
+		toolsConfig:  toolsConfig,
 	}, nil
 }
 
@@ -82,18 +105,30 @@ func (c *ListToolsCommand) RunIntoGlazeProcessor(
 		return err
 	}
 
-	allTools := []mcp.Tool{}
+	repositories_ := []*repositories.Repository{}
 	for _, repo := range c.repositories {
-		tools, _, err := repo.ListTools(ctx, s.Repository)
-		if err != nil {
-			return fmt.Errorf("error listing tools from repository: %w", err)
+		if s.Repository == "" || repo.Name == s.Repository {
+			repositories_ = append(repositories_, repo)
 		}
-		allTools = append(allTools, tools...)
 	}
+	tools, err := collectTools(repositories_, c.toolsConfig, parsedValues)
+	if err != nil {
+		return err
+	}
+
+	for _, tool := range tools {
+		description := tool.Command.Description()
+		inputSchema, err := description.ToJsonSchema()
+		if err != nil {
+			return fmt.Errorf("error creating input schema for %s: %w", description.FullPath(), err)
+		}
+		rawInputSchema, err := json.Marshal(inputSchema)
+		if err != nil {
+			return fmt.Errorf("error encoding input schema: %w", err)
+		}
 
-	for _, tool := range allTools {
 		var prettySchema bytes.Buffer
-		err := json.Indent(&prettySchema, tool.InputSchema, "", "  ")
+		err = json.Indent(&prettySchema, rawInputSchema, "", "  ")
 		if err != nil {
 			return fmt.Errorf("error formatting input schema: %w", err)
 		}
@@ -107,14 +142,16 @@ func (c *ListToolsCommand) RunIntoGlazeProcessor(
 			}
 		}
 		if outputValue == "json" {
-			inputSchema_ = tool.InputSchema
+			inputSchema_ = json.RawMessage(rawInputSchema)
 		} else {
 			inputSchema_ = prettySchema.String()
 		}
 
 		row := map[string]interface{}{
 			"name":        tool.Name,
+			"command":     mcpserver.CommandPath(description),
 			"description": tool.Description,
+			"tags":        description.Tags,
 			"inputSchema": inputSchema_,
 		}
 		row_ := types.NewRowFromMap(row)
@@ -163,7 +200,7 @@ func (mc *McpCommands) CreateToolsCmd() *cobra.Command {
 		Short: "Tool related commands",
 	}
 
-	listCmd, err := NewListToolsCommand(mc.repositories)
+	listCmd, err := NewListToolsCommand(mc.repositories, mc.toolsConfig)
 	if err != nil {
 		panic(err)
 	}
@@ -204,7 +241,7 @@ func (mc *McpCommands) CreateToolsCmd() *cobra.Command {
 	runCmd := mc.CreateRunCmd()
 	toolsCmd.AddCommand(runCmd)
 
-	schemaCmd, err := NewSchemaCommand(mc.repositories)
+	schemaCmd, err := NewSchemaCommand(mc.repositories, mc.toolsConfig)
 	if err != nil {
 		panic(err)
 	}
@@ -239,41 +276,62 @@ type RunCommandSettings struct {
 	Name         string                 `glazed:"name"`
 	Args         string                 `glazed:"args"`
 	ArgsFromFile map[string]interface{} `glazed:"args-from-file"`
+	MaxRows      int                    `glazed:"max-rows"`
 }
 
 type RunCommand struct {
 	*cmds.CommandDescription
 	repositories []*repositories.Repository
+	toolsConfig  *mcpserver.ToolsConfig
 }
 
-func NewRunCommand(repositories []*repositories.Repository) (*RunCommand, error) {
+func NewRunCommand(
+	repositories []*repositories.Repository,
+	toolsConfig *mcpserver.ToolsConfig,
+) (*RunCommand, error) {
 	return &RunCommand{
 		CommandDescription: cmds.NewCommandDescription(
 			"run",
 			cmds.WithShort("Run a tool by name"),
+			cmds.WithLong(`Run a tool by name, the way mcp serve runs it for a client.
+
+The result is printed as a JSON envelope with columns, rows, row_count,
+truncated and rendered_query. When the call fails, the envelope carries an
+error object whose kind is one of invalid_arguments, not_found, query_render,
+connection, database, canceled, timeout or internal, and the command exits
+with an error.`),
 			cmds.WithArguments(
 				fields.New(
 					"name",
 					fields.TypeString,
-					fields.WithHelp("Name of the tool to run"),
+					fields.WithHelp("Name of the tool to run, or path of its command"),
 					fields.WithRequired(true),
 				),
 			),
 			cmds.WithFlags(
-				fields.New(
-					"args",
-					fields.TypeString,
-					fields.WithHelp("Arguments as JSON string"),
-					fields.WithDefault("{}"),
-				),
-				fields.New(
-					"args-from-file",
-					fields.TypeObjectFromFile,
-					fields.WithHelp("Load arguments from JSON/YAML file"),
-				),
+				append([]*fields.Definition{
+					fields.New(
+						"args",
+						fields.TypeString,
+						fields.WithHelp("Arguments as JSON string"),
+						fields.WithDefault("{}"),
+					),
+					fields.New(
+						"args-from-file",
+						fields.TypeObjectFromFile,
+						fields.WithHelp("Load arguments from JSON/YAML file"),
+					),
+					fields.New(
+						"max-rows",
+						fields.TypeInteger,
+						fields.WithHelp("Maximum number of rows returned, 0 for no limit"),
+						fields.WithDefault(0),
+					),
+				}, toolFilterFlags()...)...,
 			),
 		),
 		repositories: repositories,
+		toolsConfig:  toolsConfig,
 	}, nil
 }
 
@@ -284,65 +342,77 @@ func (c *RunCommand) Run(ctx context.Context, parsedValues *values.Values) error
 		return err
 	}
 
-	// Find tool in repositories
-	var foundCmd cmds.Command
-	for _, repo := range c.repositories {
-		cmd, ok := repo.GetCommand(s.Name)
-		if ok {
-			foundCmd = cmd
-			break
-		}
+	result, err := c.run(ctx, parsedValues, s)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(result); err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
 	}
-	if foundCmd == nil {
-		return fmt.Errorf("command %s not found", s.Name)
+	if result.Error != nil {
+		return fmt.Errorf("tool %s failed (%s): %s", s.Name, result.Error.Kind, result.Error.Message)
+	}
+	return nil
+}
+
+// run runs the tool and returns its result envelope. Only errors that are not about the
+// tool call itself, like an invalid tools config, are returned as errors.
+func (c *RunCommand) run(
+	ctx context.Context,
+	parsedValues *values.Values,
+	s *RunCommandSettings,
+) (*mcpserver.Result, error) {
+	// Find tool among the ones mcp serve exposes
+	tools, err := collectTools(c.repositories, c.toolsConfig, parsedValues)
+	if err != nil {
+		return nil, err
+	}
+	tool, ok := mcpserver.FindTool(tools, s.Name)
+	if !ok {
+		return mcpserver.ErrorResult(ctx, &mcpserver.ToolError{
+			Kind:    mcpserver.ErrorNotFound,
+			Message: fmt.Sprintf("tool %s not found", s.Name),
+		}), nil
+	}
+	command, ok := tool.Command.(cmds.GlazeCommand)
+	if !ok {
+		return mcpserver.ErrorResult(ctx, fmt.Errorf("tool %s doesn't return rows", s.Name)), nil
 	}
 
 	// Parse args string into map
-	var argsMap map[string]interface{}
+	argsMap := map[string]interface{}{}
 	if err := json.Unmarshal([]byte(s.Args), &argsMap); err != nil {
-		return fmt.Errorf("failed to parse args JSON: %w", err)
+		return mcpserver.ErrorResult(ctx, mcpserver.NewToolError(mcpserver.ErrorInvalidArguments,
+			fmt.Errorf("failed to parse args JSON: %w", err))), nil
+	}
+	if argsMap == nil {
+		argsMap = map[string]interface{}{}
 	}
 
 	// Merge with args from file if provided
-	if s.ArgsFromFile != nil {
-		for k, v := range s.ArgsFromFile {
-			argsMap[k] = v
-		}
+	for k, v := range s.ArgsFromFile {
+		argsMap[k] = v
 	}
 
 	sqletonMiddlewares, err := sqleton_cmds.GetSqletonAdditionalMiddlewares(parsedValues)
 	if err != nil {
-		return fmt.Errorf("failed to get sqleton additional middlewares: %w", err)
+		return nil, fmt.Errorf("failed to get sqleton additional middlewares: %w", err)
 	}
 
-	// Parse parameters using runner
-	parsedToolValues, err := runner.ParseCommandValues(
-		foundCmd,
-		runner.WithValuesForSections(map[string]map[string]interface{}{
-			schema.DefaultSlug: argsMap,
-		}),
-		runner.WithAdditionalMiddlewares(sqletonMiddlewares...),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to parse tool parameters: %w", err)
-	}
-
-	// Run the command using the runner
-	err = runner.RunCommand(
-		ctx,
-		foundCmd,
-		parsedToolValues,
-		runner.WithWriter(os.Stdout), // For WriterCommand
-	)
-	if err != nil {
-		return fmt.Errorf("failed to run tool: %w", err)
+	ctx = audit.WithCaller(ctx, audit.OriginMCP, audit.CurrentUser())
+	runner_ := &mcpserver.ToolRunner{
+		Middlewares: sqletonMiddlewares,
+		MaxRows:     s.MaxRows,
 	}
-
-	return nil
+	return runner_.Run(ctx, command, argsMap), nil
 }
 
 func (mc *McpCommands) CreateRunCmd() *cobra.Command {
-	runCmd, err := NewRunCommand(mc.repositories)
+	runCmd, err := NewRunCommand(mc.repositories, mc.toolsConfig)
 	if err != nil {
 		panic(err)
 	}
@@ -374,9 +444,13 @@ func (mc *McpCommands) CreateRunCmd() *cobra.Command {
 type SchemaCommand struct {
 	*cmds.CommandDescription
 	repositories []*repositories.Repository
+	toolsConfig  *mcpserver.ToolsConfig
 }
 
-func NewSchemaCommand(repositories []*repositories.Repository) (*SchemaCommand, error) {
+func NewSchemaCommand(
+	repositories []*repositories.Repository,
+	toolsConfig *mcpserver.ToolsConfig,
+) (*SchemaCommand, error) {
 	return &SchemaCommand{
 		CommandDescription: cmds.NewCommandDescription(
 			"schema",
@@ -385,11 +459,13 @@ func NewSchemaCommand(repositories []*repositories.Repository) (*SchemaCommand,
 				fields.New(
 					"name",
 					fields.TypeString,
-					fields.WithHelp("Name of the tool to get schema for"),
+					fields.WithHelp("Name of the tool to get schema for, or path of its command"),
 				),
 			),
+			cmds.WithFlags(toolFilterFlags()...),
 		),
 		repositories: repositories,
+		toolsConfig:  toolsConfig,
 	}, nil
 }
 
@@ -405,18 +481,16 @@ func (c *SchemaCommand) RunIntoWriter(
 		return err
 	}
 
-	// Find tool in repositories
-	var foundCmd cmds.Command
-	for _, repo := range c.repositories {
-		cmd, ok := repo.GetCommand(s.Name)
-		if ok {
-			foundCmd = cmd
-			break
-		}
+	// Find tool among the ones mcp serve exposes
+	tools, err := collectTools(c.repositories, c.toolsConfig, parsedValues)
+	if err != nil {
+		return err
 	}
-	if foundCmd == nil {
-		return fmt.Errorf("command %s not found", s.Name)
+	tool, ok := mcpserver.FindTool(tools, s.Name)
+	if !ok {
+		return fmt.Errorf("tool %s not found", s.Name)
 	}
+	foundCmd := tool.Command
 
 	// Get JSON schema from command description
 	schema, err := foundCmd.Description().ToJsonSchema()
@@ -434,8 +508,37 @@ func (c *SchemaCommand) RunIntoWriter(
 	return nil
 }
 
+func (mc *McpCommands) CreateServeCmd() *cobra.Command {
+	serveCmd, err := NewServeCommand(mc.repositories, mc.version, mc.queryObservers, mc.toolsConfig, mc.serveOptions...)
+	if err != nil {
+		panic(err)
+	}
+
+	cobraCmd, err := cli.BuildCobraCommandFromCommand(serveCmd,
+		cli.WithCobraMiddlewaresFunc(func(
+			parsedValues *values.Values,
+			cmd *cobra.Command,
+			args []string,
+		) ([]sources.Middleware, error) {
+			return createCommandMiddlewares(parsedValues, cmd, args, nil)
+		}),
+		cli.WithCobraShortHelpSections(
+			schema.DefaultSlug,
+			sql.DbtSlug,
+			sql.SqlConnectionSlug,
+		),
+		cli.WithProfileSettingsSection(),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return cobraCmd
+}
+
 func (mc *McpCommands) AddToRootCommand(rootCmd *cobra.Command) {
 	toolsCmd := mc.CreateToolsCmd()
 	McpCmd.AddCommand(toolsCmd)
+	McpCmd.AddCommand(mc.CreateServeCmd())
 	rootCmd.AddCommand(McpCmd)
 }
@@ -0,0 +1,183 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/mcpserver"
+	"github.com/pkg/errors"
+)
+
+// ServeCommandSettings holds the parameters for the serve command
+type ServeCommandSettings struct {
+	Transport          string `glazed:"transport"`
+	Address            string `glazed:"address"`
+	Path               string `glazed:"path"`
+	MaxRows            int    `glazed:"max-rows"`
+	SchemaResources    bool   `glazed:"schema-resources"`
+	ReadOnlySQL        bool   `glazed:"readonly-sql"`
+	ReadOnlySQLMaxRows int    `glazed:"readonly-sql-max-rows"`
+	ReadOnlySQLTimeout string `glazed:"readonly-sql-timeout"`
+}
+
+type ServeCommand struct {
+	*cmds.CommandDescription
+	repositories   []*repositories.Repository
+	version        string
+	queryObservers []sqleton_cmds.QueryObserver
+	toolsConfig    *mcpserver.ToolsConfig
+}
+
+var _ cmds.BareCommand = (*ServeCommand)(nil)
+
+func NewServeCommand(
+	repositories []*repositories.Repository,
+	version string,
+	queryObservers []sqleton_cmds.QueryObserver,
+	toolsConfig *mcpserver.ToolsConfig,
+	options ...cmds.CommandDescriptionOption,
+) (*ServeCommand, error) {
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Serve the repository commands as MCP tools"),
+		cmds.WithLong(`Serve the repository commands as MCP tools, over stdio or streamable HTTP.
+
+Every command producing rows is exposed as a tool named after its path, with
+slashes replaced by underscores (mysql/ps becomes mysql_ps). The tool input
+schema is derived from the command flags and arguments, and the result is
+returned as structured content: the columns, the rows (at most --max-rows),
+the row count, whether rows were dropped, and the rendered query. Failed calls
+carry a typed error instead. The connection settings passed to this command
+are used for every tool call.
+
+The exposed commands can be narrowed down by tags, repository directories and an
+allowlist, and renamed or described for the client, in app.mcp.tools, in the file
+passed to --tools-config, or with the filter flags. Run mcp tools list with the
+same flags to see the result.
+
+The tables of the database are published as the schema://tables and
+schema://table/<name> resources. With --readonly-sql, the execute_readonly_sql
+tool lets the client run its own read-only queries.`),
+		cmds.WithFlags(append([]*fields.Definition{
+			fields.New(
+				"transport",
+				fields.TypeChoice,
+				fields.WithHelp("Transport to serve MCP over"),
+				fields.WithChoices("stdio", "http"),
+				fields.WithDefault("stdio"),
+			),
+			fields.New(
+				"address",
+				fields.TypeString,
+				fields.WithHelp("Address to listen on with the http transport"),
+				fields.WithDefault("localhost:8091"),
+			),
+			fields.New(
+				"path",
+				fields.TypeString,
+				fields.WithHelp("Path of the MCP endpoint with the http transport"),
+				fields.WithDefault("/mcp"),
+			),
+			fields.New(
+				"max-rows",
+				fields.TypeInteger,
+				fields.WithHelp("Maximum number of rows returned by a tool call, 0 for no limit"),
+				fields.WithDefault(1000),
+			),
+			fields.New(
+				"schema-resources",
+				fields.TypeBool,
+				fields.WithHelp("Publish the tables and columns of the database as schema:// resources"),
+				fields.WithDefault(true),
+			),
+			fields.New(
+				"readonly-sql",
+				fields.TypeBool,
+				fields.WithHelp("Add the execute_readonly_sql tool, running arbitrary read-only queries"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"readonly-sql-max-rows",
+				fields.TypeInteger,
+				fields.WithHelp("Maximum number of rows returned by execute_readonly_sql"),
+				fields.WithDefault(1000),
+			),
+			fields.New(
+				"readonly-sql-timeout",
+				fields.TypeString,
+				fields.WithHelp("Timeout for queries run by execute_readonly_sql"),
+				fields.WithDefault("30s"),
+			),
+		}, toolFilterFlags()...)...),
+	}, options...)
+
+	return &ServeCommand{
+		CommandDescription: cmds.NewCommandDescription("serve", options_...),
+		repositories:       repositories,
+		version:            version,
+		queryObservers:     queryObservers,
+		toolsConfig:        toolsConfig,
+	}, nil
+}
+
+func (c *ServeCommand) Run(ctx context.Context, parsedValues *values.Values) error {
+	s := &ServeCommandSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	valuesForSections := map[string]map[string]interface{}{}
+	for _, slug := range []string{sql.SqlConnectionSlug, sql.DbtSlug} {
+		if sectionValues, ok := parsedValues.Get(slug); ok {
+			valuesForSections[slug] = sectionValues.Fields.ToMap()
+		}
+	}
+
+	toolsConfig, err := toolsConfigFromValues(c.toolsConfig, parsedValues)
+	if err != nil {
+		return err
+	}
+
+	options := []mcpserver.Option{
+		mcpserver.WithValuesForSections(valuesForSections),
+		mcpserver.WithToolsConfig(toolsConfig),
+		mcpserver.WithMaxRows(s.MaxRows),
+		mcpserver.WithVersion(c.version),
+		mcpserver.WithQueryObservers(c.queryObservers...),
+	}
+	options = append(options, mcpserver.WithDatabase(sql.OpenDatabaseFromDefaultSqlConnectionLayer, parsedValues))
+	if s.SchemaResources {
+		options = append(options, mcpserver.WithSchemaResources())
+	}
+	if s.ReadOnlySQL {
+		timeout, err := time.ParseDuration(s.ReadOnlySQLTimeout)
+		if err != nil {
+			return errors.Wrap(err, "invalid --readonly-sql-timeout")
+		}
+		options = append(options, mcpserver.WithReadOnlySQL(mcpserver.ReadOnlySQLOptions{
+			MaxRows: s.ReadOnlySQLMaxRows,
+			Timeout: timeout,
+		}))
+	}
+
+	server, err := mcpserver.NewServer(c.repositories, options...)
+	if err != nil {
+		return err
+	}
+
+	switch s.Transport {
+	case "stdio":
+		return server.ServeStdio(ctx)
+	case "http":
+		return server.ServeHTTP(ctx, s.Address, s.Path)
+	default:
+		return fmt.Errorf("unknown transport %s", s.Transport)
+	}
+}
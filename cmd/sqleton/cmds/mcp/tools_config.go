@@ -0,0 +1,96 @@
+package mcp
+
+import (
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/sqleton/pkg/mcpserver"
+)
+
+// ToolFilterSettings holds the flags selecting the commands exposed as MCP tools.
+type ToolFilterSettings struct {
+	ToolsConfig        string   `glazed:"tools-config"`
+	Tags               []string `glazed:"tags"`
+	ExcludeTags        []string `glazed:"exclude-tags"`
+	Directories        []string `glazed:"directories"`
+	ExcludeDirectories []string `glazed:"exclude-directories"`
+	Allow              []string `glazed:"allow"`
+}
+
+func toolFilterFlags() []*fields.Definition {
+	return []*fields.Definition{
+		fields.New(
+			"tools-config",
+			fields.TypeString,
+			fields.WithHelp("YAML file selecting, renaming and describing tools, overriding app.mcp.tools"),
+		),
+		fields.New(
+			"tags",
+			fields.TypeStringList,
+			fields.WithHelp("Only expose commands having one of these tags"),
+		),
+		fields.New(
+			"exclude-tags",
+			fields.TypeStringList,
+			fields.WithHelp("Don't expose commands having any of these tags"),
+		),
+		fields.New(
+			"directories",
+			fields.TypeStringList,
+			fields.WithHelp("Only expose commands below one of these repository directories"),
+		),
+		fields.New(
+			"exclude-directories",
+			fields.TypeStringList,
+			fields.WithHelp("Don't expose commands below any of these repository directories"),
+		),
+		fields.New(
+			"allow",
+			fields.TypeStringList,
+			fields.WithHelp("Only expose these tools, by tool name or command path"),
+		),
+	}
+}
+
+// toolsConfigFromValues returns base, usually read from app.mcp.tools, overridden by
+// the --tools-config file and then by the filter flags.
+func toolsConfigFromValues(
+	base *mcpserver.ToolsConfig,
+	parsedValues *values.Values,
+) (*mcpserver.ToolsConfig, error) {
+	s := &ToolFilterSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return nil, err
+	}
+
+	ret := base
+	if s.ToolsConfig != "" {
+		fileConfig, err := mcpserver.LoadToolsConfig(s.ToolsConfig)
+		if err != nil {
+			return nil, err
+		}
+		ret = ret.Merge(fileConfig)
+	}
+	ret = ret.Merge(&mcpserver.ToolsConfig{
+		Tags:               s.Tags,
+		ExcludeTags:        s.ExcludeTags,
+		Directories:        s.Directories,
+		ExcludeDirectories: s.ExcludeDirectories,
+		Allow:              s.Allow,
+	})
+	return ret, ret.Validate()
+}
+
+// collectTools returns the tools selected by base and the filter flags.
+func collectTools(
+	repositories_ []*repositories.Repository,
+	base *mcpserver.ToolsConfig,
+	parsedValues *values.Values,
+) ([]*mcpserver.Tool, error) {
+	config, err := toolsConfigFromValues(base, parsedValues)
+	if err != nil {
+		return nil, err
+	}
+	return mcpserver.CollectTools(repositories_, config)
+}
@@ -0,0 +1,199 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/migrate"
+	"github.com/pkg/errors"
+)
+
+type MigrateCommandsCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*MigrateCommandsCommand)(nil)
+
+type MigrateCommandsSettings struct {
+	Paths  []string `glazed:"paths"`
+	DryRun bool     `glazed:"dry-run"`
+	Force  bool     `glazed:"force"`
+	Remove bool     `glazed:"remove"`
+}
+
+func NewMigrateCommandsCommand() (*MigrateCommandsCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	return &MigrateCommandsCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"migrate-commands",
+			cmds.WithShort("Convert YAML commands to .sql commands"),
+			cmds.WithLong(`Convert YAML commands to .sql commands.
+
+Each YAML command of the given files and directories is written to a .sql file
+next to it, with its metadata in a /* sqleton ... */ preamble. Subqueries that
+the query inserts with {{ subQuery "name" }} become CTEs.
+
+A row is listed for each YAML file: converted, skipped when it is not a
+command, or failed, with the reason, when it can't be converted without
+changing what it does. Existing .sql files are only overwritten with --force.
+
+  sqleton migrate-commands --dry-run ~/.sqleton/queries`),
+			cmds.WithFlags(
+				fields.New(
+					"dry-run",
+					fields.TypeBool,
+					fields.WithHelp("List what would be converted without writing any file"),
+					fields.WithDefault(false),
+				),
+				fields.New(
+					"force",
+					fields.TypeBool,
+					fields.WithHelp("Overwrite existing .sql files"),
+					fields.WithDefault(false),
+				),
+				fields.New(
+					"remove",
+					fields.TypeBool,
+					fields.WithHelp("Remove the YAML files that were converted"),
+					fields.WithDefault(false),
+				),
+			),
+			cmds.WithArguments(
+				fields.New(
+					"paths",
+					fields.TypeStringList,
+					fields.WithHelp("The YAML files, and directories of YAML files, to convert"),
+					fields.WithRequired(true),
+				),
+			),
+			cmds.WithSections(glazedSection),
+		),
+	}, nil
+}
+
+func (c *MigrateCommandsCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &MigrateCommandsSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	paths, err := yamlCommandFiles(s.Paths)
+	if err != nil {
+		return err
+	}
+
+	converted, failed := 0, 0
+	for _, path := range paths {
+		status, output, notes := migrateCommandFile(path, s)
+		switch status {
+		case "converted", "would convert":
+			converted++
+		case "failed":
+			failed++
+		}
+
+		row := types.NewRow(
+			types.MRP("path", path),
+			types.MRP("status", status),
+			types.MRP("output", output),
+			types.MRP("notes", strings.Join(notes, "; ")),
+		)
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	if s.DryRun {
+		_, _ = fmt.Fprintf(os.Stderr, "%d commands would be converted, %d could not be converted\n", converted, failed)
+	} else {
+		_, _ = fmt.Fprintf(os.Stderr, "%d commands converted, %d could not be converted\n", converted, failed)
+	}
+	return nil
+}
+
+// migrateCommandFile converts the YAML command at path, and returns its status,
+// the path of the .sql file, and notes about the conversion, or why it failed.
+func migrateCommandFile(path string, s *MigrateCommandsSettings) (string, string, []string) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "failed", "", []string{err.Error()}
+	}
+	conversion, err := migrate.ConvertYAML(path, contents)
+	if errors.Is(err, migrate.ErrNotACommand) {
+		return "skipped", "", []string{err.Error()}
+	}
+	if err != nil {
+		return "failed", "", []string{err.Error()}
+	}
+
+	output := migrate.SQLPath(path)
+	if _, err := os.Stat(output); err == nil && !s.Force {
+		return "failed", output, []string{output + " exists, pass --force to overwrite it"}
+	}
+	if s.DryRun {
+		return "would convert", output, conversion.Notes
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "failed", output, []string{err.Error()}
+	}
+	if err := os.WriteFile(output, conversion.SQL, info.Mode().Perm()); err != nil {
+		return "failed", output, []string{errors.Wrapf(err, "could not write %s", output).Error()}
+	}
+	if s.Remove {
+		if err := os.Remove(path); err != nil {
+			return "failed", output, []string{errors.Wrapf(err, "could not remove %s", path).Error()}
+		}
+	}
+	return "converted", output, conversion.Notes
+}
+
+// yamlCommandFiles returns the given files, and the .yaml and .yml files of the
+// given directories.
+func yamlCommandFiles(paths []string) ([]string, error) {
+	ret := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			ret = append(ret, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := strings.ToLower(filepath.Ext(path))
+			if !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				ret = append(ret, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
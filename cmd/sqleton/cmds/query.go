@@ -2,6 +2,8 @@ package cmds
 
 import (
 	"context"
+	"fmt"
+	"os"
 
 	"github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
@@ -10,26 +12,56 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/settings"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/promote"
 	"github.com/jmoiron/sqlx"
 )
 
 type QueryCommand struct {
 	dbConnectionFactory sql.DBConnectionFactory
+	repositoryPaths     []string
+	queryObservers      []sqleton_cmds.QueryObserver
 	*cmds.CommandDescription
 }
 
 var _ cmds.GlazeCommand = (*QueryCommand)(nil)
 
+// NewQueryCommand creates the query command, which saves the queries it runs with
+// --save-as to one of the repositories at repositoryPaths.
 func NewQueryCommand(
 	dbConnectionFactory sql.DBConnectionFactory,
+	repositoryPaths []string,
+	queryObservers []sqleton_cmds.QueryObserver,
 	options ...cmds.CommandDescriptionOption,
 ) (*QueryCommand, error) {
 	glazedSection, err := settings.NewGlazedSection()
 	if err != nil {
 		return nil, err
 	}
+	sqlAttachSection, err := flags.NewSqlAttachParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+	sqlSaveAsSection, err := flags.NewSqlSaveAsParameterLayer()
+	if err != nil {
+		return nil, err
+	}
 	options_ := append([]cmds.CommandDescriptionOption{
 		cmds.WithShort("Run a SQL query passed as a CLI argument"),
+		cmds.WithLong(`Run a SQL query passed as a CLI argument.
+
+With --attach, the query runs against local files instead of the connection: each
+CSV, TSV, JSON, JSON-lines or Parquet file is loaded into a table of an in-memory sqlite
+database, named after the file or given after a colon:
+
+  sqleton query --attach data.csv:orders "SELECT status, COUNT(*) FROM orders GROUP BY 1"
+
+Once the query runs, --save-as saves it as a command of a repository, with the
+description given by --short. --parameterize turns the literals compared to
+columns into flags defaulting to them:
+
+  sqleton query --save-as mysql/open-orders --short "Open orders" --parameterize "SELECT * FROM orders WHERE status = 'open'"`),
 		cmds.WithArguments(fields.New(
 			"query",
 			fields.TypeString,
@@ -37,11 +69,13 @@ func NewQueryCommand(
 			fields.WithRequired(true),
 		),
 		),
-		cmds.WithSections(glazedSection),
+		cmds.WithSections(glazedSection, sqlAttachSection, sqlSaveAsSection),
 	}, options...)
 
 	return &QueryCommand{
 		dbConnectionFactory: dbConnectionFactory,
+		repositoryPaths:     repositoryPaths,
+		queryObservers:      queryObservers,
 		CommandDescription:  cmds.NewCommandDescription("query", options_...),
 	}, nil
 }
@@ -59,8 +93,21 @@ func (q *QueryCommand) RunIntoGlazeProcessor(
 	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
 		return err
 	}
+	saveAs := &flags.SqlSaveAsSettings{}
+	if err := parsedValues.DecodeSectionInto(flags.SqlSaveAsSlug, saveAs); err != nil {
+		return err
+	}
+	if saveAs.SaveAs != "" {
+		// fail before running the query if the command can't be saved
+		if _, err := promote.NewSpec(s.Query, saveAs); err != nil {
+			return err
+		}
+		if _, err := promote.ChooseRepository(q.repositoryPaths, saveAs.SaveTo); err != nil {
+			return err
+		}
+	}
 
-	db, err := q.dbConnectionFactory(ctx, parsedValues)
+	db, connection, err := sqleton_cmds.OpenDatabase(ctx, q.dbConnectionFactory, parsedValues)
 	if err != nil {
 		return err
 	}
@@ -73,10 +120,25 @@ func (q *QueryCommand) RunIntoGlazeProcessor(
 		return err
 	}
 
-	err = sql.RunNamedQueryIntoGlaze(ctx, db, s.Query, map[string]interface{}{}, gp)
+	execution := sqleton_cmds.NewQueryExecution(q.FullPath(), parsedValues)
+	execution.Query = s.Query
+	execution.Connection = connection
+	counter := sqleton_cmds.NewRowCountingProcessor(gp)
+
+	err = sql.RunNamedQueryIntoGlaze(ctx, db, s.Query, map[string]interface{}{}, counter)
+	execution.Finish(db, counter.Rows(), err)
+	sqleton_cmds.NotifyQueryObservers(ctx, q.queryObservers, execution)
 	if err != nil {
 		return err
 	}
 
+	if saveAs.SaveAs != "" {
+		path, err := promote.Save(q.repositoryPaths, s.Query, saveAs)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Saved %s to %s\n", saveAs.SaveAs, path)
+	}
+
 	return nil
 }
@@ -12,7 +12,10 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/settings"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
 	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/go-go-golems/sqleton/pkg/watch"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 
@@ -22,6 +25,7 @@ import (
 type RunCommand struct {
 	*cmds.CommandDescription
 	dbConnectionFactory sql.DBConnectionFactory
+	queryObservers      []sqleton_cmds.QueryObserver
 }
 
 var _ cmds.GlazeCommand = (*RunCommand)(nil)
@@ -45,7 +49,7 @@ func (c *RunCommand) RunIntoGlazeProcessor(
 		return errors.Wrap(err, "could not initialize sql-helpers settings")
 	}
 
-	db, err := c.dbConnectionFactory(ctx, parsedValues)
+	db, connection, err := sqleton_cmds.OpenDatabase(ctx, c.dbConnectionFactory, parsedValues)
 	if err != nil {
 		return errors.Wrap(err, "could not open database")
 	}
@@ -58,6 +62,8 @@ func (c *RunCommand) RunIntoGlazeProcessor(
 		return errors.Wrapf(err, "Could not ping database")
 	}
 
+	// read all the queries upfront, since stdin can only be read once in watch mode
+	queries := []string{}
 	for _, arg := range s.InputFiles {
 		query := ""
 
@@ -76,11 +82,57 @@ func (c *RunCommand) RunIntoGlazeProcessor(
 		if ss.Explain {
 			query = "EXPLAIN " + query
 		}
+		queries = append(queries, query)
+	}
 
-		// TODO(2022-12-20, manuel): collect named parameters here, maybe through prerun?
-		// See: https://github.com/wesen/sqleton/issues/40
-		err = sql.RunNamedQueryIntoGlaze(ctx, db, query, map[string]interface{}{}, gp)
-		cobra.CheckErr(err)
+	runQueries := func(ctx context.Context, gp middlewares.Processor) error {
+		for i, query := range queries {
+			execution := sqleton_cmds.NewQueryExecution(c.FullPath(), parsedValues)
+			execution.Query = query
+			execution.Connection = connection
+			execution.Parameters["input-file"] = s.InputFiles[i]
+			counter := sqleton_cmds.NewRowCountingProcessor(gp)
+
+			// TODO(2022-12-20, manuel): collect named parameters here, maybe through prerun?
+			// See: https://github.com/wesen/sqleton/issues/40
+			err := sql.RunNamedQueryIntoGlaze(ctx, db, query, map[string]interface{}{}, counter)
+			execution.Finish(db, counter.Rows(), err)
+			sqleton_cmds.NotifyQueryObservers(ctx, c.queryObservers, execution)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	watchOptions, err := watch.OptionsFromSqlHelpers(ss)
+	if err != nil {
+		return err
+	}
+	if watchOptions != nil {
+		if err := watch.Run(ctx, c.FullPath(), parsedValues, *watchOptions, runQueries, os.Stdout); err != nil {
+			return err
+		}
+		return &cmds.ExitWithoutGlazeError{}
+	}
+
+	// all input files end up in a single snapshot
+	var recorder *snapshots.Recorder
+	if ss.Snapshot != "" {
+		if err := snapshots.CheckName(ss.Snapshot); err != nil {
+			return err
+		}
+		recorder = snapshots.NewRecorder(gp)
+		gp = recorder
+	}
+
+	cobra.CheckErr(runQueries(ctx, gp))
+
+	if recorder != nil {
+		parameters := map[string]interface{}{"input-files": s.InputFiles}
+		if _, err := recorder.Save(ss.Snapshot, c.FullPath(), parameters); err != nil {
+			return errors.Wrap(err, "could not save snapshot")
+		}
 	}
 
 	return nil
@@ -88,6 +140,7 @@ func (c *RunCommand) RunIntoGlazeProcessor(
 
 func NewRunCommand(
 	dbConnectionFactory sql.DBConnectionFactory,
+	queryObservers []sqleton_cmds.QueryObserver,
 	options ...cmds.CommandDescriptionOption,
 ) (*RunCommand, error) {
 	glazedSection, err := settings.NewGlazedSection()
@@ -98,6 +151,10 @@ func NewRunCommand(
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create SQL helpers section")
 	}
+	sqlAttachSection, err := flags.NewSqlAttachParameterLayer()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create SQL attach section")
+	}
 
 	options_ := append([]cmds.CommandDescriptionOption{
 		cmds.WithShort("Run a SQL query from sql files"),
@@ -111,11 +168,13 @@ func NewRunCommand(
 		cmds.WithSections(
 			glazedSection,
 			sqlHelpersSection,
+			sqlAttachSection,
 		),
 	}, options...)
 
 	return &RunCommand{
 		dbConnectionFactory: dbConnectionFactory,
+		queryObservers:      queryObservers,
 		CommandDescription: cmds.NewCommandDescription(
 			"run",
 			options_...,
@@ -4,18 +4,18 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	"strings"
+	"os"
 
 	sql2 "github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
-	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
 	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/settings"
 	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
 	"github.com/go-go-golems/sqleton/pkg/flags"
-	"github.com/huandu/go-sqlbuilder"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/go-go-golems/sqleton/pkg/watch"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
@@ -36,6 +36,7 @@ func NewSelectSection() (*schema.SectionImpl, error) {
 type SelectCommand struct {
 	*cmds.CommandDescription
 	dbConnectionFactory sql2.DBConnectionFactory
+	queryObservers      []cmds2.QueryObserver
 }
 
 type SelectCommandSettings struct {
@@ -44,10 +45,21 @@ type SelectCommandSettings struct {
 	Offset      int      `glazed:"offset"`
 	Count       bool     `glazed:"count"`
 	Where       []string `glazed:"where"`
+	FilterBy    []string `glazed:"filter-by"`
 	OrderBy     string   `glazed:"order-by"`
 	Distinct    bool     `glazed:"distinct"`
 	Table       string   `glazed:"table"`
 	CreateQuery string   `glazed:"create-query"`
+	Join        []string `glazed:"join"`
+	LeftJoin    []string `glazed:"left-join"`
+	GroupBy     []string `glazed:"group-by"`
+	Having      []string `glazed:"having"`
+	Sum         []string `glazed:"sum"`
+	Avg         []string `glazed:"avg"`
+	CountBy     []string `glazed:"count-by"`
+	PaginateBy  string   `glazed:"paginate-by"`
+	Cursor      string   `glazed:"cursor"`
+	Pages       int      `glazed:"pages"`
 }
 
 var _ cmds.GlazeCommand = (*SelectCommand)(nil)
@@ -67,106 +79,34 @@ func (sc *SelectCommand) RunIntoGlazeProcessor(
 		return errors.Wrap(err, "could not initialize sql-helpers settings")
 	}
 
-	sb := sqlbuilder.NewSelectBuilder()
-	sb = sb.From(s.Table)
-
-	if s.Count {
-		countColumns := strings.Join(s.Columns, ", ")
-		if s.Distinct {
-			countColumns = "DISTINCT " + countColumns
-		}
-		s.Columns = []string{sb.As(fmt.Sprintf("COUNT(%s)", countColumns), "count")}
-	} else {
-		if len(s.Columns) == 0 {
-			s.Columns = []string{"*"}
-		}
-	}
-	sb = sb.Select(s.Columns...)
-	if s.Distinct && !s.Count {
-		sb = sb.Distinct()
-	}
-
-	for _, where := range s.Where {
-		sb = sb.Where(where)
-	}
-
-	if s.Limit > 0 && !s.Count {
-		sb = sb.Limit(s.Limit)
-	}
-	if s.Offset > 0 {
-		sb = sb.Offset(s.Offset)
+	flavor, err := connectionFlavor(parsedValues)
+	if err != nil {
+		return err
 	}
-	if s.OrderBy != "" {
-		sb = sb.OrderBy(s.OrderBy)
+	selectQuery, err := newSelectQuery(s, flavor)
+	if err != nil {
+		return err
 	}
 
-	if s.CreateQuery != "" {
-		short := fmt.Sprintf("Select"+" columns from %s", s.Table)
-		if s.Count {
-			short = fmt.Sprintf("Count all rows from %s", s.Table)
-		}
-		if len(s.Where) > 0 {
-			short = fmt.Sprintf("Select"+" from %s where %s", s.Table, strings.Join(s.Where, " AND "))
-		}
-
-		queryFlags := []*fields.Definition{}
-		if len(s.Where) == 0 {
-			queryFlags = append(queryFlags, fields.New("where", fields.TypeStringList))
-		}
-		if !s.Count {
-			queryFlags = append(queryFlags, fields.New(
-				"limit",
-				fields.TypeInteger,
-				fields.WithHelp(fmt.Sprintf("Limit the number of rows (default: %d), set to 0 to disable", s.Limit)),
-				fields.WithDefault(s.Limit),
-			))
-			queryFlags = append(queryFlags, fields.New(
-				"offset",
-				fields.TypeInteger,
-				fields.WithHelp(fmt.Sprintf("Offset the number of rows (default: %d)", s.Offset)),
-				fields.WithDefault(s.Offset),
-			))
-			queryFlags = append(queryFlags, fields.New(
-				"distinct",
-				fields.TypeBool,
-				fields.WithHelp(fmt.Sprintf("Whether to select distinct rows (default: %t)", s.Distinct)),
-				fields.WithDefault(s.Distinct),
-			))
-
-			orderByHelp := "Order by"
-			orderByOptions := []fields.Option{
-				fields.WithHelp(orderByHelp),
-			}
-			if s.OrderBy != "" {
-				orderByHelp = fmt.Sprintf("Order by (default: %s)", s.OrderBy)
-				orderByOptions = append(orderByOptions, fields.WithHelp(orderByHelp), fields.WithDefault(s.OrderBy))
-			}
-			queryFlags = append(queryFlags, fields.New("order_by", fields.TypeString, orderByOptions...))
-		}
-
-		sb := &strings.Builder{}
-		_, _ = fmt.Fprintf(sb, "SELECT ")
-		if !s.Count {
-			_, _ = fmt.Fprintf(sb, "{{ if .distinct }}DISTINCT{{ end }} ")
+	// the columns of the filters are checked against the database, even when
+	// only printing the query
+	var db *sqlx.DB
+	connection := ""
+	if len(selectQuery.Filters) > 0 {
+		db, connection, err = sc.openDatabase(ctx, parsedValues)
+		if err != nil {
+			return err
 		}
-		_, _ = fmt.Fprintf(sb, "%s FROM %s", strings.Join(s.Columns, ", "), s.Table)
-		if len(s.Where) > 0 {
-			_, _ = fmt.Fprintf(sb, " WHERE %s", strings.Join(s.Where, " AND "))
-		} else {
-			_, _ = fmt.Fprintf(sb, "\nWHERE 1=1\n{{ range .where  }}  AND {{.}} {{ end }}")
+		defer func(db *sqlx.DB) {
+			_ = db.Close()
+		}(db)
+		if err := selectQuery.resolveFilters(ctx, db); err != nil {
+			return err
 		}
+	}
 
-		_, _ = fmt.Fprintf(sb, "\n{{ if .order_by }} ORDER BY {{ .order_by }}{{ end }}")
-		_, _ = fmt.Fprintf(sb, "\n{{ if .limit }} LIMIT {{ .limit }}{{ end }}")
-		_, _ = fmt.Fprintf(sb, "\nOFFSET {{ .offset }}")
-
-		query := sb.String()
-		sqlFile, err := cmds2.MarshalSpecToSQLFile(&cmds2.SqlCommandSpec{
-			Name:  s.CreateQuery,
-			Short: short,
-			Flags: queryFlags,
-			Query: query,
-		})
+	if s.CreateQuery != "" {
+		sqlFile, err := selectQuery.SqlFile(s.CreateQuery, s)
 		if err != nil {
 			return err
 		}
@@ -175,7 +115,21 @@ func (sc *SelectCommand) RunIntoGlazeProcessor(
 		return nil
 	}
 
-	query, queryArgs := sb.Build()
+	// with --paginate-by, the query of the first page is printed and audited
+	query, queryArgs, err := selectQuery.Build(s)
+	if err != nil {
+		return err
+	}
+	if selectQuery.PaginateBy != "" {
+		pager, err := newSelectPager(selectQuery, s)
+		if err != nil {
+			return err
+		}
+		query, queryArgs, _, err = pager.Next()
+		if err != nil {
+			return err
+		}
+	}
 
 	if ss.PrintQuery {
 		fmt.Println(query)
@@ -186,28 +140,130 @@ func (sc *SelectCommand) RunIntoGlazeProcessor(
 		return nil
 	}
 
-	db, err := sc.dbConnectionFactory(ctx, parsedValues)
-	if err != nil {
-		return err
+	if db == nil {
+		db, connection, err = sc.openDatabase(ctx, parsedValues)
+		if err != nil {
+			return err
+		}
+		defer func(db *sqlx.DB) {
+			_ = db.Close()
+		}(db)
 	}
-	defer func(db *sqlx.DB) {
-		_ = db.Close()
-	}(db)
 
-	err = db.PingContext(ctx)
+	observers := append(append([]cmds2.QueryObserver{}, sc.queryObservers...), cmds2.QueryObserversFromContext(ctx)...)
+	runStatement := func(
+		ctx context.Context,
+		gp middlewares.Processor,
+		query string,
+		queryArgs []interface{},
+		pager *selectPager,
+	) (*cmds2.QueryExecution, error) {
+		execution := cmds2.NewQueryExecution(sc.FullPath(), parsedValues)
+		execution.Query = query
+		execution.Connection = connection
+		execution.Parameters["table"] = s.Table
+		if len(queryArgs) > 0 {
+			execution.Parameters["args"] = queryArgs
+		}
+		if pager != nil {
+			gp = pager.Processor(gp)
+		}
+		counter := cmds2.NewRowCountingProcessor(gp)
+
+		err := sql2.RunQueryIntoGlaze(ctx, db, query, queryArgs, counter)
+		execution.Finish(db, counter.Rows(), err)
+		if err == nil && pager != nil {
+			err = pager.Finish(execution)
+			execution.Err = err
+		}
+		cmds2.NotifyQueryObservers(ctx, observers, execution)
+		return execution, err
+	}
+
+	// runQuery runs the query, or all its pages with --paginate-by, and returns
+	// the execution of the last page
+	runQuery := func(ctx context.Context, gp middlewares.Processor) (*cmds2.QueryExecution, error) {
+		if selectQuery.PaginateBy == "" {
+			return runStatement(ctx, gp, query, queryArgs, nil)
+		}
+		pager, err := newSelectPager(selectQuery, s)
+		if err != nil {
+			return nil, err
+		}
+		var execution *cmds2.QueryExecution
+		for {
+			query, queryArgs, ok, err := pager.Next()
+			if err != nil {
+				return execution, err
+			}
+			if !ok {
+				return execution, nil
+			}
+			execution, err = runStatement(ctx, gp, query, queryArgs, pager)
+			if err != nil {
+				return execution, err
+			}
+		}
+	}
+
+	watchOptions, err := watch.OptionsFromSqlHelpers(ss)
 	if err != nil {
 		return err
 	}
+	if watchOptions != nil {
+		err = watch.Run(ctx, sc.FullPath(), parsedValues, *watchOptions,
+			func(ctx context.Context, gp middlewares.Processor) error {
+				_, err := runQuery(ctx, gp)
+				return err
+			}, os.Stdout)
+		if err != nil {
+			return err
+		}
+		return &cmds.ExitWithoutGlazeError{}
+	}
+
+	var recorder *snapshots.Recorder
+	if ss.Snapshot != "" {
+		if err := snapshots.CheckName(ss.Snapshot); err != nil {
+			return err
+		}
+		recorder = snapshots.NewRecorder(gp)
+		gp = recorder
+	}
 
-	err = sql2.RunQueryIntoGlaze(ctx, db, query, queryArgs, gp)
+	execution, err := runQuery(ctx, gp)
 	if err != nil {
 		return err
 	}
+	if execution.NextCursor != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "More rows: pass --cursor %s for the next page\n", execution.NextCursor)
+	}
+
+	if recorder != nil {
+		if _, err := recorder.Save(ss.Snapshot, sc.FullPath(), execution.Parameters); err != nil {
+			return errors.Wrap(err, "could not save snapshot")
+		}
+	}
 	return nil
 }
 
+// openDatabase opens and pings the database of the command, and returns its
+// description for the query observers.
+func (sc *SelectCommand) openDatabase(ctx context.Context, parsedValues *values.Values) (*sqlx.DB, string, error) {
+	db, connection, err := cmds2.OpenDatabase(ctx, sc.dbConnectionFactory, parsedValues)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, "", err
+	}
+	return db, connection, nil
+}
+
 func NewSelectCommand(
 	dbConnectionFactory sql2.DBConnectionFactory,
+	queryObservers []cmds2.QueryObserver,
 	options ...cmds.CommandDescriptionOption,
 ) (*SelectCommand, error) {
 	glazedSection, err := settings.NewGlazedSection()
@@ -218,6 +274,10 @@ func NewSelectCommand(
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create SQL helpers section")
 	}
+	sqlAttachSection, err := flags.NewSqlAttachParameterLayer()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create SQL attach section")
+	}
 	selectSection, err := NewSelectSection()
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create select section")
@@ -229,11 +289,13 @@ func NewSelectCommand(
 			selectSection,
 			glazedSection,
 			sqlHelpersSection,
+			sqlAttachSection,
 		),
 	}, options...)
 
 	return &SelectCommand{
 		dbConnectionFactory: dbConnectionFactory,
+		queryObservers:      queryObservers,
 		CommandDescription: cmds.NewCommandDescription(
 			"select",
 			options_...,
@@ -0,0 +1,182 @@
+package cmds
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// flavorForDriver returns the go-sqlbuilder flavor of a database driver or type,
+// as given to --db-type or --driver. duckdb uses the PostgreSQL flavor, whose
+// placeholders and quotes it understands. Unknown drivers get the default flavor.
+func flavorForDriver(driver string) sqlbuilder.Flavor {
+	switch strings.ToLower(driver) {
+	case "mysql", "mariadb":
+		return sqlbuilder.MySQL
+	case "pgx", "postgres", "postgresql", "pg", "duckdb", "duck":
+		return sqlbuilder.PostgreSQL
+	case "sqlite", "sqlite3":
+		return sqlbuilder.SQLite
+	case "sqlserver", "mssql":
+		return sqlbuilder.SQLServer
+	case "clickhouse":
+		return sqlbuilder.ClickHouse
+	default:
+		return sqlbuilder.DefaultFlavor
+	}
+}
+
+// connectionFlavor returns the flavor of the database the command connects to,
+// without connecting to it.
+func connectionFlavor(parsedValues *values.Values) (sqlbuilder.Flavor, error) {
+	files, err := cmds2.AttachedFilesFromValues(parsedValues)
+	if err != nil {
+		return 0, err
+	}
+	if len(files) > 0 {
+		return sqlbuilder.SQLite, nil
+	}
+	if _, ok := parsedValues.Get(sql2.SqlConnectionSlug); !ok {
+		return sqlbuilder.DefaultFlavor, nil
+	}
+
+	config, err := sql2.NewConfigFromRawParsedLayers(parsedValues)
+	if err != nil {
+		return 0, err
+	}
+	if config.DSN != "" {
+		if config.Driver != "" {
+			return flavorForDriver(config.Driver), nil
+		}
+		scheme, _, _ := strings.Cut(config.DSN, "://")
+		return flavorForDriver(scheme), nil
+	}
+	source, err := config.GetSource()
+	if err != nil {
+		return 0, err
+	}
+	return flavorForDriver(source.Type), nil
+}
+
+var (
+	identifierPartRegexp  = regexp.MustCompile("^[^\\s.()'\"`\\[\\],;*+/<>=!~:|%^&-]+$")
+	plainIdentifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// reservedWords are the keywords that can't be used as bare names in at least one
+// of the supported databases.
+var reservedWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`all and any as asc between by case check column
+		constraint create cross current_date current_time current_timestamp current_user
+		default delete desc distinct drop else end except exists false fetch for foreign
+		from full grant group having in index inner insert intersect into is join key left
+		like limit natural not null offset on or order outer primary range references right
+		rows select set table then to true union unique update user using values when where
+		window with`) {
+		reservedWords[word] = true
+	}
+}
+
+// quoteIdentifier quotes the parts of a possibly qualified name (orders.total)
+// that can't be written bare, which are reserved words and names that are not
+// plain identifiers. Other names keep their case folding. Expressions, such as
+// COUNT(*), are returned as is.
+func quoteIdentifier(flavor sqlbuilder.Flavor, name string) string {
+	parts := strings.Split(name, ".")
+	for _, part := range parts {
+		if !identifierPartRegexp.MatchString(part) {
+			return name
+		}
+	}
+	for i, part := range parts {
+		if !plainIdentifierRegexp.MatchString(part) || reservedWords[strings.ToLower(part)] {
+			parts[i] = flavor.Quote(part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func quoteIdentifiers(flavor sqlbuilder.Flavor, names []string) []string {
+	ret := make([]string, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, quoteIdentifier(flavor, name))
+	}
+	return ret
+}
+
+// quoteTable quotes the table name of "table", "table alias" or "table AS alias".
+func quoteTable(flavor sqlbuilder.Flavor, table string) string {
+	t := parseSelectTable(table)
+	if t.Alias == "" {
+		return quoteIdentifier(flavor, t.Name)
+	}
+	return quoteIdentifier(flavor, t.Name) + " " + quoteIdentifier(flavor, t.Alias)
+}
+
+// sqlLiteral writes a value as a literal of the flavor. Quotes in strings are
+// doubled, which all supported databases accept; MySQL and ClickHouse also treat
+// backslashes as escapes.
+func sqlLiteral(flavor sqlbuilder.Flavor, value interface{}) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if flavor == sqlbuilder.SQLServer {
+			if v {
+				return "1"
+			}
+			return "0"
+		}
+		return strings.ToUpper(strconv.FormatBool(v))
+	default:
+		s := fmt.Sprint(v)
+		if flavor == sqlbuilder.MySQL || flavor == sqlbuilder.ClickHouse {
+			s = strings.ReplaceAll(s, `\`, `\\`)
+		}
+		s = "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		if flavor == sqlbuilder.SQLServer {
+			s = "N" + s
+		}
+		return s
+	}
+}
+
+// maxLimit is the limit of queries that only have an offset, since MySQL, SQLite
+// and ClickHouse only accept OFFSET after a LIMIT.
+const maxLimit = "9223372036854775807"
+
+// limitOffsetTemplate returns the LIMIT and OFFSET clauses of the query generated
+// by --create-query, in the syntax of the flavor.
+func limitOffsetTemplate(flavor sqlbuilder.Flavor) string {
+	switch flavor {
+	case sqlbuilder.PostgreSQL:
+		return "\n{{ if .limit }}LIMIT {{ .limit }}{{ end }}" +
+			"\n{{ if .offset }}OFFSET {{ .offset }}{{ end }}"
+	case sqlbuilder.SQLServer:
+		// OFFSET ... FETCH needs an ORDER BY
+		return "\n{{ if or .limit .offset }}{{ if not .order_by }}ORDER BY 1 {{ end }}" +
+			"OFFSET {{ .offset }} ROWS{{ if .limit }} FETCH NEXT {{ .limit }} ROWS ONLY{{ end }}{{ end }}"
+	default:
+		return "\n{{ if .limit }}LIMIT {{ .limit }}{{ if .offset }} OFFSET {{ .offset }}{{ end }}" +
+			"{{ else if .offset }}LIMIT " + maxLimit + " OFFSET {{ .offset }}{{ end }}"
+	}
+}
+
+// pageLimitTemplate returns the LIMIT clause of the pages of a --paginate-by query
+// generated by --create-query, in the syntax of the flavor.
+func pageLimitTemplate(flavor sqlbuilder.Flavor) string {
+	if flavor == sqlbuilder.SQLServer {
+		return "\n{{ if .limit }}OFFSET 0 ROWS FETCH NEXT {{ .limit }} ROWS ONLY{{ end }}"
+	}
+	return "\n{{ if .limit }}LIMIT {{ .limit }}{{ end }}"
+}
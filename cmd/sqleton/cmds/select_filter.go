@@ -0,0 +1,152 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	"github.com/go-go-golems/sqleton/pkg/filter"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// selectFilter is a --filter-by, with its values converted to the type of its column
+// once the columns of the tables are known.
+type selectFilter struct {
+	*filter.Filter
+	Args []interface{}
+}
+
+// selectTable is the table or a joined table of a select, with its alias.
+type selectTable struct {
+	Name  string
+	Alias string
+}
+
+// parseSelectTable parses "orders", "orders o" and "orders AS o".
+func parseSelectTable(s string) selectTable {
+	fields := strings.Fields(s)
+	switch {
+	case len(fields) == 2:
+		return selectTable{Name: fields[0], Alias: fields[1]}
+	case len(fields) == 3 && strings.EqualFold(fields[1], "as"):
+		return selectTable{Name: fields[0], Alias: fields[2]}
+	default:
+		return selectTable{Name: strings.TrimSpace(s)}
+	}
+}
+
+func (t selectTable) matches(qualifier string) bool {
+	if t.Alias != "" {
+		return t.Alias == qualifier
+	}
+	return t.Name == qualifier
+}
+
+// resolveFilters checks that the columns of the filters are columns of the table
+// or of the joined tables, and converts their values to the type of the columns.
+func (q *selectQuery) resolveFilters(ctx context.Context, db *sqlx.DB) error {
+	if len(q.Filters) == 0 {
+		return nil
+	}
+	c, err := catalog.New(db)
+	if err != nil {
+		return errors.Wrap(err, "could not check the columns of --filter-by")
+	}
+
+	tables := []selectTable{parseSelectTable(q.Table)}
+	for _, join := range q.Joins {
+		tables = append(tables, parseSelectTable(join.Table))
+	}
+	columns := make([]map[string]catalog.Column, len(tables))
+	for i, table := range tables {
+		_, tableColumns, err := c.Columns(ctx, table.Name)
+		if err != nil {
+			return err
+		}
+		columns[i] = map[string]catalog.Column{}
+		for _, column := range tableColumns {
+			columns[i][strings.ToLower(column.Name)] = column
+		}
+	}
+
+	for _, f := range q.Filters {
+		qualifier, name := "", f.Column
+		if i := strings.LastIndex(f.Column, "."); i >= 0 {
+			qualifier, name = f.Column[:i], f.Column[i+1:]
+		}
+
+		found := []catalog.Column{}
+		foundIn := []string{}
+		for i, table := range tables {
+			if qualifier != "" && !table.matches(qualifier) {
+				continue
+			}
+			if column, ok := columns[i][strings.ToLower(name)]; ok {
+				found = append(found, column)
+				foundIn = append(foundIn, table.Name)
+			}
+		}
+
+		switch len(found) {
+		case 0:
+			return errors.Errorf("unknown column %s in --filter-by, expected one of %s",
+				f.Column, strings.Join(filterColumnNames(tables, columns), ", "))
+		case 1:
+			f.Args, err = f.Filter.Args(found[0].Type)
+			if err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("column %s in --filter-by is ambiguous, it is a column of %s",
+				f.Column, strings.Join(foundIn, " and "))
+		}
+	}
+	return nil
+}
+
+// filterColumnNames lists the columns that can be filtered on, qualified when
+// several tables are selected.
+func filterColumnNames(tables []selectTable, columns []map[string]catalog.Column) []string {
+	ret := []string{}
+	for i, table := range tables {
+		names := []string{}
+		for _, column := range columns[i] {
+			name := column.Name
+			if len(tables) > 1 {
+				qualifier := table.Alias
+				if qualifier == "" {
+					qualifier = table.Name
+				}
+				name = qualifier + "." + name
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ret = append(ret, names...)
+	}
+	return ret
+}
+
+// literal returns the condition of the filter with its values inlined as literals
+// of flavor, for the query generated by --create-query.
+func (f *selectFilter) literal(flavor sqlbuilder.Flavor) (string, error) {
+	args := make([]interface{}, 0, len(f.Args))
+	for _, arg := range f.Args {
+		args = append(args, sqlbuilder.Raw(sqlLiteral(flavor, arg)))
+	}
+	cond := sqlbuilder.NewCond()
+	condition, err := f.Condition(cond, quoteIdentifier(flavor, f.Column), args)
+	if err != nil {
+		return "", err
+	}
+	ret, _ := cond.Args.CompileWithFlavor(condition, flavor)
+	// values are inlined into a template, where {{ would start an action
+	if strings.Contains(ret, "{{") || strings.Contains(ret, "}}") {
+		ret = fmt.Sprintf("{{ %q }}", ret)
+	}
+	return ret, nil
+}
@@ -0,0 +1,183 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/pkg/errors"
+)
+
+// selectCursor is the position of a --paginate-by query: the value of the
+// pagination column in the last row of a page.
+type selectCursor struct {
+	Column string      `json:"c"`
+	Value  interface{} `json:"v"`
+}
+
+// Encode returns the cursor as an opaque token for --cursor.
+func (c *selectCursor) Encode() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", errors.Wrap(err, "could not encode cursor")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor decodes a token returned by Encode. Numbers are decoded as int64
+// when they are integers, so that they compare to integer columns.
+func decodeCursor(token string) (*selectCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.Errorf("invalid cursor %q", token)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	ret := &selectCursor{}
+	if err := decoder.Decode(ret); err != nil || ret.Column == "" {
+		return nil, errors.Errorf("invalid cursor %q", token)
+	}
+	if n, ok := ret.Value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			ret.Value = i
+		} else if f, err := n.Float64(); err == nil {
+			ret.Value = f
+		}
+	}
+	return ret, nil
+}
+
+// checkPagination rejects the settings that can't be combined with --paginate-by.
+func (q *selectQuery) checkPagination(s *SelectCommandSettings) error {
+	if q.PaginateBy == "" {
+		if s.Cursor != "" {
+			return errors.New("--cursor needs --paginate-by")
+		}
+		return nil
+	}
+
+	switch {
+	case s.Limit <= 0:
+		return errors.New("--paginate-by needs --limit, the number of rows of a page")
+	case s.Offset > 0:
+		return errors.New("--paginate-by can't be used with --offset")
+	case s.OrderBy != "":
+		return errors.New("--paginate-by orders the rows by its column, it can't be used with --order-by")
+	case q.Grouped:
+		return errors.New("--paginate-by can't be used with grouped or aggregate queries")
+	case s.Pages < 0:
+		return errors.New("--pages can't be negative")
+	}
+
+	if len(q.Columns) == 1 && q.Columns[0] == "*" {
+		return nil
+	}
+	for _, column := range q.Columns {
+		if column == quoteIdentifier(q.Flavor, q.PaginateBy) || pageKey(column) == q.pageKey() {
+			return nil
+		}
+	}
+	return errors.Errorf("--paginate-by %s must be one of the selected --columns", q.PaginateBy)
+}
+
+// pageKey is the name of a column in the rows returned by the database, without
+// the table and quotes.
+func pageKey(column string) string {
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		column = column[i+1:]
+	}
+	return strings.Trim(column, "\"`[]")
+}
+
+func (q *selectQuery) pageKey() string {
+	return pageKey(q.PaginateBy)
+}
+
+// selectPager runs the pages of a --paginate-by query, starting after a cursor.
+// Every page is fetched with WHERE column > last value, until a page has fewer
+// rows than the limit, or --pages pages have been fetched.
+type selectPager struct {
+	query    *selectQuery
+	settings *SelectCommandSettings
+	after    *selectCursor
+	pages    int
+	done     bool
+
+	last interface{}
+	rows int
+}
+
+func newSelectPager(q *selectQuery, s *SelectCommandSettings) (*selectPager, error) {
+	ret := &selectPager{query: q, settings: s}
+	if s.Cursor != "" {
+		cursor, err := decodeCursor(s.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Column != q.PaginateBy {
+			return nil, errors.Errorf("the cursor pages by %s, not by %s", cursor.Column, q.PaginateBy)
+		}
+		ret.after = cursor
+	}
+	return ret, nil
+}
+
+// Next returns the query of the next page, and false when all pages were fetched.
+func (p *selectPager) Next() (string, []interface{}, bool, error) {
+	if p.done {
+		return "", nil, false, nil
+	}
+	query, args, err := p.query.BuildPage(p.settings, p.after)
+	if err != nil {
+		return "", nil, false, err
+	}
+	return query, args, true, nil
+}
+
+// Processor returns the processor the rows of the next page are added to.
+func (p *selectPager) Processor(gp middlewares.Processor) middlewares.Processor {
+	p.last, p.rows = nil, 0
+	return &pageProcessor{Processor: gp, pager: p}
+}
+
+// Finish records the page that was run by execution. When --pages stops the
+// pagination before the last page, the cursor of the next page is set on the
+// execution.
+func (p *selectPager) Finish(execution *cmds2.QueryExecution) error {
+	p.pages++
+	if p.rows < p.settings.Limit {
+		p.done = true
+		return nil
+	}
+	if p.last == nil {
+		return errors.Errorf("column %s of the last row of the page is NULL, so the page after it is unknown", p.query.PaginateBy)
+	}
+	p.after = &selectCursor{Column: p.query.PaginateBy, Value: p.last}
+
+	if p.settings.Pages > 0 && p.pages >= p.settings.Pages {
+		p.done = true
+		cursor, err := p.after.Encode()
+		if err != nil {
+			return err
+		}
+		execution.NextCursor = cursor
+	}
+	return nil
+}
+
+// pageProcessor keeps the value of the pagination column of the last row.
+type pageProcessor struct {
+	middlewares.Processor
+	pager *selectPager
+}
+
+func (p *pageProcessor) AddRow(ctx context.Context, row types.Row) error {
+	p.pager.rows++
+	p.pager.last, _ = row.Get(p.pager.query.pageKey())
+	return p.Processor.AddRow(ctx, row)
+}
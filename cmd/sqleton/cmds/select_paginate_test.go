@@ -0,0 +1,164 @@
+package cmds
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	sql2 "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSelectCommand(t *testing.T, observers ...cmds2.QueryObserver) *SelectCommand {
+	t.Helper()
+	dbtSection, err := sql2.NewDbtParameterLayer()
+	require.NoError(t, err)
+	connectionSection, err := sql2.NewSqlConnectionParameterLayer()
+	require.NoError(t, err)
+	command, err := NewSelectCommand(sql2.OpenDatabaseFromDefaultSqlConnectionLayer, observers,
+		cmds.WithSections(dbtSection, connectionSection))
+	require.NoError(t, err)
+	return command
+}
+
+func runSelect(t *testing.T, command *SelectCommand, valuesForSections map[string]map[string]interface{}) ([]interface{}, error) {
+	t.Helper()
+	parsedValues, err := runner.ParseCommandValues(command, runner.WithValuesForSections(valuesForSections))
+	require.NoError(t, err)
+
+	gp := middlewares.NewTableProcessor()
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+	ctx := context.Background()
+	if err := command.RunIntoGlazeProcessor(ctx, parsedValues, gp); err != nil {
+		return nil, err
+	}
+	require.NoError(t, gp.Close(ctx))
+	ids := []interface{}{}
+	for _, row := range gp.GetTable().Rows {
+		id, _ := row.Get("id")
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func TestSelectPaginate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlx.Open("sqlite3", path)
+	require.NoError(t, err)
+	for _, statement := range []string{
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT)",
+		"INSERT INTO orders VALUES (1, 'open'), (2, 'paid'), (3, 'open'), (4, 'open'), (5, 'paid'), (6, 'open'), (7, 'open')",
+	} {
+		_, err := db.Exec(statement)
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	executions := []*cmds2.QueryExecution{}
+	command := newTestSelectCommand(t, cmds2.QueryObserverFunc(func(ctx context.Context, execution *cmds2.QueryExecution) {
+		executions = append(executions, execution)
+	}))
+	connection := map[string]interface{}{"db-type": "sqlite", "database": path}
+
+	// all pages are streamed
+	ids, err := runSelect(t, command, map[string]map[string]interface{}{
+		sql2.SqlConnectionSlug: connection,
+		SelectSlug: {
+			"table": "orders", "paginate-by": "id", "limit": 2,
+			"filter-by": []string{"status=open"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(1), int64(3), int64(4), int64(6), int64(7)}, ids)
+	require.Len(t, executions, 3)
+	require.Equal(t, `SELECT * FROM orders WHERE status = ? AND id > ? ORDER BY id LIMIT ?`, executions[2].Query)
+	require.Equal(t, []interface{}{"open", int64(6), 2}, executions[2].Parameters["args"])
+	require.Empty(t, executions[2].NextCursor)
+
+	// --pages stops early with a cursor, which resumes after the last row
+	executions = nil
+	selectValues := map[string]interface{}{"table": "orders", "paginate-by": "id", "limit": 3, "pages": 1}
+	ids, err = runSelect(t, command, map[string]map[string]interface{}{
+		sql2.SqlConnectionSlug: connection,
+		SelectSlug:             selectValues,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(1), int64(2), int64(3)}, ids)
+	require.Len(t, executions, 1)
+	cursor := executions[0].NextCursor
+	decoded, err := decodeCursor(cursor)
+	require.NoError(t, err)
+	require.Equal(t, &selectCursor{Column: "id", Value: int64(3)}, decoded)
+
+	selectValues["cursor"] = cursor
+	ids, err = runSelect(t, command, map[string]map[string]interface{}{
+		sql2.SqlConnectionSlug: connection,
+		SelectSlug:             selectValues,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(4), int64(5), int64(6)}, ids)
+}
+
+func TestSelectPaginateErrors(t *testing.T) {
+	for expected, s := range map[string]*SelectCommandSettings{
+		"--paginate-by needs --limit, the number of rows of a page": {Table: "orders", PaginateBy: "id"},
+		"--paginate-by can't be used with --offset":                 {Table: "orders", PaginateBy: "id", Limit: 10, Offset: 5},
+		"--paginate-by orders the rows by its column, it can't be used with --order-by": {
+			Table: "orders", PaginateBy: "id", Limit: 10, OrderBy: "id DESC",
+		},
+		"--paginate-by can't be used with grouped or aggregate queries": {
+			Table: "orders", PaginateBy: "id", Limit: 10, CountBy: []string{"status"},
+		},
+		"--paginate-by id must be one of the selected --columns": {
+			Table: "orders", PaginateBy: "id", Limit: 10, Columns: []string{"status"},
+		},
+		"--cursor needs --paginate-by": {Table: "orders", Limit: 10, Cursor: "abc"},
+	} {
+		_, err := newSelectQuery(s, sqlbuilder.SQLite)
+		require.EqualError(t, err, expected)
+	}
+
+	s := &SelectCommandSettings{Table: "orders o", PaginateBy: "o.id", Limit: 10, Columns: []string{"o.id", "o.status"}}
+	q, err := newSelectQuery(s, sqlbuilder.SQLite)
+	require.NoError(t, err)
+
+	cursor, err := (&selectCursor{Column: "id", Value: 3}).Encode()
+	require.NoError(t, err)
+	s.Cursor = cursor
+	_, err = newSelectPager(q, s)
+	require.EqualError(t, err, "the cursor pages by id, not by o.id")
+	s.Cursor = "not a cursor"
+	_, err = newSelectPager(q, s)
+	require.EqualError(t, err, `invalid cursor "not a cursor"`)
+}
+
+func TestSelectPaginateSqlFile(t *testing.T) {
+	s := &SelectCommandSettings{Table: "orders", PaginateBy: "id", Limit: 2}
+	q, err := newSelectQuery(s, sqlbuilder.SQLite)
+	require.NoError(t, err)
+	sqlFile, err := q.SqlFile("orders", s)
+	require.NoError(t, err)
+	spec, err := cmds2.ParseSQLFileSpec("orders.sql", []byte(sqlFile))
+	require.NoError(t, err)
+	names := []string{}
+	for _, flag := range spec.Flags {
+		names = append(names, flag.Name)
+	}
+	require.Equal(t, []string{"where", "limit", "distinct", "after"}, names)
+	require.Equal(t, "id", spec.PaginateBy)
+
+	command, err := (&cmds2.SqlCommandCompiler{}).Compile(spec)
+	require.NoError(t, err)
+	query, err := command.RenderQuery(context.Background(), nil, map[string]interface{}{
+		"limit": 2, "distinct": false, "after": "it's", "where": []string{},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT  * FROM orders\nWHERE 1=1\n  AND id > 'it''s'\nORDER BY id\nLIMIT 2", query)
+}
@@ -0,0 +1,348 @@
+package cmds
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/filter"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+)
+
+// selectJoin is a table joined with --join or --left-join.
+type selectJoin struct {
+	Option sqlbuilder.JoinOption
+	Table  string
+	On     string
+}
+
+// parseJoins parses table:on-expr joins. The table can have an alias
+// ("customers c:c.id = o.customer_id"), the expression can contain colons.
+func parseJoins(option sqlbuilder.JoinOption, joins []string) ([]selectJoin, error) {
+	ret := []selectJoin{}
+	for _, join := range joins {
+		table, on, ok := strings.Cut(join, ":")
+		table, on = strings.TrimSpace(table), strings.TrimSpace(on)
+		if !ok || table == "" || on == "" {
+			return nil, errors.Errorf("invalid join %q, expected table:on-expression", join)
+		}
+		ret = append(ret, selectJoin{Option: option, Table: table, On: on})
+	}
+	return ret, nil
+}
+
+var nonAliasRegexp = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// aggregateAlias names the column of an aggregate, e.g. sum_total for SUM(o.total).
+func aggregateAlias(function string, column string) string {
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		column = column[i+1:]
+	}
+	return strings.ToLower(function) + "_" + strings.Trim(nonAliasRegexp.ReplaceAllString(column, "_"), "_")
+}
+
+// selectQuery is the query of sqleton select, built from its settings. Table and
+// the tables of Joins are kept as given, the columns are quoted for Flavor.
+type selectQuery struct {
+	Flavor  sqlbuilder.Flavor
+	Table   string
+	Joins   []selectJoin
+	Columns []string
+	Where   []string
+	Filters []*selectFilter
+	GroupBy []string
+	Having  []string
+	OrderBy string
+	// PaginateBy is the column of --paginate-by, as given.
+	PaginateBy string
+	// Grouped is set when the query returns one row per group, or the aggregates
+	// of all rows.
+	Grouped bool
+}
+
+func newSelectQuery(s *SelectCommandSettings, flavor sqlbuilder.Flavor) (*selectQuery, error) {
+	joins, err := parseJoins(sqlbuilder.InnerJoin, s.Join)
+	if err != nil {
+		return nil, err
+	}
+	leftJoins, err := parseJoins(sqlbuilder.LeftJoin, s.LeftJoin)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []*selectFilter{}
+	for _, expr := range s.FilterBy {
+		f, err := filter.Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, &selectFilter{Filter: f})
+	}
+
+	ret := &selectQuery{
+		Flavor:     flavor,
+		Table:      s.Table,
+		Joins:      append(joins, leftJoins...),
+		Where:      s.Where,
+		Filters:    filters,
+		Having:     s.Having,
+		OrderBy:    s.OrderBy,
+		PaginateBy: s.PaginateBy,
+	}
+
+	for _, column := range quoteIdentifiers(flavor, append(append([]string{}, s.GroupBy...), s.CountBy...)) {
+		if !contains(ret.GroupBy, column) {
+			ret.GroupBy = append(ret.GroupBy, column)
+		}
+	}
+
+	aggregates := []string{}
+	if s.Count {
+		countColumns := strings.Join(quoteIdentifiers(flavor, s.Columns), ", ")
+		if countColumns == "" {
+			countColumns = "*"
+		}
+		if s.Distinct {
+			countColumns = "DISTINCT " + countColumns
+		}
+		aggregates = append(aggregates, fmt.Sprintf("COUNT(%s) AS count", countColumns))
+	} else if len(s.CountBy) > 0 {
+		aggregates = append(aggregates, "COUNT(*) AS count")
+	}
+	for _, column := range s.Sum {
+		aggregates = append(aggregates, fmt.Sprintf("SUM(%s) AS %s", quoteIdentifier(flavor, column), aggregateAlias("sum", column)))
+	}
+	for _, column := range s.Avg {
+		aggregates = append(aggregates, fmt.Sprintf("AVG(%s) AS %s", quoteIdentifier(flavor, column), aggregateAlias("avg", column)))
+	}
+	if len(s.Having) > 0 && len(aggregates) == 0 && len(ret.GroupBy) == 0 {
+		return nil, errors.New("--having needs --group-by or an aggregate")
+	}
+	ret.Grouped = len(aggregates) > 0 || len(ret.GroupBy) > 0
+
+	switch {
+	case len(s.Columns) > 0 && !s.Count:
+		ret.Columns = append(ret.Columns, quoteIdentifiers(flavor, s.Columns)...)
+		for _, column := range quoteIdentifiers(flavor, s.CountBy) {
+			if !contains(ret.Columns, column) {
+				ret.Columns = append(ret.Columns, column)
+			}
+		}
+	case ret.Grouped:
+		ret.Columns = append(ret.Columns, ret.GroupBy...)
+	default:
+		ret.Columns = []string{"*"}
+	}
+	ret.Columns = append(ret.Columns, aggregates...)
+
+	if ret.OrderBy == "" && len(s.CountBy) > 0 {
+		ret.OrderBy = "count DESC"
+	}
+
+	if err := ret.checkPagination(s); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Build returns the query for the limit, offset and distinct settings of s. With
+// --paginate-by, it is the query of the first page.
+func (q *selectQuery) Build(s *SelectCommandSettings) (string, []interface{}, error) {
+	return q.BuildPage(s, nil)
+}
+
+// BuildPage returns the query of the page of a --paginate-by query that starts
+// after the cursor, or the first page when after is nil.
+func (q *selectQuery) BuildPage(s *SelectCommandSettings, after *selectCursor) (string, []interface{}, error) {
+	sb := q.Flavor.NewSelectBuilder()
+	sb = sb.Select(q.Columns...).From(quoteTable(q.Flavor, q.Table))
+	if s.Distinct && !s.Count {
+		sb = sb.Distinct()
+	}
+	for _, join := range q.Joins {
+		sb = sb.JoinWithOption(join.Option, quoteTable(q.Flavor, join.Table), join.On)
+	}
+	for _, where := range q.Where {
+		sb = sb.Where(where)
+	}
+	for _, f := range q.Filters {
+		condition, err := f.Condition(&sb.Cond, quoteIdentifier(q.Flavor, f.Column), f.Args)
+		if err != nil {
+			return "", nil, err
+		}
+		sb = sb.Where(condition)
+	}
+	if after != nil {
+		sb = sb.Where(sb.GreaterThan(quoteIdentifier(q.Flavor, q.PaginateBy), after.Value))
+	}
+	if len(q.GroupBy) > 0 {
+		sb = sb.GroupBy(q.GroupBy...)
+	}
+	if len(q.Having) > 0 {
+		sb = sb.Having(q.Having...)
+	}
+
+	// a count without groups is a single row
+	multipleRows := !s.Count || len(q.GroupBy) > 0
+	if s.Limit > 0 && multipleRows {
+		sb = sb.Limit(s.Limit)
+	}
+	if s.Offset > 0 {
+		sb = sb.Offset(s.Offset)
+		if s.Limit == 0 && q.Flavor != sqlbuilder.PostgreSQL && q.Flavor != sqlbuilder.SQLServer {
+			// the builder leaves out the OFFSET of these flavors when there is no LIMIT
+			sb = sb.Limit(math.MaxInt64)
+		}
+	}
+	if q.PaginateBy != "" {
+		sb = sb.OrderBy(quoteIdentifier(q.Flavor, q.PaginateBy))
+	} else if q.OrderBy != "" {
+		sb = sb.OrderBy(q.OrderBy)
+	}
+
+	query, args := sb.Build()
+	return query, args, nil
+}
+
+// SqlFile returns the query as a sqleton command named name, with the values of
+// the filters inlined. The where and having clauses that were not given become
+// flags, as do the limit, offset, distinct and order by settings of queries
+// returning several rows. With --paginate-by, the offset and order by flags are
+// replaced by an after flag, the last value of the previous page.
+func (q *selectQuery) SqlFile(name string, s *SelectCommandSettings) (string, error) {
+	where := append([]string{}, q.Where...)
+	for _, f := range q.Filters {
+		condition, err := f.literal(q.Flavor)
+		if err != nil {
+			return "", err
+		}
+		where = append(where, condition)
+	}
+
+	short := fmt.Sprintf("Select"+" columns from %s", q.Table)
+	if s.Count {
+		short = fmt.Sprintf("Count all rows from %s", q.Table)
+	}
+	if len(where) > 0 {
+		short = fmt.Sprintf("Select"+" from %s where %s", q.Table, strings.Join(where, " AND "))
+	}
+	if len(q.GroupBy) > 0 {
+		short += fmt.Sprintf(" grouped by %s", strings.Join(q.GroupBy, ", "))
+	}
+
+	multipleRows := !s.Count || len(q.GroupBy) > 0
+
+	queryFlags := []*fields.Definition{}
+	if len(where) == 0 {
+		queryFlags = append(queryFlags, fields.New("where", fields.TypeStringList))
+	}
+	if len(q.GroupBy) > 0 && len(q.Having) == 0 {
+		queryFlags = append(queryFlags, fields.New("having", fields.TypeStringList))
+	}
+	if q.PaginateBy != "" {
+		queryFlags = append(queryFlags, fields.New(
+			"limit",
+			fields.TypeInteger,
+			fields.WithHelp(fmt.Sprintf("Number of rows of a page (default: %d)", s.Limit)),
+			fields.WithDefault(s.Limit),
+		))
+		queryFlags = append(queryFlags, fields.New(
+			"distinct",
+			fields.TypeBool,
+			fields.WithHelp(fmt.Sprintf("Whether to select distinct rows (default: %t)", s.Distinct)),
+			fields.WithDefault(s.Distinct),
+		))
+		queryFlags = append(queryFlags, fields.New(
+			"after",
+			fields.TypeString,
+			fields.WithHelp(fmt.Sprintf("Select the rows after this %s, the last one of the previous page", q.PaginateBy)),
+		))
+	} else if multipleRows {
+		queryFlags = append(queryFlags, fields.New(
+			"limit",
+			fields.TypeInteger,
+			fields.WithHelp(fmt.Sprintf("Limit the number of rows (default: %d), set to 0 to disable", s.Limit)),
+			fields.WithDefault(s.Limit),
+		))
+		queryFlags = append(queryFlags, fields.New(
+			"offset",
+			fields.TypeInteger,
+			fields.WithHelp(fmt.Sprintf("Offset the number of rows (default: %d)", s.Offset)),
+			fields.WithDefault(s.Offset),
+		))
+		queryFlags = append(queryFlags, fields.New(
+			"distinct",
+			fields.TypeBool,
+			fields.WithHelp(fmt.Sprintf("Whether to select distinct rows (default: %t)", s.Distinct)),
+			fields.WithDefault(s.Distinct),
+		))
+
+		orderByHelp := "Order by"
+		orderByOptions := []fields.Option{
+			fields.WithHelp(orderByHelp),
+		}
+		if q.OrderBy != "" {
+			orderByHelp = fmt.Sprintf("Order by (default: %s)", q.OrderBy)
+			orderByOptions = append(orderByOptions, fields.WithHelp(orderByHelp), fields.WithDefault(q.OrderBy))
+		}
+		queryFlags = append(queryFlags, fields.New("order_by", fields.TypeString, orderByOptions...))
+	}
+
+	sb := &strings.Builder{}
+	_, _ = fmt.Fprintf(sb, "SELECT ")
+	if !s.Count {
+		_, _ = fmt.Fprintf(sb, "{{ if .distinct }}DISTINCT{{ end }} ")
+	}
+	_, _ = fmt.Fprintf(sb, "%s FROM %s", strings.Join(q.Columns, ", "), quoteTable(q.Flavor, q.Table))
+	for _, join := range q.Joins {
+		_, _ = fmt.Fprintf(sb, "\n%s JOIN %s ON %s", join.Option, quoteTable(q.Flavor, join.Table), join.On)
+	}
+	if len(where) > 0 {
+		_, _ = fmt.Fprintf(sb, " WHERE %s", strings.Join(where, " AND "))
+	} else {
+		_, _ = fmt.Fprintf(sb, "\nWHERE 1=1\n{{ range .where  }}  AND {{.}} {{ end }}")
+	}
+	if len(q.GroupBy) > 0 {
+		_, _ = fmt.Fprintf(sb, "\nGROUP BY %s", strings.Join(q.GroupBy, ", "))
+	}
+	if len(q.Having) > 0 {
+		_, _ = fmt.Fprintf(sb, "\nHAVING %s", strings.Join(q.Having, " AND "))
+	} else if len(q.GroupBy) > 0 {
+		_, _ = fmt.Fprintf(sb, "\nHAVING 1=1\n{{ range .having }}  AND {{.}} {{ end }}")
+	}
+
+	if q.PaginateBy != "" {
+		column := quoteIdentifier(q.Flavor, q.PaginateBy)
+		_, _ = fmt.Fprintf(sb, "\n{{ if .after }}  AND %s > '{{ .after | sqlEscape }}'{{ end }}", column)
+		_, _ = fmt.Fprintf(sb, "\nORDER BY %s", column)
+		_, _ = fmt.Fprint(sb, pageLimitTemplate(q.Flavor))
+	} else if multipleRows {
+		_, _ = fmt.Fprintf(sb, "\n{{ if .order_by }} ORDER BY {{ .order_by }}{{ end }}")
+		_, _ = fmt.Fprint(sb, limitOffsetTemplate(q.Flavor))
+	}
+
+	spec := &cmds2.SqlCommandSpec{
+		Name:  name,
+		Short: short,
+		Flags: queryFlags,
+		Query: sb.String(),
+	}
+	if q.PaginateBy != "" {
+		spec.PaginateBy = q.pageKey()
+	}
+	return cmds2.MarshalSpecToSQLFile(spec)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package cmds
+
+import (
+	"context"
+	"testing"
+
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectQueryBuild(t *testing.T) {
+	for expected, s := range map[string]*SelectCommandSettings{
+		"SELECT * FROM orders LIMIT ?": {
+			Table: "orders", Limit: 50,
+		},
+		"SELECT COUNT(*) AS count FROM orders": {
+			Table: "orders", Limit: 50, Count: true,
+		},
+		"SELECT c.name, SUM(o.total) AS sum_total, AVG(o.total) AS avg_total FROM orders o " +
+			"LEFT JOIN customers c ON c.id = o.customer_id GROUP BY c.name HAVING SUM(o.total) > 5": {
+			Table:    "orders o",
+			LeftJoin: []string{"customers c:c.id = o.customer_id"},
+			GroupBy:  []string{"c.name"},
+			Sum:      []string{"o.total"},
+			Avg:      []string{"o.total"},
+			Having:   []string{"SUM(o.total) > 5"},
+		},
+		"SELECT status, COUNT(*) AS count FROM orders GROUP BY status ORDER BY count DESC": {
+			Table: "orders", CountBy: []string{"status"},
+		},
+		"SELECT status, COUNT(DISTINCT customer_id) AS count FROM orders GROUP BY status LIMIT ?": {
+			Table: "orders", Count: true, Distinct: true, Columns: []string{"customer_id"},
+			GroupBy: []string{"status"}, Limit: 10,
+		},
+		"SELECT o.id, c.name FROM orders o INNER JOIN customers c ON c.id = o.customer_id::int": {
+			Table: "orders o", Columns: []string{"o.id", "c.name"},
+			Join: []string{"customers c:c.id = o.customer_id::int"},
+		},
+	} {
+		q, err := newSelectQuery(s, sqlbuilder.SQLite)
+		require.NoError(t, err)
+		query, _, err := q.Build(s)
+		require.NoError(t, err)
+		require.Equal(t, expected, query)
+	}
+
+	_, err := newSelectQuery(&SelectCommandSettings{Table: "orders", Join: []string{"customers"}}, sqlbuilder.SQLite)
+	require.EqualError(t, err, `invalid join "customers", expected table:on-expression`)
+	_, err = newSelectQuery(&SelectCommandSettings{Table: "orders", Having: []string{"x > 1"}}, sqlbuilder.SQLite)
+	require.EqualError(t, err, "--having needs --group-by or an aggregate")
+}
+
+func TestSelectQuerySqlFile(t *testing.T) {
+	s := &SelectCommandSettings{Table: "orders", CountBy: []string{"status"}, Limit: 10}
+	q, err := newSelectQuery(s, sqlbuilder.SQLite)
+	require.NoError(t, err)
+	sqlFile, err := q.SqlFile("statuses", s)
+	require.NoError(t, err)
+
+	spec, err := cmds2.ParseSQLFileSpec("statuses.sql", []byte(sqlFile))
+	require.NoError(t, err)
+	flags := []string{}
+	for _, flag := range spec.Flags {
+		flags = append(flags, flag.Name)
+	}
+	require.Equal(t, []string{"where", "having", "limit", "offset", "distinct", "order_by"}, flags)
+	require.Contains(t, spec.Query, "GROUP BY status\nHAVING 1=1")
+	require.Equal(t, "count DESC", *spec.Flags[5].Default)
+}
+
+func TestSelectQueryFilters(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	db.SetMaxOpenConns(1)
+	for _, statement := range []string{
+		"CREATE TABLE orders (id INTEGER, customer_id INTEGER, status TEXT, total REAL, created_at TEXT)",
+		"CREATE TABLE customers (id INTEGER, name TEXT)",
+	} {
+		_, err := db.Exec(statement)
+		require.NoError(t, err)
+	}
+	ctx := context.Background()
+
+	s := &SelectCommandSettings{
+		Table:    "orders o",
+		LeftJoin: []string{"customers AS c:c.id = o.customer_id"},
+		FilterBy: []string{"status=open|paid", "total>=10", "c.name~o'%", "created_at="},
+	}
+	q, err := newSelectQuery(s, sqlbuilder.SQLite)
+	require.NoError(t, err)
+	require.NoError(t, q.resolveFilters(ctx, db))
+	query, args, err := q.Build(s)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM orders o LEFT JOIN customers c ON c.id = o.customer_id "+
+		"WHERE status IN (?, ?) AND total >= ? AND c.name LIKE ? AND created_at IS NULL", query)
+	require.Equal(t, []interface{}{"open", "paid", 10.0, "o'%"}, args)
+
+	s.CreateQuery = "open_orders"
+	sqlFile, err := q.SqlFile("open_orders", s)
+	require.NoError(t, err)
+	require.Contains(t, sqlFile, "status IN ('open', 'paid') AND total >= 10 AND c.name LIKE 'o''%' AND created_at IS NULL")
+
+	for filter_, expected := range map[string]string{
+		"nope=1":     "unknown column nope in --filter-by, expected one of o.created_at, o.customer_id, o.id, o.status, o.total, c.id, c.name",
+		"id=1":       "column id in --filter-by is ambiguous, it is a column of orders and customers",
+		"x.id=1":     "unknown column x.id in --filter-by",
+		"o.id=one":   `invalid value "one" for column o.id`,
+		"o.id~1%":    "",
+		"O.ID=1":     "unknown column O.ID in --filter-by",
+		"c.NAME=ada": "",
+	} {
+		s := &SelectCommandSettings{Table: "orders o", LeftJoin: []string{"customers c:c.id = o.customer_id"}, FilterBy: []string{filter_}}
+		q, err := newSelectQuery(s, sqlbuilder.SQLite)
+		require.NoError(t, err)
+		err = q.resolveFilters(ctx, db)
+		if expected == "" {
+			require.NoError(t, err, filter_)
+			continue
+		}
+		require.ErrorContains(t, err, expected, filter_)
+	}
+
+	_, err = newSelectQuery(&SelectCommandSettings{Table: "orders", FilterBy: []string{"1=1 OR 1=1"}}, sqlbuilder.SQLite)
+	require.EqualError(t, err, `invalid filter "1=1 OR 1=1", "1" is not a column name`)
+}
+
+func TestSelectQueryFlavors(t *testing.T) {
+	s := &SelectCommandSettings{
+		Table:   "order",
+		Columns: []string{"id", "user", "Total", "COUNT(*)"},
+		Limit:   10,
+		Offset:  20,
+	}
+	for flavor, expected := range map[sqlbuilder.Flavor]string{
+		sqlbuilder.MySQL:      "SELECT id, `user`, Total, COUNT(*) FROM `order` LIMIT ? OFFSET ?",
+		sqlbuilder.PostgreSQL: `SELECT id, "user", Total, COUNT(*) FROM "order" LIMIT $1 OFFSET $2`,
+		sqlbuilder.SQLite:     `SELECT id, "user", Total, COUNT(*) FROM "order" LIMIT ? OFFSET ?`,
+		sqlbuilder.SQLServer:  `SELECT id, "user", Total, COUNT(*) FROM "order" ORDER BY 1 OFFSET @p1 ROWS FETCH NEXT @p2 ROWS ONLY`,
+		sqlbuilder.ClickHouse: "SELECT id, `user`, Total, COUNT(*) FROM `order` LIMIT ? OFFSET ?",
+	} {
+		q, err := newSelectQuery(s, flavor)
+		require.NoError(t, err)
+		query, args, err := q.Build(s)
+		require.NoError(t, err)
+		require.Equal(t, expected, query, flavor.String())
+		if flavor == sqlbuilder.SQLServer {
+			require.Equal(t, []interface{}{20, 10}, args)
+		} else {
+			require.Equal(t, []interface{}{10, 20}, args, flavor.String())
+		}
+	}
+
+	// an offset without a limit
+	s = &SelectCommandSettings{Table: "orders", Offset: 20}
+	q, err := newSelectQuery(s, sqlbuilder.SQLite)
+	require.NoError(t, err)
+	query, _, err := q.Build(s)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM orders LIMIT ? OFFSET ?", query)
+	q, err = newSelectQuery(s, sqlbuilder.PostgreSQL)
+	require.NoError(t, err)
+	query, _, err = q.Build(s)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM orders OFFSET $1", query)
+
+	for name, expected := range map[string]string{
+		"orders":           "orders",
+		"o.total":          "o.total",
+		"public.order":     `public."order"`,
+		"2fa":              `"2fa"`,
+		"prix_café":        `"prix_café"`,
+		"COUNT(*)":         "COUNT(*)",
+		"total - 1":        "total - 1",
+		"o.*":              "o.*",
+		`"Quoted"`:         `"Quoted"`,
+		"customer_id::int": "customer_id::int",
+	} {
+		require.Equal(t, expected, quoteIdentifier(sqlbuilder.PostgreSQL, name), name)
+	}
+	require.Equal(t, `"order" o`, quoteTable(sqlbuilder.PostgreSQL, "order AS o"))
+
+	for flavor, expected := range map[sqlbuilder.Flavor]string{
+		sqlbuilder.MySQL:      `'it''s a \\'`,
+		sqlbuilder.PostgreSQL: `'it''s a \'`,
+		sqlbuilder.SQLServer:  `N'it''s a \'`,
+	} {
+		require.Equal(t, expected, sqlLiteral(flavor, `it's a \`), flavor.String())
+	}
+	require.Equal(t, "0", sqlLiteral(sqlbuilder.SQLServer, false))
+	require.Equal(t, "2.5", sqlLiteral(sqlbuilder.SQLite, 2.5))
+}
+
+func TestSelectQuerySqlFileFlavors(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	_, err = db.Exec("CREATE TABLE orders (id INTEGER, status TEXT)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO orders VALUES (1, 'open'), (2, 'open'), (3, 'paid')")
+	require.NoError(t, err)
+
+	s := &SelectCommandSettings{Table: "orders", FilterBy: []string{"status=open"}, Limit: 1}
+	for flavor, expected := range map[sqlbuilder.Flavor]string{
+		sqlbuilder.SQLite:     "SELECT  * FROM orders WHERE status = 'open'\nLIMIT 1 OFFSET 1",
+		sqlbuilder.PostgreSQL: "SELECT  * FROM orders WHERE status = 'open'\nLIMIT 1\nOFFSET 1",
+		sqlbuilder.SQLServer:  "SELECT  * FROM orders WHERE status = N'open'\nORDER BY 1 OFFSET 1 ROWS FETCH NEXT 1 ROWS ONLY",
+	} {
+		q, err := newSelectQuery(s, flavor)
+		require.NoError(t, err)
+		require.NoError(t, q.resolveFilters(context.Background(), db))
+		sqlFile, err := q.SqlFile("open", s)
+		require.NoError(t, err)
+		spec, err := cmds2.ParseSQLFileSpec("open.sql", []byte(sqlFile))
+		require.NoError(t, err)
+
+		command, err := (&cmds2.SqlCommandCompiler{}).Compile(spec)
+		require.NoError(t, err)
+		query, err := command.RenderQuery(context.Background(), db, map[string]interface{}{
+			"limit": 1, "offset": 1, "distinct": false, "order_by": "",
+		})
+		require.NoError(t, err)
+		require.Equal(t, expected, query, flavor.String())
+	}
+
+	// the sqlite query runs, also with an offset and no limit
+	q, err := newSelectQuery(s, sqlbuilder.SQLite)
+	require.NoError(t, err)
+	require.NoError(t, q.resolveFilters(context.Background(), db))
+	sqlFile, err := q.SqlFile("open", s)
+	require.NoError(t, err)
+	spec, err := cmds2.ParseSQLFileSpec("open.sql", []byte(sqlFile))
+	require.NoError(t, err)
+	command, err := (&cmds2.SqlCommandCompiler{}).Compile(spec)
+	require.NoError(t, err)
+	query, err := command.RenderQuery(context.Background(), db, map[string]interface{}{
+		"limit": 0, "offset": 1, "distinct": false, "order_by": "id",
+	})
+	require.NoError(t, err)
+	ids := []int{}
+	require.NoError(t, db.Select(&ids, "SELECT id FROM ("+query+")"))
+	require.Equal(t, []int{2}, ids)
+}
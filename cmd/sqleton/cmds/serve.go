@@ -3,14 +3,18 @@ package cmds
 import (
 	"context"
 	"embed"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync"
 
+	"github.com/go-go-golems/clay/pkg/repositories"
 	"github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
 	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/parka/pkg/glazed/handlers/datatables"
 	"github.com/go-go-golems/parka/pkg/handlers"
@@ -20,9 +24,16 @@ import (
 	generic_command "github.com/go-go-golems/parka/pkg/handlers/generic-command"
 	"github.com/go-go-golems/parka/pkg/handlers/template"
 	"github.com/go-go-golems/parka/pkg/handlers/template-dir"
+	"github.com/go-go-golems/parka/pkg/render"
 	"github.com/go-go-golems/parka/pkg/server"
 	"github.com/go-go-golems/parka/pkg/utils/fs"
+	"github.com/go-go-golems/sqleton/pkg/audit"
 	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/observability"
+	"github.com/go-go-golems/sqleton/pkg/stream"
+	"github.com/go-go-golems/sqleton/pkg/watch"
+	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -33,22 +44,30 @@ type ServeCommand struct {
 	*cmds.CommandDescription
 	dbConnectionFactory sql.DBConnectionFactory
 	repositories        []string
+	queryObservers      []sqleton_cmds.QueryObserver
 }
 
 var _ cmds.BareCommand = (*ServeCommand)(nil)
 
 type ServeSettings struct {
-	Dev         bool     `glazed:"dev"`
-	Debug       bool     `glazed:"debug"`
-	ServePort   int      `glazed:"serve-port"`
-	ServeHost   string   `glazed:"serve-host"`
-	ContentDirs []string `glazed:"content-dirs"`
-	ConfigFile  string   `glazed:"serve-config-file"`
+	Dev           bool     `glazed:"dev"`
+	Debug         bool     `glazed:"debug"`
+	ServePort     int      `glazed:"serve-port"`
+	ServeHost     string   `glazed:"serve-host"`
+	ContentDirs   []string `glazed:"content-dirs"`
+	ConfigFile    string   `glazed:"serve-config-file"`
+	Metrics       bool     `glazed:"metrics"`
+	MetricsPath   string   `glazed:"metrics-path"`
+	AccessLog     bool     `glazed:"access-log"`
+	AccessLogFile string   `glazed:"access-log-file"`
+	Stream        bool     `glazed:"stream"`
+	StreamMin     string   `glazed:"stream-min-interval"`
 }
 
 func NewServeCommand(
 	dbConnectionFactory sql.DBConnectionFactory,
 	repositoryPaths []string,
+	queryObservers []sqleton_cmds.QueryObserver,
 	options ...cmds.CommandDescriptionOption,
 ) (*ServeCommand, error) {
 	sqlConnectionSection, err := sql.NewSqlConnectionParameterLayer()
@@ -98,6 +117,42 @@ func NewServeCommand(
 				fields.TypeString,
 				fields.WithHelp("Config file to configure the serve functionality"),
 			),
+			fields.New(
+				"metrics",
+				fields.TypeBool,
+				fields.WithHelp("Expose prometheus metrics for the served commands (unauthenticated)"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"metrics-path",
+				fields.TypeString,
+				fields.WithHelp("Path to expose the prometheus metrics on"),
+				fields.WithDefault("/metrics"),
+			),
+			fields.New(
+				"access-log",
+				fields.TypeBool,
+				fields.WithHelp("Write structured JSON access logs, including the command, redacted parameters and query hash"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"access-log-file",
+				fields.TypeString,
+				fields.WithHelp("File to append the JSON access logs to (default: stderr)"),
+				fields.WithDefault(""),
+			),
+			fields.New(
+				"stream",
+				fields.TypeBool,
+				fields.WithHelp("Expose /stream/<command> to re-run commands on an interval and push changes over server-sent events (unauthenticated)"),
+				fields.WithDefault(false),
+			),
+			fields.New(
+				"stream-min-interval",
+				fields.TypeString,
+				fields.WithHelp("Shortest interval clients can request on /stream"),
+				fields.WithDefault("1s"),
+			),
 		),
 		cmds.WithSections(sqlConnectionSection, dbtSection),
 	)
@@ -107,7 +162,8 @@ func NewServeCommand(
 			"serve",
 			options_...,
 		),
-		repositories: repositoryPaths,
+		repositories:   repositoryPaths,
+		queryObservers: queryObservers,
 	}, nil
 }
 
@@ -146,6 +202,13 @@ func (s *ServeCommand) runWithConfigFile(
 		server_.RegisterDebugRoutes()
 	}
 
+	queryObservers, closeObservability, err := s.setupObservability(ss, server_)
+	if err != nil {
+		return err
+	}
+	defer closeObservability()
+	served := &servedRepositories{}
+
 	commandDirHandlerOptions := []command_dir.CommandDirHandlerOption{}
 	templateDirHandlerOptions := []template_dir.TemplateDirHandlerOption{}
 
@@ -166,7 +229,12 @@ func (s *ServeCommand) runWithConfigFile(
 	commandDirHandlerOptions = append(
 		commandDirHandlerOptions,
 		command_dir.WithGenericCommandHandlerOptions(
+			generic_command.WithPostMiddlewares(
+				cliOnlyHelpersMiddleware(),
+				connectionMiddleware(sqlConnectionLayer, dbtConnectionLayer),
+			),
 			generic_command.WithParameterFilterOptions(
+				cliOnlyHelpersFilter(),
 				// I think this is correct and sets the connection settings?
 				config.WithMergeOverrideLayer(
 					sqlConnectionLayer.Section.GetSlug(),
@@ -198,7 +266,7 @@ func (s *ServeCommand) runWithConfigFile(
 		handlers.WithAppendCommandDirHandlerOptions(commandDirHandlerOptions...),
 		handlers.WithAppendTemplateDirHandlerOptions(templateDirHandlerOptions...),
 		handlers.WithAppendTemplateHandlerOptions(templateHandlerOptions...),
-		handlers.WithRepositoryFactory(sqleton_cmds.NewRepositoryFactory()),
+		handlers.WithRepositoryFactory(served.Factory(queryObservers...)),
 		handlers.WithDevMode(devMode),
 	)
 
@@ -234,6 +302,11 @@ func (s *ServeCommand) Run(
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true})
 
 	if ss.ConfigFile != "" {
+		// the routes of a config file don't serve the repositories passed to serve,
+		// which are the ones /stream is built from
+		if ss.Stream {
+			return errors.New("--stream can't be used with --serve-config-file")
+		}
 		return s.runWithConfigFile(ctx, parsedValues, ss.ConfigFile, serverOptions)
 	}
 
@@ -296,6 +369,13 @@ func (s *ServeCommand) Run(
 		server_.RegisterDebugRoutes()
 	}
 
+	queryObservers, closeObservability, err := s.setupObservability(ss, server_)
+	if err != nil {
+		return err
+	}
+	defer closeObservability()
+	served := &servedRepositories{}
+
 	// This section configures the command directory default setting specific to sqleton
 	sqlConnectionLayer, ok := parsedValues.Get(sql.SqlConnectionSlug)
 	if !ok || sqlConnectionLayer == nil {
@@ -306,11 +386,25 @@ func (s *ServeCommand) Run(
 		return errors.Errorf("dbt section is required")
 	}
 
+	var dataTablesLookup render.TemplateLookup = datatables.NewDataTablesLookupTemplate()
+	if ss.Stream {
+		err = s.setupStream(ss, server_, served, queryObservers, sqlConnectionLayer, dbtConnectionLayer)
+		if err != nil {
+			return err
+		}
+		dataTablesLookup = stream.NewLiveDataTablesLookup(dataTablesLookup, "data-tables.tmpl.html")
+	}
+
 	// commandDirHandlerOptions will apply to all command dirs loaded by the server
 	commandDirHandlerOptions := []command_dir.CommandDirHandlerOption{
 		command_dir.WithGenericCommandHandlerOptions(
-			generic_command.WithTemplateLookup(datatables.NewDataTablesLookupTemplate()),
+			generic_command.WithTemplateLookup(dataTablesLookup),
+			generic_command.WithPostMiddlewares(
+				cliOnlyHelpersMiddleware(),
+				connectionMiddleware(sqlConnectionLayer, dbtConnectionLayer),
+			),
 			generic_command.WithParameterFilterOptions(
+				cliOnlyHelpersFilter(),
 				config.WithReplaceOverrideLayer(
 					dbtConnectionLayer.Section.GetSlug(),
 					dbtConnectionLayer.Fields.ToMap(),
@@ -328,8 +422,13 @@ func (s *ServeCommand) Run(
 
 	commandHandlerOptions := []command.CommandHandlerOption{
 		command.WithGenericCommandHandlerOptions(
-			generic_command.WithTemplateLookup(datatables.NewDataTablesLookupTemplate()),
+			generic_command.WithTemplateLookup(dataTablesLookup),
+			generic_command.WithPostMiddlewares(
+				cliOnlyHelpersMiddleware(),
+				connectionMiddleware(sqlConnectionLayer, dbtConnectionLayer),
+			),
 			generic_command.WithParameterFilterOptions(
+				cliOnlyHelpersFilter(),
 				config.WithReplaceOverrideLayer(
 					dbtConnectionLayer.Section.GetSlug(),
 					dbtConnectionLayer.Fields.ToMap(),
@@ -360,7 +459,7 @@ func (s *ServeCommand) Run(
 		handlers.WithAppendCommandDirHandlerOptions(commandDirHandlerOptions...),
 		handlers.WithAppendTemplateDirHandlerOptions(templateDirHandlerOptions...),
 		handlers.WithAppendCommandHandlerOptions(commandHandlerOptions...),
-		handlers.WithRepositoryFactory(sqleton_cmds.NewRepositoryFactory()),
+		handlers.WithRepositoryFactory(served.Factory(queryObservers...)),
 		handlers.WithDevMode(ss.Dev),
 	)
 
@@ -371,6 +470,189 @@ func (s *ServeCommand) Run(
 	return nil
 }
 
+// setupObservability registers the metrics endpoint and the access log middleware on the server,
+// and returns the query observers that need to be passed to the command loader so that
+// executed commands are reported.
+func (s *ServeCommand) setupObservability(
+	ss *ServeSettings,
+	server_ *server.Server,
+) ([]sqleton_cmds.QueryObserver, func(), error) {
+	observers := append([]sqleton_cmds.QueryObserver{}, s.queryObservers...)
+	closer := func() {}
+
+	// record the HTTP caller for the audit log, and so that commands know they are
+	// not run from a terminal
+	server_.Group.Use(auditCallerMiddleware)
+	server_.Group.Use(nextCursorMiddleware)
+
+	if ss.AccessLog {
+		var w io.Writer = os.Stderr
+		if ss.AccessLogFile != "" {
+			f, err := os.OpenFile(ss.AccessLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "could not open access log file")
+			}
+			w = f
+			closer = func() {
+				_ = f.Close()
+			}
+		}
+		accessLog := observability.NewAccessLog(w)
+		server_.Group.Use(accessLog.Middleware())
+		observers = append(observers, accessLog)
+	}
+
+	if ss.Metrics {
+		metrics := observability.NewMetrics()
+		server_.Group.GET(ss.MetricsPath, echo.WrapHandler(metrics.Handler()))
+		observers = append(observers, metrics)
+	}
+
+	return observers, closer, nil
+}
+
+// setupStream registers /stream/<command>, which serves the commands of the
+// repositories passed to serve, using the connection settings of serve itself.
+func (s *ServeCommand) setupStream(
+	ss *ServeSettings,
+	server_ *server.Server,
+	served *servedRepositories,
+	queryObservers []sqleton_cmds.QueryObserver,
+	sqlConnectionLayer *values.SectionValues,
+	dbtConnectionLayer *values.SectionValues,
+) error {
+	minInterval, err := watch.ParseInterval(ss.StreamMin)
+	if err != nil {
+		return err
+	}
+
+	dirs := []string{}
+	for _, repositoryPath := range s.repositories {
+		dir := os.ExpandEnv(repositoryPath)
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	repository, err := served.Factory(queryObservers...)(dirs)
+	if err != nil {
+		return errors.Wrap(err, "could not load commands for streaming")
+	}
+	repositories_ := []*repositories.Repository{repository}
+
+	handler := stream.NewHandler(
+		func(path string) (cmds.Command, bool) {
+			return sqleton_cmds.FindRepositoryCommand(repositories_, path)
+		},
+		stream.WithMinInterval(minInterval),
+		stream.WithMiddlewares(sources.FromMap(map[string]map[string]interface{}{
+			sqlConnectionLayer.Section.GetSlug(): sqlConnectionLayer.Fields.ToMap(),
+			dbtConnectionLayer.Section.GetSlug(): dbtConnectionLayer.Fields.ToMap(),
+		}, fields.WithSource("serve"))),
+	)
+	server_.Group.GET("/stream/*", handler.Handle)
+	return nil
+}
+
+// servedRepositories collects the repositories loaded by serve, so that federated
+// commands can run the commands served next to them as sources.
+type servedRepositories struct {
+	mu           sync.Mutex
+	repositories []*repositories.Repository
+}
+
+// Factory returns a repository factory that adds the repositories it creates.
+func (r *servedRepositories) Factory(queryObservers ...sqleton_cmds.QueryObserver) handlers.RepositoryFactory {
+	factory := sqleton_cmds.NewRepositoryFactory(r.Lookup, queryObservers...)
+	return func(dirs []string) (*repositories.Repository, error) {
+		repository, err := factory(dirs)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		// a reloaded config file creates new repositories, which take precedence
+		r.repositories = append([]*repositories.Repository{repository}, r.repositories...)
+		return repository, nil
+	}
+}
+
+// Lookup finds a command in the served repositories.
+func (r *servedRepositories) Lookup(path string) (cmds.Command, bool) {
+	r.mu.Lock()
+	repositories_ := r.repositories
+	r.mu.Unlock()
+	return sqleton_cmds.FindRepositoryCommand(repositories_, path)
+}
+
+// cliOnlyHelpersFilter keeps the sql helpers that only make sense in a terminal, such
+// as --watch, out of the parameters that clients can set.
+func cliOnlyHelpersFilter() config.ParameterFilterOption {
+	return config.WithBlacklistLayerParameters(flags.SqlHelpersSlug, flags.CLIOnlySqlHelpers...)
+}
+
+// cliOnlyHelpersMiddleware is cliOnlyHelpersFilter as a post middleware. The query
+// handlers of parka v0.6 only run the last middlewares they are given, which are the
+// post middlewares, and skip the parameter filter.
+func cliOnlyHelpersMiddleware() sources.Middleware {
+	return sources.BlacklistSectionFields(map[string][]string{
+		flags.SqlHelpersSlug: flags.CLIOnlySqlHelpers,
+	})
+}
+
+// connectionMiddleware sets the connection of serve on the served commands. Like
+// cliOnlyHelpersMiddleware, it repeats the parameter filter as a post middleware.
+func connectionMiddleware(sections ...*values.SectionValues) sources.Middleware {
+	valuesForSections := map[string]map[string]interface{}{}
+	for _, section := range sections {
+		valuesForSections[section.Section.GetSlug()] = section.Fields.ToMap()
+	}
+	return sources.FromMap(valuesForSections, fields.WithSource("serve"))
+}
+
+// auditCallerMiddleware identifies the HTTP caller for the audit log, using the basic auth
+// user or the user header set by an authenticating proxy, and falling back to the remote address.
+func auditCallerMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		user := ""
+		if username, _, ok := req.BasicAuth(); ok {
+			user = username
+		}
+		for _, header := range []string{"X-Forwarded-User", "X-Remote-User"} {
+			if user == "" {
+				user = req.Header.Get(header)
+			}
+		}
+		if user == "" {
+			user = c.RealIP()
+		}
+		c.SetRequest(req.WithContext(audit.WithCaller(req.Context(), audit.OriginHTTP, user)))
+		return next(c)
+	}
+}
+
+// NextCursorTrailer is the response trailer holding the cursor of the next page of
+// a paginated command, to pass as its after parameter.
+const NextCursorTrailer = "X-Sqleton-Next-Cursor"
+
+// nextCursorMiddleware sets the NextCursorTrailer when a paginated command returns a
+// full page. It is a trailer rather than a header because the handlers start
+// writing the response before the query runs.
+func nextCursorMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Add("Trailer", NextCursorTrailer)
+		req := c.Request()
+		ctx := sqleton_cmds.ContextWithQueryObservers(req.Context(),
+			sqleton_cmds.QueryObserverFunc(func(_ context.Context, execution *sqleton_cmds.QueryExecution) {
+				if execution.NextCursor != "" {
+					c.Response().Header().Set(NextCursorTrailer, execution.NextCursor)
+				}
+			}))
+		c.SetRequest(req.WithContext(ctx))
+		return next(c)
+	}
+}
+
 // runConfigFileHandler runs the config file handler and the server.
 // The config file handler will watch the config file for changes and reload the server.
 // The server will run until the context is canceled (which can be done through Ctrl-C).
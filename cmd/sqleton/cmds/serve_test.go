@@ -0,0 +1,170 @@
+package cmds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	generic_command "github.com/go-go-golems/parka/pkg/handlers/generic-command"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func serveData(t *testing.T, handler *generic_command.GenericCommandHandler, command cmds.Command, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	err := auditCallerMiddleware(nextCursorMiddleware(func(c echo.Context) error {
+		return handler.ServeData(c, command)
+	}))(c)
+	require.NoError(t, err)
+	require.NoError(t, ctx.Err(), "the request didn't return")
+	return rec
+}
+
+func TestServeIgnoresWatchAndSnapshot(t *testing.T) {
+	command, err := cmds2.NewSqlCommand(
+		cmds.NewCommandDescription("widgets"),
+		cmds2.WithDbConnectionFactory(func(_ context.Context, _ *values.Values) (*sqlx.DB, error) {
+			db, err := sqlx.Connect("sqlite3", ":memory:")
+			if err != nil {
+				return nil, err
+			}
+			_, err = db.Exec("CREATE TABLE widgets (name TEXT); INSERT INTO widgets VALUES ('bolt')")
+			return db, err
+		}),
+		cmds2.WithQuery("SELECT name FROM widgets"),
+	)
+	require.NoError(t, err)
+
+	handler, err := generic_command.NewGenericCommandHandler(
+		generic_command.WithPostMiddlewares(cliOnlyHelpersMiddleware()),
+		generic_command.WithParameterFilterOptions(cliOnlyHelpersFilter()),
+	)
+	require.NoError(t, err)
+
+	rec := serveData(t, handler, command, "/data/widgets?watch=1s&watch-deltas=true&snapshot=before")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `[{"name": "bolt"}]`, rec.Body.String())
+}
+
+func TestServeRunsTheCommandSourcesOfFederatedCommands(t *testing.T) {
+	dir := t.TempDir()
+	database := filepath.Join(dir, "shop.db")
+	db, err := sqlx.Connect("sqlite3", database)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE widgets (name TEXT, price REAL); INSERT INTO widgets VALUES ('bolt', 1.5), ('nut', 0.5)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	queries := filepath.Join(dir, "queries")
+	require.NoError(t, os.MkdirAll(queries, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(queries, "widgets.sql"), []byte(`/* sqleton
+name: widgets
+short: List widgets
+*/
+SELECT name, price FROM widgets
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(queries, "cheap.sql"), []byte(`/* sqleton
+name: cheap
+short: List cheap widgets
+sources:
+  - name: w
+    command: widgets
+*/
+SELECT name FROM w WHERE price < 1
+`), 0o644))
+
+	served := &servedRepositories{}
+	_, err = served.Factory()([]string{queries})
+	require.NoError(t, err)
+	command, ok := served.Lookup("cheap")
+	require.True(t, ok)
+
+	sqlConnectionSection, err := sql.NewSqlConnectionParameterLayer()
+	require.NoError(t, err)
+	serveValues := values.New()
+	require.NoError(t, sources.Execute(
+		schema.NewSchema(schema.WithSections(sqlConnectionSection)),
+		serveValues,
+		sources.FromMap(map[string]map[string]interface{}{
+			sql.SqlConnectionSlug: {"db-type": "sqlite", "database": database},
+		}),
+		sources.FromDefaults(),
+	))
+	sqlConnectionValues, ok := serveValues.Get(sql.SqlConnectionSlug)
+	require.True(t, ok)
+
+	handler, err := generic_command.NewGenericCommandHandler(
+		generic_command.WithPostMiddlewares(connectionMiddleware(sqlConnectionValues)),
+	)
+	require.NoError(t, err)
+
+	rec := serveData(t, handler, command, "/data/cheap")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `[{"name": "nut"}]`, rec.Body.String())
+}
+
+func TestServeReturnsTheNextCursorOfPaginatedCommands(t *testing.T) {
+	database := filepath.Join(t.TempDir(), "shop.db")
+	db, err := sqlx.Connect("sqlite3", database)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO widgets (name) VALUES ('bolt'), ('nut'), ('screw')")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	spec, err := cmds2.ParseSQLFileSpec("widgets.sql", []byte(`/* sqleton
+name: widgets
+short: List widgets
+paginate-by: id
+flags:
+  - name: limit
+    type: int
+    default: 2
+  - name: after
+    type: string
+*/
+SELECT id, name FROM widgets
+WHERE 1=1
+{{ if .after }}  AND id > '{{ .after | sqlEscape }}'{{ end }}
+ORDER BY id
+LIMIT {{ .limit }}
+`))
+	require.NoError(t, err)
+	compiler := &cmds2.SqlCommandCompiler{
+		DBConnectionFactory: func(_ context.Context, _ *values.Values) (*sqlx.DB, error) {
+			return sqlx.Connect("sqlite3", database)
+		},
+	}
+	command, err := compiler.Compile(spec)
+	require.NoError(t, err)
+
+	handler, err := generic_command.NewGenericCommandHandler()
+	require.NoError(t, err)
+
+	rec := serveData(t, handler, command, "/data/widgets")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `[{"id": 1, "name": "bolt"}, {"id": 2, "name": "nut"}]`, rec.Body.String())
+	cursor := rec.Result().Trailer.Get(NextCursorTrailer)
+	require.Equal(t, "2", cursor)
+
+	rec = serveData(t, handler, command, "/data/widgets?after="+cursor)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.JSONEq(t, `[{"id": 3, "name": "screw"}]`, rec.Body.String())
+	require.Empty(t, rec.Result().Trailer.Get(NextCursorTrailer))
+}
@@ -0,0 +1,200 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+const (
+	shellPrompt             = "sqleton> "
+	shellContinuationPrompt = "      -> "
+)
+
+type ShellCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory sql.DBConnectionFactory
+	commandLookup       sqleton_cmds.CommandLookup
+	queryObservers      []sqleton_cmds.QueryObserver
+}
+
+var _ cmds.BareCommand = (*ShellCommand)(nil)
+
+type ShellSettings struct {
+	HistoryFile string `glazed:"history-file"`
+}
+
+func NewShellCommand(
+	dbConnectionFactory sql.DBConnectionFactory,
+	commandLookup sqleton_cmds.CommandLookup,
+	queryObservers []sqleton_cmds.QueryObserver,
+	options ...cmds.CommandDescriptionOption,
+) (*ShellCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, err
+	}
+	sqlAttachSection, err := flags.NewSqlAttachParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Run SQL statements and repository commands interactively"),
+		cmds.WithLong(`Run SQL statements and repository commands interactively, on a
+single connection that is opened once for the whole session.
+
+Statements end with a semicolon and can span several lines. Their rows are
+output like the rows of the other commands, in the format given by the glazed
+flags, which \format changes. \run runs a repository command with its flags:
+
+  sqleton> \format csv
+  sqleton> \run mysql ps --db foo
+
+\d lists the tables, \d TABLE the columns of a table, and \? all the commands.
+When the input is not a terminal, the statements are read from it and the shell
+stops at the first error:
+
+  echo "SELECT COUNT(*) FROM orders;" | sqleton shell --profile shop`),
+		cmds.WithFlags(
+			fields.New(
+				"history-file",
+				fields.TypeString,
+				fields.WithHelp("File the line history is kept in (default: sqleton/shell_history in the user config directory)"),
+			),
+		),
+		cmds.WithSections(glazedSection, sqlAttachSection),
+	}, options...)
+
+	return &ShellCommand{
+		CommandDescription:  cmds.NewCommandDescription("shell", options_...),
+		dbConnectionFactory: dbConnectionFactory,
+		commandLookup:       commandLookup,
+		queryObservers:      queryObservers,
+	}, nil
+}
+
+func (c *ShellCommand) Run(ctx context.Context, parsedValues *values.Values) error {
+	s := &ShellSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	glazedValues, ok := parsedValues.Get(settings.GlazedSlug)
+	if !ok {
+		return errors.New("glazed section not found")
+	}
+
+	db, connection, err := sqleton_cmds.OpenDatabase(ctx, c.dbConnectionFactory, parsedValues)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	session := &shellSession{
+		db:           db,
+		parsedValues: parsedValues,
+		connection:   connection,
+		glazedValues: glazedValues,
+		lookup:       c.commandLookup,
+		observers:    append(append([]sqleton_cmds.QueryObserver{}, c.queryObservers...), sqleton_cmds.QueryObserversFromContext(ctx)...),
+		out:          os.Stdout,
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return session.RunScript(ctx, os.Stdin)
+	}
+
+	historyFile := s.HistoryFile
+	if historyFile == "" {
+		historyFile, err = DefaultShellHistoryFile()
+		if err != nil {
+			return err
+		}
+	}
+	history, err := openShellHistory(historyFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = history.Close()
+	}()
+
+	return runShellTerminal(ctx, fd, session, history)
+}
+
+// runShellTerminal reads the lines of the session with a line editor. The
+// terminal is only in raw mode while a line is edited: the statements run with
+// the terminal restored, so that their output is written as is, and ctrl-c
+// cancels the running statement instead of the shell.
+func runShellTerminal(ctx context.Context, fd int, session *shellSession, history *shellHistory) error {
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return errors.Wrap(err, "could not set the terminal to raw mode")
+	}
+	defer func() {
+		_ = term.Restore(fd, state)
+	}()
+
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, shellPrompt)
+	terminal.History = history
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		_ = terminal.SetSize(width, height)
+	}
+	_, _ = fmt.Fprintln(terminal, `Type \? for help, \q or ctrl-d to quit.`)
+
+	for {
+		if session.Pending() {
+			terminal.SetPrompt(shellContinuationPrompt)
+		} else {
+			terminal.SetPrompt(shellPrompt)
+		}
+		line, err := terminal.ReadLine()
+		if err == io.EOF {
+			_, _ = fmt.Fprintln(terminal)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := term.Restore(fd, state); err != nil {
+			return err
+		}
+		runCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		err = session.HandleLine(runCtx, line)
+		stop()
+		if errors.Is(err, errShellQuit) {
+			return nil
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		if _, err := term.MakeRaw(fd); err != nil {
+			return errors.Wrap(err, "could not set the terminal to raw mode")
+		}
+	}
+}
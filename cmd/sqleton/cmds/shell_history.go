@@ -0,0 +1,106 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxShellHistory is the number of lines kept in the shell history.
+const maxShellHistory = 1000
+
+// DefaultShellHistoryFile returns sqleton/shell_history in the user config directory.
+func DefaultShellHistoryFile() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "could not determine user config directory")
+	}
+	return filepath.Join(configDir, "sqleton", "shell_history"), nil
+}
+
+// shellHistory is the line history of sqleton shell, used by the line editor
+// (it implements term.History). Every line is appended to a file, so that the
+// history is kept across sessions.
+type shellHistory struct {
+	entries []string
+	file    *os.File
+}
+
+// openShellHistory loads the last lines of the history file at path, and opens
+// it to append new lines. The history is only kept in memory when path is empty.
+func openShellHistory(path string) (*shellHistory, error) {
+	ret := &shellHistory{}
+	if path == "" {
+		return ret, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "could not read shell history")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			ret.entries = append(ret.entries, line)
+		}
+	}
+	truncated := len(ret.entries) > maxShellHistory
+	if truncated {
+		ret.entries = ret.entries[len(ret.entries)-maxShellHistory:]
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, errors.Wrap(err, "could not create shell history directory")
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if truncated {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	ret.file, err = os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open shell history")
+	}
+	if truncated {
+		for _, entry := range ret.entries {
+			if _, err := fmt.Fprintln(ret.file, entry); err != nil {
+				return nil, errors.Wrap(err, "could not write shell history")
+			}
+		}
+	}
+	return ret, nil
+}
+
+// Add adds a line to the history, unless it is blank or repeats the last line.
+func (h *shellHistory) Add(entry string) {
+	if strings.TrimSpace(entry) == "" || strings.Contains(entry, "\n") {
+		return
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxShellHistory {
+		h.entries = h.entries[1:]
+	}
+	if h.file != nil {
+		_, _ = fmt.Fprintln(h.file, entry)
+	}
+}
+
+func (h *shellHistory) Len() int {
+	return len(h.entries)
+}
+
+// At returns the idx-th most recent line.
+func (h *shellHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+func (h *shellHistory) Close() error {
+	if h.file == nil {
+		return nil
+	}
+	return h.file.Close()
+}
@@ -0,0 +1,345 @@
+package cmds
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const shellHelp = `SQL statements end with a semicolon, and can span several lines.
+
+  \d               list the tables and views
+  \d TABLE         list the columns of TABLE
+  \format          show the output format
+  \format FORMAT [TABLE-FORMAT]
+                   output the rows as FORMAT (table, csv, json, yaml, ...)
+  \run COMMAND [FLAGS...]
+                   run a repository command, e.g. \run mysql ps --db foo
+  \run COMMAND --help
+                   show the flags of a repository command
+  \r               discard the statement being typed
+  \?               show this help
+  \q               quit
+`
+
+// errShellQuit is returned by shellSession.HandleLine when the user quits.
+var errShellQuit = errors.New("quit")
+
+// shellSession runs the input of sqleton shell on a single connection: SQL
+// statements, which end with a semicolon, and backslash commands. The rows are
+// written to out with the glazed settings of the session, whose output format
+// can be changed with \format.
+type shellSession struct {
+	db           *sqlx.DB
+	parsedValues *values.Values
+	// connection describes db for the query observers
+	connection   string
+	glazedValues *values.SectionValues
+	lookup       sqleton_cmds.CommandLookup
+	observers    []sqleton_cmds.QueryObserver
+	out          io.Writer
+
+	statement strings.Builder
+}
+
+// Pending returns true when a statement has been started, but not yet ended by a
+// semicolon.
+func (s *shellSession) Pending() bool {
+	return s.statement.Len() > 0
+}
+
+// HandleLine handles a line of input. The statement is run once a line ends with
+// a semicolon. It returns errShellQuit on \q.
+func (s *shellSession) HandleLine(ctx context.Context, line string) error {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, `\`) {
+		return s.runBackslashCommand(ctx, trimmed)
+	}
+	if trimmed == "" && !s.Pending() {
+		return nil
+	}
+
+	s.statement.WriteString(line)
+	s.statement.WriteString("\n")
+	if !strings.HasSuffix(trimmed, ";") {
+		return nil
+	}
+	return s.Flush(ctx)
+}
+
+// Flush runs the pending statement, if any.
+func (s *shellSession) Flush(ctx context.Context) error {
+	query := strings.TrimSpace(s.statement.String())
+	s.statement.Reset()
+	query = strings.TrimSpace(strings.TrimRight(query, ";"))
+	if query == "" {
+		return nil
+	}
+	return s.RunQuery(ctx, query)
+}
+
+// RunScript handles the lines read from r, for example when the input of the
+// shell is not a terminal. It stops at the first error.
+func (s *shellSession) RunScript(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		err := s.HandleLine(ctx, scanner.Text())
+		if errors.Is(err, errShellQuit) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return s.Flush(ctx)
+}
+
+// RunQuery runs an ad-hoc statement and outputs its rows.
+func (s *shellSession) RunQuery(ctx context.Context, query string) error {
+	execution := sqleton_cmds.NewQueryExecution("shell", s.parsedValues)
+	execution.Query = query
+	execution.Connection = s.connection
+	rows := 0
+	err := s.withProcessor(ctx, func(gp middlewares.Processor) error {
+		counter := sqleton_cmds.NewRowCountingProcessor(gp)
+		defer func() {
+			rows = counter.Rows()
+		}()
+		return sql.RunQueryIntoGlaze(ctx, s.db, query, nil, counter)
+	})
+	execution.Finish(s.db, rows, err)
+	sqleton_cmds.NotifyQueryObservers(ctx, s.observers, execution)
+	return err
+}
+
+// withProcessor calls f with a processor that outputs the rows it is given in
+// the current format.
+func (s *shellSession) withProcessor(ctx context.Context, f func(gp middlewares.Processor) error) error {
+	gp, err := settings.SetupTableProcessor(s.glazedValues)
+	if err != nil {
+		return err
+	}
+	_, err = settings.SetupProcessorOutput(gp, s.glazedValues, s.out)
+	if err != nil {
+		return err
+	}
+	if err := f(gp); err != nil {
+		return err
+	}
+	return gp.Close(ctx)
+}
+
+func (s *shellSession) runBackslashCommand(ctx context.Context, line string) error {
+	args, err := splitShellArgs(line)
+	if err != nil {
+		return err
+	}
+	name, args := args[0], args[1:]
+
+	switch name {
+	case `\q`, `\quit`:
+		return errShellQuit
+	case `\?`, `\h`, `\help`:
+		_, err := fmt.Fprint(s.out, shellHelp)
+		return err
+	case `\r`, `\reset`:
+		s.statement.Reset()
+		return nil
+	case `\format`:
+		return s.setFormat(args)
+	case `\d`:
+		return s.describe(ctx, args)
+	case `\run`:
+		return s.runCommand(ctx, args)
+	default:
+		return errors.Errorf(`unknown command %s, \? lists the commands`, name)
+	}
+}
+
+// setFormat changes the output format, and the table format if given. Without
+// arguments, it prints the current format.
+func (s *shellSession) setFormat(args []string) error {
+	keys := []string{"output", "table-format"}
+	if len(args) == 0 {
+		output := s.glazedValues.Fields.GetValue("output")
+		if output == "table" {
+			_, err := fmt.Fprintf(s.out, "%v (%v)\n", output, s.glazedValues.Fields.GetValue("table-format"))
+			return err
+		}
+		_, err := fmt.Fprintln(s.out, output)
+		return err
+	}
+	if len(args) > len(keys) {
+		return errors.New(`usage: \format FORMAT [TABLE-FORMAT]`)
+	}
+
+	// check all the values before changing any of them
+	for i, arg := range args {
+		v, ok := s.glazedValues.Fields.Get(keys[i])
+		if !ok {
+			return errors.Errorf("the %s setting is missing", keys[i])
+		}
+		if _, err := v.Definition.CheckValueValidity(arg); err != nil {
+			return errors.Wrapf(err, "invalid %s", keys[i])
+		}
+	}
+	for i, arg := range args {
+		if _, err := s.glazedValues.Fields.UpdateExistingValue(keys[i], arg, fields.WithSource("shell")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe lists the tables of the database, or the columns of a table.
+func (s *shellSession) describe(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New(`usage: \d [TABLE]`)
+	}
+	catalog_, err := catalog.New(s.db)
+	if err != nil {
+		return err
+	}
+
+	return s.withProcessor(ctx, func(gp middlewares.Processor) error {
+		if len(args) == 0 {
+			tables, err := catalog_.Tables(ctx)
+			if err != nil {
+				return err
+			}
+			for _, table := range tables {
+				if err := gp.AddRow(ctx, tableRow(table)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		_, columns, err := catalog_.Columns(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if err := gp.AddRow(ctx, columnRow(column)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// runCommand runs a repository command on the connection of the shell.
+func (s *shellSession) runCommand(ctx context.Context, args []string) error {
+	if s.lookup == nil {
+		return errors.New("no repository commands are loaded")
+	}
+	command, path, args, err := s.findCommand(args)
+	if err != nil {
+		return err
+	}
+	cliPath := strings.ReplaceAll(path, "/", " ")
+
+	sqlCommand, ok := command.(*sqleton_cmds.SqlCommand)
+	if !ok {
+		return errors.Errorf("%s is not a SQL command, run it with sqleton %s", cliPath, cliPath)
+	}
+	if len(sqlCommand.Sources) > 0 {
+		return errors.Errorf("%s queries other connections, run it with sqleton %s", cliPath, cliPath)
+	}
+
+	parsedValues, usage, err := sqleton_cmds.ParseCommandArgs(command, args)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse the flags of %s", cliPath)
+	}
+	if parsedValues == nil {
+		_, err := fmt.Fprint(s.out, usage)
+		return err
+	}
+
+	return s.withProcessor(ctx, func(gp middlewares.Processor) error {
+		return sqlCommand.RunIntoGlazeProcessorWithDB(ctx, s.db, parsedValues.GetDataMap(), gp)
+	})
+}
+
+// findCommand looks up the command named by the arguments before the first flag,
+// such as mysql ps in mysql ps --db foo. The longest of them that names a command
+// is used, the rest are its arguments.
+func (s *shellSession) findCommand(args []string) (cmds.Command, string, []string, error) {
+	words := 0
+	for words < len(args) && !strings.HasPrefix(args[words], "-") {
+		words++
+	}
+	if words == 0 {
+		return nil, "", nil, errors.New(`\run needs a command, e.g. \run mysql ps --db foo`)
+	}
+
+	for i := words; i > 0; i-- {
+		path := strings.Join(args[:i], "/")
+		if command, ok := s.lookup(path); ok {
+			return command, path, args[i:], nil
+		}
+	}
+	return nil, "", nil, errors.Errorf("unknown command %s", strings.Join(args[:words], " "))
+}
+
+// splitShellArgs splits a line into words at spaces. Single and double quotes
+// group words, and a backslash escapes the next character inside double quotes.
+func splitShellArgs(line string) ([]string, error) {
+	ret := []string{}
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' {
+				escaped = true
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				ret = append(ret, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		ret = append(ret, word.String())
+	}
+	return ret, nil
+}
@@ -0,0 +1,215 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	cmds2 "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+const shellTestCommand = `/* sqleton
+name: orders
+short: List the orders of a status
+flags:
+  - name: status
+    type: string
+    default: open
+*/
+SELECT id FROM orders WHERE status = '{{ .status }}' ORDER BY id
+`
+
+func newTestShellSession(t *testing.T) (*shellSession, *bytes.Buffer, *[]*cmds2.QueryExecution) {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	for _, statement := range []string{
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT NOT NULL)",
+		"INSERT INTO orders VALUES (1, 'open'), (2, 'paid'), (3, 'open')",
+	} {
+		_, err := db.Exec(statement)
+		require.NoError(t, err)
+	}
+
+	spec, err := cmds2.ParseSQLFileSpec("orders.sql", []byte(shellTestCommand))
+	require.NoError(t, err)
+	ordersCommand, err := (&cmds2.SqlCommandCompiler{}).Compile(spec, cmds.WithParents("shop"))
+	require.NoError(t, err)
+
+	shellCommand, err := NewShellCommand(nil, nil, nil)
+	require.NoError(t, err)
+	parsedValues, err := runner.ParseCommandValues(shellCommand, runner.WithValuesForSections(
+		map[string]map[string]interface{}{settings.GlazedSlug: {"output": "csv"}},
+	))
+	require.NoError(t, err)
+	glazedValues, ok := parsedValues.Get(settings.GlazedSlug)
+	require.True(t, ok)
+
+	out := &bytes.Buffer{}
+	executions := []*cmds2.QueryExecution{}
+	session := &shellSession{
+		db:           db,
+		parsedValues: parsedValues,
+		glazedValues: glazedValues,
+		lookup: func(path string) (cmds.Command, bool) {
+			if path == "shop/orders" {
+				return ordersCommand, true
+			}
+			return nil, false
+		},
+		observers: []cmds2.QueryObserver{cmds2.QueryObserverFunc(func(ctx context.Context, execution *cmds2.QueryExecution) {
+			executions = append(executions, execution)
+		})},
+		out: out,
+	}
+	return session, out, &executions
+}
+
+func handleLines(t *testing.T, session *shellSession, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		require.NoError(t, session.HandleLine(context.Background(), line), line)
+	}
+}
+
+func TestShellStatements(t *testing.T) {
+	session, out, executions := newTestShellSession(t)
+
+	handleLines(t, session, "SELECT id, status", "FROM orders")
+	require.True(t, session.Pending())
+	require.Empty(t, out.String())
+	handleLines(t, session, "WHERE status = 'open';")
+	require.False(t, session.Pending())
+	require.Equal(t, "id,status\n1,open\n3,open\n", out.String())
+
+	require.Len(t, *executions, 1)
+	execution := (*executions)[0]
+	require.Equal(t, "shell", execution.Command)
+	require.Equal(t, "SELECT id, status\nFROM orders\nWHERE status = 'open'", execution.Query)
+	require.Equal(t, 2, execution.Rows)
+
+	out.Reset()
+	handleLines(t, session, `\format json`, "SELECT COUNT(*) AS n FROM orders;", `\format`)
+	require.JSONEq(t, `[{"n": 3}]`, strings.TrimSuffix(out.String(), "json\n"))
+	require.True(t, strings.HasSuffix(out.String(), "json\n"))
+
+	out.Reset()
+	handleLines(t, session, "SELECT 1", `\r`, "SELECT 2 AS x;")
+	require.Equal(t, "[\n{\n  \"x\": 2\n}\n]\n", out.String())
+
+	err := session.HandleLine(context.Background(), "SELECT * FROM missing;")
+	require.ErrorContains(t, err, "no such table: missing")
+	require.Error(t, (*executions)[len(*executions)-1].Err)
+
+	require.ErrorContains(t, session.HandleLine(context.Background(), `\format xml`), "invalid output")
+	require.EqualError(t, session.HandleLine(context.Background(), `\nope`), `unknown command \nope, \? lists the commands`)
+	require.ErrorIs(t, session.HandleLine(context.Background(), `\q`), errShellQuit)
+}
+
+func TestShellDescribe(t *testing.T) {
+	session, out, _ := newTestShellSession(t)
+
+	handleLines(t, session, `\d`)
+	require.Equal(t, "name,type\norders,table\n", out.String())
+
+	out.Reset()
+	handleLines(t, session, `\d orders`)
+	require.Equal(t, "position,name,type,nullable,default,primary_key\n"+
+		"1,id,INTEGER,true,<nil>,true\n"+
+		"2,status,TEXT,false,<nil>,false\n", out.String())
+}
+
+func TestShellRun(t *testing.T) {
+	session, out, _ := newTestShellSession(t)
+
+	handleLines(t, session, `\run shop orders`)
+	require.Equal(t, "id\n1\n3\n", out.String())
+
+	out.Reset()
+	handleLines(t, session, `\run shop/orders --status "paid"`)
+	require.Equal(t, "id\n2\n", out.String())
+
+	out.Reset()
+	handleLines(t, session, `\run shop orders --help`)
+	require.Contains(t, out.String(), "List the orders of a status")
+	require.Contains(t, out.String(), "--status")
+
+	for line, expected := range map[string]string{
+		`\run`:                          `\run needs a command, e.g. \run mysql ps --db foo`,
+		`\run shop`:                     "unknown command shop",
+		`\run shop orders --bogus`:      "could not parse the flags of shop orders: unknown flag: --bogus",
+		`\run shop orders --status 'a`:  "unterminated ' quote",
+		`\run shop orders extra ignore`: "could not parse the flags of shop orders",
+	} {
+		require.ErrorContains(t, session.HandleLine(context.Background(), line), expected, line)
+	}
+}
+
+func TestShellScript(t *testing.T) {
+	session, out, _ := newTestShellSession(t)
+
+	script := "\\format csv\nSELECT id FROM orders\nWHERE id > 1;\n\nSELECT 'last' AS x"
+	require.NoError(t, session.RunScript(context.Background(), strings.NewReader(script)))
+	require.Equal(t, "id\n2\n3\nx\nlast\n", out.String())
+
+	out.Reset()
+	require.NoError(t, session.RunScript(context.Background(), strings.NewReader("\\q\nSELECT 1;")))
+	require.Empty(t, out.String())
+}
+
+func TestSplitShellArgs(t *testing.T) {
+	for line, expected := range map[string][]string{
+		`\run mysql ps --db foo`:        {`\run`, "mysql", "ps", "--db", "foo"},
+		`\run  a   --x "b c" 'd "e"'`:   {`\run`, "a", "--x", "b c", `d "e"`},
+		`\run a --x="b \"c\""`:          {`\run`, "a", `--x=b "c"`},
+		`\run a --x ''`:                 {`\run`, "a", "--x", ""},
+		`\d`:                            {`\d`},
+		`\run a --like 'x\y'`:           {`\run`, "a", "--like", `x\y`},
+		"\\format\tcsv":                 {`\format`, "csv"},
+		`\run a --where "status = 'a'"`: {`\run`, "a", "--where", "status = 'a'"},
+	} {
+		args, err := splitShellArgs(line)
+		require.NoError(t, err, line)
+		require.Equal(t, expected, args, line)
+	}
+
+	_, err := splitShellArgs(`\run a "b`)
+	require.EqualError(t, err, `unterminated " quote`)
+}
+
+func TestShellHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sqleton", "shell_history")
+	history, err := openShellHistory(path)
+	require.NoError(t, err)
+	for _, line := range []string{"SELECT 1;", "", "SELECT 1;", `\d`} {
+		history.Add(line)
+	}
+	require.Equal(t, 2, history.Len())
+	require.Equal(t, `\d`, history.At(0))
+	require.Equal(t, "SELECT 1;", history.At(1))
+	require.NoError(t, history.Close())
+
+	history, err = openShellHistory(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, history.Len())
+	require.Equal(t, `\d`, history.At(0))
+	for i := 0; i < maxShellHistory+5; i++ {
+		history.Add(strings.Repeat("x", i+1))
+	}
+	require.Equal(t, maxShellHistory, history.Len())
+	require.NoError(t, history.Close())
+
+	history, err = openShellHistory(path)
+	require.NoError(t, err)
+	require.Equal(t, maxShellHistory, history.Len())
+	require.Equal(t, strings.Repeat("x", maxShellHistory+5), history.At(0))
+	require.NoError(t, history.Close())
+}
@@ -0,0 +1,276 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewSnapshotCommand creates the snapshot command group. The repositories are used to
+// re-run the command a snapshot was taken from when diffing against a fresh run.
+func NewSnapshotCommand(
+	repositories_ []*repositories.Repository,
+	options ...cmds.CommandDescriptionOption,
+) (*cobra.Command, error) {
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "List and compare result snapshots stored with --snapshot",
+	}
+
+	listCommand, err := NewSnapshotListCommand()
+	if err != nil {
+		return nil, err
+	}
+	cobraListCommand, err := sqleton_cmds.BuildCobraCommandWithSqletonMiddlewares(listCommand)
+	if err != nil {
+		return nil, err
+	}
+	snapshotCmd.AddCommand(cobraListCommand)
+
+	diffCommand, err := NewSnapshotDiffCommand(repositories_, options...)
+	if err != nil {
+		return nil, err
+	}
+	cobraDiffCommand, err := sqleton_cmds.BuildCobraCommandWithSqletonMiddlewares(diffCommand)
+	if err != nil {
+		return nil, err
+	}
+	snapshotCmd.AddCommand(cobraDiffCommand)
+
+	return snapshotCmd, nil
+}
+
+type SnapshotListCommand struct {
+	*cmds.CommandDescription
+}
+
+var _ cmds.GlazeCommand = (*SnapshotListCommand)(nil)
+
+type SnapshotListSettings struct {
+	Name string `glazed:"name"`
+}
+
+func NewSnapshotListCommand() (*SnapshotListCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	return &SnapshotListCommand{
+		CommandDescription: cmds.NewCommandDescription(
+			"ls",
+			cmds.WithShort("List stored snapshots"),
+			cmds.WithArguments(
+				fields.New(
+					"name",
+					fields.TypeString,
+					fields.WithHelp("Only list the snapshots stored under this name"),
+				),
+			),
+			cmds.WithSections(glazedSection),
+		),
+	}, nil
+}
+
+func (c *SnapshotListCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &SnapshotListSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	store, err := snapshots.NewDefaultStore()
+	if err != nil {
+		return err
+	}
+
+	names := []string{s.Name}
+	if s.Name == "" {
+		names, err = store.Names()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		history, err := store.History(name)
+		if err != nil {
+			return err
+		}
+		for i, path := range history {
+			snapshot, err := snapshots.Load(path)
+			if err != nil {
+				return err
+			}
+			ref := name
+			if back := len(history) - 1 - i; back > 0 {
+				ref = fmt.Sprintf("%s~%d", name, back)
+			}
+			row := types.NewRow(
+				types.MRP("ref", ref),
+				types.MRP("created_at", snapshot.CreatedAt),
+				types.MRP("command", snapshot.Command),
+				types.MRP("rows", len(snapshot.Rows)),
+				types.MRP("parameters", snapshot.Parameters),
+				types.MRP("file", filepath.Base(path)),
+			)
+			if err := gp.AddRow(ctx, row); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type SnapshotDiffCommand struct {
+	*cmds.CommandDescription
+	repositories []*repositories.Repository
+}
+
+var _ cmds.GlazeCommand = (*SnapshotDiffCommand)(nil)
+
+type SnapshotDiffSettings struct {
+	From string   `glazed:"from"`
+	To   string   `glazed:"to"`
+	Key  []string `glazed:"key"`
+}
+
+func NewSnapshotDiffCommand(
+	repositories_ []*repositories.Repository,
+	options ...cmds.CommandDescriptionOption,
+) (*SnapshotDiffCommand, error) {
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create glazed section")
+	}
+
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Compare two snapshots, or a snapshot against a fresh run"),
+		cmds.WithLong(`Compare two snapshots, or a snapshot against a fresh run.
+
+Snapshots are referenced by name (the latest snapshot), name~N (the Nth
+snapshot before the latest) or by file path. When only one snapshot is given,
+the command it was taken from is run again with the same parameters, using the
+connection settings passed to this command.
+
+Rows are matched by the --key columns. Without a key, whole rows are compared
+and only added and removed rows are reported.`),
+		cmds.WithArguments(
+			fields.New(
+				"from",
+				fields.TypeString,
+				fields.WithHelp("The snapshot to compare from"),
+				fields.WithRequired(true),
+			),
+			fields.New(
+				"to",
+				fields.TypeString,
+				fields.WithHelp("The snapshot to compare to (default: a fresh run)"),
+			),
+		),
+		cmds.WithFlags(
+			fields.New(
+				"key",
+				fields.TypeStringList,
+				fields.WithHelp("Columns identifying a row"),
+			),
+		),
+		cmds.WithSections(glazedSection),
+	}, options...)
+
+	return &SnapshotDiffCommand{
+		CommandDescription: cmds.NewCommandDescription("diff", options_...),
+		repositories:       repositories_,
+	}, nil
+}
+
+func (c *SnapshotDiffCommand) RunIntoGlazeProcessor(
+	ctx context.Context,
+	parsedValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	s := &SnapshotDiffSettings{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+
+	store, err := snapshots.NewDefaultStore()
+	if err != nil {
+		return err
+	}
+
+	from, err := store.Resolve(s.From)
+	if err != nil {
+		return err
+	}
+
+	var to *snapshots.Snapshot
+	if s.To != "" {
+		to, err = store.Resolve(s.To)
+	} else {
+		to, err = c.runFresh(ctx, parsedValues, from)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := snapshots.Diff(from, to, s.Key)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runFresh runs the repository command the snapshot was taken from, with the stored
+// parameters and the connection settings of the diff command itself.
+func (c *SnapshotDiffCommand) runFresh(
+	ctx context.Context,
+	parsedValues *values.Values,
+	from *snapshots.Snapshot,
+) (*snapshots.Snapshot, error) {
+	command, ok := sqleton_cmds.FindRepositoryCommand(c.repositories, from.Command)
+	if !ok {
+		return nil, errors.Errorf(
+			"snapshot %s was taken from %s, which is not a repository command, pass a second snapshot to compare to",
+			from.Name, from.Command)
+	}
+	glazeCommand, ok := command.(cmds.GlazeCommand)
+	if !ok {
+		return nil, errors.Errorf("command %s does not produce rows", from.Command)
+	}
+
+	commandValues, err := sqleton_cmds.RepositoryCommandValues(command, from.Parameters, parsedValues)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse stored parameters for %s", from.Command)
+	}
+
+	recorder := snapshots.NewRecorder(nil)
+	if err := glazeCommand.RunIntoGlazeProcessor(ctx, commandValues, recorder); err != nil {
+		return nil, errors.Wrapf(err, "could not run %s", from.Command)
+	}
+
+	return recorder.Snapshot(from.Name, from.Command, from.Parameters), nil
+}
@@ -0,0 +1,74 @@
+package cmds
+
+import (
+	"context"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/tui"
+	"github.com/jmoiron/sqlx"
+)
+
+type TuiCommand struct {
+	*cmds.CommandDescription
+	dbConnectionFactory sql.DBConnectionFactory
+	repositories        []*repositories.Repository
+}
+
+var _ cmds.BareCommand = (*TuiCommand)(nil)
+
+func NewTuiCommand(
+	dbConnectionFactory sql.DBConnectionFactory,
+	repositories_ []*repositories.Repository,
+	options ...cmds.CommandDescriptionOption,
+) (*TuiCommand, error) {
+	sqlAttachSection, err := flags.NewSqlAttachParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+	options_ := append([]cmds.CommandDescriptionOption{
+		cmds.WithShort("Browse and run the repository commands in a terminal UI"),
+		cmds.WithLong(`Browse and run the repository commands in a terminal UI.
+
+The SQL commands of the repositories are listed by directory. The flags of the
+selected command are edited in a form, while its query is rendered as they
+change. Running the command shows its rows in a table, which can be scrolled,
+sorted by a column and exported to a file. All the commands run on the
+connection given by the connection flags or --profile.`),
+		cmds.WithSections(sqlAttachSection),
+	}, options...)
+
+	return &TuiCommand{
+		CommandDescription:  cmds.NewCommandDescription("tui", options_...),
+		dbConnectionFactory: dbConnectionFactory,
+		repositories:        repositories_,
+	}, nil
+}
+
+func (c *TuiCommand) Run(ctx context.Context, parsedValues *values.Values) error {
+	db, err := c.dbConnectionFactory(ctx, parsedValues)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	commands := []cmds.Command{}
+	for _, repository := range c.repositories {
+		commands = append(commands, repository.CollectCommands([]string{}, true)...)
+	}
+
+	program := tea.NewProgram(tui.NewModel(ctx, db, commands), tea.WithAltScreen(), tea.WithContext(ctx))
+	_, err = program.Run()
+	return err
+}
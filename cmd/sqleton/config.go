@@ -8,18 +8,29 @@ import (
 	"strings"
 
 	glazed_config "github.com/go-go-golems/glazed/pkg/config"
+	"github.com/go-go-golems/sqleton/pkg/audit"
+	"github.com/go-go-golems/sqleton/pkg/history"
+	"github.com/go-go-golems/sqleton/pkg/mcpserver"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
 const (
 	sqletonRepositoriesEnvVar = "SQLETON_REPOSITORIES"
+	sqletonAuditLogEnvVar     = "SQLETON_AUDIT_LOG"
 	localSqletonConfigFile    = ".sqleton.yml"
 	localSqletonOverrideFile  = ".sqleton.override.yml"
 )
 
 type AppConfigBlock struct {
-	Repositories []string `yaml:"repositories"`
+	Repositories []string        `yaml:"repositories"`
+	Audit        audit.Config    `yaml:"audit,omitempty"`
+	History      *history.Config `yaml:"history,omitempty"`
+	MCP          MCPConfig       `yaml:"mcp,omitempty"`
+}
+
+type MCPConfig struct {
+	Tools *mcpserver.ToolsConfig `yaml:"tools,omitempty"`
 }
 
 type AppConfig struct {
@@ -74,6 +85,16 @@ func loadAppConfigFromResolvedFiles(files []glazed_config.ResolvedConfigFile) (*
 			return nil, err
 		}
 		repositoryPaths = append(repositoryPaths, cfg.RepositoryPaths()...)
+		// later (more local) config files override the audit settings of earlier ones
+		if cfg.App.Audit.Enabled() {
+			merged.App.Audit = cfg.App.Audit
+		}
+		if cfg.App.History != nil {
+			merged.App.History = cfg.App.History
+		}
+		if cfg.App.MCP.Tools != nil {
+			merged.App.MCP.Tools = merged.App.MCP.Tools.Merge(cfg.App.MCP.Tools)
+		}
 	}
 
 	merged.App.Repositories = normalizeRepositoryPaths(repositoryPaths)
@@ -120,6 +141,44 @@ func collectRepositoryPaths(appName string) ([]string, error) {
 	return normalizeRepositoryPaths(repositoryPaths), nil
 }
 
+// collectAuditConfig returns the audit log settings from the app config files,
+// overridden by the SQLETON_AUDIT_LOG environment variable.
+func collectAuditConfig(appName string) (*audit.Config, error) {
+	cfg, err := loadAppConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := cfg.App.Audit
+	if value, ok := os.LookupEnv(sqletonAuditLogEnvVar); ok && value != "" {
+		ret = audit.Config{Path: value}
+	}
+	return &ret, nil
+}
+
+// collectHistoryConfig returns the query history settings from the app config
+// files. The history is kept unless a config file disables it.
+func collectHistoryConfig(appName string) (*history.Config, error) {
+	cfg, err := loadAppConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.App.History == nil {
+		return &history.Config{}, nil
+	}
+	return cfg.App.History, nil
+}
+
+// collectMCPToolsConfig returns the app.mcp.tools settings from the app config files,
+// selecting the commands exposed by mcp serve.
+func collectMCPToolsConfig(appName string) (*mcpserver.ToolsConfig, error) {
+	cfg, err := loadAppConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.App.MCP.Tools, nil
+}
+
 func repositoriesFromEnv() []string {
 	value, ok := os.LookupEnv(sqletonRepositoriesEnvVar)
 	if !ok || value == "" {
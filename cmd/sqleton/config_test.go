@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	glazed_config "github.com/go-go-golems/glazed/pkg/config"
 	"github.com/stretchr/testify/require"
 )
 
@@ -167,3 +168,87 @@ func scrubGitEnv(env []string) []string {
 	}
 	return ret
 }
+
+func TestLoadAppConfigFromResolvedFilesLaterAuditConfigWins(t *testing.T) {
+	tmpDir := t.TempDir()
+	userConfig := filepath.Join(tmpDir, "user.yaml")
+	localConfig := filepath.Join(tmpDir, "local.yaml")
+	noAuditConfig := filepath.Join(tmpDir, "no-audit.yaml")
+
+	require.NoError(t, os.WriteFile(userConfig, []byte("app:\n  audit:\n    path: /var/log/sqleton/audit.jsonl\n"), 0o644))
+	require.NoError(t, os.WriteFile(localConfig, []byte("app:\n  audit:\n    path: ./audit.db\n    format: sqlite\n"), 0o644))
+	require.NoError(t, os.WriteFile(noAuditConfig, []byte("app:\n  repositories:\n    - /tmp/repo\n"), 0o644))
+
+	cfg, err := loadAppConfigFromResolvedFiles([]glazed_config.ResolvedConfigFile{
+		{Path: userConfig},
+		{Path: localConfig},
+		{Path: noAuditConfig},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "./audit.db", cfg.App.Audit.Path)
+	require.Equal(t, "sqlite", cfg.App.Audit.Format)
+	require.Equal(t, []string{"/tmp/repo"}, cfg.RepositoryPaths())
+}
+
+func TestLoadAppConfigFromResolvedFilesLaterHistoryConfigWins(t *testing.T) {
+	tmpDir := t.TempDir()
+	userConfig := filepath.Join(tmpDir, "user.yaml")
+	localConfig := filepath.Join(tmpDir, "local.yaml")
+	noHistoryConfig := filepath.Join(tmpDir, "no-history.yaml")
+
+	require.NoError(t, os.WriteFile(userConfig, []byte("app:\n  history:\n    path: /tmp/history.db\n"), 0o644))
+	require.NoError(t, os.WriteFile(localConfig, []byte("app:\n  history:\n    disabled: true\n"), 0o644))
+	require.NoError(t, os.WriteFile(noHistoryConfig, []byte("app:\n  repositories:\n    - /tmp/repo\n"), 0o644))
+
+	cfg, err := loadAppConfigFromResolvedFiles([]glazed_config.ResolvedConfigFile{
+		{Path: userConfig},
+		{Path: noHistoryConfig},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/tmp/history.db", cfg.App.History.Path)
+	require.False(t, cfg.App.History.Disabled)
+
+	cfg, err = loadAppConfigFromResolvedFiles([]glazed_config.ResolvedConfigFile{
+		{Path: userConfig},
+		{Path: localConfig},
+		{Path: noHistoryConfig},
+	})
+	require.NoError(t, err)
+	require.True(t, cfg.App.History.Disabled)
+}
+
+func TestLoadAppConfigFromResolvedFilesMergesMCPTools(t *testing.T) {
+	tmpDir := t.TempDir()
+	userConfig := filepath.Join(tmpDir, "user.yaml")
+	localConfig := filepath.Join(tmpDir, "local.yaml")
+
+	require.NoError(t, os.WriteFile(userConfig, []byte(`app:
+  mcp:
+    tools:
+      tags: [safe]
+      exclude-directories: [admin]
+      overrides:
+        mysql/ps:
+          name: list_processes
+`), 0o644))
+	require.NoError(t, os.WriteFile(localConfig, []byte(`app:
+  mcp:
+    tools:
+      tags: [reports]
+      overrides:
+        mysql/kill:
+          description: Kill a query
+`), 0o644))
+
+	cfg, err := loadAppConfigFromResolvedFiles([]glazed_config.ResolvedConfigFile{
+		{Path: userConfig},
+		{Path: localConfig},
+	})
+	require.NoError(t, err)
+	tools := cfg.App.MCP.Tools
+	require.NotNil(t, tools)
+	require.Equal(t, []string{"reports"}, tools.Tags)
+	require.Equal(t, []string{"admin"}, tools.ExcludeDirectories)
+	require.Equal(t, "list_processes", tools.Overrides["mysql/ps"].Name)
+	require.Equal(t, "Kill a query", tools.Overrides["mysql/kill"].Description)
+}
@@ -23,8 +23,10 @@ import (
 	parka_doc "github.com/go-go-golems/parka/pkg/doc"
 	"github.com/go-go-golems/sqleton/cmd/sqleton/cmds"
 	"github.com/go-go-golems/sqleton/cmd/sqleton/cmds/mcp"
+	"github.com/go-go-golems/sqleton/pkg/audit"
 	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
 	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/history"
 	"github.com/pkg/errors"
 	"github.com/pkg/profile"
 	"github.com/rs/zerolog/log"
@@ -43,6 +45,26 @@ var version = "dev"
 var profiler interface {
 	Stop()
 }
+var auditor *audit.Auditor
+var historyRecorder *history.Recorder
+
+// historyPath is the sqlite database of the query history, see initQueryObservers.
+var historyPath string
+
+// queryObservers are handed to every command that runs queries, see initQueryObservers.
+var queryObservers []sqleton_cmds.QueryObserver
+
+// queryConnectionFactory opens the configured connection, or the files passed to
+// --attach for the commands that have the sql-attach section.
+var queryConnectionFactory = sqleton_cmds.WithAttachedFiles(sql.OpenDatabaseFromDefaultSqlConnectionLayer)
+
+// loadedRepositories are the repositories of the sqleton commands, in which the
+// command sources of federated commands are looked up.
+var loadedRepositories []*repositories.Repository
+
+func findRepositoryCommand(path string) (glazed_cmds.Command, bool) {
+	return sqleton_cmds.FindRepositoryCommand(loadedRepositories, path)
+}
 
 var rootCmd = &cobra.Command{
 	Use:   "sqleton",
@@ -70,6 +92,12 @@ var rootCmd = &cobra.Command{
 			log.Info().Msg("Stopping memory profiler")
 			profiler.Stop()
 		}
+		if auditor != nil {
+			_ = auditor.Close()
+		}
+		if historyRecorder != nil {
+			_ = historyRecorder.Close()
+		}
 	},
 	Version: version,
 }
@@ -94,7 +122,10 @@ var runCommandCmd = &cobra.Command{
 		commandArgs := args[1:]
 
 		loader := &sqleton_cmds.SqlCommandLoader{
-			DBConnectionFactory: sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+			DBConnectionFactory: queryConnectionFactory,
+			QueryObservers:      queryObservers,
+			CommandLookup:       findRepositoryCommand,
+			AttachFiles:         true,
 		}
 		fs_, resolvedPath, err := loaders.FileNameToFsFilePath(filePath)
 		if err != nil {
@@ -168,7 +199,22 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 		return err
 	}
 
-	runCommand, err := cmds.NewRunCommand(sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+	err = cmds.AddDbSchemaCommands(sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		glazed_cmds.WithSections(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+
+	queryObservers, err = initQueryObservers()
+	if err != nil {
+		return err
+	}
+
+	runCommand, err := cmds.NewRunCommand(queryConnectionFactory,
+		queryObservers,
 		glazed_cmds.WithSections(
 			dbtParameterLayer,
 			sqlConnectionParameterLayer,
@@ -183,7 +229,8 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 	}
 	rootCmd.AddCommand(cobraRunCommand)
 
-	selectCommand, err := cmds.NewSelectCommand(sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+	selectCommand, err := cmds.NewSelectCommand(queryConnectionFactory,
+		queryObservers,
 		glazed_cmds.WithSections(
 			dbtParameterLayer,
 			sqlConnectionParameterLayer,
@@ -199,8 +246,21 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 	}
 	rootCmd.AddCommand(cobraSelectCommand)
 
+	repositoryPaths, err := collectRepositoryPaths("sqleton")
+	if err != nil {
+		return err
+	}
+
+	defaultDirectory := "$HOME/.sqleton/queries"
+	_, err = os.Stat(os.ExpandEnv(defaultDirectory))
+	if err == nil {
+		repositoryPaths = append(repositoryPaths, os.ExpandEnv(defaultDirectory))
+	}
+
 	queryCommand, err := cmds.NewQueryCommand(
-		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		queryConnectionFactory,
+		repositoryPaths,
+		queryObservers,
 		glazed_cmds.WithSections(
 			dbtParameterLayer,
 			sqlConnectionParameterLayer,
@@ -214,19 +274,28 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 	}
 	rootCmd.AddCommand(cobraQueryCommand)
 
-	repositoryPaths, err := collectRepositoryPaths("sqleton")
+	shellCommand, err := cmds.NewShellCommand(
+		queryConnectionFactory,
+		findRepositoryCommand,
+		queryObservers,
+		glazed_cmds.WithSections(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
 	if err != nil {
 		return err
 	}
-
-	defaultDirectory := "$HOME/.sqleton/queries"
-	_, err = os.Stat(os.ExpandEnv(defaultDirectory))
-	if err == nil {
-		repositoryPaths = append(repositoryPaths, os.ExpandEnv(defaultDirectory))
+	cobraShellCommand, err := buildSqletonCobraCommand(shellCommand)
+	if err != nil {
+		return err
 	}
+	rootCmd.AddCommand(cobraShellCommand)
 
 	loader := &sqleton_cmds.SqlCommandLoader{
-		DBConnectionFactory: sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		DBConnectionFactory: queryConnectionFactory,
+		QueryObservers:      queryObservers,
+		CommandLookup:       findRepositoryCommand,
+		AttachFiles:         true,
 	}
 	directories := []repositories.Directory{
 		{
@@ -258,25 +327,119 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 			repositories.WithCommandLoader(loader),
 		),
 	}
+	loadedRepositories = repositories_
 
 	allCommands, err := repositories.LoadRepositories(
 		helpSystem,
 		rootCmd,
 		repositories_,
 		cli.WithParserConfig(sqleton_cmds.NewSqletonParserConfig()),
-		cli.WithCobraShortHelpSections(schema.DefaultSlug, sql.DbtSlug, sql.SqlConnectionSlug, flags.SqlHelpersSlug),
+		cli.WithCobraShortHelpSections(schema.DefaultSlug, sql.DbtSlug, sql.SqlConnectionSlug, flags.SqlHelpersSlug, flags.SqlAttachSlug),
 	)
 	if err != nil {
 		return err
 	}
 
 	// Create and add MCP commands
-	mcpCommands := mcp.NewMcpCommands(repositories_)
+	mcpToolsConfig, err := collectMCPToolsConfig("sqleton")
+	if err != nil {
+		return err
+	}
+	mcpCommands := mcp.NewMcpCommands(repositories_, version, queryObservers, mcpToolsConfig,
+		glazed_cmds.WithSections(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
 	mcpCommands.AddToRootCommand(rootCmd)
 
+	snapshotCmd, err := cmds.NewSnapshotCommand(repositories_,
+		glazed_cmds.WithSections(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(snapshotCmd)
+
+	historyCmd, err := cmds.NewHistoryCommand(historyPath, queryConnectionFactory, repositories_, repositoryPaths, queryObservers,
+		glazed_cmds.WithSections(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(historyCmd)
+
+	tuiCommand, err := cmds.NewTuiCommand(queryConnectionFactory, repositories_,
+		glazed_cmds.WithSections(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraTuiCommand, err := buildSqletonCobraCommand(tuiCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraTuiCommand)
+
+	fmtCommand, err := cmds.NewFmtCommand()
+	if err != nil {
+		return err
+	}
+	cobraFmtCommand, err := buildSqletonCobraCommand(fmtCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraFmtCommand)
+
+	migrateCommandsCommand, err := cmds.NewMigrateCommandsCommand()
+	if err != nil {
+		return err
+	}
+	cobraMigrateCommandsCommand, err := buildSqletonCobraCommand(migrateCommandsCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraMigrateCommandsCommand)
+
+	copyCommand, err := cmds.NewCopyCommand(sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		repositories_,
+		queryObservers,
+		glazed_cmds.WithSections(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraCopyCommand, err := buildSqletonCobraCommand(copyCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraCopyCommand)
+
+	loadCommand, err := cmds.NewLoadCommand(sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		glazed_cmds.WithSections(
+			dbtParameterLayer,
+			sqlConnectionParameterLayer,
+		))
+	if err != nil {
+		return err
+	}
+	cobraLoadCommand, err := buildSqletonCobraCommand(loadCommand)
+	if err != nil {
+		return err
+	}
+	rootCmd.AddCommand(cobraLoadCommand)
+
 	serveCommand, err := cmds.NewServeCommand(
 		sql.OpenDatabaseFromDefaultSqlConnectionLayer,
 		repositoryPaths,
+		queryObservers,
 	)
 	if err != nil {
 		return err
@@ -333,6 +496,43 @@ func initAllCommands(helpSystem *help.HelpSystem) error {
 	return nil
 }
 
+// initQueryObservers sets up the observers that every executed query is reported to:
+// the audit log, if one is configured in app.audit or SQLETON_AUDIT_LOG, and the query
+// history, unless app.history disables it.
+func initQueryObservers() ([]sqleton_cmds.QueryObserver, error) {
+	observers := []sqleton_cmds.QueryObserver{}
+
+	auditConfig, err := collectAuditConfig("sqleton")
+	if err != nil {
+		return nil, err
+	}
+	if auditConfig.Enabled() {
+		// like the history, the audit log is opened by the first query, not by
+		// commands such as --help
+		sink, err := audit.OpenLazySink(auditConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not open audit log")
+		}
+		auditor = audit.NewAuditor(sink)
+		observers = append(observers, auditor)
+	}
+
+	historyConfig, err := collectHistoryConfig("sqleton")
+	if err != nil {
+		return nil, err
+	}
+	historyPath, err = historyConfig.ResolvePath()
+	if err != nil {
+		return nil, err
+	}
+	if !historyConfig.Disabled {
+		historyRecorder = history.NewRecorder(historyPath)
+		observers = append(observers, historyRecorder)
+	}
+
+	return observers, nil
+}
+
 // sqletonInitialProfilesContent provides the default YAML content for a new sqleton profiles file.
 func sqletonInitialProfilesContent() string {
 	return `# Sqleton Profiles Configuration
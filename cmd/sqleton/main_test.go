@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,6 +13,7 @@ import (
 
 	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
 	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/sqlfmt"
 	"github.com/stretchr/testify/require"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -141,6 +143,149 @@ func TestConfiguredRepositoryDiscoveryFromConfigFileSmoke(t *testing.T) {
 	require.Equal(t, "gamma", rows[2]["name"])
 }
 
+func TestHistorySmoke(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	dbPath := filepath.Join(tmpDir, "history.db")
+
+	homeDir := filepath.Join(tmpDir, "home")
+	require.NoError(t, os.MkdirAll(homeDir, 0o755))
+	require.NoError(t, os.MkdirAll(repoDir, 0o755))
+
+	createSmokeSQLiteDB(t, dbPath)
+	writeSmokeCommandFile(t, filepath.Join(repoDir, "smoke-widgets.sql"))
+
+	run := func(args ...string) []map[string]interface{} {
+		args = append(args, "--output", "json")
+		return runSqletonJSONWithEnv(t, homeDir, map[string]string{"SQLETON_REPOSITORIES": repoDir}, args...)
+	}
+	connection := []string{"--db-type", "sqlite", "--database", dbPath}
+
+	require.Len(t, run(append([]string{"smoke-widgets", "--only-active"}, connection...)...), 2)
+	require.Len(t, run(append([]string{"query", "SELECT name FROM widgets WHERE id = 2"}, connection...)...), 1)
+
+	rows := run("history", "ls")
+	require.Len(t, rows, 2)
+	require.Equal(t, float64(2), rows[0]["id"])
+	require.Equal(t, "query", rows[0]["command"])
+	require.Equal(t, "SELECT name FROM widgets WHERE id = 2", rows[0]["query"])
+	require.Equal(t, "smoke-widgets", rows[1]["command"])
+	require.Equal(t, float64(2), rows[1]["rows"])
+
+	rows = run("history", "search", "ONLY_ACTIVE")
+	require.Len(t, rows, 1)
+	require.Equal(t, float64(1), rows[0]["id"])
+
+	rows = run("history", "show", "1")
+	require.Len(t, rows, 1)
+	require.Equal(t, map[string]interface{}{"only_active": true}, rows[0]["parameters"])
+
+	// repository commands are rendered again, so the new widget is returned
+	db, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO widgets (name, active) VALUES ('delta', 1)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	rows = run(append([]string{"history", "rerun", "1"}, connection...)...)
+	require.Len(t, rows, 3)
+	require.Equal(t, "delta", rows[2]["name"])
+
+	rows = run(append([]string{"history", "rerun", "2"}, connection...)...)
+	require.Equal(t, []map[string]interface{}{{"name": "beta"}}, rows)
+
+	rows = run("history", "ls", "--command", "query")
+	require.Len(t, rows, 2)
+	require.Equal(t, float64(4), rows[0]["id"])
+	require.Equal(t, "SELECT name FROM widgets WHERE id = 2", rows[0]["query"])
+}
+
+func TestQuerySaveAsSmoke(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	dbPath := filepath.Join(tmpDir, "smoke.db")
+
+	homeDir := filepath.Join(tmpDir, "home")
+	require.NoError(t, os.MkdirAll(homeDir, 0o755))
+	require.NoError(t, os.MkdirAll(repoDir, 0o755))
+
+	createSmokeSQLiteDB(t, dbPath)
+
+	run := func(args ...string) []map[string]interface{} {
+		args = append(args, "--output", "json", "--db-type", "sqlite", "--database", dbPath)
+		return runSqletonJSONWithEnv(t, homeDir, map[string]string{"SQLETON_REPOSITORIES": repoDir}, args...)
+	}
+
+	rows := run("query", "SELECT name FROM widgets WHERE id = 2",
+		"--save-as", "saved/widget", "--short", "Show a widget", "--parameterize")
+	require.Equal(t, []map[string]interface{}{{"name": "beta"}}, rows)
+	require.FileExists(t, filepath.Join(repoDir, "saved", "widget.sql"))
+
+	rows = run("saved", "widget")
+	require.Equal(t, []map[string]interface{}{{"name": "beta"}}, rows)
+	rows = run("saved", "widget", "--id", "3")
+	require.Equal(t, []map[string]interface{}{{"name": "gamma"}}, rows)
+}
+
+func TestMigrateCommandsSmoke(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	dbPath := filepath.Join(tmpDir, "smoke.db")
+
+	homeDir := filepath.Join(tmpDir, "home")
+	require.NoError(t, os.MkdirAll(homeDir, 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "legacy"), 0o755))
+
+	createSmokeSQLiteDB(t, dbPath)
+	err := os.WriteFile(filepath.Join(repoDir, "legacy", "widgets.yaml"), []byte(`name: widgets [name]
+short: List active widgets
+flags:
+  - name: name
+    type: string
+    default: gamma
+subqueries:
+  active: SELECT id FROM widgets WHERE active = 1
+query: |
+  SELECT name FROM widgets
+  WHERE id IN ({{ subQuery "active" }})
+  AND name = {{ .name | sqlString }}
+`), 0o644)
+	require.NoError(t, err)
+
+	env := map[string]string{"SQLETON_REPOSITORIES": repoDir}
+	rows := runSqletonJSONWithEnv(t, homeDir, env, "migrate-commands", repoDir, "--remove", "--output", "json")
+	require.Len(t, rows, 1)
+	require.Equal(t, "converted", rows[0]["status"])
+	require.NoFileExists(t, filepath.Join(repoDir, "legacy", "widgets.yaml"))
+
+	rows = runSqletonJSONWithEnv(t, homeDir, env, "legacy", "widgets",
+		"--output", "json", "--db-type", "sqlite", "--database", dbPath)
+	require.Equal(t, []map[string]interface{}{{"name": "gamma"}}, rows)
+}
+
+// TestEmbeddedQueriesAreFormatted keeps the embedded commands as sqleton fmt
+// writes them.
+func TestEmbeddedQueriesAreFormatted(t *testing.T) {
+	err := fs.WalkDir(queriesFS, "queries", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".sql" {
+			return err
+		}
+		contents, err := queriesFS.ReadFile(path)
+		require.NoError(t, err)
+		formatted, err := sqlfmt.FormatFile(path, contents, sqlfmt.Options{})
+		require.NoError(t, err)
+		require.Equal(t, string(formatted), string(contents), "run sqleton fmt cmd/sqleton/queries")
+		return nil
+	})
+	require.NoError(t, err)
+}
+
 func TestRunCommandExplicitConfigFileSmoke(t *testing.T) {
 	t.Parallel()
 
@@ -282,7 +427,8 @@ func runSqletonJSONWithEnv(t *testing.T, homeDir string, extraEnv map[string]str
 			strings.HasPrefix(e, "SQLETON_SCHEMA=") ||
 			strings.HasPrefix(e, "SQLETON_USE_DBT_PROFILES=") ||
 			strings.HasPrefix(e, "SQLETON_DBT_PROFILE=") ||
-			strings.HasPrefix(e, "SQLETON_DBT_PROFILES_PATH=") {
+			strings.HasPrefix(e, "SQLETON_DBT_PROFILES_PATH=") ||
+			strings.HasPrefix(e, "SQLETON_HISTORY_DB=") {
 			continue
 		}
 		env = append(env, e)
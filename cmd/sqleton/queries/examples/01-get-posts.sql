@@ -5,4 +5,3 @@ long: Show all posts and their ID
 */
 SELECT wp.ID, wp.post_title, wp.post_status FROM wp_posts wp
 WHERE post_type = 'post'
-
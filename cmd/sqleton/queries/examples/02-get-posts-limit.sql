@@ -6,17 +6,15 @@ flags:
   - name: limit
     shortFlag: l
     type: int
-    default: 10
     help: Limit the number of posts
+    default: 10
   - name: status
     type: stringList
     help: Select posts by status
-    required: false
 */
 SELECT wp.ID, wp.post_title, wp.post_status FROM wp_posts wp
 WHERE post_type = 'post'
 {{ if .status -}}
 AND post_status IN ({{ .status | sqlStringIn }})
 {{- end }}
-LIMIT {{ .limit }} 
-
+LIMIT {{ .limit }}
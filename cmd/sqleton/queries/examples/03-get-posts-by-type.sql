@@ -1,29 +1,27 @@
 /* sqleton
 name: ls-posts-type [types...]
-short: "Show all WP posts, limited, by type (default: post, page)"
+short: 'Show all WP posts, limited, by type (default: post, page)'
 long: Show all posts and their ID
 flags:
   - name: limit
     shortFlag: l
     type: int
-    default: 10
     help: Limit the number of posts
+    default: 10
   - name: status
     type: stringList
     help: Select posts by status
-    required: false
   - name: order_by
     type: string
-    default: post_date DESC
     help: Order by column
+    default: post_date DESC
 arguments:
   - name: types
     type: stringList
+    help: Select posts by type
     default:
       - post
       - page
-    help: Select posts by type
-    required: false
 */
 SELECT wp.ID, wp.post_title, wp.post_type, wp.post_status, wp.post_date FROM wp_posts wp
 WHERE post_type IN ({{ .types | sqlStringIn }})
@@ -32,4 +30,3 @@ AND post_status IN ({{ .status | sqlStringIn }})
 {{- end }}
 ORDER BY {{ .order_by }}
 LIMIT {{ .limit }}
-
@@ -4,4 +4,3 @@ short: Show full MySQL processlist
 long: SHOW FULL PROCESSLIST
 */
 SHOW FULL PROCESSLIST
-
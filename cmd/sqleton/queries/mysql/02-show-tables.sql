@@ -4,4 +4,3 @@ short: Show all tables in namespace
 long: SHOW TABLES
 */
 SHOW TABLES
-
@@ -16,8 +16,8 @@ flags:
     help: List of index name patterns to match
   - name: order_by
     type: string
-    default: table_name ASC
     help: Order by
+    default: table_name ASC
 */
 SELECT
   TABLE_NAME AS table_name,
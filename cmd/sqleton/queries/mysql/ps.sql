@@ -36,7 +36,10 @@ flags:
   - name: foobar
     type: intList
     help: Filter by foobar
-    default: [1, 2, 3]
+    default:
+      - 1
+      - 2
+      - 3
 */
 SELECT 
 Id,User,Host,db,Command,Time,State
@@ -72,4 +75,3 @@ AND host = {{ .hostname | sqlString }}
 {{ if .info_like -}}
 AND info LIKE {{ .info_like | sqlLike }}
 {{ end -}}
-
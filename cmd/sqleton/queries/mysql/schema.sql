@@ -73,4 +73,3 @@ WHERE 1=1
   AND COLUMN_TYPE = '{{ .type }}'
 {{ end }}
 ORDER BY table_name
-
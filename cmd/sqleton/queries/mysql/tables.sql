@@ -10,15 +10,28 @@ flags:
     help: List of tables
   - name: engine
     type: choiceList
-    choices: ['InnoDB', 'MyISAM', 'MEMORY', 'MERGE', 'ARCHIVE', 'FEDERATED', 'BLACKHOLE', 'CSV', 'NDB', 'PERFORMANCE_SCHEMA', 'TokuDB', 'RocksDB', 'Aria']
     help: Engine type
+    choices:
+      - InnoDB
+      - MyISAM
+      - MEMORY
+      - MERGE
+      - ARCHIVE
+      - FEDERATED
+      - BLACKHOLE
+      - CSV
+      - NDB
+      - PERFORMANCE_SCHEMA
+      - TokuDB
+      - RocksDB
+      - Aria
   - name: order_by
     type: string
-    default: TABLE_NAME ASC
     help: Order by
+    default: TABLE_NAME ASC
   - name: limit
-    help: Limit the number of results
     type: int
+    help: Limit the number of results
     default: 0
   - name: offset
     type: int
@@ -50,4 +63,3 @@ ORDER BY {{ .order_by }}
   OFFSET {{ .offset }}
 {{ end }}
 {{ end }}
-
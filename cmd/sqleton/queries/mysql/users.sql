@@ -13,8 +13,10 @@ flags:
     help: Username pattern for LIKE search
   - name: password_expired
     type: choice
-    choices: ['Y', 'N']
     help: Filter users by password expired status
+    choices:
+      - "Y"
+      - "N"
   - name: active_privileges
     type: stringList
     help: List of privileges to check if they are active (Y)
@@ -28,8 +30,8 @@ flags:
     default: 0
   - name: order_by
     type: string
-    default: User
     help: Order by column
+    default: User
 */
 SELECT
   User,
@@ -4,9 +4,12 @@ short: Get detailed column information from PostgreSQL tables
 flags:
   - name: detail_level
     type: choice
-    choices: [basic, standard, full]
-    default: standard
     help: Control the amount of column information returned
+    default: standard
+    choices:
+      - basic
+      - standard
+      - full
   - name: db_schema
     type: string
     help: Schema name to filter by
@@ -45,8 +48,8 @@ flags:
     default: true
   - name: order_by
     type: string
-    default: "table_schema, table_name, ordinal_position"
     help: Order results by specified columns
+    default: table_schema, table_name, ordinal_position
   - name: limit
     type: int
     help: Limit the number of results
@@ -142,4 +145,3 @@ ORDER BY {{ .order_by }}
     OFFSET {{ .offset }}
   {{ end }}
 {{ end }}
-
@@ -27,8 +27,8 @@ flags:
     default: 0
   - name: order_by
     type: string
-    default: backend_start DESC
     help: Order by
+    default: backend_start DESC
 tags:
   - pg
   - admin
@@ -69,4 +69,3 @@ ORDER BY {{ .order_by }}
     OFFSET {{ .offset }}
   {{ end }}
 {{ end }}
-
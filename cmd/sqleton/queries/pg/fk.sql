@@ -26,8 +26,8 @@ flags:
     help: Foreign column name to filter by
   - name: order_by
     type: string
-    default: tc.table_name, tc.constraint_name
     help: Order results by specified columns
+    default: tc.table_name, tc.constraint_name
   - name: limit
     type: int
     help: Limit the number of results
@@ -89,4 +89,3 @@ ORDER BY {{ .order_by }}
     OFFSET {{ .offset }}
   {{ end }}
 {{ end }}
-
@@ -28,4 +28,3 @@ flags:
   -- If no flags are provided, raise an error
   RAISE EXCEPTION 'You must provide either a pid, dbuser, or dbname';
 {{ end }}
-
@@ -21,8 +21,8 @@ flags:
     default: 0
   - name: order_by
     type: string
-    default: query_start DESC
     help: Order by
+    default: query_start DESC
 */
 {{ if .explain }}
   EXPLAIN
@@ -56,4 +56,3 @@ ORDER BY {{ .order_by }}
     OFFSET {{ .offset }}
   {{ end }}
 {{ end }}
-
@@ -29,8 +29,8 @@ flags:
     default: false
   - name: order_by
     type: string
-    default: table_name ASC
     help: Order results by specified columns
+    default: table_name ASC
   - name: limit
     type: int
     help: Limit the number of results
@@ -91,4 +91,3 @@ ORDER BY {{ .order_by }}
     OFFSET {{ .offset }}
   {{ end }}
 {{ end }}
-
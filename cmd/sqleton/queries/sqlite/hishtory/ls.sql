@@ -42,8 +42,8 @@ flags:
     type: stringList
     help: List of entry ids
   - name: limit
-    help: Limit the number of results
     type: int
+    help: Limit the number of results
     default: 10
   - name: offset
     type: int
@@ -51,12 +51,12 @@ flags:
     default: 0
   - name: order_by
     type: string
-    default: start_time DESC
     help: Order by
+    default: start_time DESC
   - name: verbose
     type: bool
-    default: false
     help: Display all columns
+    default: false
 */
 {{ if .explain }}EXPLAIN{{ end }}
 SELECT
@@ -89,4 +89,3 @@ WHERE 1=1
 {{ if .entry_id }}AND entry_id IN ({{ .entry_id | sqlStringIn }}){{ end }}
 ORDER BY {{ .order_by }}
 {{ if .limit }}LIMIT {{ .limit }}{{ if .offset }} OFFSET {{ .offset }}{{ end }}{{ end }}
-
@@ -18,8 +18,8 @@ flags:
     type: stringList
     help: List of column types to match using LIKE
   - name: limit
-    help: Limit the number of results
     type: int
+    help: Limit the number of results
     default: 0
   - name: offset
     type: int
@@ -27,8 +27,8 @@ flags:
     default: 0
   - name: order_by
     type: string
-    default: name ASC
     help: Order by
+    default: name ASC
 */
 {{ if .explain }}
   EXPLAIN
@@ -1,13 +1,13 @@
 /* sqleton
 name: ls-posts
-short: "Show all WP posts"
+short: Show all WP posts
 long: Show all posts and their ID
 flags:
   - name: limit
     shortFlag: l
     type: int
-    default: 10
     help: Limit the number of posts
+    default: 10
   - name: offset
     type: int
     help: Offset
@@ -15,63 +15,51 @@ flags:
   - name: status
     type: stringList
     help: Select posts by status
-    required: false
   - name: order_by
     type: string
     help: Order by column
   - name: ids
     type: intList
     help: Select posts by id
-    required: false
   - name: types
     type: stringList
+    help: Select posts by type
     default:
       - post
       - page
-    help: Select posts by type
-    required: false
   - name: body_like
     type: stringList
     help: Select posts by body
-    required: false
   - name: from
     type: date
     help: Select posts from date
-    required: false
   - name: to
     type: date
     help: Select posts to date
-    required: false
   - name: title_like
     type: string
     help: Select posts by title
-    required: false
   - name: slugs_like
     type: stringList
     help: Select posts by slug patterns
-    required: false
   - name: templates_like
     type: stringList
     help: Select posts by template patterns
-    required: false
   - name: slugs
     type: stringList
     help: Select posts by slug
-    required: false
   - name: templates
     type: stringList
     help: Select posts by template
-    required: false
   - name: group_by
     type: choiceList
+    help: Group and count posts by selected field
     choices:
       - status
       - type
       - template
       - date
       - slug
-    help: Group and count posts by selected field
-    required: false
 */
 {{ if not .group_by }}
 SELECT
@@ -155,4 +143,3 @@ GROUP BY {{ .group_by | join ", " }}
 LIMIT {{ .limit }}
 OFFSET {{ .offset }}
 {{ end }}
-
@@ -35,8 +35,8 @@ flags:
     type: stringList
     help: Post tags
   - name: limit
-    help: Limit the number of results
     type: int
+    help: Limit the number of results
     default: 5
   - name: offset
     type: int
@@ -44,8 +44,8 @@ flags:
     default: 0
   - name: order_by
     type: string
-    default: post_date DESC
     help: Order by
+    default: post_date DESC
 */
 {{ if .explain }}
     EXPLAIN
@@ -128,4 +128,3 @@ ORDER BY {{ .order_by }}
     OFFSET {{ .offset }}
 {{ end }}
 {{ end }}
-
@@ -3,9 +3,8 @@ name: posts-counts
 short: Count posts by type
 flags:
   - name: post_type
-    help: Post type
     type: stringList
-    required: false
+    help: Post type
 */
 SELECT
   post_type,
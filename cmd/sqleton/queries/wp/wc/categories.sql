@@ -15,8 +15,8 @@ flags:
     type: stringList
     help: List of names to match with LIKE
   - name: limit
-    help: Limit the number of results
     type: int
+    help: Limit the number of results
     default: 0
   - name: offset
     type: int
@@ -24,8 +24,8 @@ flags:
     default: 0
   - name: order_by
     type: string
-    default: tt.description DESC
     help: Order by
+    default: tt.description DESC
   - name: with_content
     type: bool
     help: Include content
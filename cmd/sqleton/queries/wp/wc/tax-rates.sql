@@ -21,8 +21,8 @@ flags:
     type: stringList
     help: Tax rate states
   - name: limit
-    help: Limit the number of results
     type: int
+    help: Limit the number of results
     default: 0
   - name: offset
     type: int
@@ -30,8 +30,8 @@ flags:
     default: 0
   - name: order_by
     type: string
-    default: tax_rate_id DESC
     help: Order by
+    default: tax_rate_id DESC
 */
 {{ if .explain }}
   EXPLAIN
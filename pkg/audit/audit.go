@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Entry is a single record in the audit log.
+type Entry struct {
+	Timestamp  time.Time              `json:"timestamp"`
+	User       string                 `json:"user"`
+	Origin     string                 `json:"origin"`
+	Profile    string                 `json:"profile,omitempty"`
+	Connection string                 `json:"connection,omitempty"`
+	Command    string                 `json:"command"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Query      string                 `json:"query"`
+	Rows       int                    `json:"rows"`
+	DurationMs float64                `json:"duration_ms"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Sink persists audit entries. Implementations need to be safe for concurrent use,
+// since serve runs commands from multiple goroutines.
+type Sink interface {
+	Write(ctx context.Context, entry *Entry) error
+	Close() error
+}
+
+const (
+	OriginCLI  = sqleton_cmds.OriginCLI
+	OriginHTTP = sqleton_cmds.OriginHTTP
+	OriginMCP  = sqleton_cmds.OriginMCP
+)
+
+// WithCaller attaches the identity of whoever triggered the queries run with ctx.
+// When no caller is set, the OS user is recorded with the cli origin.
+func WithCaller(ctx context.Context, origin string, user string) context.Context {
+	return sqleton_cmds.ContextWithCaller(ctx, origin, user)
+}
+
+// CallerFromContext returns the origin and the user set with WithCaller.
+func CallerFromContext(ctx context.Context) (string, string) {
+	return sqleton_cmds.CallerFromContext(ctx)
+}
+
+// CurrentUser returns the name of the OS user running sqleton.
+func CurrentUser() string {
+	return sqleton_cmds.CurrentUser()
+}
+
+// Auditor turns query executions into audit entries and hands them to a sink.
+type Auditor struct {
+	sink Sink
+}
+
+var _ sqleton_cmds.QueryObserver = (*Auditor)(nil)
+
+func NewAuditor(sink Sink) *Auditor {
+	return &Auditor{sink: sink}
+}
+
+func (a *Auditor) ObserveQuery(ctx context.Context, execution *sqleton_cmds.QueryExecution) {
+	origin, user := CallerFromContext(ctx)
+	entry := &Entry{
+		Timestamp:  execution.StartedAt.UTC(),
+		User:       user,
+		Origin:     origin,
+		Profile:    execution.Profile,
+		Connection: execution.Connection,
+		Command:    execution.Command,
+		Parameters: sqleton_cmds.RedactParameters(execution.Parameters),
+		Query:      execution.Query,
+		Rows:       execution.Rows,
+		DurationMs: float64(execution.Duration.Microseconds()) / 1000.0,
+	}
+	if execution.Err != nil {
+		entry.Error = execution.Err.Error()
+	}
+
+	// the query has already run at this point, so a failing audit sink is reported but
+	// does not turn the command into a failure.
+	if err := a.sink.Write(context.WithoutCancel(ctx), entry); err != nil {
+		log.Error().Err(err).Str("command", execution.Command).Msg("could not write audit log entry")
+	}
+}
+
+func (a *Auditor) Close() error {
+	return a.sink.Close()
+}
+
+const (
+	FormatJSONL  = "jsonl"
+	FormatSQLite = "sqlite"
+)
+
+// Config selects where audit entries are written. An empty Path disables auditing.
+type Config struct {
+	Path   string `yaml:"path"`
+	Format string `yaml:"format,omitempty"`
+}
+
+func (c *Config) Enabled() bool {
+	return c != nil && strings.TrimSpace(c.Path) != ""
+}
+
+// OpenSink opens the sink described by the config. When no format is given,
+// files ending in .db, .sqlite or .sqlite3 are written as sqlite databases and
+// everything else as JSON lines.
+func OpenSink(config *Config) (Sink, error) {
+	open, err := sinkOpener(config)
+	if err != nil {
+		return nil, err
+	}
+	return open()
+}
+
+// OpenLazySink checks the config like OpenSink, but only opens the sink when the
+// first entry is written, so that commands which don't run queries don't create
+// or lock the audit log.
+func OpenLazySink(config *Config) (Sink, error) {
+	open, err := sinkOpener(config)
+	if err != nil {
+		return nil, err
+	}
+	return &lazySink{open: open}, nil
+}
+
+func sinkOpener(config *Config) (func() (Sink, error), error) {
+	if !config.Enabled() {
+		return nil, errors.New("audit log path is not set")
+	}
+
+	path := os.ExpandEnv(strings.TrimSpace(config.Path))
+	format := config.Format
+	if format == "" {
+		format = FormatJSONL
+		lower := strings.ToLower(path)
+		for _, suffix := range []string{".db", ".sqlite", ".sqlite3"} {
+			if strings.HasSuffix(lower, suffix) {
+				format = FormatSQLite
+			}
+		}
+	}
+
+	switch format {
+	case FormatJSONL:
+		return func() (Sink, error) {
+			return NewJSONLSink(path)
+		}, nil
+	case FormatSQLite:
+		return func() (Sink, error) {
+			return NewSQLiteSink(path)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown audit log format %q", format)
+	}
+}
@@ -0,0 +1,230 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecution() *sqleton_cmds.QueryExecution {
+	return &sqleton_cmds.QueryExecution{
+		Command: "mysql/ps",
+		Parameters: map[string]interface{}{
+			"user_like": "app%",
+			"password":  "hunter2",
+		},
+		Query:      "SELECT * FROM information_schema.processlist",
+		Connection: "mysql://reporter@db:3306/app",
+		Profile:    "production",
+		Rows:       3,
+		StartedAt:  time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:   1500 * time.Microsecond,
+	}
+}
+
+func TestAuditorWritesJSONLEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	sink, err := OpenSink(&Config{Path: path})
+	require.NoError(t, err)
+	require.IsType(t, &JSONLSink{}, sink)
+
+	auditor := NewAuditor(sink)
+	ctx := WithCaller(context.Background(), OriginHTTP, "alice")
+	auditor.ObserveQuery(ctx, newTestExecution())
+
+	failed := newTestExecution()
+	failed.Err = errors.New("table not found")
+	auditor.ObserveQuery(context.Background(), failed)
+	require.NoError(t, auditor.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := Entry{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 2)
+
+	require.Equal(t, "alice", entries[0].User)
+	require.Equal(t, OriginHTTP, entries[0].Origin)
+	require.Equal(t, "production", entries[0].Profile)
+	require.Equal(t, "mysql/ps", entries[0].Command)
+	require.Equal(t, sqleton_cmds.RedactedValue, entries[0].Parameters["password"])
+	require.Equal(t, "app%", entries[0].Parameters["user_like"])
+	require.Equal(t, 3, entries[0].Rows)
+	require.Equal(t, 1.5, entries[0].DurationMs)
+	require.Empty(t, entries[0].Error)
+
+	require.Equal(t, OriginCLI, entries[1].Origin)
+	require.Equal(t, "table not found", entries[1].Error)
+}
+
+func TestAuditorWritesSQLiteEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	sink, err := OpenSink(&Config{Path: path})
+	require.NoError(t, err)
+	require.IsType(t, &SQLiteSink{}, sink)
+
+	auditor := NewAuditor(sink)
+	auditor.ObserveQuery(WithCaller(context.Background(), OriginMCP, "bob"), newTestExecution())
+	require.NoError(t, auditor.Close())
+
+	db, err := sqlx.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	row := struct {
+		User       string `db:"user"`
+		Origin     string `db:"origin"`
+		Command    string `db:"command"`
+		Connection string `db:"connection"`
+		Parameters string `db:"parameters"`
+		Rows       int    `db:"rows"`
+	}{}
+	require.NoError(t, db.Get(&row, "SELECT user, origin, command, connection, parameters, rows FROM audit_log"))
+	require.Equal(t, "bob", row.User)
+	require.Equal(t, OriginMCP, row.Origin)
+	require.Equal(t, "mysql/ps", row.Command)
+	require.Equal(t, "mysql://reporter@db:3306/app", row.Connection)
+	require.Contains(t, row.Parameters, sqleton_cmds.RedactedValue)
+	require.NotContains(t, row.Parameters, "hunter2")
+	require.Equal(t, 3, row.Rows)
+}
+
+// barrierProcessor holds each row until every execution has reached its row, so
+// that all the queries are rendered before any execution is reported.
+type barrierProcessor struct {
+	middlewares.Processor
+	arrived *sync.WaitGroup
+}
+
+func (p *barrierProcessor) AddRow(ctx context.Context, row types.Row) error {
+	p.arrived.Done()
+	p.arrived.Wait()
+	return p.Processor.AddRow(ctx, row)
+}
+
+// TestAuditorRecordsTheQueryOfEachConcurrentExecution runs a command from several
+// goroutines, as serve and MCP do, and checks that each entry holds the query of
+// its own execution. Run it with -race to catch executions sharing state.
+func TestAuditorRecordsTheQueryOfEachConcurrentExecution(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := OpenSink(&Config{Path: path})
+	require.NoError(t, err)
+	auditor := NewAuditor(sink)
+
+	const runs = 16
+	openDB := func(_ context.Context, _ *values.Values) (*sqlx.DB, error) {
+		db, err := sqlx.Connect("sqlite3", ":memory:")
+		if err != nil {
+			return nil, err
+		}
+		_, err = db.Exec("CREATE TABLE widgets (name TEXT)")
+		for i := 0; err == nil && i < runs; i++ {
+			_, err = db.Exec("INSERT INTO widgets VALUES (?)", fmt.Sprintf("widget-%d", i))
+		}
+		return db, err
+	}
+	command, err := sqleton_cmds.NewSqlCommand(
+		cmds.NewCommandDescription("widgets", cmds.WithFlags(fields.New("name", fields.TypeString))),
+		sqleton_cmds.WithDbConnectionFactory(openDB),
+		sqleton_cmds.WithQuery("SELECT name FROM widgets WHERE name = {{ .name | sqlString }}"),
+		sqleton_cmds.WithQueryObservers(auditor),
+	)
+	require.NoError(t, err)
+
+	var wg, arrived sync.WaitGroup
+	arrived.Add(runs)
+	errs := make(chan error, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			parsedValues, err := runner.ParseCommandValues(command, runner.WithValuesForSections(
+				map[string]map[string]interface{}{schema.DefaultSlug: {"name": name}},
+			))
+			if err != nil {
+				arrived.Done()
+				errs <- err
+				return
+			}
+			gp := middlewares.NewTableProcessor()
+			gp.AddTableMiddleware(&table.NullTableMiddleware{})
+			ctx := WithCaller(context.Background(), OriginHTTP, name)
+			errs <- command.RunIntoGlazeProcessor(ctx, parsedValues, &barrierProcessor{Processor: gp, arrived: &arrived})
+		}(fmt.Sprintf("widget-%d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.NoError(t, auditor.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	entries := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := Entry{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		require.Equal(t, fmt.Sprintf("SELECT name FROM widgets WHERE name = '%s'", entry.User), entry.Query)
+		require.Equal(t, entry.User, entry.Parameters["name"])
+		entries++
+	}
+	require.Equal(t, runs, entries)
+}
+
+func TestOpenSinkRejectsUnknownFormat(t *testing.T) {
+	_, err := OpenSink(&Config{Path: filepath.Join(t.TempDir(), "audit.log"), Format: "xml"})
+	require.Error(t, err)
+}
+
+func TestLazySinkOnlyCreatesTheLogOnTheFirstEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	sink, err := OpenLazySink(&Config{Path: path})
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err), "the audit log was created before any query ran")
+
+	auditor := NewAuditor(sink)
+	auditor.ObserveQuery(context.Background(), newTestExecution())
+	require.NoError(t, auditor.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"command":"mysql/ps"`)
+
+	_, err = OpenLazySink(&Config{Path: path, Format: "xml"})
+	require.Error(t, err)
+}
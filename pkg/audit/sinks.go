@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// JSONLSink appends every entry as a single JSON line to a file.
+type JSONLSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+var _ Sink = (*JSONLSink)(nil)
+
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, errors.Wrap(err, "could not create audit log directory")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open audit log")
+	}
+	return &JSONLSink{f: f}, nil
+}
+
+func (s *JSONLSink) Write(_ context.Context, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "could not encode audit entry")
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(data)
+	return err
+}
+
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+const createAuditTableQuery = `
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp TEXT NOT NULL,
+	user TEXT NOT NULL,
+	origin TEXT NOT NULL,
+	profile TEXT,
+	connection TEXT,
+	command TEXT NOT NULL,
+	parameters TEXT,
+	query TEXT,
+	rows INTEGER NOT NULL,
+	duration_ms REAL NOT NULL,
+	error TEXT
+)`
+
+// SQLiteSink writes entries into an audit_log table in a sqlite database,
+// creating the table if it doesn't exist.
+type SQLiteSink struct {
+	db *sqlx.DB
+}
+
+var _ Sink = (*SQLiteSink)(nil)
+
+func NewSQLiteSink(path string) (*SQLiteSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, errors.Wrap(err, "could not create audit log directory")
+	}
+	db, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open audit database")
+	}
+	// sqlite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(createAuditTableQuery); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "could not create audit_log table")
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+func (s *SQLiteSink) Write(ctx context.Context, entry *Entry) error {
+	parameters, err := json.Marshal(entry.Parameters)
+	if err != nil {
+		return errors.Wrap(err, "could not encode audit parameters")
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO audit_log (timestamp, user, origin, profile, connection, command, parameters, query, rows, duration_ms, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00"),
+		entry.User,
+		entry.Origin,
+		entry.Profile,
+		entry.Connection,
+		entry.Command,
+		string(parameters),
+		entry.Query,
+		entry.Rows,
+		entry.DurationMs,
+		entry.Error,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not insert audit entry")
+	}
+	return nil
+}
+
+func (s *SQLiteSink) Close() error {
+	return s.db.Close()
+}
+
+// lazySink opens its sink when the first entry is written. A sink that can't be
+// opened fails every write, which the auditor reports.
+type lazySink struct {
+	open func() (Sink, error)
+
+	mu   sync.Mutex
+	sink Sink
+	err  error
+}
+
+var _ Sink = (*lazySink)(nil)
+
+func (s *lazySink) Write(ctx context.Context, entry *Entry) error {
+	s.mu.Lock()
+	if s.sink == nil && s.err == nil {
+		s.sink, s.err = s.open()
+	}
+	sink, err := s.sink, s.err
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return sink.Write(ctx, entry)
+}
+
+func (s *lazySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sink == nil {
+		return nil
+	}
+	err := s.sink.Close()
+	s.sink = nil
+	return err
+}
@@ -0,0 +1,720 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Table is a table or view of the connected database.
+type Table struct {
+	Schema string `json:"schema,omitempty" yaml:"schema,omitempty" db:"table_schema"`
+	Name   string `json:"name" yaml:"name" db:"table_name"`
+	Type   string `json:"type" yaml:"type" db:"table_type"`
+}
+
+// QualifiedName returns schema.name, or just the name when the table has no schema.
+func (t Table) QualifiedName() string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+// Column is a column of a table.
+type Column struct {
+	Name       string  `json:"name" yaml:"name" db:"column_name"`
+	Position   int     `json:"position" yaml:"position" db:"ordinal_position"`
+	Type       string  `json:"type" yaml:"type" db:"data_type"`
+	Nullable   bool    `json:"nullable" yaml:"nullable" db:"is_nullable"`
+	Default    *string `json:"default,omitempty" yaml:"default,omitempty" db:"column_default"`
+	PrimaryKey bool    `json:"primary_key" yaml:"primary_key" db:"primary_key"`
+}
+
+// Index is an index of a table. Columns holds the indexed expression for indexes on
+// expressions. Primary keys are listed as unique indexes.
+type Index struct {
+	Name    string   `json:"name" yaml:"name"`
+	Columns []string `json:"columns" yaml:"columns"`
+	Unique  bool     `json:"unique" yaml:"unique"`
+	Primary bool     `json:"primary" yaml:"primary"`
+}
+
+// ForeignKey is a foreign key of a table. ReferencedSchema is empty when the
+// referenced table is in the same schema, or the database has no schemas.
+type ForeignKey struct {
+	Name              string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Columns           []string `json:"columns" yaml:"columns"`
+	ReferencedSchema  string   `json:"referenced_schema,omitempty" yaml:"referenced_schema,omitempty"`
+	ReferencedTable   string   `json:"referenced_table" yaml:"referenced_table"`
+	ReferencedColumns []string `json:"referenced_columns" yaml:"referenced_columns"`
+	OnUpdate          string   `json:"on_update,omitempty" yaml:"on_update,omitempty"`
+	OnDelete          string   `json:"on_delete,omitempty" yaml:"on_delete,omitempty"`
+}
+
+// ReferencedQualifiedName returns the referenced table, qualified with its schema if it has one.
+func (f ForeignKey) ReferencedQualifiedName() string {
+	return Table{Schema: f.ReferencedSchema, Name: f.ReferencedTable}.QualifiedName()
+}
+
+const (
+	TableTypeTable = "table"
+	TableTypeView  = "view"
+)
+
+// Dialects, as returned by Catalog.Dialect.
+const (
+	DialectSqlite   = "sqlite"
+	DialectMysql    = "mysql"
+	DialectPostgres = "postgres"
+	DialectDuckdb   = "duckdb"
+)
+
+// Catalog introspects the tables of a live database connection. The queries depend
+// on the driver of the connection: sqlite, mysql, postgres and duckdb are supported.
+type Catalog struct {
+	db          *sqlx.DB
+	dialect     dialect
+	dialectName string
+}
+
+type dialect interface {
+	tables(ctx context.Context, db *sqlx.DB) ([]Table, error)
+	// columns returns the columns of table, in order. The table has been resolved
+	// through tables, so it exists.
+	columns(ctx context.Context, db *sqlx.DB, table Table) ([]Column, error)
+	// indexes returns the indexes of table, primary key included.
+	indexes(ctx context.Context, db *sqlx.DB, table Table) ([]Index, error)
+	// foreignKeys returns the foreign keys of table, with their columns in order.
+	foreignKeys(ctx context.Context, db *sqlx.DB, table Table) ([]ForeignKey, error)
+}
+
+func New(db *sqlx.DB) (*Catalog, error) {
+	var d dialect
+	var name string
+	switch strings.ToLower(db.DriverName()) {
+	case "sqlite3", "sqlite":
+		d, name = sqliteDialect{}, DialectSqlite
+	case "mysql":
+		d, name = mysqlDialect{}, DialectMysql
+	case "pgx", "postgres", "postgresql":
+		d = postgresDialect{informationSchemaDialect{systemSchemas: []string{"pg_catalog", "information_schema"}}}
+		name = DialectPostgres
+	case "duckdb":
+		d = duckdbDialect{informationSchemaDialect{systemSchemas: []string{"information_schema", "pg_catalog"}}}
+		name = DialectDuckdb
+	default:
+		return nil, errors.Errorf("schema introspection is not supported for driver %s", db.DriverName())
+	}
+	return &Catalog{db: db, dialect: d, dialectName: name}, nil
+}
+
+// Dialect returns the SQL dialect of the database, one of the Dialect constants.
+func (c *Catalog) Dialect() string {
+	return c.dialectName
+}
+
+// Tables lists the tables and views of the database, leaving out system tables.
+func (c *Catalog) Tables(ctx context.Context) ([]Table, error) {
+	tables, err := c.dialect.tables(ctx, c.db)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list tables")
+	}
+	return tables, nil
+}
+
+// Table resolves name, which can be qualified with a schema (e.g. public.users).
+// An unqualified name that exists in several schemas is an error.
+func (c *Catalog) Table(ctx context.Context, name string) (*Table, error) {
+	tables, err := c.Tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Table
+	for _, table := range tables {
+		if table.Name == name || (table.Schema != "" && table.QualifiedName() == name) {
+			found = append(found, table)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, &TableNotFoundError{Name: name}
+	case 1:
+		return &found[0], nil
+	default:
+		names := make([]string, 0, len(found))
+		for _, table := range found {
+			names = append(names, table.QualifiedName())
+		}
+		return nil, errors.Errorf("table %s is ambiguous, use one of %s", name, strings.Join(names, ", "))
+	}
+}
+
+// Columns returns the columns of the table name, see Table.
+func (c *Catalog) Columns(ctx context.Context, name string) (*Table, []Column, error) {
+	table, err := c.Table(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := c.dialect.columns(ctx, c.db, *table)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not list columns of %s", name)
+	}
+	return table, columns, nil
+}
+
+// Indexes returns the indexes of the table name, see Table.
+func (c *Catalog) Indexes(ctx context.Context, name string) (*Table, []Index, error) {
+	table, err := c.Table(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexes, err := c.dialect.indexes(ctx, c.db, *table)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not list indexes of %s", name)
+	}
+	return table, indexes, nil
+}
+
+// ForeignKeys returns the foreign keys of the table name, see Table.
+func (c *Catalog) ForeignKeys(ctx context.Context, name string) (*Table, []ForeignKey, error) {
+	table, err := c.Table(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	foreignKeys, err := c.dialect.foreignKeys(ctx, c.db, *table)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not list foreign keys of %s", name)
+	}
+	return table, foreignKeys, nil
+}
+
+type TableNotFoundError struct {
+	Name string
+}
+
+func (e *TableNotFoundError) Error() string {
+	return "table " + e.Name + " not found"
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) tables(ctx context.Context, db *sqlx.DB) ([]Table, error) {
+	tables := []Table{}
+	err := db.SelectContext(ctx, &tables, `
+SELECT name AS table_name, type AS table_type
+FROM sqlite_master
+WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+ORDER BY name`)
+	return tables, err
+}
+
+func (sqliteDialect) columns(ctx context.Context, db *sqlx.DB, table Table) ([]Column, error) {
+	rows := []struct {
+		CID     int            `db:"cid"`
+		Name    string         `db:"name"`
+		Type    string         `db:"type"`
+		NotNull bool           `db:"notnull"`
+		Default sql.NullString `db:"dflt_value"`
+		PK      int            `db:"pk"`
+	}{}
+	err := db.SelectContext(ctx, &rows,
+		`SELECT cid, name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]Column, 0, len(rows))
+	for _, row := range rows {
+		columns = append(columns, Column{
+			Name:       row.Name,
+			Position:   row.CID + 1,
+			Type:       row.Type,
+			Nullable:   !row.NotNull,
+			Default:    nullString(row.Default),
+			PrimaryKey: row.PK > 0,
+		})
+	}
+	return columns, nil
+}
+
+// mysqlDialect lists the tables of the current database.
+type mysqlDialect struct{}
+
+func (mysqlDialect) tables(ctx context.Context, db *sqlx.DB) ([]Table, error) {
+	tables := []Table{}
+	err := db.SelectContext(ctx, &tables, `
+SELECT
+  TABLE_NAME AS table_name,
+  CASE WHEN TABLE_TYPE = 'VIEW' THEN 'view' ELSE 'table' END AS table_type
+FROM INFORMATION_SCHEMA.TABLES
+WHERE TABLE_SCHEMA = DATABASE()
+ORDER BY TABLE_NAME`)
+	return tables, err
+}
+
+func (mysqlDialect) columns(ctx context.Context, db *sqlx.DB, table Table) ([]Column, error) {
+	rows := []struct {
+		Name     string         `db:"column_name"`
+		Position int            `db:"ordinal_position"`
+		Type     string         `db:"column_type"`
+		Nullable string         `db:"is_nullable"`
+		Default  sql.NullString `db:"column_default"`
+		Key      string         `db:"column_key"`
+	}{}
+	err := db.SelectContext(ctx, &rows, `
+SELECT
+  COLUMN_NAME AS column_name,
+  ORDINAL_POSITION AS ordinal_position,
+  COLUMN_TYPE AS column_type,
+  IS_NULLABLE AS is_nullable,
+  COLUMN_DEFAULT AS column_default,
+  COLUMN_KEY AS column_key
+FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+ORDER BY ORDINAL_POSITION`, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]Column, 0, len(rows))
+	for _, row := range rows {
+		columns = append(columns, Column{
+			Name:       row.Name,
+			Position:   row.Position,
+			Type:       row.Type,
+			Nullable:   row.Nullable == "YES",
+			Default:    nullString(row.Default),
+			PrimaryKey: row.Key == "PRI",
+		})
+	}
+	return columns, nil
+}
+
+// informationSchemaDialect uses the standard information_schema views, as provided
+// by postgres and duckdb. Tables of all non-system schemas are listed.
+type informationSchemaDialect struct {
+	systemSchemas []string
+}
+
+func (d informationSchemaDialect) tables(ctx context.Context, db *sqlx.DB) ([]Table, error) {
+	query, args, err := sqlx.In(`
+SELECT
+  table_schema,
+  table_name,
+  CASE WHEN table_type = 'VIEW' THEN 'view' ELSE 'table' END AS table_type
+FROM information_schema.tables
+WHERE table_schema NOT IN (?)
+ORDER BY table_schema, table_name`, d.systemSchemas)
+	if err != nil {
+		return nil, err
+	}
+	tables := []Table{}
+	err = db.SelectContext(ctx, &tables, db.Rebind(query), args...)
+	return tables, err
+}
+
+func (d informationSchemaDialect) columns(ctx context.Context, db *sqlx.DB, table Table) ([]Column, error) {
+	rows := []struct {
+		Name       string         `db:"column_name"`
+		Position   int            `db:"ordinal_position"`
+		Type       string         `db:"data_type"`
+		Nullable   string         `db:"is_nullable"`
+		Default    sql.NullString `db:"column_default"`
+		PrimaryKey bool           `db:"primary_key"`
+	}{}
+	err := db.SelectContext(ctx, &rows, db.Rebind(`
+SELECT
+  c.column_name,
+  c.ordinal_position,
+  c.data_type,
+  c.is_nullable,
+  c.column_default,
+  EXISTS (
+    SELECT 1
+    FROM information_schema.table_constraints tc
+    JOIN information_schema.key_column_usage kcu
+      ON kcu.constraint_name = tc.constraint_name
+     AND kcu.constraint_schema = tc.constraint_schema
+     AND kcu.table_name = tc.table_name
+    WHERE tc.constraint_type = 'PRIMARY KEY'
+      AND tc.table_schema = c.table_schema
+      AND tc.table_name = c.table_name
+      AND kcu.column_name = c.column_name
+  ) AS primary_key
+FROM information_schema.columns c
+WHERE c.table_schema = ? AND c.table_name = ?
+ORDER BY c.ordinal_position`), table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]Column, 0, len(rows))
+	for _, row := range rows {
+		columns = append(columns, Column{
+			Name:       row.Name,
+			Position:   row.Position,
+			Type:       row.Type,
+			Nullable:   row.Nullable == "YES",
+			Default:    nullString(row.Default),
+			PrimaryKey: row.PrimaryKey,
+		})
+	}
+	return columns, nil
+}
+
+func (sqliteDialect) indexes(ctx context.Context, db *sqlx.DB, table Table) ([]Index, error) {
+	list := []struct {
+		Name   string `db:"name"`
+		Unique bool   `db:"unique"`
+		Origin string `db:"origin"`
+	}{}
+	err := db.SelectContext(ctx, &list,
+		`SELECT name, "unique", origin FROM pragma_index_list(?) ORDER BY name`, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := []Index{}
+	hasPrimary := false
+	for _, entry := range list {
+		columns := []sql.NullString{}
+		err := db.SelectContext(ctx, &columns,
+			`SELECT name FROM pragma_index_info(?) ORDER BY seqno`, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		index := Index{Name: entry.Name, Unique: entry.Unique, Primary: entry.Origin == "pk"}
+		for _, column := range columns {
+			if column.Valid {
+				index.Columns = append(index.Columns, column.String)
+			} else {
+				index.Columns = append(index.Columns, "(expression)")
+			}
+		}
+		hasPrimary = hasPrimary || index.Primary
+		indexes = append(indexes, index)
+	}
+
+	// an INTEGER PRIMARY KEY is the rowid of the table and has no index of its own
+	if !hasPrimary {
+		primaryKey, err := sqlitePrimaryKey(ctx, db, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(primaryKey) > 0 {
+			indexes = append([]Index{{Name: primaryIndexName, Columns: primaryKey, Unique: true, Primary: true}}, indexes...)
+		}
+	}
+	return indexes, nil
+}
+
+func (sqliteDialect) foreignKeys(ctx context.Context, db *sqlx.DB, table Table) ([]ForeignKey, error) {
+	rows := []struct {
+		ID       int            `db:"id"`
+		Table    string         `db:"table"`
+		From     string         `db:"from"`
+		To       sql.NullString `db:"to"`
+		OnUpdate string         `db:"on_update"`
+		OnDelete string         `db:"on_delete"`
+	}{}
+	err := db.SelectContext(ctx, &rows,
+		`SELECT id, "table", "from", "to", on_update, on_delete FROM pragma_foreign_key_list(?) ORDER BY id, seq`,
+		table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys := []ForeignKey{}
+	for i, row := range rows {
+		if i == 0 || row.ID != rows[i-1].ID {
+			foreignKeys = append(foreignKeys, ForeignKey{
+				ReferencedTable: row.Table,
+				OnUpdate:        row.OnUpdate,
+				OnDelete:        row.OnDelete,
+			})
+		}
+		foreignKey := &foreignKeys[len(foreignKeys)-1]
+		foreignKey.Columns = append(foreignKey.Columns, row.From)
+		if row.To.Valid {
+			foreignKey.ReferencedColumns = append(foreignKey.ReferencedColumns, row.To.String)
+		}
+	}
+
+	// a reference without columns is to the primary key of the referenced table
+	for i := range foreignKeys {
+		if len(foreignKeys[i].ReferencedColumns) > 0 {
+			continue
+		}
+		primaryKey, err := sqlitePrimaryKey(ctx, db, foreignKeys[i].ReferencedTable)
+		if err != nil {
+			return nil, err
+		}
+		foreignKeys[i].ReferencedColumns = primaryKey
+	}
+	return foreignKeys, nil
+}
+
+func sqlitePrimaryKey(ctx context.Context, db *sqlx.DB, table string) ([]string, error) {
+	columns := []string{}
+	err := db.SelectContext(ctx, &columns,
+		`SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, table)
+	return columns, err
+}
+
+func (mysqlDialect) indexes(ctx context.Context, db *sqlx.DB, table Table) ([]Index, error) {
+	rows := []indexColumn{}
+	err := db.SelectContext(ctx, &rows, `
+SELECT
+  INDEX_NAME AS index_name,
+  COALESCE(COLUMN_NAME, '(expression)') AS column_name,
+  NON_UNIQUE = 0 AS is_unique,
+  INDEX_NAME = 'PRIMARY' AS is_primary
+FROM INFORMATION_SCHEMA.STATISTICS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+ORDER BY INDEX_NAME, SEQ_IN_INDEX`, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	return groupIndexColumns(rows), nil
+}
+
+func (mysqlDialect) foreignKeys(ctx context.Context, db *sqlx.DB, table Table) ([]ForeignKey, error) {
+	rows := []foreignKeyColumn{}
+	err := db.SelectContext(ctx, &rows, `
+SELECT
+  kcu.CONSTRAINT_NAME AS constraint_name,
+  kcu.COLUMN_NAME AS column_name,
+  CASE WHEN kcu.REFERENCED_TABLE_SCHEMA = DATABASE() THEN '' ELSE kcu.REFERENCED_TABLE_SCHEMA END AS referenced_schema,
+  kcu.REFERENCED_TABLE_NAME AS referenced_table,
+  kcu.REFERENCED_COLUMN_NAME AS referenced_column,
+  rc.UPDATE_RULE AS on_update,
+  rc.DELETE_RULE AS on_delete
+FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE kcu
+JOIN INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS rc
+  ON rc.CONSTRAINT_SCHEMA = kcu.CONSTRAINT_SCHEMA
+ AND rc.CONSTRAINT_NAME = kcu.CONSTRAINT_NAME
+ AND rc.TABLE_NAME = kcu.TABLE_NAME
+WHERE kcu.TABLE_SCHEMA = DATABASE() AND kcu.TABLE_NAME = ? AND kcu.REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY kcu.CONSTRAINT_NAME, kcu.ORDINAL_POSITION`, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	return groupForeignKeyColumns(rows), nil
+}
+
+// postgresDialect reads indexes and foreign keys from pg_catalog, since
+// information_schema has no indexes and loses the column order of foreign keys.
+type postgresDialect struct {
+	informationSchemaDialect
+}
+
+func (postgresDialect) indexes(ctx context.Context, db *sqlx.DB, table Table) ([]Index, error) {
+	rows := []indexColumn{}
+	err := db.SelectContext(ctx, &rows, `
+SELECT
+  i.relname AS index_name,
+  COALESCE(a.attname, pg_get_indexdef(ix.indexrelid, k.ord::int, true)) AS column_name,
+  ix.indisunique AS is_unique,
+  ix.indisprimary AS is_primary
+FROM pg_index ix
+JOIN pg_class t ON t.oid = ix.indrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_class i ON i.oid = ix.indexrelid
+CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+LEFT JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum AND k.attnum > 0
+WHERE n.nspname = $1 AND t.relname = $2 AND k.ord <= ix.indnkeyatts
+ORDER BY i.relname, k.ord`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	return groupIndexColumns(rows), nil
+}
+
+func (postgresDialect) foreignKeys(ctx context.Context, db *sqlx.DB, table Table) ([]ForeignKey, error) {
+	rows := []foreignKeyColumn{}
+	err := db.SelectContext(ctx, &rows, `
+SELECT
+  con.conname AS constraint_name,
+  a.attname AS column_name,
+  CASE WHEN fn.nspname = n.nspname THEN '' ELSE fn.nspname END AS referenced_schema,
+  ft.relname AS referenced_table,
+  fa.attname AS referenced_column,
+  `+postgresReferentialAction("con.confupdtype")+` AS on_update,
+  `+postgresReferentialAction("con.confdeltype")+` AS on_delete
+FROM pg_constraint con
+JOIN pg_class t ON t.oid = con.conrelid
+JOIN pg_namespace n ON n.oid = t.relnamespace
+JOIN pg_class ft ON ft.oid = con.confrelid
+JOIN pg_namespace fn ON fn.oid = ft.relnamespace
+CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, fattnum, ord)
+JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+JOIN pg_attribute fa ON fa.attrelid = con.confrelid AND fa.attnum = k.fattnum
+WHERE con.contype = 'f' AND n.nspname = $1 AND t.relname = $2
+ORDER BY con.conname, k.ord`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	return groupForeignKeyColumns(rows), nil
+}
+
+func postgresReferentialAction(column string) string {
+	return `CASE ` + column + `
+    WHEN 'r' THEN 'RESTRICT' WHEN 'c' THEN 'CASCADE' WHEN 'n' THEN 'SET NULL'
+    WHEN 'd' THEN 'SET DEFAULT' ELSE 'NO ACTION' END`
+}
+
+// duckdbDialect reads indexes and foreign keys from the duckdb_constraints and
+// duckdb_indexes table functions. Primary keys and unique constraints are listed
+// as indexes, since duckdb backs them with one.
+type duckdbDialect struct {
+	informationSchemaDialect
+}
+
+func (duckdbDialect) indexes(ctx context.Context, db *sqlx.DB, table Table) ([]Index, error) {
+	rows := []struct {
+		Name    string `db:"index_name"`
+		Columns string `db:"columns"`
+		Unique  bool   `db:"is_unique"`
+		Primary bool   `db:"is_primary"`
+	}{}
+	err := db.SelectContext(ctx, &rows, `
+SELECT
+  CASE WHEN constraint_type = 'PRIMARY KEY' THEN 'PRIMARY' ELSE constraint_name END AS index_name,
+  array_to_string(constraint_column_names, ',') AS columns,
+  true AS is_unique,
+  constraint_type = 'PRIMARY KEY' AS is_primary
+FROM duckdb_constraints()
+WHERE schema_name = ? AND table_name = ? AND constraint_type IN ('PRIMARY KEY', 'UNIQUE')
+UNION ALL
+SELECT
+  index_name,
+  trim(expressions, '[]') AS columns,
+  is_unique,
+  is_primary
+FROM duckdb_indexes()
+WHERE schema_name = ? AND table_name = ?
+ORDER BY index_name`, table.Schema, table.Name, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make([]Index, 0, len(rows))
+	for _, row := range rows {
+		indexes = append(indexes, Index{
+			Name:    row.Name,
+			Columns: splitColumnList(row.Columns),
+			Unique:  row.Unique,
+			Primary: row.Primary,
+		})
+	}
+	return indexes, nil
+}
+
+func (duckdbDialect) foreignKeys(ctx context.Context, db *sqlx.DB, table Table) ([]ForeignKey, error) {
+	rows := []struct {
+		Name              string `db:"constraint_name"`
+		Columns           string `db:"columns"`
+		ReferencedTable   string `db:"referenced_table"`
+		ReferencedColumns string `db:"referenced_columns"`
+	}{}
+	err := db.SelectContext(ctx, &rows, `
+SELECT
+  constraint_name,
+  array_to_string(constraint_column_names, ',') AS columns,
+  referenced_table,
+  array_to_string(referenced_column_names, ',') AS referenced_columns
+FROM duckdb_constraints()
+WHERE schema_name = ? AND table_name = ? AND constraint_type = 'FOREIGN KEY'
+ORDER BY constraint_name`, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys := make([]ForeignKey, 0, len(rows))
+	for _, row := range rows {
+		foreignKeys = append(foreignKeys, ForeignKey{
+			Name:              row.Name,
+			Columns:           splitColumnList(row.Columns),
+			ReferencedTable:   row.ReferencedTable,
+			ReferencedColumns: splitColumnList(row.ReferencedColumns),
+		})
+	}
+	return foreignKeys, nil
+}
+
+// primaryIndexName names primary keys that have no index name of their own.
+const primaryIndexName = "PRIMARY"
+
+// indexColumn is a row of the index queries, one per column of each index, ordered
+// by index name and column position.
+type indexColumn struct {
+	Name    string `db:"index_name"`
+	Column  string `db:"column_name"`
+	Unique  bool   `db:"is_unique"`
+	Primary bool   `db:"is_primary"`
+}
+
+func groupIndexColumns(rows []indexColumn) []Index {
+	indexes := []Index{}
+	for i, row := range rows {
+		if i == 0 || row.Name != rows[i-1].Name {
+			indexes = append(indexes, Index{Name: row.Name, Unique: row.Unique, Primary: row.Primary})
+		}
+		index := &indexes[len(indexes)-1]
+		index.Columns = append(index.Columns, row.Column)
+	}
+	return indexes
+}
+
+// foreignKeyColumn is a row of the foreign key queries, one per column of each
+// foreign key, ordered by constraint name and column position.
+type foreignKeyColumn struct {
+	Name             string `db:"constraint_name"`
+	Column           string `db:"column_name"`
+	ReferencedSchema string `db:"referenced_schema"`
+	ReferencedTable  string `db:"referenced_table"`
+	ReferencedColumn string `db:"referenced_column"`
+	OnUpdate         string `db:"on_update"`
+	OnDelete         string `db:"on_delete"`
+}
+
+func groupForeignKeyColumns(rows []foreignKeyColumn) []ForeignKey {
+	foreignKeys := []ForeignKey{}
+	for i, row := range rows {
+		if i == 0 || row.Name != rows[i-1].Name {
+			foreignKeys = append(foreignKeys, ForeignKey{
+				Name:             row.Name,
+				ReferencedSchema: row.ReferencedSchema,
+				ReferencedTable:  row.ReferencedTable,
+				OnUpdate:         row.OnUpdate,
+				OnDelete:         row.OnDelete,
+			})
+		}
+		foreignKey := &foreignKeys[len(foreignKeys)-1]
+		foreignKey.Columns = append(foreignKey.Columns, row.Column)
+		foreignKey.ReferencedColumns = append(foreignKey.ReferencedColumns, row.ReferencedColumn)
+	}
+	return foreignKeys
+}
+
+func splitColumnList(s string) []string {
+	columns := []string{}
+	for _, column := range strings.Split(s, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+func nullString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
@@ -0,0 +1,150 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	_, err = db.Exec(`
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, role TEXT DEFAULT 'member');
+CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users(id), title TEXT);
+CREATE VIEW admins AS SELECT * FROM users WHERE role = 'admin';
+CREATE UNIQUE INDEX users_name ON users (name);
+CREATE INDEX posts_user_title ON posts (user_id, lower(title));
+CREATE TABLE tags (post_id INTEGER, name TEXT, PRIMARY KEY (post_id, name), FOREIGN KEY (post_id) REFERENCES posts ON DELETE CASCADE);
+`)
+	require.NoError(t, err)
+	return db
+}
+
+func TestSqliteTables(t *testing.T) {
+	c, err := New(openTestDB(t))
+	require.NoError(t, err)
+
+	tables, err := c.Tables(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []Table{
+		{Name: "admins", Type: TableTypeView},
+		{Name: "posts", Type: TableTypeTable},
+		{Name: "tags", Type: TableTypeTable},
+		{Name: "users", Type: TableTypeTable},
+	}, tables)
+}
+
+func TestSqliteColumns(t *testing.T) {
+	c, err := New(openTestDB(t))
+	require.NoError(t, err)
+
+	table, columns, err := c.Columns(context.Background(), "users")
+	require.NoError(t, err)
+	require.Equal(t, "users", table.Name)
+
+	role := "'member'"
+	require.Equal(t, []Column{
+		{Name: "id", Position: 1, Type: "INTEGER", Nullable: true, PrimaryKey: true},
+		{Name: "name", Position: 2, Type: "TEXT", Nullable: false},
+		{Name: "role", Position: 3, Type: "TEXT", Nullable: true, Default: &role},
+	}, columns)
+
+	_, _, err = c.Columns(context.Background(), "nope")
+	var notFound *TableNotFoundError
+	require.ErrorAs(t, err, &notFound)
+}
+
+func TestSqliteIndexes(t *testing.T) {
+	c, err := New(openTestDB(t))
+	require.NoError(t, err)
+
+	_, indexes, err := c.Indexes(context.Background(), "users")
+	require.NoError(t, err)
+	require.Equal(t, []Index{
+		{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+		{Name: "users_name", Columns: []string{"name"}, Unique: true},
+	}, indexes)
+
+	_, indexes, err = c.Indexes(context.Background(), "posts")
+	require.NoError(t, err)
+	require.Equal(t, []Index{
+		{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+		{Name: "posts_user_title", Columns: []string{"user_id", "(expression)"}},
+	}, indexes)
+
+	_, indexes, err = c.Indexes(context.Background(), "tags")
+	require.NoError(t, err)
+	require.Equal(t, []Index{
+		{Name: "sqlite_autoindex_tags_1", Columns: []string{"post_id", "name"}, Unique: true, Primary: true},
+	}, indexes)
+}
+
+func TestSqliteForeignKeys(t *testing.T) {
+	c, err := New(openTestDB(t))
+	require.NoError(t, err)
+
+	_, foreignKeys, err := c.ForeignKeys(context.Background(), "posts")
+	require.NoError(t, err)
+	require.Equal(t, []ForeignKey{{
+		Columns:           []string{"user_id"},
+		ReferencedTable:   "users",
+		ReferencedColumns: []string{"id"},
+		OnUpdate:          "NO ACTION",
+		OnDelete:          "NO ACTION",
+	}}, foreignKeys)
+
+	// a reference without columns resolves to the primary key
+	_, foreignKeys, err = c.ForeignKeys(context.Background(), "tags")
+	require.NoError(t, err)
+	require.Equal(t, []ForeignKey{{
+		Columns:           []string{"post_id"},
+		ReferencedTable:   "posts",
+		ReferencedColumns: []string{"id"},
+		OnUpdate:          "NO ACTION",
+		OnDelete:          "CASCADE",
+	}}, foreignKeys)
+
+	_, foreignKeys, err = c.ForeignKeys(context.Background(), "users")
+	require.NoError(t, err)
+	require.Empty(t, foreignKeys)
+}
+
+func TestSqliteDump(t *testing.T) {
+	c, err := New(openTestDB(t))
+	require.NoError(t, err)
+
+	dump, err := c.Dump(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, DialectSqlite, dump.Dialect)
+	require.Len(t, dump.Tables, 4)
+
+	users := dump.FindTable("users")
+	require.NotNil(t, users)
+	require.Equal(t, "integer", users.Columns[0].Type)
+	require.Len(t, users.Indexes, 2)
+	require.Empty(t, users.ForeignKeys)
+
+	admins := dump.FindTable("admins")
+	require.Equal(t, TableTypeView, admins.Type)
+	require.Len(t, admins.Columns, 3)
+	require.Empty(t, admins.Indexes)
+
+	path := filepath.Join(t.TempDir(), "schema.yaml")
+	for _, format := range []string{"yaml", "json"} {
+		data, err := dump.Marshal(format)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		loaded, err := LoadSchema(path)
+		require.NoError(t, err)
+		require.Equal(t, dump, loaded, format)
+	}
+}
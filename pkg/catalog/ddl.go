@@ -0,0 +1,350 @@
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationDDL returns the statements applying changes, as returned by DiffSchemas,
+// in the given dialect. Statements are ordered so that foreign keys and indexes are
+// dropped before what they depend on, and created after it. Changes that the dialect
+// can't express with ALTER TABLE, such as altering a column on sqlite, are written
+// as comments.
+func MigrationDDL(dialect string, changes []Change) (string, error) {
+	switch dialect {
+	case DialectSqlite, DialectMysql, DialectPostgres, DialectDuckdb:
+	default:
+		return "", errors.Errorf("unknown dialect %s", dialect)
+	}
+	g := ddlGenerator{dialect: dialect}
+
+	phases := []func(change *Change) []string{
+		g.dropForeignKey,
+		g.dropIndex,
+		g.dropTable,
+		g.dropColumn,
+		g.createTable,
+		g.alterColumn,
+		g.createIndex,
+		g.addForeignKey,
+	}
+	statements := []string{}
+	for _, phase := range phases {
+		for i := range changes {
+			statements = append(statements, phase(&changes[i])...)
+		}
+	}
+	if len(statements) == 0 {
+		return "", nil
+	}
+	return strings.Join(statements, "\n") + "\n", nil
+}
+
+// CreateTableDDL returns the CREATE TABLE statement of table, followed by the CREATE
+// INDEX statements of its indexes, in the given dialect.
+func CreateTableDDL(dialect string, table *TableSchema) (string, error) {
+	return MigrationDDL(dialect, []Change{{
+		Kind:    ChangeAdd,
+		Object:  ObjectTable,
+		Table:   table.QualifiedName(),
+		ToTable: table,
+	}})
+}
+
+// QuoteIdentifier quotes a column or index name for dialect, if it isn't a plain lower
+// case name.
+func QuoteIdentifier(dialect string, name string) string {
+	return ddlGenerator{dialect: dialect}.quote(name)
+}
+
+// QuoteTable quotes a table name for dialect, see QuoteIdentifier. The name can be
+// qualified with a schema on postgres and duckdb.
+func QuoteTable(dialect string, name string) string {
+	return ddlGenerator{dialect: dialect}.table(name)
+}
+
+type ddlGenerator struct {
+	dialect string
+}
+
+func unsupported(format string, args ...interface{}) string {
+	return "-- " + fmt.Sprintf(format, args...)
+}
+
+func (g ddlGenerator) dropForeignKey(change *Change) []string {
+	if change.Object != ObjectForeignKey || change.Kind == ChangeAdd {
+		return nil
+	}
+	foreignKey := change.FromForeignKey
+	switch {
+	case g.dialect == DialectSqlite || g.dialect == DialectDuckdb:
+		return []string{unsupported("%s cannot drop foreign key %s of %s, the table has to be rebuilt",
+			g.dialect, change.Name, change.Table)}
+	case foreignKey.Name == "":
+		return []string{unsupported("foreign key %s of %s has no name to drop it by", change.Name, change.Table)}
+	case g.dialect == DialectMysql:
+		return []string{fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s;", g.table(change.Table), g.quote(foreignKey.Name))}
+	default:
+		return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", g.table(change.Table), g.quote(foreignKey.Name))}
+	}
+}
+
+func (g ddlGenerator) addForeignKey(change *Change) []string {
+	if change.Object != ObjectForeignKey || change.Kind == ChangeDrop {
+		return nil
+	}
+	if g.dialect == DialectSqlite || g.dialect == DialectDuckdb {
+		return []string{unsupported("%s cannot add foreign key %s to %s, the table has to be rebuilt",
+			g.dialect, change.Name, change.Table)}
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s ADD %s;", g.table(change.Table), g.foreignKey(change.ToForeignKey))}
+}
+
+func (g ddlGenerator) dropIndex(change *Change) []string {
+	if change.Object != ObjectIndex || change.Kind == ChangeAdd {
+		return nil
+	}
+	index := change.FromIndex
+	if index.Primary {
+		switch g.dialect {
+		case DialectMysql:
+			return []string{fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY;", g.table(change.Table))}
+		case DialectPostgres:
+			return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", g.table(change.Table), g.quote(index.Name))}
+		default:
+			return []string{unsupported("%s cannot drop the primary key of %s, the table has to be rebuilt",
+				g.dialect, change.Table)}
+		}
+	}
+	if g.dialect == DialectMysql {
+		return []string{fmt.Sprintf("DROP INDEX %s ON %s;", g.quote(index.Name), g.table(change.Table))}
+	}
+	return []string{fmt.Sprintf("DROP INDEX %s;", g.table(g.schemaOf(change.Table)+index.Name))}
+}
+
+func (g ddlGenerator) createIndex(change *Change) []string {
+	if change.Object != ObjectIndex || change.Kind == ChangeDrop {
+		return nil
+	}
+	return g.createIndexStatements(change.Table, change.ToIndex)
+}
+
+func (g ddlGenerator) createIndexStatements(table string, index *Index) []string {
+	if index.Primary {
+		if g.dialect == DialectMysql || g.dialect == DialectPostgres {
+			return []string{fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s);", g.table(table), g.columns(index.Columns))}
+		}
+		return []string{unsupported("%s cannot add a primary key to %s, the table has to be rebuilt", g.dialect, table)}
+	}
+
+	name := index.Name
+	// sqlite reserves its own names for the indexes of unique constraints
+	if strings.HasPrefix(name, "sqlite_") {
+		name = tableName(table) + "_" + strings.Join(index.Columns, "_") + "_key"
+	}
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	return []string{fmt.Sprintf("CREATE %sINDEX %s ON %s (%s);",
+		unique, g.quote(name), g.table(table), g.columns(index.Columns))}
+}
+
+func (g ddlGenerator) dropTable(change *Change) []string {
+	if (change.Object != ObjectTable && change.Object != ObjectView) || change.Kind == ChangeAdd {
+		return nil
+	}
+	if change.FromTable.Type == TableTypeView {
+		return []string{fmt.Sprintf("DROP VIEW %s;", g.table(change.Table))}
+	}
+	return []string{fmt.Sprintf("DROP TABLE %s;", g.table(change.Table))}
+}
+
+func (g ddlGenerator) createTable(change *Change) []string {
+	if (change.Object != ObjectTable && change.Object != ObjectView) || change.Kind == ChangeDrop {
+		return nil
+	}
+	table := change.ToTable
+	if table.Type == TableTypeView {
+		return []string{unsupported("create view %s: view definitions are not part of the schema", change.Table)}
+	}
+
+	definitions := []string{}
+	for i := range table.Columns {
+		definitions = append(definitions, g.column(&table.Columns[i]))
+	}
+	indexes := []string{}
+	for i := range table.Indexes {
+		index := &table.Indexes[i]
+		if index.Primary {
+			definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", g.columns(index.Columns)))
+			continue
+		}
+		indexes = append(indexes, g.createIndexStatements(change.Table, index)...)
+	}
+	for i := range table.ForeignKeys {
+		definitions = append(definitions, g.foreignKey(&table.ForeignKeys[i]))
+	}
+
+	statement := fmt.Sprintf("CREATE TABLE %s (\n  %s\n);", g.table(change.Table), strings.Join(definitions, ",\n  "))
+	return append([]string{statement}, indexes...)
+}
+
+func (g ddlGenerator) dropColumn(change *Change) []string {
+	if change.Object != ObjectColumn || change.Kind != ChangeDrop {
+		return nil
+	}
+	return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", g.table(change.Table), g.quote(change.Name))}
+}
+
+func (g ddlGenerator) alterColumn(change *Change) []string {
+	if change.Object != ObjectColumn {
+		return nil
+	}
+	table := g.table(change.Table)
+	switch change.Kind {
+	case ChangeAdd:
+		return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", table, g.column(change.ToColumn))}
+	case ChangeAlter:
+	default:
+		return nil
+	}
+
+	from, to := change.FromColumn, change.ToColumn
+	column := g.quote(to.Name)
+	switch g.dialect {
+	case DialectSqlite:
+		return []string{unsupported("sqlite cannot alter column %s of %s (%s to %s), the table has to be rebuilt",
+			to.Name, change.Table, change.From, change.To)}
+	case DialectMysql:
+		return []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s;", table, g.column(to))}
+	}
+
+	statements := []string{}
+	if from.Type != to.Type {
+		statements = append(statements,
+			fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s;", table, column, g.type_(to.Type)))
+	}
+	if from.Nullable != to.Nullable {
+		action := "SET NOT NULL"
+		if to.Nullable {
+			action = "DROP NOT NULL"
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s;", table, column, action))
+	}
+	if (from.Default == nil) != (to.Default == nil) || (to.Default != nil && *from.Default != *to.Default) {
+		action := "DROP DEFAULT"
+		if to.Default != nil {
+			action = "SET DEFAULT " + *to.Default
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s;", table, column, action))
+	}
+	return statements
+}
+
+func (g ddlGenerator) column(column *Column) string {
+	ret := g.quote(column.Name) + " " + g.type_(column.Type)
+	if !column.Nullable {
+		ret += " NOT NULL"
+	}
+	if column.Default != nil {
+		ret += " DEFAULT " + *column.Default
+	}
+	return ret
+}
+
+func (g ddlGenerator) foreignKey(foreignKey *ForeignKey) string {
+	ret := ""
+	if foreignKey.Name != "" {
+		ret = "CONSTRAINT " + g.quote(foreignKey.Name) + " "
+	}
+	ret += fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)",
+		g.columns(foreignKey.Columns),
+		g.table(foreignKey.ReferencedQualifiedName()),
+		g.columns(foreignKey.ReferencedColumns))
+	if foreignKey.OnUpdate != "" && !strings.EqualFold(foreignKey.OnUpdate, "NO ACTION") {
+		ret += " ON UPDATE " + strings.ToUpper(foreignKey.OnUpdate)
+	}
+	if foreignKey.OnDelete != "" && !strings.EqualFold(foreignKey.OnDelete, "NO ACTION") {
+		ret += " ON DELETE " + strings.ToUpper(foreignKey.OnDelete)
+	}
+	return ret
+}
+
+// type_ maps a normalized type back to a type of the dialect, where the normalized
+// name is not understood as is.
+func (g ddlGenerator) type_(type_ string) string {
+	switch g.dialect {
+	case DialectPostgres:
+		switch type_ {
+		case "double":
+			return "double precision"
+		case "blob":
+			return "bytea"
+		}
+	case DialectMysql:
+		switch type_ {
+		case "timestamp":
+			return "datetime"
+		case "timestamptz":
+			return "timestamp"
+		case "varchar":
+			return "varchar(255)"
+		}
+	}
+	return type_
+}
+
+func (g ddlGenerator) columns(columns []string) string {
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, g.quote(column))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// table quotes a table name, qualified with its schema on postgres and duckdb.
+func (g ddlGenerator) table(name string) string {
+	if schema, table, ok := strings.Cut(name, "."); ok && (g.dialect == DialectPostgres || g.dialect == DialectDuckdb) {
+		return g.quote(schema) + "." + g.quote(table)
+	}
+	return g.quote(name)
+}
+
+// schemaOf returns the "schema." prefix of a qualified table name, if any.
+func (g ddlGenerator) schemaOf(name string) string {
+	if schema, _, ok := strings.Cut(name, "."); ok {
+		return schema + "."
+	}
+	return ""
+}
+
+func tableName(name string) string {
+	if _, table, ok := strings.Cut(name, "."); ok {
+		return table
+	}
+	return name
+}
+
+var plainIdentifierRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// reservedWords are the keywords that are likely to be used as names.
+var reservedWords = map[string]bool{
+	"check": true, "default": true, "from": true, "group": true, "index": true, "key": true,
+	"order": true, "primary": true, "references": true, "select": true, "table": true,
+	"to": true, "user": true, "where": true,
+}
+
+// quote quotes an identifier if it isn't a plain lower case name.
+func (g ddlGenerator) quote(name string) string {
+	if plainIdentifierRegexp.MatchString(name) && !reservedWords[name] {
+		return name
+	}
+	if g.dialect == DialectMysql {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,277 @@
+package catalog
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdd   ChangeKind = "add"
+	ChangeDrop  ChangeKind = "drop"
+	ChangeAlter ChangeKind = "alter"
+)
+
+type ObjectKind string
+
+const (
+	ObjectTable      ObjectKind = "table"
+	ObjectView       ObjectKind = "view"
+	ObjectColumn     ObjectKind = "column"
+	ObjectIndex      ObjectKind = "index"
+	ObjectForeignKey ObjectKind = "foreign_key"
+)
+
+// Change is a difference between two schemas, to apply to the first one to get
+// the second one.
+type Change struct {
+	Kind   ChangeKind
+	Object ObjectKind
+	// Table is the qualified name of the table the change applies to.
+	Table string
+	// Name is the name of the changed object. Tables and views are named by Table.
+	Name string
+	// From and To describe the definition before and after the change, and are empty
+	// for added and dropped objects respectively.
+	From string
+	To   string
+
+	// The definitions before and after the change, for generating DDL. Only those of
+	// the changed object are set.
+	FromTable, ToTable           *TableSchema
+	FromColumn, ToColumn         *Column
+	FromIndex, ToIndex           *Index
+	FromForeignKey, ToForeignKey *ForeignKey
+}
+
+// DiffSchemas returns the changes that turn from into to. Tables are matched by
+// qualified name, columns and indexes by name, and foreign keys by their columns and
+// referenced table, since their names are often generated. The primary key is
+// matched as such, whatever its name, and so are the indexes sqlite generates for
+// unique constraints. Column order is not compared.
+func DiffSchemas(from, to *Schema) []Change {
+	changes := []Change{}
+
+	for i := range from.Tables {
+		fromTable := &from.Tables[i]
+		if to.FindTable(fromTable.QualifiedName()) == nil {
+			changes = append(changes, Change{
+				Kind:      ChangeDrop,
+				Object:    tableObject(fromTable),
+				Table:     fromTable.QualifiedName(),
+				From:      fromTable.Type,
+				FromTable: fromTable,
+			})
+		}
+	}
+
+	for i := range to.Tables {
+		toTable := &to.Tables[i]
+		fromTable := from.FindTable(toTable.QualifiedName())
+		switch {
+		case fromTable == nil:
+			changes = append(changes, Change{
+				Kind:    ChangeAdd,
+				Object:  tableObject(toTable),
+				Table:   toTable.QualifiedName(),
+				To:      toTable.Type,
+				ToTable: toTable,
+			})
+		case fromTable.Type != toTable.Type:
+			changes = append(changes, Change{
+				Kind:      ChangeAlter,
+				Object:    tableObject(toTable),
+				Table:     toTable.QualifiedName(),
+				From:      fromTable.Type,
+				To:        toTable.Type,
+				FromTable: fromTable,
+				ToTable:   toTable,
+			})
+		case toTable.Type == TableTypeTable:
+			changes = append(changes, diffTables(fromTable, toTable)...)
+		}
+	}
+
+	return changes
+}
+
+func tableObject(table *TableSchema) ObjectKind {
+	if table.Type == TableTypeView {
+		return ObjectView
+	}
+	return ObjectTable
+}
+
+func diffTables(from, to *TableSchema) []Change {
+	changes := []Change{}
+	table := to.QualifiedName()
+
+	fromColumns := map[string]*Column{}
+	for i := range from.Columns {
+		fromColumns[from.Columns[i].Name] = &from.Columns[i]
+	}
+	toColumns := map[string]*Column{}
+	for i := range to.Columns {
+		toColumns[to.Columns[i].Name] = &to.Columns[i]
+	}
+	for i := range from.Columns {
+		column := &from.Columns[i]
+		if _, ok := toColumns[column.Name]; !ok {
+			changes = append(changes, Change{
+				Kind: ChangeDrop, Object: ObjectColumn, Table: table, Name: column.Name,
+				From: describeColumn(column), FromColumn: column,
+			})
+		}
+	}
+	for i := range to.Columns {
+		column := &to.Columns[i]
+		fromColumn, ok := fromColumns[column.Name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{
+				Kind: ChangeAdd, Object: ObjectColumn, Table: table, Name: column.Name,
+				To: describeColumn(column), ToColumn: column,
+			})
+		case describeColumn(fromColumn) != describeColumn(column):
+			changes = append(changes, Change{
+				Kind: ChangeAlter, Object: ObjectColumn, Table: table, Name: column.Name,
+				From: describeColumn(fromColumn), To: describeColumn(column),
+				FromColumn: fromColumn, ToColumn: column,
+			})
+		}
+	}
+
+	fromIndexes := map[string]*Index{}
+	for i := range from.Indexes {
+		fromIndexes[indexKey(&from.Indexes[i])] = &from.Indexes[i]
+	}
+	toIndexes := map[string]*Index{}
+	for i := range to.Indexes {
+		toIndexes[indexKey(&to.Indexes[i])] = &to.Indexes[i]
+	}
+	for i := range from.Indexes {
+		index := &from.Indexes[i]
+		if _, ok := toIndexes[indexKey(index)]; !ok {
+			changes = append(changes, Change{
+				Kind: ChangeDrop, Object: ObjectIndex, Table: table, Name: index.Name,
+				From: describeIndex(index), FromIndex: index,
+			})
+		}
+	}
+	for i := range to.Indexes {
+		index := &to.Indexes[i]
+		fromIndex, ok := fromIndexes[indexKey(index)]
+		switch {
+		case !ok:
+			changes = append(changes, Change{
+				Kind: ChangeAdd, Object: ObjectIndex, Table: table, Name: index.Name,
+				To: describeIndex(index), ToIndex: index,
+			})
+		case describeIndex(fromIndex) != describeIndex(index):
+			changes = append(changes, Change{
+				Kind: ChangeAlter, Object: ObjectIndex, Table: table, Name: index.Name,
+				From: describeIndex(fromIndex), To: describeIndex(index),
+				FromIndex: fromIndex, ToIndex: index,
+			})
+		}
+	}
+
+	fromForeignKeys := map[string]*ForeignKey{}
+	for i := range from.ForeignKeys {
+		fromForeignKeys[foreignKeyKey(&from.ForeignKeys[i])] = &from.ForeignKeys[i]
+	}
+	toForeignKeys := map[string]*ForeignKey{}
+	for i := range to.ForeignKeys {
+		toForeignKeys[foreignKeyKey(&to.ForeignKeys[i])] = &to.ForeignKeys[i]
+	}
+	for i := range from.ForeignKeys {
+		foreignKey := &from.ForeignKeys[i]
+		if _, ok := toForeignKeys[foreignKeyKey(foreignKey)]; !ok {
+			changes = append(changes, Change{
+				Kind: ChangeDrop, Object: ObjectForeignKey, Table: table, Name: foreignKeyName(foreignKey),
+				From: describeForeignKey(foreignKey), FromForeignKey: foreignKey,
+			})
+		}
+	}
+	for i := range to.ForeignKeys {
+		foreignKey := &to.ForeignKeys[i]
+		fromForeignKey, ok := fromForeignKeys[foreignKeyKey(foreignKey)]
+		switch {
+		case !ok:
+			changes = append(changes, Change{
+				Kind: ChangeAdd, Object: ObjectForeignKey, Table: table, Name: foreignKeyName(foreignKey),
+				To: describeForeignKey(foreignKey), ToForeignKey: foreignKey,
+			})
+		case describeForeignKey(fromForeignKey) != describeForeignKey(foreignKey):
+			changes = append(changes, Change{
+				Kind: ChangeAlter, Object: ObjectForeignKey, Table: table, Name: foreignKeyName(foreignKey),
+				From: describeForeignKey(fromForeignKey), To: describeForeignKey(foreignKey),
+				FromForeignKey: fromForeignKey, ToForeignKey: foreignKey,
+			})
+		}
+	}
+
+	return changes
+}
+
+func indexKey(index *Index) string {
+	switch {
+	case index.Primary:
+		return "primary key"
+	case strings.HasPrefix(index.Name, "sqlite_autoindex_"):
+		// sqlite numbers the indexes of unique constraints in creation order
+		return describeIndex(index)
+	default:
+		return index.Name
+	}
+}
+
+func foreignKeyKey(foreignKey *ForeignKey) string {
+	return "(" + strings.Join(foreignKey.Columns, ", ") + ") " + foreignKey.ReferencedQualifiedName()
+}
+
+func foreignKeyName(foreignKey *ForeignKey) string {
+	if foreignKey.Name != "" {
+		return foreignKey.Name
+	}
+	return foreignKeyKey(foreignKey)
+}
+
+func describeColumn(column *Column) string {
+	ret := column.Type
+	if !column.Nullable {
+		ret += " not null"
+	}
+	if column.Default != nil {
+		ret += " default " + *column.Default
+	}
+	return ret
+}
+
+func describeIndex(index *Index) string {
+	columns := "(" + strings.Join(index.Columns, ", ") + ")"
+	switch {
+	case index.Primary:
+		return "primary key " + columns
+	case index.Unique:
+		return "unique " + columns
+	default:
+		return columns
+	}
+}
+
+// describeForeignKey leaves out the referential actions that are the default.
+func describeForeignKey(foreignKey *ForeignKey) string {
+	ret := fmt.Sprintf("(%s) references %s(%s)",
+		strings.Join(foreignKey.Columns, ", "),
+		foreignKey.ReferencedQualifiedName(),
+		strings.Join(foreignKey.ReferencedColumns, ", "))
+	if action := strings.ToLower(foreignKey.OnUpdate); action != "" && action != "no action" {
+		ret += " on update " + action
+	}
+	if action := strings.ToLower(foreignKey.OnDelete); action != "" && action != "no action" {
+		ret += " on delete " + action
+	}
+	return ret
+}
@@ -0,0 +1,169 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeType(t *testing.T) {
+	for type_, expected := range map[string]string{
+		"INTEGER":                     "integer",
+		"int(11)":                     "integer",
+		"int4":                        "integer",
+		"int(10) unsigned":            "integer unsigned",
+		"tinyint(1)":                  "boolean",
+		"BIGINT":                      "bigint",
+		"character varying(255)":      "varchar(255)",
+		"character(2)":                "char(2)",
+		"double precision":            "double",
+		"DECIMAL(10,2)":               "numeric(10,2)",
+		"timestamp without time zone": "timestamp",
+		"TIMESTAMP WITH TIME ZONE":    "timestamptz",
+		"datetime":                    "timestamp",
+		"text":                        "text",
+		"interval":                    "interval",
+	} {
+		require.Equal(t, expected, NormalizeType(type_), type_)
+	}
+
+	require.Equal(t, "'member'", NormalizeDefault("'member'::text"))
+	require.Equal(t, "'x'", NormalizeDefault("'x'::character varying"))
+	require.Equal(t, "nextval('users_id_seq'::regclass)", NormalizeDefault("nextval('users_id_seq'::regclass)"))
+}
+
+func testSchemas() (*Schema, *Schema) {
+	member, admin := "'member'", "'admin'"
+	from := &Schema{Dialect: DialectPostgres, Tables: []TableSchema{
+		{
+			Table: Table{Schema: "public", Name: "users", Type: TableTypeTable},
+			Columns: []Column{
+				{Name: "id", Type: "integer", PrimaryKey: true},
+				{Name: "name", Type: "text"},
+				{Name: "role", Type: "text", Nullable: true, Default: &member},
+			},
+			Indexes: []Index{{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true}},
+		},
+		{
+			Table: Table{Schema: "public", Name: "posts", Type: TableTypeTable},
+			Columns: []Column{
+				{Name: "id", Type: "integer", PrimaryKey: true},
+				{Name: "user_id", Type: "integer", Nullable: true},
+			},
+			Indexes: []Index{
+				{Name: "posts_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+				{Name: "posts_user", Columns: []string{"user_id"}},
+			},
+			ForeignKeys: []ForeignKey{{
+				Name: "posts_user_id_fkey", Columns: []string{"user_id"},
+				ReferencedTable: "users", ReferencedColumns: []string{"id"},
+			}},
+		},
+		{Table: Table{Schema: "public", Name: "old", Type: TableTypeTable}},
+	}}
+	to := &Schema{Dialect: DialectPostgres, Tables: []TableSchema{
+		{
+			Table: Table{Schema: "public", Name: "users", Type: TableTypeTable},
+			Columns: []Column{
+				{Name: "id", Type: "integer", PrimaryKey: true},
+				{Name: "name", Type: "varchar(100)", Nullable: true},
+				{Name: "role", Type: "text", Nullable: true, Default: &admin},
+				{Name: "email", Type: "text"},
+			},
+			Indexes: []Index{
+				{Name: "users_pk", Columns: []string{"id"}, Unique: true, Primary: true},
+				{Name: "users_email", Columns: []string{"email"}, Unique: true},
+			},
+		},
+		{
+			Table: Table{Schema: "public", Name: "posts", Type: TableTypeTable},
+			Columns: []Column{
+				{Name: "id", Type: "integer", PrimaryKey: true},
+				{Name: "user_id", Type: "integer", Nullable: true},
+			},
+			Indexes: []Index{{Name: "posts_pkey", Columns: []string{"id"}, Unique: true, Primary: true}},
+			ForeignKeys: []ForeignKey{{
+				Name: "fk_posts_users", Columns: []string{"user_id"},
+				ReferencedTable: "users", ReferencedColumns: []string{"id"}, OnDelete: "CASCADE",
+			}},
+		},
+		{Table: Table{Schema: "public", Name: "active_users", Type: TableTypeView}},
+	}}
+	return from, to
+}
+
+func TestDiffSchemas(t *testing.T) {
+	from, to := testSchemas()
+
+	type change struct {
+		Kind   ChangeKind
+		Object ObjectKind
+		Table  string
+		Name   string
+		From   string
+		To     string
+	}
+	changes := []change{}
+	for _, c := range DiffSchemas(from, to) {
+		changes = append(changes, change{c.Kind, c.Object, c.Table, c.Name, c.From, c.To})
+	}
+	require.Equal(t, []change{
+		{ChangeDrop, ObjectTable, "public.old", "", "table", ""},
+		{ChangeAlter, ObjectColumn, "public.users", "name", "text not null", "varchar(100)"},
+		{ChangeAlter, ObjectColumn, "public.users", "role", "text default 'member'", "text default 'admin'"},
+		{ChangeAdd, ObjectColumn, "public.users", "email", "", "text not null"},
+		{ChangeAdd, ObjectIndex, "public.users", "users_email", "", "unique (email)"},
+		{ChangeDrop, ObjectIndex, "public.posts", "posts_user", "(user_id)", ""},
+		{ChangeAlter, ObjectForeignKey, "public.posts", "fk_posts_users",
+			"(user_id) references users(id)", "(user_id) references users(id) on delete cascade"},
+		{ChangeAdd, ObjectView, "public.active_users", "", "", "view"},
+	}, changes)
+
+	require.Empty(t, DiffSchemas(to, to))
+}
+
+func TestMigrationDDL(t *testing.T) {
+	from, to := testSchemas()
+	changes := DiffSchemas(from, to)
+
+	ddl, err := MigrationDDL(DialectPostgres, changes)
+	require.NoError(t, err)
+	require.Equal(t, `ALTER TABLE public.posts DROP CONSTRAINT posts_user_id_fkey;
+DROP INDEX public.posts_user;
+DROP TABLE public.old;
+-- create view public.active_users: view definitions are not part of the schema
+ALTER TABLE public.users ALTER COLUMN name TYPE varchar(100);
+ALTER TABLE public.users ALTER COLUMN name DROP NOT NULL;
+ALTER TABLE public.users ALTER COLUMN role SET DEFAULT 'admin';
+ALTER TABLE public.users ADD COLUMN email text NOT NULL;
+CREATE UNIQUE INDEX users_email ON public.users (email);
+ALTER TABLE public.posts ADD CONSTRAINT fk_posts_users FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+`, ddl)
+
+	ddl, err = MigrationDDL(DialectMysql, changes)
+	require.NoError(t, err)
+	require.Contains(t, ddl, " DROP FOREIGN KEY posts_user_id_fkey;\n")
+	require.Contains(t, ddl, " MODIFY COLUMN name varchar(100);\n")
+
+	ddl, err = MigrationDDL(DialectSqlite, []Change{{
+		Kind: ChangeAdd, Object: ObjectTable, Table: "order", ToTable: &TableSchema{
+			Table:   Table{Name: "order", Type: TableTypeTable},
+			Columns: []Column{{Name: "id", Type: "integer"}, {Name: "Total", Type: "numeric(10,2)", Nullable: true}},
+			Indexes: []Index{
+				{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Primary: true},
+				{Name: "sqlite_autoindex_order_1", Columns: []string{"Total"}, Unique: true},
+			},
+		},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, `CREATE TABLE "order" (
+  id integer NOT NULL,
+  "Total" numeric(10,2),
+  PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX "order_Total_key" ON "order" ("Total");
+`, ddl)
+
+	_, err = MigrationDDL("oracle", changes)
+	require.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is a dialect-neutral model of the tables of a database, as written by
+// db schema-dump and compared by db schema-diff. Column types and defaults are
+// normalized, see NormalizeType and NormalizeDefault.
+type Schema struct {
+	// Dialect is the dialect the schema was dumped from.
+	Dialect string        `json:"dialect" yaml:"dialect"`
+	Tables  []TableSchema `json:"tables" yaml:"tables"`
+}
+
+// TableSchema is a table or view with its columns, indexes and foreign keys. Views
+// have no indexes or foreign keys.
+type TableSchema struct {
+	Table       `yaml:",inline"`
+	Columns     []Column     `json:"columns" yaml:"columns"`
+	Indexes     []Index      `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+	ForeignKeys []ForeignKey `json:"foreign_keys,omitempty" yaml:"foreign_keys,omitempty"`
+}
+
+// Dump reads the schema of all tables and views of the database.
+func (c *Catalog) Dump(ctx context.Context) (*Schema, error) {
+	tables, err := c.Tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Schema{Dialect: c.dialectName, Tables: []TableSchema{}}
+	for _, table := range tables {
+		tableSchema := TableSchema{Table: table}
+
+		columns, err := c.dialect.columns(ctx, c.db, table)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list columns of %s", table.QualifiedName())
+		}
+		for _, column := range columns {
+			column.Type = NormalizeType(column.Type)
+			if column.Default != nil {
+				default_ := NormalizeDefault(*column.Default)
+				column.Default = &default_
+			}
+			tableSchema.Columns = append(tableSchema.Columns, column)
+		}
+
+		if table.Type == TableTypeTable {
+			tableSchema.Indexes, err = c.dialect.indexes(ctx, c.db, table)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not list indexes of %s", table.QualifiedName())
+			}
+			tableSchema.ForeignKeys, err = c.dialect.foreignKeys(ctx, c.db, table)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not list foreign keys of %s", table.QualifiedName())
+			}
+			// empty lists are left out of the dump
+			if len(tableSchema.Indexes) == 0 {
+				tableSchema.Indexes = nil
+			}
+			if len(tableSchema.ForeignKeys) == 0 {
+				tableSchema.ForeignKeys = nil
+			}
+		}
+
+		ret.Tables = append(ret.Tables, tableSchema)
+	}
+	return ret, nil
+}
+
+// LoadSchema reads a schema written by db schema-dump, as YAML or JSON.
+func LoadSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read schema %s", path)
+	}
+	ret := &Schema{}
+	// JSON is valid YAML, so both are read by the YAML decoder
+	if err := yaml.Unmarshal(data, ret); err != nil {
+		return nil, errors.Wrapf(err, "could not parse schema %s", path)
+	}
+	return ret, nil
+}
+
+// Marshal encodes the schema as "yaml" or "json".
+func (s *Schema) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		return yaml.Marshal(s)
+	case "json":
+		return json.MarshalIndent(s, "", "  ")
+	default:
+		return nil, errors.Errorf("unknown schema format %s", format)
+	}
+}
+
+// FindTable returns the table with the given qualified name, or nil.
+func (s *Schema) FindTable(name string) *TableSchema {
+	for i := range s.Tables {
+		if s.Tables[i].QualifiedName() == name {
+			return &s.Tables[i]
+		}
+	}
+	return nil
+}
+
+var (
+	whitespaceRegexp   = regexp.MustCompile(`\s+`)
+	displayWidthRegexp = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint)\(\d+\)`)
+	castRegexp         = regexp.MustCompile(`::[a-z][a-z0-9 _]*(\[\])?$`)
+)
+
+// typeAliases maps the type names of the different dialects to a common name.
+var typeAliases = map[string]string{
+	"int":                         "integer",
+	"int4":                        "integer",
+	"mediumint":                   "integer",
+	"int8":                        "bigint",
+	"int2":                        "smallint",
+	"bool":                        "boolean",
+	"character varying":           "varchar",
+	"char varying":                "varchar",
+	"character":                   "char",
+	"bpchar":                      "char",
+	"float8":                      "double",
+	"double precision":            "double",
+	"float4":                      "real",
+	"float":                       "real",
+	"decimal":                     "numeric",
+	"datetime":                    "timestamp",
+	"timestamp without time zone": "timestamp",
+	"timestamp with time zone":    "timestamptz",
+	"time without time zone":      "time",
+	"time with time zone":         "timetz",
+}
+
+// NormalizeType returns the dialect-neutral name of a column type: lower case, with
+// aliases such as int4, int(11) or character varying replaced by a common name.
+// Length and precision arguments are kept.
+func NormalizeType(type_ string) string {
+	t := strings.ToLower(strings.TrimSpace(whitespaceRegexp.ReplaceAllString(type_, " ")))
+	if t == "tinyint(1)" {
+		return "boolean"
+	}
+	t = displayWidthRegexp.ReplaceAllString(t, "$1")
+
+	// the longest alias wins, so that character varying(n) is not read as character
+	alias := ""
+	for name := range typeAliases {
+		if len(name) > len(alias) && strings.HasPrefix(t, name) &&
+			(len(t) == len(name) || t[len(name)] == '(' || t[len(name)] == ' ') {
+			alias = name
+		}
+	}
+	if alias == "" {
+		return t
+	}
+	return typeAliases[alias] + t[len(alias):]
+}
+
+// NormalizeDefault strips the casts postgres adds to default values, as in
+// 'member'::text.
+func NormalizeDefault(default_ string) string {
+	for {
+		stripped := castRegexp.ReplaceAllString(default_, "")
+		if stripped == default_ {
+			return strings.TrimSpace(default_)
+		}
+		default_ = stripped
+	}
+}
@@ -0,0 +1,158 @@
+package cmds
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	clay_sql "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/loader"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// AttachedFile is a file loaded into the scratch database, as passed to --attach.
+type AttachedFile struct {
+	Path  string
+	Table string
+}
+
+var tableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var nonIdentifierRegexp = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// ParseAttachedFile parses a file[:table] specification. Without a table, the
+// table is named after the file, without its extension.
+func ParseAttachedFile(spec string) (AttachedFile, error) {
+	path, table := spec, ""
+	if i := strings.LastIndex(spec, ":"); i >= 0 && tableNameRegexp.MatchString(spec[i+1:]) {
+		path, table = spec[:i], spec[i+1:]
+	}
+	if path == "" {
+		return AttachedFile{}, errors.Errorf("invalid attached file %q, expected file[:table]", spec)
+	}
+
+	if table == "" {
+		base := filepath.Base(path)
+		table = nonIdentifierRegexp.ReplaceAllString(strings.TrimSuffix(base, filepath.Ext(base)), "_")
+		if table == "" || table == "_" {
+			return AttachedFile{}, errors.Errorf("could not derive a table name from %s, use %s:table", path, path)
+		}
+		if table[0] >= '0' && table[0] <= '9' {
+			table = "_" + table
+		}
+	}
+
+	return AttachedFile{Path: path, Table: table}, nil
+}
+
+// AttachedFilesFromValues returns the files passed to --attach, or nil when the
+// command has no sql-attach section.
+func AttachedFilesFromValues(parsedValues *values.Values) ([]AttachedFile, error) {
+	if _, ok := parsedValues.Get(flags.SqlAttachSlug); !ok {
+		return nil, nil
+	}
+	s := &flags.SqlAttachSettings{}
+	if err := parsedValues.DecodeSectionInto(flags.SqlAttachSlug, s); err != nil {
+		return nil, err
+	}
+
+	ret := []AttachedFile{}
+	tables := map[string]string{}
+	for _, spec := range s.Attach {
+		file, err := ParseAttachedFile(spec)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := tables[strings.ToLower(file.Table)]; ok {
+			return nil, errors.Errorf("%s and %s are both attached as table %s", other, file.Path, file.Table)
+		}
+		tables[strings.ToLower(file.Table)] = file.Path
+		ret = append(ret, file)
+	}
+	return ret, nil
+}
+
+// OpenAttachedFiles loads files into a new in-memory sqlite database, one table
+// per file, with column types inferred from the records. A record that can't be
+// loaded is an error, so that queries never run against partial data.
+func OpenAttachedFiles(ctx context.Context, files []AttachedFile) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// each connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	for _, file := range files {
+		_, err := loader.Load(ctx, db, file.Path, loader.Options{
+			Table:       file.Table,
+			CreateTable: true,
+		}, func(rejection loader.Rejection) error {
+			return errors.Errorf("record %d: %s", rejection.Position, rejection.Reason)
+		})
+		if err != nil {
+			_ = db.Close()
+			return nil, errors.Wrapf(err, "could not attach %s", file.Path)
+		}
+	}
+
+	return db, nil
+}
+
+// OpenDatabase opens the database the queries of parsedValues run on: the files
+// passed to --attach, loaded into an in-memory sqlite database, for commands with
+// the sql-attach section, or the connection of factory. It also returns the
+// description of the database it opened, for the query observers.
+func OpenDatabase(
+	ctx context.Context,
+	factory clay_sql.DBConnectionFactory,
+	parsedValues *values.Values,
+) (*sqlx.DB, string, error) {
+	files, err := AttachedFilesFromValues(parsedValues)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(files) > 0 {
+		db, err := OpenAttachedFiles(ctx, files)
+		if err != nil {
+			return nil, "", err
+		}
+		return db, describeAttachedFiles(files), nil
+	}
+
+	db, err := factory(ctx, parsedValues)
+	if err != nil {
+		return nil, "", err
+	}
+	connection := ""
+	if config, err := clay_sql.NewConfigFromRawParsedLayers(parsedValues); err == nil {
+		connection = DescribeConnection(config)
+	}
+	return db, connection, nil
+}
+
+// WithAttachedFiles wraps a connection factory so that commands with the
+// sql-attach section run against the files passed to --attach, loaded into an
+// in-memory sqlite database, instead of the configured connection.
+func WithAttachedFiles(factory clay_sql.DBConnectionFactory) clay_sql.DBConnectionFactory {
+	return func(ctx context.Context, parsedValues *values.Values) (*sqlx.DB, error) {
+		db, _, err := OpenDatabase(ctx, factory, parsedValues)
+		return db, err
+	}
+}
+
+// describeAttachedFiles describes the scratch database of files for the query
+// observers, in the format of DescribeConnection.
+func describeAttachedFiles(files []AttachedFile) string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	return "sqlite:attach:" + strings.Join(paths, ",")
+}
@@ -0,0 +1,135 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	clay_sql "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAttachedFile(t *testing.T) {
+	for spec, expected := range map[string]AttachedFile{
+		"data.csv:orders":        {Path: "data.csv", Table: "orders"},
+		"exports/data.csv":       {Path: "exports/data.csv", Table: "data"},
+		"2024 sales.jsonl":       {Path: "2024 sales.jsonl", Table: "_2024_sales"},
+		"C:/exports/data.csv":    {Path: "C:/exports/data.csv", Table: "data"},
+		`C:\exports\data.csv:t1`: {Path: `C:\exports\data.csv`, Table: "t1"},
+	} {
+		file, err := ParseAttachedFile(spec)
+		require.NoError(t, err, spec)
+		require.Equal(t, expected, file, spec)
+	}
+
+	_, err := ParseAttachedFile(":orders")
+	require.Error(t, err)
+}
+
+func TestWithAttachedFiles(t *testing.T) {
+	dir := t.TempDir()
+	orders := filepath.Join(dir, "data.csv")
+	require.NoError(t, os.WriteFile(orders, []byte("id,customer_id,total\n1,1,10.5\n2,1,4\n3,2,7\n"), 0o644))
+	customers := filepath.Join(dir, "customers.jsonl")
+	require.NoError(t, os.WriteFile(customers, []byte("{\"id\":1,\"name\":\"ada\"}\n{\"id\":2,\"name\":\"bob\"}\n"), 0o644))
+
+	factoryCalled := false
+	factory := WithAttachedFiles(func(ctx context.Context, parsedValues *values.Values) (*sqlx.DB, error) {
+		factoryCalled = true
+		return nil, nil
+	})
+
+	db, err := factory(context.Background(), attachValues(t, []string{orders + ":orders", customers}))
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	require.False(t, factoryCalled)
+
+	var totals []struct {
+		Name  string  `db:"name"`
+		Total float64 `db:"total"`
+	}
+	require.NoError(t, db.Select(&totals, `SELECT c.name, SUM(o.total) AS total
+FROM orders o JOIN customers c ON c.id = o.customer_id GROUP BY 1 ORDER BY 1`))
+	require.Len(t, totals, 2)
+	require.Equal(t, "ada", totals[0].Name)
+	require.Equal(t, 14.5, totals[0].Total)
+
+	_, err = factory(context.Background(), attachValues(t, []string{orders + ":t", customers + ":T"}))
+	require.EqualError(t, err, orders+" and "+customers+" are both attached as table T")
+
+	_, err = factory(context.Background(), attachValues(t, nil))
+	require.NoError(t, err)
+	require.True(t, factoryCalled)
+}
+
+func TestSqlCommandDescribesTheDatabaseItOpened(t *testing.T) {
+	dir := t.TempDir()
+	orders := filepath.Join(dir, "data.csv")
+	require.NoError(t, os.WriteFile(orders, []byte("id,total\n1,10.5\n"), 0o644))
+
+	connections := []string{}
+	newCommand := func(options ...SqlCommandOption) *SqlCommand {
+		command, err := NewSqlCommand(cmds.NewCommandDescription("orders"), append([]SqlCommandOption{
+			WithDbConnectionFactory(clay_sql.OpenDatabaseFromDefaultSqlConnectionLayer),
+			WithQuery("SELECT 1"),
+			WithQueryObservers(QueryObserverFunc(func(_ context.Context, execution *QueryExecution) {
+				connections = append(connections, execution.Connection)
+			})),
+		}, options...)...)
+		require.NoError(t, err)
+		return command
+	}
+	run := func(command *SqlCommand, valuesForSections map[string]map[string]interface{}) {
+		parsedValues, err := runner.ParseCommandValues(command, runner.WithValuesForSections(valuesForSections))
+		require.NoError(t, err)
+		gp := middlewares.NewTableProcessor()
+		gp.AddTableMiddleware(&table.NullTableMiddleware{})
+		require.NoError(t, command.RunIntoGlazeProcessor(context.Background(), parsedValues, gp))
+	}
+	database := filepath.Join(dir, "shop.db")
+	connection := map[string]interface{}{"db-type": "sqlite", "database": database}
+
+	// the command of serve and MCP can't be run against attached files
+	command := newCommand()
+	_, ok := command.Description().Schema.Get(flags.SqlAttachSlug)
+	require.False(t, ok)
+	run(command, map[string]map[string]interface{}{clay_sql.SqlConnectionSlug: connection})
+
+	command = newCommand(WithAttachSection())
+	run(command, map[string]map[string]interface{}{
+		clay_sql.SqlConnectionSlug: connection,
+		flags.SqlAttachSlug:        {"attach": []string{orders}},
+	})
+	run(command, map[string]map[string]interface{}{clay_sql.SqlConnectionSlug: connection})
+
+	require.Equal(t, []string{"sqlite:" + database, "sqlite:attach:" + orders, "sqlite:" + database}, connections)
+}
+
+func attachValues(t *testing.T, files []string) *values.Values {
+	t.Helper()
+
+	section, err := flags.NewSqlAttachParameterLayer()
+	require.NoError(t, err)
+
+	parsed := values.New()
+	err = sources.Execute(
+		schema.NewSchema(schema.WithSections(section)),
+		parsed,
+		sources.FromMap(map[string]map[string]interface{}{
+			flags.SqlAttachSlug: {"attach": files},
+		}),
+		sources.FromDefaults(),
+	)
+	require.NoError(t, err)
+	return parsed
+}
@@ -0,0 +1,43 @@
+package cmds
+
+import (
+	"context"
+	"os"
+	"os/user"
+)
+
+// The origins of the queries run by sqleton commands.
+const (
+	OriginCLI  = "cli"
+	OriginHTTP = "http"
+	OriginMCP  = "mcp"
+)
+
+type callerKey struct{}
+
+type caller struct {
+	user   string
+	origin string
+}
+
+// ContextWithCaller attaches the identity of whoever triggered the queries run
+// with ctx. When no caller is set, the OS user is the caller, with the cli origin.
+func ContextWithCaller(ctx context.Context, origin string, user string) context.Context {
+	return context.WithValue(ctx, callerKey{}, &caller{user: user, origin: origin})
+}
+
+// CallerFromContext returns the origin and the user set with ContextWithCaller.
+func CallerFromContext(ctx context.Context) (string, string) {
+	if c, ok := ctx.Value(callerKey{}).(*caller); ok {
+		return c.origin, c.user
+	}
+	return OriginCLI, CurrentUser()
+}
+
+// CurrentUser returns the name of the OS user running sqleton.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
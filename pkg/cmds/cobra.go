@@ -15,6 +15,7 @@ import (
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	glazed_config "github.com/go-go-golems/glazed/pkg/config"
 	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -53,6 +54,8 @@ func BuildCobraCommandWithSqletonMiddlewares(
 			clay_sql.DbtSlug,
 			clay_sql.SqlConnectionSlug,
 			flags.SqlHelpersSlug,
+			flags.SqlAttachSlug,
+			flags.SqlSaveAsSlug,
 		),
 	}, options...)
 
@@ -93,12 +96,10 @@ func GetSqletonAdditionalMiddlewares(
 		return nil, err
 	}
 
-	xdgConfigPath, err := os.UserConfigDir()
+	defaultProfileFile, err := DefaultProfileFile()
 	if err != nil {
 		return nil, err
 	}
-
-	defaultProfileFile := fmt.Sprintf("%s/sqleton/profiles.yaml", xdgConfigPath)
 	if profileSettings.ProfileFile == "" {
 		profileSettings.ProfileFile = defaultProfileFile
 	}
@@ -140,3 +141,99 @@ func GetSqletonAdditionalMiddlewares(
 
 	return middlewares_, nil
 }
+
+// ParseCommandArgs parses the flags and arguments of command from args, as they
+// would be given on the command line, for commands that run on a connection
+// that is already open. Only the flags of the command itself are parsed, not the
+// connection or output flags. When args ask for help, it returns no values and
+// the usage of the command.
+func ParseCommandArgs(command cmds.Command, args []string) (*values.Values, string, error) {
+	description := command.Description()
+	parser, err := cli.NewCobraParserFromSections(
+		description.Schema.Subset(schema.DefaultSlug),
+		&cli.CobraParserConfig{SkipCommandSettingsSection: true},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cobraCommand := &cobra.Command{Use: description.Name, Short: description.Short}
+	if err := parser.AddToCobraCommand(cobraCommand); err != nil {
+		return nil, "", err
+	}
+	cobraCommand.InitDefaultHelpFlag()
+	if err := cobraCommand.ParseFlags(args); err != nil {
+		return nil, "", err
+	}
+	if help, _ := cobraCommand.Flags().GetBool("help"); help {
+		return nil, fmt.Sprintf("%s\n\nFlags:\n%s", description.Short, cobraCommand.Flags().FlagUsages()), nil
+	}
+
+	parsedValues, err := parser.Parse(cobraCommand, cobraCommand.Flags().Args())
+	if err != nil {
+		return nil, "", err
+	}
+	return parsedValues, "", nil
+}
+
+// DefaultProfileFile returns the profiles file used when --profile-file is not set.
+func DefaultProfileFile() (string, error) {
+	xdgConfigPath, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/sqleton/profiles.yaml", xdgConfigPath), nil
+}
+
+// ProfileValues parses the sections of schema_ from a single profile, on top of their
+// defaults, ignoring flags and environment. This is used by commands that connect to
+// several databases, each given by a profile. An empty profileFile is the default
+// profiles file.
+func ProfileValues(schema_ *schema.Schema, profileFile string, profile string) (*values.Values, error) {
+	defaultProfileFile, err := DefaultProfileFile()
+	if err != nil {
+		return nil, err
+	}
+	if profileFile == "" {
+		profileFile = defaultProfileFile
+	}
+
+	parsedValues := values.New()
+	err = sources.Execute(schema_, parsedValues,
+		sources.GatherFlagsFromProfiles(
+			defaultProfileFile,
+			profileFile,
+			profile,
+			"default",
+			fields.WithSource("profiles"),
+			fields.WithMetadata(map[string]interface{}{
+				"profileFile": profileFile,
+				"profile":     profile,
+			}),
+		),
+		sources.FromDefaults(fields.WithSource(fields.SourceDefaults)),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load profile %s", profile)
+	}
+	return parsedValues, nil
+}
+
+// SqliteValues parses the sections of schema_ for a connection to the sqlite file at
+// path, on top of their defaults, like ProfileValues.
+func SqliteValues(schema_ *schema.Schema, path string) (*values.Values, error) {
+	parsedValues := values.New()
+	err := sources.Execute(schema_, parsedValues,
+		sources.FromMap(map[string]map[string]interface{}{
+			clay_sql.SqlConnectionSlug: {
+				"db-type":  "sqlite",
+				"database": path,
+			},
+		}),
+		sources.FromDefaults(fields.WithSource(fields.SourceDefaults)),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not configure sqlite database %s", path)
+	}
+	return parsedValues, nil
+}
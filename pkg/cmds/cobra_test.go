@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	clay_sql "github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cli"
 	"github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/sources"
@@ -62,3 +63,49 @@ func newParsedCommandSettings(t *testing.T, commandSettings map[string]interface
 
 	return parsed
 }
+
+func TestProfileValues(t *testing.T) {
+	profileFile := filepath.Join(t.TempDir(), "profiles.yaml")
+	require.NoError(t, os.WriteFile(profileFile, []byte(`
+staging:
+  sql-connection:
+    db-type: sqlite
+    database: staging.db
+production:
+  sql-connection:
+    db-type: pg
+    database: app
+`), 0o644))
+
+	section, err := clay_sql.NewSqlConnectionParameterLayer()
+	require.NoError(t, err)
+	schema_ := schema.NewSchema(schema.WithSections(section))
+
+	for profile, expected := range map[string][2]string{
+		"staging":    {"sqlite", "staging.db"},
+		"production": {"pg", "app"},
+	} {
+		parsed, err := ProfileValues(schema_, profileFile, profile)
+		require.NoError(t, err)
+		settings := &clay_sql.DatabaseConfig{}
+		require.NoError(t, parsed.DecodeSectionInto(clay_sql.SqlConnectionSlug, settings))
+		require.Equal(t, expected[0], settings.Type, profile)
+		require.Equal(t, expected[1], settings.Database, profile)
+	}
+
+	_, err = ProfileValues(schema_, profileFile, "nope")
+	require.Error(t, err)
+}
+
+func TestSqliteValues(t *testing.T) {
+	section, err := clay_sql.NewSqlConnectionParameterLayer()
+	require.NoError(t, err)
+	schema_ := schema.NewSchema(schema.WithSections(section))
+
+	parsed, err := SqliteValues(schema_, "/tmp/out.db")
+	require.NoError(t, err)
+	settings := &clay_sql.DatabaseConfig{}
+	require.NoError(t, parsed.DecodeSectionInto(clay_sql.SqlConnectionSlug, settings))
+	require.Equal(t, "sqlite", settings.Type)
+	require.Equal(t, "/tmp/out.db", settings.Database)
+}
@@ -0,0 +1,36 @@
+package cmds
+
+// QueryStage is the step of running a SqlCommand that failed.
+type QueryStage string
+
+const (
+	// QueryStageConnect covers opening and pinging the database.
+	QueryStageConnect QueryStage = "connect"
+	// QueryStageRender covers rendering the query template with the parameters.
+	QueryStageRender QueryStage = "render"
+	// QueryStageExecute covers running the query and reading its rows.
+	QueryStageExecute QueryStage = "execute"
+)
+
+// QueryError is returned by SqlCommand when connecting, rendering the query or running
+// it fails, so that callers can tell these apart from invalid parameters. The message
+// is the one of the wrapped error.
+type QueryError struct {
+	Stage QueryStage
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+func newQueryError(stage QueryStage, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &QueryError{Stage: stage, Err: err}
+}
@@ -1,14 +1,58 @@
 package cmds
 
 import (
+	"strings"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
 	"github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/parka/pkg/handlers"
 )
 
-func NewRepositoryFactory() handlers.RepositoryFactory {
+// NewRepositoryFactory returns a factory of repositories of sql commands, as served
+// by parka. The command sources of federated commands are found with lookup.
+func NewRepositoryFactory(lookup CommandLookup, observers ...QueryObserver) handlers.RepositoryFactory {
 	loader := &SqlCommandLoader{
 		DBConnectionFactory: sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		QueryObservers:      observers,
+		CommandLookup:       lookup,
 	}
 
 	return handlers.NewRepositoryFactoryFromReaderLoaders(loader)
 }
+
+// FindRepositoryCommand returns the command with the given full path (e.g. mysql/ps).
+// Unlike Repository.GetCommand, it doesn't return the first command below a
+// matching prefix.
+func FindRepositoryCommand(repositories_ []*repositories.Repository, path string) (cmds.Command, bool) {
+	path = strings.Trim(path, "/")
+	for _, repository := range repositories_ {
+		command, ok := repository.GetCommand(path)
+		if ok && command.Description().FullPath() == path {
+			return command, true
+		}
+	}
+	return nil, false
+}
+
+// RepositoryCommandValues parses the values to run a repository command with, from
+// parameters for its flags and arguments, and the connection sections of
+// connectionValues, the values of the command that runs it.
+func RepositoryCommandValues(
+	command cmds.Command,
+	parameters map[string]interface{},
+	connectionValues *values.Values,
+) (*values.Values, error) {
+	valuesForSections := map[string]map[string]interface{}{
+		schema.DefaultSlug: parameters,
+	}
+	for _, slug := range []string{sql.SqlConnectionSlug, sql.DbtSlug} {
+		if sectionValues, ok := connectionValues.Get(slug); ok {
+			valuesForSections[slug] = sectionValues.Fields.ToMap()
+		}
+	}
+	return runner.ParseCommandValues(command, runner.WithValuesForSections(valuesForSections))
+}
@@ -0,0 +1,310 @@
+package cmds
+
+import (
+	"context"
+	"strings"
+
+	clay_sql "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	"github.com/go-go-golems/sqleton/pkg/copier"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// SourceSpec is a source of a federated command: the rows of a query or of a
+// repository command, run on a connection profile and loaded into a table of the
+// scratch sqlite database the query of the command runs on.
+type SourceSpec struct {
+	// Name is the name of the table the rows are loaded into.
+	Name string `yaml:"name"`
+	// Profile is the connection profile the source runs on. The connection of
+	// the command is used if empty.
+	Profile string `yaml:"profile,omitempty"`
+	// Query is a query template, rendered with the parameters of the command.
+	Query string `yaml:"query,omitempty"`
+	// Command is the path of a repository command, run with Parameters.
+	Command    string                 `yaml:"command,omitempty"`
+	Parameters map[string]interface{} `yaml:"parameters,omitempty"`
+}
+
+func (s *SourceSpec) Validate() error {
+	if !tableNameRegexp.MatchString(s.Name) {
+		return errors.Errorf("invalid source name %q, expected a table name", s.Name)
+	}
+	switch {
+	case s.Query != "" && s.Command != "":
+		return errors.Errorf("source %s has both a query and a command", s.Name)
+	case s.Query == "" && s.Command == "":
+		return errors.Errorf("source %s needs a query or a command", s.Name)
+	case s.Query != "" && len(s.Parameters) > 0:
+		return errors.Errorf("source %s has parameters, which are only used by commands", s.Name)
+	}
+	return nil
+}
+
+func validateSources(sources_ []*SourceSpec) error {
+	names := map[string]bool{}
+	for _, source := range sources_ {
+		if source == nil {
+			return errors.New("empty source")
+		}
+		if err := source.Validate(); err != nil {
+			return err
+		}
+		if names[strings.ToLower(source.Name)] {
+			return errors.Errorf("source %s is declared twice", source.Name)
+		}
+		names[strings.ToLower(source.Name)] = true
+	}
+	return nil
+}
+
+// CommandLookup returns the repository command with the given full path, see
+// FindRepositoryCommand.
+type CommandLookup func(path string) (cmds.Command, bool)
+
+type runningSourcesKey struct{}
+
+// openSources loads the sources of the command into a new in-memory sqlite
+// database, along with the files passed to --attach. Without loadSources, the
+// database only holds the attached files, which is enough to render the query.
+func (s *SqlCommand) openSources(
+	ctx context.Context,
+	parsedValues *values.Values,
+	loadSources bool,
+) (*sqlx.DB, error) {
+	files, err := AttachedFilesFromValues(parsedValues)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		for _, source := range s.Sources {
+			if strings.EqualFold(file.Table, source.Name) {
+				return nil, errors.Errorf("%s is attached as table %s, which is a source of %s",
+					file.Path, file.Table, s.FullPath())
+			}
+		}
+	}
+
+	db, err := OpenAttachedFiles(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	if !loadSources {
+		return db, nil
+	}
+
+	// a command can't be one of its own sources, even indirectly
+	running, _ := ctx.Value(runningSourcesKey{}).([]string)
+	for _, path := range running {
+		if path == s.FullPath() {
+			_ = db.Close()
+			return nil, errors.Errorf("%s is one of its own sources", s.FullPath())
+		}
+	}
+	ctx = context.WithValue(ctx, runningSourcesKey{}, append(append([]string{}, running...), s.FullPath()))
+
+	for _, source := range s.Sources {
+		if err := s.loadSource(ctx, db, source, parsedValues); err != nil {
+			_ = db.Close()
+			return nil, errors.Wrapf(err, "could not load source %s", source.Name)
+		}
+	}
+	return db, nil
+}
+
+func (s *SqlCommand) loadSource(
+	ctx context.Context,
+	db *sqlx.DB,
+	source *SourceSpec,
+	parsedValues *values.Values,
+) error {
+	sourceValues, err := sourceConnectionValues(parsedValues, source.Profile)
+	if err != nil {
+		return err
+	}
+
+	copier_, err := copier.New(ctx, db, copier.Options{
+		Table:       source.Name,
+		CreateTable: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	if source.Command != "" {
+		err = s.runSourceCommand(ctx, source, sourceValues, copier_)
+	} else {
+		err = s.runSourceQuery(ctx, db, source, sourceValues, parsedValues.GetDataMap(), copier_)
+	}
+	if err != nil {
+		return err
+	}
+	if err := copier_.Close(ctx); err != nil {
+		return err
+	}
+	if source.Command != "" && !copier_.Created() {
+		return errors.Errorf("command %s returned no rows, so the columns of the table are unknown", source.Command)
+	}
+	return nil
+}
+
+// runSourceQuery renders the query of source with the parameters of the command
+// and copies its rows into gp. A query without rows still creates its table,
+// with text columns.
+func (s *SqlCommand) runSourceQuery(
+	ctx context.Context,
+	scratch *sqlx.DB,
+	source *SourceSpec,
+	sourceValues *values.Values,
+	dataMap map[string]interface{},
+	gp *copier.Copier,
+) error {
+	db, err := s.dbConnectionFactory(ctx, sourceValues)
+	if err != nil {
+		return err
+	}
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	if err := db.PingContext(ctx); err != nil {
+		return errors.Wrapf(err, "could not ping database")
+	}
+
+	query, err := clay_sql.RenderQuery(ctx, db, source.Query, nil, dataMap)
+	if err != nil {
+		return errors.Wrap(err, "could not render query")
+	}
+
+	execution := NewQueryExecution(s.FullPath(), sourceValues)
+	execution.Query = query
+	execution.Parameters = s.commandParameters(dataMap)
+	execution.Parameters["source"] = source.Name
+	counter := NewRowCountingProcessor(gp)
+
+	columns, err := RunQueryIntoGlazeWithColumns(ctx, db, query, counter)
+	observers := append(append([]QueryObserver{}, s.queryObservers...), QueryObserversFromContext(ctx)...)
+	execution.Finish(db, counter.Rows(), err)
+	NotifyQueryObservers(ctx, observers, execution)
+	if err != nil {
+		return err
+	}
+
+	if counter.Rows() > 0 {
+		return nil
+	}
+	table := &catalog.TableSchema{Table: catalog.Table{Name: source.Name, Type: catalog.TableTypeTable}}
+	for i, column := range columns {
+		table.Columns = append(table.Columns, catalog.Column{Name: column, Position: i + 1, Type: "text", Nullable: true})
+	}
+	ddl, err := catalog.CreateTableDDL(catalog.DialectSqlite, table)
+	if err != nil {
+		return err
+	}
+	_, err = scratch.ExecContext(ctx, ddl)
+	return err
+}
+
+// runSourceCommand runs the repository command of source on the source connection,
+// copying its rows into gp.
+func (s *SqlCommand) runSourceCommand(
+	ctx context.Context,
+	source *SourceSpec,
+	sourceValues *values.Values,
+	gp middlewares.Processor,
+) error {
+	if s.commandLookup == nil {
+		return errors.Errorf("command %s can't be looked up outside of a repository", source.Command)
+	}
+	command, ok := s.commandLookup(source.Command)
+	if !ok {
+		return errors.Errorf("command %s not found", source.Command)
+	}
+	glazeCommand, ok := command.(cmds.GlazeCommand)
+	if !ok {
+		return errors.Errorf("command %s does not produce rows", source.Command)
+	}
+
+	defaultSection, hasDefaultSection := command.Description().GetDefaultSection()
+	for name := range source.Parameters {
+		if !hasDefaultSection {
+			return errors.Errorf("command %s has no parameter %s", source.Command, name)
+		}
+		if _, ok := defaultSection.GetDefinitions().Get(name); !ok {
+			return errors.Errorf("command %s has no parameter %s", source.Command, name)
+		}
+	}
+
+	commandValues, err := RepositoryCommandValues(command, source.Parameters, sourceValues)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse parameters for %s", source.Command)
+	}
+	if err := glazeCommand.RunIntoGlazeProcessor(ctx, commandValues, gp); err != nil {
+		return errors.Wrapf(err, "could not run %s", source.Command)
+	}
+	return nil
+}
+
+// sourceConnectionValues returns the connection values of a source: those of
+// profile, read from the profile file of the running command, or the connection
+// of the command itself if profile is empty. The values only hold the connection
+// sections, so that the sources don't see --attach.
+func sourceConnectionValues(parsedValues *values.Values, profile string) (*values.Values, error) {
+	sqlConnectionSection, err := clay_sql.NewSqlConnectionParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+	dbtSection, err := clay_sql.NewDbtParameterLayer()
+	if err != nil {
+		return nil, err
+	}
+	schema_ := schema.NewSchema(schema.WithSections(sqlConnectionSection, dbtSection))
+
+	if profile != "" {
+		return CommandProfileValues(schema_, parsedValues, profile)
+	}
+
+	valuesForSections := map[string]map[string]interface{}{}
+	for _, slug := range []string{clay_sql.SqlConnectionSlug, clay_sql.DbtSlug} {
+		if sectionValues, ok := parsedValues.Get(slug); ok {
+			valuesForSections[slug] = sectionValues.Fields.ToMap()
+		}
+	}
+	ret := values.New()
+	err = sources.Execute(schema_, ret,
+		sources.FromMap(valuesForSections),
+		sources.FromDefaults(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// CommandProfileValues returns the values of the sections of schema_ for profile,
+// read from the profile file given to the running command (--profile-file), if any.
+func CommandProfileValues(schema_ *schema.Schema, parsedValues *values.Values, profile string) (*values.Values, error) {
+	profileSettings := &cli.ProfileSettings{}
+	if _, ok := parsedValues.Get(cli.ProfileSettingsSlug); ok {
+		if err := parsedValues.DecodeSectionInto(cli.ProfileSettingsSlug, profileSettings); err != nil {
+			return nil, err
+		}
+	}
+	return ProfileValues(schema_, profileSettings.ProfileFile, profile)
+}
+
+// describeSources describes the scratch database of a federated command for the
+// query observers, in the format of DescribeConnection.
+func describeSources(sources_ []*SourceSpec) string {
+	names := make([]string, 0, len(sources_))
+	for _, source := range sources_ {
+		names = append(names, source.Name)
+	}
+	return "sqlite:sources:" + strings.Join(names, ",")
+}
@@ -0,0 +1,210 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	clay_sql "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func createSqliteFile(t *testing.T, path string, statements ...string) {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	for _, statement := range statements {
+		_, err := db.Exec(statement)
+		require.NoError(t, err)
+	}
+}
+
+func runFederated(t *testing.T, command *SqlCommand, valuesForSections map[string]map[string]interface{}) ([]types.Row, error) {
+	t.Helper()
+	parsedValues, err := runner.ParseCommandValues(command, runner.WithValuesForSections(valuesForSections))
+	require.NoError(t, err)
+
+	gp := middlewares.NewTableProcessor()
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+	ctx := context.Background()
+	if err := command.RunIntoGlazeProcessor(ctx, parsedValues, gp); err != nil {
+		return nil, err
+	}
+	require.NoError(t, gp.Close(ctx))
+	return gp.GetTable().Rows, nil
+}
+
+func TestFederatedCommand(t *testing.T) {
+	dir := t.TempDir()
+	shop := filepath.Join(dir, "shop.db")
+	createSqliteFile(t, shop,
+		"CREATE TABLE orders (id INTEGER, customer_id INTEGER, total REAL, created TEXT)",
+		"INSERT INTO orders VALUES (1, 1, 10.5, '2024-01-02'), (2, 1, 4, '2024-03-01'), (3, 2, 7, '2024-03-05')")
+	crm := filepath.Join(dir, "crm.db")
+	createSqliteFile(t, crm,
+		"CREATE TABLE customers (id INTEGER, name TEXT)",
+		"INSERT INTO customers VALUES (1, 'ada'), (2, 'bob')")
+	profileFile := filepath.Join(dir, "profiles.yaml")
+	require.NoError(t, os.WriteFile(profileFile, []byte(fmt.Sprintf(`crm:
+  sql-connection:
+    db-type: sqlite
+    database: %s
+`, crm)), 0o644))
+
+	spec, err := ParseSQLFileSpec("revenue.sql", []byte(`/* sqleton
+name: revenue
+short: Revenue per customer
+flags:
+  - name: since
+    type: string
+    default: "2024-01-01"
+sources:
+  - name: orders
+    query: SELECT customer_id, total FROM orders WHERE created >= '{{ .since }}'
+  - name: customers
+    profile: crm
+    query: SELECT id, name FROM customers
+*/
+SELECT c.name, SUM(o.total) AS revenue
+FROM customers c LEFT JOIN orders o ON o.customer_id = c.id
+GROUP BY c.name ORDER BY c.name
+`))
+	require.NoError(t, err)
+
+	profileSection, err := cli.NewProfileSettingsSection()
+	require.NoError(t, err)
+	executions := []*QueryExecution{}
+	compiler := &SqlCommandCompiler{
+		DBConnectionFactory: clay_sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		QueryObservers: []QueryObserver{QueryObserverFunc(func(ctx context.Context, execution *QueryExecution) {
+			executions = append(executions, execution)
+		})},
+	}
+	command, err := compiler.Compile(spec, cmds.WithSections(profileSection))
+	require.NoError(t, err)
+
+	valuesForSections := map[string]map[string]interface{}{
+		clay_sql.SqlConnectionSlug: {"db-type": "sqlite", "database": shop},
+		cli.ProfileSettingsSlug:    {"profile-file": profileFile},
+	}
+	rows, err := runFederated(t, command, valuesForSections)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	revenue, _ := rows[0].Get("revenue")
+	require.Equal(t, 14.5, revenue)
+
+	require.Len(t, executions, 3)
+	require.Equal(t, "orders", executions[0].Parameters["source"])
+	require.Equal(t, "sqlite:"+shop, executions[0].Connection)
+	require.Equal(t, "sqlite:"+crm, executions[1].Connection)
+	require.Equal(t, "sqlite:sources:orders,customers", executions[2].Connection)
+
+	// sources without rows still create their table
+	valuesForSections["default"] = map[string]interface{}{"since": "2025-01-01"}
+	rows, err = runFederated(t, command, valuesForSections)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	revenue, _ = rows[0].Get("revenue")
+	require.Nil(t, revenue)
+}
+
+func TestFederatedCommandSources(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "test.db")
+	createSqliteFile(t, db,
+		"CREATE TABLE customers (id INTEGER, name TEXT)",
+		"INSERT INTO customers VALUES (1, 'ada'), (2, 'bob')")
+
+	commands := map[string]cmds.Command{}
+	compiler := &SqlCommandCompiler{
+		DBConnectionFactory: clay_sql.OpenDatabaseFromDefaultSqlConnectionLayer,
+		CommandLookup: func(path string) (cmds.Command, bool) {
+			command, ok := commands[path]
+			return command, ok
+		},
+	}
+	compile := func(spec *SqlCommandSpec) *SqlCommand {
+		if spec.Short == "" {
+			spec.Short = spec.Name
+		}
+		command, err := compiler.Compile(spec)
+		require.NoError(t, err)
+		commands[spec.Name] = command
+		return command
+	}
+
+	compile(&SqlCommandSpec{
+		Name:  "customers",
+		Flags: []*fields.Definition{fields.New("skip", fields.TypeString, fields.WithDefault(""))},
+		Query: "SELECT * FROM customers WHERE name <> {{ .skip | sqlString }}",
+	})
+
+	report := compile(&SqlCommandSpec{
+		Name: "report",
+		Sources: []*SourceSpec{
+			{Name: "c", Command: "customers", Parameters: map[string]interface{}{"skip": "bob"}},
+		},
+		Query: "SELECT name FROM c",
+	})
+	valuesForSections := map[string]map[string]interface{}{
+		clay_sql.SqlConnectionSlug: {"db-type": "sqlite", "database": db},
+	}
+	rows, err := runFederated(t, report, valuesForSections)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	name, _ := rows[0].Get("name")
+	require.Equal(t, "ada", name)
+
+	empty := compile(&SqlCommandSpec{
+		Name:    "empty",
+		Sources: []*SourceSpec{{Name: "c", Command: "empty_customers"}},
+		Query:   "SELECT name FROM c",
+	})
+	compile(&SqlCommandSpec{Name: "empty_customers", Query: "SELECT * FROM customers WHERE 0"})
+	_, err = runFederated(t, empty, valuesForSections)
+	require.ErrorContains(t, err, "command empty_customers returned no rows")
+
+	unknown := compile(&SqlCommandSpec{
+		Name: "unknown",
+		Sources: []*SourceSpec{
+			{Name: "c", Command: "customers", Parameters: map[string]interface{}{"nope": 1}},
+		},
+		Query: "SELECT name FROM c",
+	})
+	_, err = runFederated(t, unknown, valuesForSections)
+	require.ErrorContains(t, err, "command customers has no parameter nope")
+
+	loop := compile(&SqlCommandSpec{
+		Name:    "loop",
+		Sources: []*SourceSpec{{Name: "l", Command: "loop"}},
+		Query:   "SELECT * FROM l",
+	})
+	_, err = runFederated(t, loop, valuesForSections)
+	require.ErrorContains(t, err, "loop is one of its own sources")
+}
+
+func TestValidateSources(t *testing.T) {
+	for expected, sources_ := range map[string][]*SourceSpec{
+		`invalid source name "a b", expected a table name`: {{Name: "a b", Query: "SELECT 1"}},
+		"source a has both a query and a command":          {{Name: "a", Query: "SELECT 1", Command: "x"}},
+		"source a needs a query or a command":              {{Name: "a"}},
+		"source a has parameters, which are only used by commands": {
+			{Name: "a", Query: "SELECT 1", Parameters: map[string]interface{}{"x": 1}},
+		},
+		"source A is declared twice": {{Name: "a", Query: "SELECT 1"}, {Name: "A", Query: "SELECT 2"}},
+	} {
+		require.EqualError(t, validateSources(sources_), expected)
+	}
+	require.NoError(t, validateSources([]*SourceSpec{{Name: "a", Query: "SELECT 1"}, {Name: "b", Command: "x"}}))
+}
@@ -13,6 +13,12 @@ import (
 
 type SqlCommandLoader struct {
 	DBConnectionFactory sql.DBConnectionFactory
+	QueryObservers      []QueryObserver
+	// CommandLookup finds the command sources of federated commands, usually in
+	// the repositories the loader loads commands into.
+	CommandLookup CommandLookup
+	// AttachFiles adds the sql-attach section to the commands, see WithAttachSection.
+	AttachFiles bool
 }
 
 const sqletonSQLDetectionReadLimit = 64 * 1024
@@ -42,6 +48,9 @@ func (scl *SqlCommandLoader) LoadCommands(
 
 		compiler := &SqlCommandCompiler{
 			DBConnectionFactory: scl.DBConnectionFactory,
+			QueryObservers:      scl.QueryObservers,
+			CommandLookup:       scl.CommandLookup,
+			AttachFiles:         scl.AttachFiles,
 		}
 		cmd, err := compiler.Compile(spec, options...)
 		if err != nil {
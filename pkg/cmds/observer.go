@@ -0,0 +1,223 @@
+package cmds
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	clay_sql "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cli"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/jmoiron/sqlx"
+)
+
+// QueryExecution describes a single statement that was run by a sqleton command.
+// It is handed to every registered QueryObserver once the statement has completed,
+// whether it succeeded or not.
+type QueryExecution struct {
+	Command    string
+	Parameters map[string]interface{}
+	Query      string
+	// Connection describes the database that was queried, without credentials.
+	Connection string
+	Profile    string
+	Rows       int
+	StartedAt  time.Time
+	Duration   time.Duration
+	DBStats    sql.DBStats
+	Err        error
+	// NextCursor is set by paginated queries that stopped before the last page, to
+	// fetch the next page.
+	NextCursor string
+}
+
+// NewQueryExecution starts recording an execution of command, filling in the connection
+// and profile from the parsed values when the corresponding sections are present.
+// Commands that open their database with OpenDatabase replace the connection with
+// the description of the database that was actually opened.
+func NewQueryExecution(command string, parsedValues *values.Values) *QueryExecution {
+	ret := &QueryExecution{
+		Command:    command,
+		Parameters: map[string]interface{}{},
+		StartedAt:  time.Now(),
+	}
+	if parsedValues == nil {
+		return ret
+	}
+
+	if _, ok := parsedValues.Get(cli.ProfileSettingsSlug); ok {
+		profileSettings := &cli.ProfileSettings{}
+		if err := parsedValues.DecodeSectionInto(cli.ProfileSettingsSlug, profileSettings); err == nil {
+			ret.Profile = profileSettings.Profile
+		}
+	}
+
+	if config, err := clay_sql.NewConfigFromRawParsedLayers(parsedValues); err == nil {
+		ret.Connection = DescribeConnection(config)
+	}
+
+	return ret
+}
+
+// Finish records the outcome of the execution.
+func (q *QueryExecution) Finish(db *sqlx.DB, rows int, err error) {
+	q.Rows = rows
+	q.Duration = time.Since(q.StartedAt)
+	if db != nil {
+		q.DBStats = db.Stats()
+	}
+	q.Err = err
+}
+
+// QueryHash returns a short stable hash of the rendered query, suitable for
+// correlating log lines without logging the full statement.
+func (q *QueryExecution) QueryHash() string {
+	if q.Query == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(q.Query))
+	return hex.EncodeToString(h[:8])
+}
+
+type QueryObserver interface {
+	ObserveQuery(ctx context.Context, execution *QueryExecution)
+}
+
+type QueryObserverFunc func(ctx context.Context, execution *QueryExecution)
+
+func (f QueryObserverFunc) ObserveQuery(ctx context.Context, execution *QueryExecution) {
+	f(ctx, execution)
+}
+
+type queryObserversKey struct{}
+
+// ContextWithQueryObservers returns a context in which the queries run by sqleton
+// commands are also reported to observers, on top of the observers the commands
+// were created with. This lets a caller see the executions of a single run, for
+// example to return the rendered query.
+func ContextWithQueryObservers(ctx context.Context, observers ...QueryObserver) context.Context {
+	observers = append(QueryObserversFromContext(ctx), observers...)
+	return context.WithValue(ctx, queryObserversKey{}, observers)
+}
+
+// QueryObserversFromContext returns the observers added with ContextWithQueryObservers.
+func QueryObserversFromContext(ctx context.Context) []QueryObserver {
+	observers, _ := ctx.Value(queryObserversKey{}).([]QueryObserver)
+	return append([]QueryObserver{}, observers...)
+}
+
+func NotifyQueryObservers(ctx context.Context, observers []QueryObserver, execution *QueryExecution) {
+	for _, observer := range observers {
+		observer.ObserveQuery(ctx, execution)
+	}
+}
+
+var sensitiveParameterFragments = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"dsn",
+	"api-key",
+	"api_key",
+	"apikey",
+	"credential",
+}
+
+const RedactedValue = "[REDACTED]"
+
+// RedactParameters returns a copy of parameters where the values of keys that look
+// like they carry credentials are replaced with RedactedValue.
+func RedactParameters(parameters map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(parameters))
+	for k, v := range parameters {
+		if isSensitiveParameter(k) {
+			ret[k] = RedactedValue
+			continue
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+func isSensitiveParameter(name string) bool {
+	lower := strings.ToLower(name)
+	for _, fragment := range sensitiveParameterFragments {
+		if strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// DescribeConnection renders a human readable description of the database connection
+// that never includes the password.
+func DescribeConnection(config *clay_sql.DatabaseConfig) string {
+	if config.UseDbtProfiles {
+		return fmt.Sprintf("dbt:%s", config.DbtProfile)
+	}
+	if config.DSN != "" {
+		return fmt.Sprintf("%s:%s", config.Driver, redactDSN(config.DSN))
+	}
+
+	switch strings.ToLower(config.Type) {
+	case "sqlite", "sqlite3", "duckdb", "duck":
+		// file based databases have no host, port or user
+		return fmt.Sprintf("%s:%s", config.Type, config.Database)
+	}
+
+	ret := config.Type + "://"
+	if config.User != "" {
+		ret += config.User + "@"
+	}
+	ret += config.Host
+	if config.Port != 0 {
+		ret += fmt.Sprintf(":%d", config.Port)
+	}
+	if config.Database != "" {
+		ret += "/" + config.Database
+	}
+	return ret
+}
+
+var keyValuePasswordRegexp = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+var mysqlPasswordRegexp = regexp.MustCompile(`^([^:/@]+):[^@]*@`)
+
+func redactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		if u, err := url.Parse(dsn); err == nil {
+			return u.Redacted()
+		}
+	}
+	if keyValuePasswordRegexp.MatchString(dsn) {
+		return keyValuePasswordRegexp.ReplaceAllString(dsn, "${1}"+RedactedValue)
+	}
+	return mysqlPasswordRegexp.ReplaceAllString(dsn, "${1}:"+RedactedValue+"@")
+}
+
+// RowCountingProcessor forwards rows to the wrapped processor while counting them.
+type RowCountingProcessor struct {
+	middlewares.Processor
+	rows int
+}
+
+func NewRowCountingProcessor(gp middlewares.Processor) *RowCountingProcessor {
+	return &RowCountingProcessor{Processor: gp}
+}
+
+func (p *RowCountingProcessor) AddRow(ctx context.Context, row types.Row) error {
+	p.rows++
+	return p.Processor.AddRow(ctx, row)
+}
+
+func (p *RowCountingProcessor) Rows() int {
+	return p.rows
+}
@@ -0,0 +1,142 @@
+package cmds
+
+import (
+	"context"
+	"testing"
+
+	clay_sql "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlCommandNotifiesQueryObservers(t *testing.T) {
+	executions := []*QueryExecution{}
+	observer := QueryObserverFunc(func(_ context.Context, execution *QueryExecution) {
+		executions = append(executions, execution)
+	})
+
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test",
+			cmds.WithFlags(fields.New("name", fields.TypeString)),
+			cmds.WithParents("reports"),
+		),
+		WithDbConnectionFactory(createDB),
+		WithQuery("SELECT * FROM test WHERE name != {{ .name | sqlString }}"),
+		WithQueryObservers(observer),
+	)
+	require.NoError(t, err)
+
+	parsedLayers, err := makeSimpleDefaultLayer(
+		values.WithFieldValue("name", "test2"),
+		values.WithFieldValue("test", "ignored"),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	gp := middlewares.NewTableProcessor()
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+	require.NoError(t, s.RunIntoGlazeProcessor(ctx, parsedLayers, gp))
+
+	require.Len(t, executions, 1)
+	execution := executions[0]
+	require.NoError(t, execution.Err)
+	require.Equal(t, "reports/test", execution.Command)
+	require.Equal(t, "SELECT * FROM test WHERE name != 'test2'", execution.Query)
+	require.Equal(t, map[string]interface{}{"name": "test2"}, execution.Parameters)
+	require.Equal(t, 2, execution.Rows)
+	require.NotEmpty(t, execution.QueryHash())
+}
+
+func TestSqlCommandReportsQueryErrorsToObservers(t *testing.T) {
+	var observed *QueryExecution
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("broken"),
+		WithDbConnectionFactory(createDB),
+		WithQuery("SELECT * FROM missing_table"),
+		WithQueryObservers(QueryObserverFunc(func(_ context.Context, execution *QueryExecution) {
+			observed = execution
+		})),
+	)
+	require.NoError(t, err)
+
+	gp := middlewares.NewTableProcessor()
+	err = s.RunIntoGlazeProcessor(context.Background(), values.New(), gp)
+	require.Error(t, err)
+
+	require.NotNil(t, observed)
+	require.Error(t, observed.Err)
+	require.Equal(t, 0, observed.Rows)
+
+	var queryError *QueryError
+	require.ErrorAs(t, err, &queryError)
+	require.Equal(t, QueryStageExecute, queryError.Stage)
+}
+
+func TestSqlCommandNotifiesContextQueryObservers(t *testing.T) {
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test"),
+		WithDbConnectionFactory(createDB),
+		WithQuery("SELECT * FROM test WHERE id = 2"),
+	)
+	require.NoError(t, err)
+
+	queries := []string{}
+	ctx := ContextWithQueryObservers(context.Background(),
+		QueryObserverFunc(func(_ context.Context, execution *QueryExecution) {
+			queries = append(queries, execution.Query)
+		}))
+
+	gp := middlewares.NewTableProcessor()
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+	require.NoError(t, s.RunIntoGlazeProcessor(ctx, values.New(), gp))
+	require.Equal(t, []string{"SELECT * FROM test WHERE id = 2"}, queries)
+
+	s.Query = "SELECT * FROM test WHERE id = {{ 2 | nope }}"
+	err = s.RunIntoGlazeProcessor(ctx, values.New(), gp)
+	var queryError *QueryError
+	require.ErrorAs(t, err, &queryError)
+	require.Equal(t, QueryStageRender, queryError.Stage)
+	require.Len(t, queries, 2)
+}
+
+func TestRedactParameters(t *testing.T) {
+	redacted := RedactParameters(map[string]interface{}{
+		"password": "hunter2",
+		"dsn":      "postgres://user:pw@host/db",
+		"apiToken": "abc",
+		"limit":    10,
+	})
+
+	require.Equal(t, RedactedValue, redacted["password"])
+	require.Equal(t, RedactedValue, redacted["dsn"])
+	require.Equal(t, RedactedValue, redacted["apiToken"])
+	require.Equal(t, 10, redacted["limit"])
+}
+
+func TestDescribeConnectionOmitsPasswords(t *testing.T) {
+	require.Equal(t,
+		"mysql://reporter@db:3306/app",
+		DescribeConnection(&clay_sql.DatabaseConfig{
+			Type: "mysql", User: "reporter", Password: "hunter2", Host: "db", Port: 3306, Database: "app",
+		}))
+
+	for _, dsn := range []string{
+		"postgres://reporter:hunter2@db:5432/app?sslmode=disable",
+		"host=db user=reporter password=hunter2 dbname=app",
+		"reporter:hunter2@tcp(db:3306)/app",
+	} {
+		description := DescribeConnection(&clay_sql.DatabaseConfig{DSN: dsn, Driver: "test"})
+		require.NotContains(t, description, "hunter2", dsn)
+		require.Contains(t, description, "reporter", dsn)
+	}
+}
+
+func TestDescribeConnectionForFileDatabases(t *testing.T) {
+	require.Equal(t,
+		"sqlite:/tmp/test.db",
+		DescribeConnection(&clay_sql.DatabaseConfig{Type: "sqlite", Database: "/tmp/test.db", Port: 3306}))
+}
@@ -0,0 +1,37 @@
+package cmds
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// pageProcessor keeps the value of the paginate-by column in the last row of a
+// page of a paginated command.
+type pageProcessor struct {
+	middlewares.Processor
+	column string
+	rows   int
+	last   interface{}
+}
+
+func (p *pageProcessor) AddRow(ctx context.Context, row types.Row) error {
+	p.rows++
+	p.last, _ = row.Get(p.column)
+	return p.Processor.AddRow(ctx, row)
+}
+
+// nextCursor returns the after value of the next page, when the page was full and
+// there might be more rows, and "" otherwise.
+func (p *pageProcessor) nextCursor(dataMap map[string]interface{}) string {
+	limit, ok := dataMap["limit"].(int)
+	if !ok || limit <= 0 || p.rows < limit || p.last == nil {
+		return ""
+	}
+	if b, ok := p.last.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(p.last)
+}
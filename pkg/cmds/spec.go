@@ -44,6 +44,8 @@ type SqlCommandSpec struct {
 	Metadata   map[string]interface{} `yaml:"metadata,omitempty"`
 	Query      string                 `yaml:"query"`
 	SubQueries map[string]string      `yaml:"subqueries,omitempty"`
+	Sources    []*SourceSpec          `yaml:"sources,omitempty"`
+	PaginateBy string                 `yaml:"paginate-by,omitempty"`
 }
 
 func (s *SqlCommandSpec) Validate() error {
@@ -56,11 +58,19 @@ func (s *SqlCommandSpec) Validate() error {
 	if strings.TrimSpace(s.Query) == "" {
 		return errors.Errorf("sql command spec %q is missing query body", s.Name)
 	}
+	if err := validateSources(s.Sources); err != nil {
+		return errors.Wrapf(err, "sql command spec %q", s.Name)
+	}
 	return nil
 }
 
 type SqlCommandCompiler struct {
 	DBConnectionFactory clay_sql.DBConnectionFactory
+	QueryObservers      []QueryObserver
+	// CommandLookup finds the command sources of federated commands.
+	CommandLookup CommandLookup
+	// AttachFiles adds the sql-attach section to the commands, see WithAttachSection.
+	AttachFiles bool
 }
 
 func (c *SqlCommandCompiler) Compile(
@@ -74,12 +84,19 @@ func (c *SqlCommandCompiler) Compile(
 		return nil, err
 	}
 
-	cmd, err := NewSqlCommand(
-		cmds.NewCommandDescription(spec.Name),
+	commandOptions := []SqlCommandOption{
 		WithDbConnectionFactory(c.DBConnectionFactory),
 		WithQuery(spec.Query),
 		WithSubQueries(spec.SubQueries),
-	)
+		WithSources(spec.Sources),
+		WithPaginateBy(spec.PaginateBy),
+		WithCommandLookup(c.CommandLookup),
+		WithQueryObservers(c.QueryObservers...),
+	}
+	if c.AttachFiles {
+		commandOptions = append(commandOptions, WithAttachSection())
+	}
+	cmd, err := NewSqlCommand(cmds.NewCommandDescription(spec.Name), commandOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +151,17 @@ func normalizeOptionalBoolFlags(flags []*fields.Definition) []*fields.Definition
 }
 
 func ParseSQLFileSpec(path string, contents []byte) (*SqlCommandSpec, error) {
+	return parseSQLFileSpec(path, contents, false)
+}
+
+// ParseSQLFileSpecStrict parses a .sql command like ParseSQLFileSpec, but rejects
+// the preamble keys that are not part of a SqlCommandSpec, which ParseSQLFileSpec
+// ignores, so that a spec written back with MarshalSpecToSQLFile loses nothing.
+func ParseSQLFileSpecStrict(path string, contents []byte) (*SqlCommandSpec, error) {
+	return parseSQLFileSpec(path, contents, true)
+}
+
+func parseSQLFileSpec(path string, contents []byte, strict bool) (*SqlCommandSpec, error) {
 	metadataText, body, err := splitSqletonSQLPreamble(contents)
 	if err != nil {
 		return nil, errors.Wrapf(err, "parse sqleton sql preamble: %s", path)
@@ -141,6 +169,7 @@ func ParseSQLFileSpec(path string, contents []byte) (*SqlCommandSpec, error) {
 
 	spec := &SqlCommandSpec{}
 	decoder := yaml.NewDecoder(strings.NewReader(metadataText))
+	decoder.KnownFields(strict)
 	if err := decoder.Decode(spec); err != nil {
 		return nil, errors.Wrapf(err, "decode sqleton sql metadata: %s", path)
 	}
@@ -199,6 +228,21 @@ func LooksLikeSqletonSQLCommand(contents []byte) bool {
 	return strings.HasPrefix(raw, "sqleton")
 }
 
+// sqlFilePreamble is the part of a SqlCommandSpec written to the preamble of a .sql
+// command, whose query is the body of the file.
+type sqlFilePreamble struct {
+	Name       string                 `yaml:"name"`
+	Short      string                 `yaml:"short"`
+	Long       string                 `yaml:"long,omitempty"`
+	Layout     []*layout.Section      `yaml:"layout,omitempty"`
+	Flags      []*fields.Definition   `yaml:"flags,omitempty"`
+	Arguments  []*fields.Definition   `yaml:"arguments,omitempty"`
+	Tags       []string               `yaml:"tags,omitempty"`
+	Metadata   map[string]interface{} `yaml:"metadata,omitempty"`
+	Sources    []*SourceSpec          `yaml:"sources,omitempty"`
+	PaginateBy string                 `yaml:"paginate-by,omitempty"`
+}
+
 func MarshalSpecToSQLFile(spec *SqlCommandSpec) (string, error) {
 	if spec == nil {
 		return "", errors.New("sql command spec is nil")
@@ -210,15 +254,17 @@ func MarshalSpecToSQLFile(spec *SqlCommandSpec) (string, error) {
 		return "", errors.New("sql command spec with subqueries cannot be marshaled to a .sql file")
 	}
 
-	metadata := &SqlCommandSpec{
-		Name:      spec.Name,
-		Short:     spec.Short,
-		Long:      spec.Long,
-		Layout:    spec.Layout,
-		Flags:     spec.Flags,
-		Arguments: spec.Arguments,
-		Tags:      spec.Tags,
-		Metadata:  spec.Metadata,
+	metadata := &sqlFilePreamble{
+		Name:       spec.Name,
+		Short:      spec.Short,
+		Long:       spec.Long,
+		Layout:     spec.Layout,
+		Flags:      spec.Flags,
+		Arguments:  spec.Arguments,
+		Tags:       spec.Tags,
+		Metadata:   spec.Metadata,
+		Sources:    spec.Sources,
+		PaginateBy: spec.PaginateBy,
 	}
 
 	var buf bytes.Buffer
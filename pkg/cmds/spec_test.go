@@ -1,11 +1,13 @@
 package cmds
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestCompileSetsOptionalBoolFlagDefaultFalse(t *testing.T) {
@@ -68,3 +70,27 @@ func TestCompileDoesNotDefaultRequiredBoolFlag(t *testing.T) {
 	require.True(t, ok)
 	require.Nil(t, flag.Default)
 }
+
+func TestMarshalSpecToSQLFileKeepsTheQueryOutOfThePreamble(t *testing.T) {
+	spec := &SqlCommandSpec{
+		Name:  "active-users",
+		Short: "List active users",
+		Query: "SELECT * FROM users WHERE active",
+	}
+
+	contents, err := MarshalSpecToSQLFile(spec)
+	require.NoError(t, err)
+	preamble, body, err := splitSqletonSQLPreamble([]byte(contents))
+	require.NoError(t, err)
+	require.NotContains(t, preamble, "query:")
+	require.Equal(t, spec.Query, strings.TrimSpace(body))
+
+	parsed, err := ParseSQLFileSpecStrict("active-users.sql", []byte(contents))
+	require.NoError(t, err)
+	require.Equal(t, spec, parsed)
+
+	// YAML specs carry their query
+	yamlSpec, err := yaml.Marshal(spec)
+	require.NoError(t, err)
+	require.Contains(t, string(yamlSpec), "query: SELECT * FROM users WHERE active")
+}
@@ -4,16 +4,22 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 
 	clay_sql "github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
 	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/go-go-golems/sqleton/pkg/watch"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
@@ -35,15 +41,19 @@ type SqlCommand struct {
 	*cmds.CommandDescription `yaml:",inline"`
 	Query                    string                       `yaml:"query"`
 	SubQueries               map[string]string            `yaml:"subqueries,omitempty"`
+	Sources                  []*SourceSpec                `yaml:"sources,omitempty"`
+	PaginateBy               string                       `yaml:"paginate-by,omitempty"`
 	dbConnectionFactory      clay_sql.DBConnectionFactory `yaml:"-"`
-	renderedQuery            string
+	commandLookup            CommandLookup                `yaml:"-"`
+	queryObservers           []QueryObserver              `yaml:"-"`
+	attachFiles              bool                         `yaml:"-"`
 }
 
 func (s *SqlCommand) Metadata(
 	ctx context.Context,
 	parsedValues *values.Values,
 ) (map[string]interface{}, error) {
-	db, err := s.dbConnectionFactory(ctx, parsedValues)
+	db, _, err := s.openDatabase(ctx, parsedValues, false)
 	if err != nil {
 		return nil, err
 	}
@@ -99,6 +109,46 @@ func WithSubQueries(subQueries map[string]string) SqlCommandOption {
 	}
 }
 
+// WithSources makes the command federated: its sources are loaded into a scratch
+// sqlite database, which the query runs on.
+func WithSources(sources_ []*SourceSpec) SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.Sources = sources_
+	}
+}
+
+// WithPaginateBy makes the command paginated: its query returns pages of limit
+// rows, ordered by column and starting after the after parameter. When a page is
+// full, the value of column in its last row is reported as the NextCursor of the
+// execution.
+func WithPaginateBy(column string) SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.PaginateBy = column
+	}
+}
+
+// WithCommandLookup sets how the command sources of a federated command are found.
+func WithCommandLookup(lookup CommandLookup) SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.commandLookup = lookup
+	}
+}
+
+func WithQueryObservers(observers ...QueryObserver) SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.queryObservers = append(s.queryObservers, observers...)
+	}
+}
+
+// WithAttachSection adds the sql-attach section, so that the command can be run
+// against files passed to --attach instead of its connection. serve and MCP leave
+// it out, their clients don't choose the database.
+func WithAttachSection() SqlCommandOption {
+	return func(s *SqlCommand) {
+		s.attachFiles = true
+	}
+}
+
 func NewSqlCommand(
 	description *cmds.CommandDescription,
 	options ...SqlCommandOption,
@@ -119,12 +169,6 @@ func NewSqlCommand(
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create SQL helpers section")
 	}
-	description.Schema.AppendSections(
-		sqlHelpersSection,
-		sqlConnectionSection,
-		dbtSection,
-		glazedSection,
-	)
 
 	ret := &SqlCommand{
 		CommandDescription: description,
@@ -135,6 +179,20 @@ func NewSqlCommand(
 		option(ret)
 	}
 
+	description.Schema.AppendSections(sqlHelpersSection)
+	if ret.attachFiles {
+		sqlAttachSection, err := flags.NewSqlAttachParameterLayer()
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create SQL attach section")
+		}
+		description.Schema.AppendSections(sqlAttachSection)
+	}
+	description.Schema.AppendSections(
+		sqlConnectionSection,
+		dbtSection,
+		glazedSection,
+	)
+
 	return ret, nil
 }
 
@@ -147,9 +205,25 @@ func (s *SqlCommand) RunIntoGlazeProcessor(
 		return errors.New("dbConnectionFactory is not set")
 	}
 
-	db, err := s.dbConnectionFactory(ctx, parsedValues)
+	helperSettings := &flags.SqlHelpersSettings{}
+	if _, ok := parsedValues.Get(flags.SqlHelpersSlug); ok {
+		if err := parsedValues.DecodeSectionInto(flags.SqlHelpersSlug, helperSettings); err != nil {
+			return errors.Wrap(err, "could not decode sql helper settings")
+		}
+	}
+	if origin, _ := CallerFromContext(ctx); origin != OriginCLI {
+		if helperSettings.Watch != "" {
+			return errors.Errorf("--watch can only be used from the command line, not over %s", origin)
+		}
+		if helperSettings.Snapshot != "" {
+			return errors.Errorf("--snapshot can only be used from the command line, not over %s", origin)
+		}
+	}
+
+	// printing the query doesn't need the rows of the sources
+	db, connection, err := s.openDatabase(ctx, parsedValues, !helperSettings.PrintQuery)
 	if err != nil {
-		return err
+		return newQueryError(QueryStageConnect, err)
 	}
 	defer func(db *sqlx.DB) {
 		_ = db.Close()
@@ -157,22 +231,84 @@ func (s *SqlCommand) RunIntoGlazeProcessor(
 
 	err = db.PingContext(ctx)
 	if err != nil {
-		return errors.Wrapf(err, "Could not ping database")
+		return newQueryError(QueryStageConnect, errors.Wrapf(err, "Could not ping database"))
 	}
 
 	dataMap := parsedValues.GetDataMap()
-	helperSettings := &flags.SqlHelpersSettings{}
-	if _, ok := parsedValues.Get(flags.SqlHelpersSlug); ok {
-		if err := parsedValues.DecodeSectionInto(flags.SqlHelpersSlug, helperSettings); err != nil {
-			return errors.Wrap(err, "could not decode sql helper settings")
-		}
-	}
 
 	if helperSettings.PrintQuery {
 		return s.PrintQuery(ctx, db, dataMap)
 	}
 
-	return s.RunIntoGlazeProcessorWithDB(ctx, db, dataMap, gp)
+	watchOptions, err := watch.OptionsFromSqlHelpers(helperSettings)
+	if err != nil {
+		return err
+	}
+	if watchOptions != nil {
+		runs := 0
+		err = watch.Run(ctx, s.FullPath(), parsedValues, *watchOptions,
+			func(ctx context.Context, gp middlewares.Processor) error {
+				runDB := db
+				// the sources of a federated command are reloaded on every run after the first
+				if len(s.Sources) > 0 && runs > 0 {
+					sourcesDB, err := s.openSources(ctx, parsedValues, true)
+					if err != nil {
+						return err
+					}
+					defer func(db *sqlx.DB) {
+						_ = db.Close()
+					}(sourcesDB)
+					runDB = sourcesDB
+				}
+				runs++
+				execution := s.newQueryExecution(parsedValues, connection)
+				return s.runObservedIntoGlazeProcessor(ctx, runDB, dataMap, gp, execution)
+			}, os.Stdout)
+		if err != nil {
+			return err
+		}
+		return &cmds.ExitWithoutGlazeError{}
+	}
+
+	execution := s.newQueryExecution(parsedValues, connection)
+	if helperSettings.Snapshot == "" {
+		return s.runObservedIntoGlazeProcessor(ctx, db, dataMap, gp, execution)
+	}
+
+	if err := snapshots.CheckName(helperSettings.Snapshot); err != nil {
+		return err
+	}
+	recorder := snapshots.NewRecorder(gp)
+	if err := s.runObservedIntoGlazeProcessor(ctx, db, dataMap, recorder, execution); err != nil {
+		return err
+	}
+	snapshot, err := recorder.Save(helperSettings.Snapshot, s.FullPath(), execution.Parameters)
+	if err != nil {
+		return errors.Wrap(err, "could not save snapshot")
+	}
+	log.Debug().Str("path", snapshot.Path).Msg("saved snapshot")
+	return nil
+}
+
+// openDatabase opens the connection of the command, or the scratch database of a
+// federated command, with its sources loaded if loadSources is set. It also returns
+// the description of the database it opened, for the query observers.
+func (s *SqlCommand) openDatabase(
+	ctx context.Context,
+	parsedValues *values.Values,
+	loadSources bool,
+) (*sqlx.DB, string, error) {
+	if len(s.Sources) > 0 {
+		db, err := s.openSources(ctx, parsedValues, loadSources)
+		return db, describeSources(s.Sources), err
+	}
+	return OpenDatabase(ctx, s.dbConnectionFactory, parsedValues)
+}
+
+func (s *SqlCommand) newQueryExecution(parsedValues *values.Values, connection string) *QueryExecution {
+	ret := NewQueryExecution(s.FullPath(), parsedValues)
+	ret.Connection = connection
+	return ret
 }
 
 func (s *SqlCommand) PrintQuery(
@@ -180,13 +316,12 @@ func (s *SqlCommand) PrintQuery(
 	db *sqlx.DB,
 	dataMap map[string]interface{},
 ) error {
-	var err error
-	s.renderedQuery, err = s.RenderQuery(ctx, db, dataMap)
+	query, err := s.RenderQuery(ctx, db, dataMap)
 	if err != nil {
 		return errors.Wrapf(err, "Could not generate query")
 	}
 
-	fmt.Println(s.renderedQuery)
+	fmt.Println(query)
 	return &cmds.ExitWithoutGlazeError{}
 }
 
@@ -196,18 +331,76 @@ func (s *SqlCommand) RunIntoGlazeProcessorWithDB(
 	dataMap map[string]interface{},
 	gp middlewares.Processor,
 ) error {
-	var err error
-	s.renderedQuery, err = s.RenderQuery(ctx, db, dataMap)
+	execution := NewQueryExecution(s.FullPath(), nil)
+	return s.runObservedIntoGlazeProcessor(ctx, db, dataMap, gp, execution)
+}
+
+// runObservedIntoGlazeProcessor renders and runs the query, and reports the execution
+// to the registered query observers.
+func (s *SqlCommand) runObservedIntoGlazeProcessor(
+	ctx context.Context,
+	db *sqlx.DB,
+	dataMap map[string]interface{},
+	gp middlewares.Processor,
+	execution *QueryExecution,
+) error {
+	execution.Parameters = s.commandParameters(dataMap)
+	var page *pageProcessor
+	if s.PaginateBy != "" {
+		page = &pageProcessor{Processor: gp, column: s.PaginateBy}
+		gp = page
+	}
+	counter := NewRowCountingProcessor(gp)
+
+	query, err := s.runIntoGlazeProcessorWithDB(ctx, db, dataMap, counter)
+
+	observers := append(append([]QueryObserver{}, s.queryObservers...), QueryObserversFromContext(ctx)...)
+	if len(observers) > 0 {
+		execution.Query = query
+		execution.Finish(db, counter.Rows(), err)
+		if err == nil && page != nil {
+			execution.NextCursor = page.nextCursor(dataMap)
+		}
+		NotifyQueryObservers(ctx, observers, execution)
+	}
+
+	return err
+}
+
+// runIntoGlazeProcessorWithDB renders and runs the query, and returns the rendered
+// query, which is empty if it could not be rendered. The command is shared by the
+// concurrent requests of serve and MCP, so the query is not kept on it.
+func (s *SqlCommand) runIntoGlazeProcessorWithDB(
+	ctx context.Context,
+	db *sqlx.DB,
+	dataMap map[string]interface{},
+	gp middlewares.Processor,
+) (string, error) {
+	query, err := s.RenderQuery(ctx, db, dataMap)
 	if err != nil {
-		return errors.Wrapf(err, "Could not generate query")
+		return "", newQueryError(QueryStageRender, errors.Wrapf(err, "Could not generate query"))
 	}
 
-	err = s.RunQueryIntoGlaze(ctx, db, gp)
+	err = s.RunQueryIntoGlaze(ctx, db, query, gp)
 	if err != nil {
-		return errors.Wrapf(err, "Could not run query")
+		return query, newQueryError(QueryStageExecute, errors.Wrapf(err, "Could not run query"))
 	}
 
-	return nil
+	return query, nil
+}
+
+// commandParameters restricts dataMap to the flags and arguments declared by the command
+// itself, leaving out connection and output settings.
+func (s *SqlCommand) commandParameters(dataMap map[string]interface{}) map[string]interface{} {
+	ret := map[string]interface{}{}
+	collect := func(definition *fields.Definition) {
+		if v, ok := dataMap[definition.Name]; ok {
+			ret[definition.Name] = v
+		}
+	}
+	s.GetDefaultFlags().ForEach(collect)
+	s.GetDefaultArguments().ForEach(collect)
+	return ret
 }
 
 func (s *SqlCommand) RenderQueryFull(
@@ -218,7 +411,7 @@ func (s *SqlCommand) RenderQueryFull(
 		return "", errors.Errorf("dbConnectionFactory is not set")
 	}
 
-	db, err := s.dbConnectionFactory(ctx, parsedValues)
+	db, _, err := s.openDatabase(ctx, parsedValues, false)
 	if err != nil {
 		return "", err
 	}
@@ -259,12 +452,71 @@ func (s *SqlCommand) RenderQuery(
 	return ret, nil
 }
 
-// RunQueryIntoGlaze runs the query and processes the results into Glaze.
-// This requires RenderQuery to be invoked first in order to have a s.renderedQuery.
+// RunQueryIntoGlaze runs query, as rendered by RenderQuery, and processes the
+// results into Glaze.
 // NOTE(manuel, 2024-04-11) This really could benefit of a further cleanup, what with codegen now
 func (s *SqlCommand) RunQueryIntoGlaze(
 	ctx context.Context,
 	db *sqlx.DB,
+	query string,
 	gp middlewares.Processor) error {
-	return clay_sql.RunQueryIntoGlaze(ctx, db, s.renderedQuery, []interface{}{}, gp)
+	return clay_sql.RunQueryIntoGlaze(ctx, db, query, []interface{}{}, gp)
+}
+
+// Preparer prepares statements, on a database or in a transaction.
+type Preparer interface {
+	PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error)
+}
+
+// RunQueryIntoGlazeWithColumns runs query like clay's RunQueryIntoGlaze, and also
+// returns its columns, which clay doesn't and which are known even when the query
+// returns no rows. Once they are known, the columns are also returned with errors,
+// and errors returned by gp are wrapped, so that they can be found with errors.Is.
+func RunQueryIntoGlazeWithColumns(
+	ctx context.Context,
+	db Preparer,
+	query string,
+	gp middlewares.Processor,
+) ([]string, error) {
+	// use a prepared statement so that when using mysql, we get native types back
+	stmt, err := db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not prepare query: %s", query)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+	rows, err := stmt.QueryxContext(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Could not execute query: %s", query)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Wrap(err, "Could not get columns")
+	}
+	for rows.Next() {
+		m := map[string]interface{}{}
+		if err := rows.MapScan(m); err != nil {
+			return columns, errors.Wrap(err, "Could not scan row")
+		}
+		row := types.NewRow()
+		for _, column := range columns {
+			if v, ok := m[column].([]byte); ok {
+				row.Set(column, string(v))
+			} else {
+				row.Set(column, m[column])
+			}
+		}
+		if err := gp.AddRow(ctx, row); err != nil {
+			return columns, errors.Wrap(err, "Could not process input object")
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return columns, errors.Wrap(err, "Could not read rows")
+	}
+	return columns, nil
 }
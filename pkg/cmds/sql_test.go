@@ -5,13 +5,16 @@ import (
 	"github.com/go-go-golems/clay/pkg/sql"
 	"github.com/go-go-golems/glazed/pkg/cmds"
 	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
 	schema "github.com/go-go-golems/glazed/pkg/cmds/schema"
 	"github.com/go-go-golems/glazed/pkg/cmds/values"
 	assert2 "github.com/go-go-golems/glazed/pkg/helpers/assert"
 	"github.com/go-go-golems/glazed/pkg/middlewares"
 	"github.com/go-go-golems/glazed/pkg/middlewares/table"
 	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/flags"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -464,3 +467,58 @@ func TestMapSubQuery(t *testing.T) {
 	assert.Equal(t, "test1", name)
 
 }
+
+func TestWatchAndSnapshotAreOnlyRunFromTheCLI(t *testing.T) {
+	s, err := NewSqlCommand(
+		cmds.NewCommandDescription("test"),
+		WithDbConnectionFactory(createDB),
+		WithQuery("SELECT * FROM test"),
+	)
+	require.NoError(t, err)
+
+	for flag, value := range map[string]string{"watch": "1s", "snapshot": "before"} {
+		parsedValues, err := runner.ParseCommandValues(s, runner.WithValuesForSections(map[string]map[string]interface{}{
+			flags.SqlHelpersSlug: {flag: value},
+		}))
+		require.NoError(t, err)
+
+		for _, origin := range []string{OriginHTTP, OriginMCP} {
+			gp := middlewares.NewTableProcessor()
+			gp.AddTableMiddleware(&table.NullTableMiddleware{})
+			ctx := ContextWithCaller(context.Background(), origin, "bob")
+			err = s.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+			require.EqualError(t, err, "--"+flag+" can only be used from the command line, not over "+origin)
+		}
+	}
+}
+
+func TestRunQueryIntoGlazeWithColumns(t *testing.T) {
+	ctx := context.Background()
+	db, err := createDB(ctx, nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+
+	gp := middlewares.NewTableProcessor()
+	gp.AddTableMiddleware(&table.NullTableMiddleware{})
+	columns, err := RunQueryIntoGlazeWithColumns(ctx, db, "SELECT id, name FROM test WHERE id > 3", gp)
+	require.NoError(t, err)
+	require.Equal(t, []string{"id", "name"}, columns)
+	require.NoError(t, gp.Close(ctx))
+	require.Empty(t, gp.GetTable().Rows)
+
+	stop := errors.New("stop")
+	columns, err = RunQueryIntoGlazeWithColumns(ctx, db, "SELECT name FROM test", &failingProcessor{err: stop})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, []string{"name"}, columns)
+}
+
+type failingProcessor struct {
+	middlewares.Processor
+	err error
+}
+
+func (p *failingProcessor) AddRow(context.Context, types.Row) error {
+	return p.err
+}
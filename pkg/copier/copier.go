@@ -0,0 +1,80 @@
+// Package copier writes rows into a database table, in batches. It backs sqleton
+// copy, which streams the rows of a table, a query or any sqleton command from one
+// connection into a table on another, and sqleton load, which loads files.
+package copier
+
+import (
+	"context"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/jmoiron/sqlx"
+)
+
+// DefaultBatchSize is the number of rows inserted per transaction.
+const DefaultBatchSize = 500
+
+type Options struct {
+	// Table is the target table, which can be qualified with a schema.
+	Table string
+	// CreateTable creates the table if it doesn't exist.
+	CreateTable bool
+	// ColumnTypes gives the types of the columns of a created table, overriding
+	// the types inferred from the first batch. See InferType for the type names.
+	ColumnTypes map[string]string
+	// BatchSize is the number of rows inserted per transaction, DefaultBatchSize
+	// if zero.
+	BatchSize int
+	// UpsertKey lists the columns identifying a row. When set, rows whose key
+	// already exists in the table are updated instead of inserted. The key has
+	// to be unique in the target table, which it is if the copy created it.
+	UpsertKey []string
+}
+
+// Copier is a glazed processor inserting the rows it is given into a table with a
+// Writer, so that the rows of any command can be copied by running the command
+// into it.
+type Copier struct {
+	*Writer
+	batchSize int
+	batch     []types.Row
+}
+
+var _ middlewares.Processor = (*Copier)(nil)
+
+// New returns a copier writing to db, see NewWriter.
+func New(ctx context.Context, db *sqlx.DB, options Options) (*Copier, error) {
+	writer, err := NewWriter(ctx, db, options)
+	if err != nil {
+		return nil, err
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &Copier{Writer: writer, batchSize: batchSize}, nil
+}
+
+func (c *Copier) AddRow(ctx context.Context, row types.Row) error {
+	if err := c.CheckRow(row); err != nil {
+		return err
+	}
+	c.batch = append(c.batch, row)
+	if len(c.batch) >= c.batchSize {
+		return c.flush(ctx)
+	}
+	return nil
+}
+
+// Close writes the last batch. It doesn't close the database.
+func (c *Copier) Close(ctx context.Context) error {
+	return c.flush(ctx)
+}
+
+func (c *Copier) flush(ctx context.Context) error {
+	if err := c.Write(ctx, c.batch); err != nil {
+		return err
+	}
+	c.batch = nil
+	return nil
+}
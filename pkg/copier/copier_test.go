@@ -0,0 +1,120 @@
+package copier
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func copyRows(t *testing.T, db *sqlx.DB, options Options, rows ...types.Row) *Copier {
+	t.Helper()
+	ctx := context.Background()
+	c, err := New(ctx, db, options)
+	require.NoError(t, err)
+	for _, row := range rows {
+		require.NoError(t, c.AddRow(ctx, row))
+	}
+	require.NoError(t, c.Close(ctx))
+	return c
+}
+
+type user struct {
+	ID    int64   `db:"id"`
+	Name  string  `db:"name"`
+	Score *string `db:"score"`
+}
+
+func TestCopyCreatesTable(t *testing.T) {
+	db := openTestDB(t)
+
+	c := copyRows(t, db, Options{Table: "users", CreateTable: true, BatchSize: 2},
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "ada"), types.MRP("score", 1.5)),
+		types.NewRow(types.MRP("id", 2), types.MRP("name", "bob"), types.MRP("score", nil)),
+		types.NewRow(types.MRP("id", 3), types.MRP("name", "cy")),
+	)
+	require.True(t, c.Created())
+	require.Equal(t, 3, c.Rows())
+
+	cat, err := catalog.New(db)
+	require.NoError(t, err)
+	_, columns, err := cat.Columns(context.Background(), "users")
+	require.NoError(t, err)
+	types_ := map[string]string{}
+	for _, column := range columns {
+		types_[column.Name] = catalog.NormalizeType(column.Type)
+	}
+	require.Equal(t, map[string]string{"id": "bigint", "name": "text", "score": "double"}, types_)
+
+	var names []string
+	require.NoError(t, db.Select(&names, "SELECT name FROM users ORDER BY id"))
+	require.Equal(t, []string{"ada", "bob", "cy"}, names)
+}
+
+func TestCopyUpsert(t *testing.T) {
+	db := openTestDB(t)
+
+	c := copyRows(t, db, Options{Table: "users", CreateTable: true, UpsertKey: []string{"id"}},
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "ada")),
+		types.NewRow(types.MRP("id", 2), types.MRP("name", "bob")),
+	)
+	require.True(t, c.Created())
+
+	c = copyRows(t, db, Options{Table: "users", CreateTable: true, UpsertKey: []string{"id"}},
+		types.NewRow(types.MRP("id", 2), types.MRP("name", "bobby")),
+		types.NewRow(types.MRP("id", 3), types.MRP("name", "cy")),
+	)
+	require.False(t, c.Created())
+	require.Equal(t, 2, c.Rows())
+
+	var names []string
+	require.NoError(t, db.Select(&names, "SELECT name FROM users ORDER BY id"))
+	require.Equal(t, []string{"ada", "bobby", "cy"}, names)
+}
+
+func TestCopyIntoExistingTable(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, score TEXT)`)
+	require.NoError(t, err)
+
+	c := copyRows(t, db, Options{Table: "users", CreateTable: true},
+		types.NewRow(types.MRP("id", 1), types.MRP("name", "ada"), types.MRP("score", map[string]interface{}{"a": 1})),
+	)
+	require.False(t, c.Created())
+
+	var users []user
+	require.NoError(t, db.Select(&users, "SELECT id, name, score FROM users"))
+	require.Len(t, users, 1)
+	require.Equal(t, `{"a":1}`, *users[0].Score)
+
+	ctx := context.Background()
+	c, err = New(ctx, db, Options{Table: "users", CreateTable: true})
+	require.NoError(t, err)
+	err = c.AddRow(ctx, types.NewRow(types.MRP("id", 2), types.MRP("email", "x")))
+	require.EqualError(t, err, "column email does not exist in table users")
+
+	_, err = New(ctx, db, Options{Table: "users", CreateTable: true, UpsertKey: []string{"email"}})
+	require.EqualError(t, err, "upsert key column email does not exist in table users")
+}
+
+func TestInferType(t *testing.T) {
+	require.Equal(t, "text", InferType(nil))
+	require.Equal(t, "text", InferType([]interface{}{nil}))
+	require.Equal(t, "bigint", InferType([]interface{}{nil, 1, int64(2)}))
+	require.Equal(t, "double", InferType([]interface{}{1, 2.5}))
+	require.Equal(t, "boolean", InferType([]interface{}{true, false}))
+	require.Equal(t, "text", InferType([]interface{}{1, "a"}))
+}
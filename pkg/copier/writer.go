@@ -0,0 +1,484 @@
+package copier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// maxParameters bounds the placeholders of a single INSERT statement. It is the
+// limit of older sqlite versions, and well below those of the other databases.
+const maxParameters = 999
+
+// Writer writes batches of rows into a table. Rows are inserted with the columns
+// of the first row checked; later rows can leave columns out, but not add new ones.
+//
+// If the table doesn't exist and Options.CreateTable is set, it is created when the
+// first batch is written, with the types of Options.ColumnTypes or types inferred
+// from the values of that batch (see InferType), and with the upsert key as primary
+// key.
+//
+// On postgres, batches without upsert key are written with COPY, and with
+// multi-row INSERT statements otherwise.
+type Writer struct {
+	db      *sqlx.DB
+	dialect string
+	options Options
+
+	// columns holds the columns of the table once it exists.
+	columns []catalog.Column
+	exists  bool
+	created bool
+
+	rowColumns []string
+	rows       int
+}
+
+// Rejection is a row of a batch that the database refused.
+type Rejection struct {
+	// Index is the index of the row in the batch.
+	Index int
+	Err   error
+}
+
+// NewWriter returns a writer to the table of options. The table is looked up right
+// away, so that a missing table or upsert key column is reported before any row is
+// read. A missing table is returned as a *catalog.TableNotFoundError unless
+// Options.CreateTable is set.
+func NewWriter(ctx context.Context, db *sqlx.DB, options Options) (*Writer, error) {
+	if options.Table == "" {
+		return nil, errors.New("no target table given")
+	}
+
+	catalog_, err := catalog.New(db)
+	if err != nil {
+		return nil, err
+	}
+	ret := &Writer{db: db, dialect: catalog_.Dialect(), options: options}
+
+	_, columns, err := catalog_.Columns(ctx, options.Table)
+	var notFound *catalog.TableNotFoundError
+	switch {
+	case errors.As(err, &notFound) && options.CreateTable:
+		return ret, nil
+	case err != nil:
+		return nil, err
+	}
+
+	ret.exists = true
+	ret.columns = columns
+	for _, key := range options.UpsertKey {
+		if ret.column(key) == nil {
+			return nil, errors.Errorf("upsert key column %s does not exist in table %s", key, options.Table)
+		}
+	}
+	return ret, nil
+}
+
+// Columns returns the columns of the target table, or nil if it doesn't exist yet.
+func (w *Writer) Columns() []catalog.Column {
+	return w.columns
+}
+
+// SetColumnTypes sets Options.ColumnTypes, for callers that infer the types once
+// they know whether the table exists.
+func (w *Writer) SetColumnTypes(columnTypes map[string]string) {
+	w.options.ColumnTypes = columnTypes
+}
+
+// Dialect returns the dialect of the target database.
+func (w *Writer) Dialect() string {
+	return w.dialect
+}
+
+// Rows returns the number of rows written so far.
+func (w *Writer) Rows() int {
+	return w.rows
+}
+
+// Created returns true if the writer created the target table.
+func (w *Writer) Created() bool {
+	return w.created
+}
+
+func (w *Writer) column(name string) *catalog.Column {
+	for i := range w.columns {
+		if w.columns[i].Name == name {
+			return &w.columns[i]
+		}
+	}
+	return nil
+}
+
+// CheckRow returns an error if the columns of row can't be written: if they don't
+// exist in the table, or, after the first row, if they are not columns of the first
+// row.
+func (w *Writer) CheckRow(row types.Row) error {
+	if w.rowColumns != nil {
+		for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+			if !contains(w.rowColumns, pair.Key) {
+				return errors.Errorf("column %s is not in the first copied row", pair.Key)
+			}
+		}
+		return nil
+	}
+
+	rowColumns := []string{}
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		if w.exists && w.column(pair.Key) == nil {
+			return errors.Errorf("column %s does not exist in table %s", pair.Key, w.options.Table)
+		}
+		rowColumns = append(rowColumns, pair.Key)
+	}
+	for _, key := range w.options.UpsertKey {
+		if !contains(rowColumns, key) {
+			return errors.Errorf("upsert key column %s is not in the copied rows", key)
+		}
+	}
+	w.rowColumns = rowColumns
+	return nil
+}
+
+// Write writes rows, which have been checked with CheckRow, in a single
+// transaction.
+func (w *Writer) Write(ctx context.Context, rows []types.Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := w.ensureTable(ctx, rows); err != nil {
+		return err
+	}
+
+	var err error
+	if w.usesCopy() {
+		err = w.copyFrom(ctx, rows)
+	} else {
+		err = w.insert(ctx, rows)
+	}
+	if err != nil {
+		return err
+	}
+	w.rows += len(rows)
+	return nil
+}
+
+// WriteRejecting writes rows like Write. If the batch fails, the rows are written
+// one by one, and those the database refuses are returned instead of failing the
+// batch. An error is only returned if the table can't be created.
+func (w *Writer) WriteRejecting(ctx context.Context, rows []types.Row) ([]Rejection, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	if err := w.ensureTable(ctx, rows); err != nil {
+		return nil, err
+	}
+	if err := w.Write(ctx, rows); err == nil {
+		return nil, nil
+	}
+
+	rejections := []Rejection{}
+	for i, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := w.Write(ctx, []types.Row{row}); err != nil {
+			rejections = append(rejections, Rejection{Index: i, Err: errors.Cause(err)})
+		}
+	}
+	return rejections, nil
+}
+
+func (w *Writer) usesCopy() bool {
+	return w.dialect == catalog.DialectPostgres && len(w.options.UpsertKey) == 0 &&
+		w.db.DriverName() == "pgx"
+}
+
+func (w *Writer) ensureTable(ctx context.Context, rows []types.Row) error {
+	if w.exists {
+		return nil
+	}
+	return w.createTable(ctx, rows)
+}
+
+func (w *Writer) args(row types.Row) ([]interface{}, error) {
+	ret := make([]interface{}, 0, len(w.rowColumns))
+	for _, column := range w.rowColumns {
+		value, _ := row.Get(column)
+		arg, err := toArg(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not convert column %s", column)
+		}
+		ret = append(ret, arg)
+	}
+	return ret, nil
+}
+
+func (w *Writer) insert(ctx context.Context, rows []types.Row) error {
+	tx, err := w.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	rowsPerStatement := maxParameters / len(w.rowColumns)
+	if rowsPerStatement == 0 {
+		rowsPerStatement = 1
+	}
+	for start := 0; start < len(rows); start += rowsPerStatement {
+		end := start + rowsPerStatement
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := w.insertStatement(ctx, tx, rows[start:end]); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "could not commit rows into %s", w.options.Table)
+	}
+	return nil
+}
+
+func (w *Writer) insertStatement(ctx context.Context, tx *sqlx.Tx, rows []types.Row) error {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(w.rowColumns)), ", ") + ")"
+	tuples := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(w.rowColumns))
+	for _, row := range rows {
+		tuples = append(tuples, placeholders)
+		rowArgs, err := w.args(row)
+		if err != nil {
+			return err
+		}
+		args = append(args, rowArgs...)
+	}
+
+	columns := make([]string, 0, len(w.rowColumns))
+	for _, column := range w.rowColumns {
+		columns = append(columns, catalog.QuoteIdentifier(w.dialect, column))
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s",
+		catalog.QuoteTable(w.dialect, w.options.Table),
+		strings.Join(columns, ", "),
+		strings.Join(tuples, ", "),
+		w.upsertClause())
+
+	if _, err := tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+		return errors.Wrapf(err, "could not insert rows into %s", w.options.Table)
+	}
+	return nil
+}
+
+// copyFrom writes rows with the COPY protocol of postgres.
+func (w *Writer) copyFrom(ctx context.Context, rows []types.Row) error {
+	values := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		args, err := w.args(row)
+		if err != nil {
+			return err
+		}
+		values = append(values, args)
+	}
+
+	table := pgx.Identifier{w.options.Table}
+	if schema, name, ok := strings.Cut(w.options.Table, "."); ok {
+		table = pgx.Identifier{schema, name}
+	}
+
+	conn, err := w.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	err = conn.Raw(func(driverConn interface{}) error {
+		pgxConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.Errorf("unexpected postgres connection %T", driverConn)
+		}
+		_, err := pgxConn.Conn().CopyFrom(ctx, table, w.rowColumns, pgx.CopyFromRows(values))
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "could not copy rows into %s", w.options.Table)
+	}
+	return nil
+}
+
+// upsertClause returns the clause updating the non-key columns of rows whose key
+// already exists.
+func (w *Writer) upsertClause() string {
+	if len(w.options.UpsertKey) == 0 {
+		return ""
+	}
+	quote := func(column string) string {
+		return catalog.QuoteIdentifier(w.dialect, column)
+	}
+
+	updates := []string{}
+	for _, column := range w.rowColumns {
+		if contains(w.options.UpsertKey, column) {
+			continue
+		}
+		if w.dialect == catalog.DialectMysql {
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", quote(column), quote(column)))
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", quote(column), quote(column)))
+		}
+	}
+
+	if w.dialect == catalog.DialectMysql {
+		if len(updates) == 0 {
+			// mysql has no DO NOTHING, a no-op update does the same
+			key := quote(w.options.UpsertKey[0])
+			updates = append(updates, key+" = "+key)
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+
+	keys := make([]string, 0, len(w.options.UpsertKey))
+	for _, key := range w.options.UpsertKey {
+		keys = append(keys, quote(key))
+	}
+	if len(updates) == 0 {
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(keys, ", "))
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keys, ", "), strings.Join(updates, ", "))
+}
+
+// createTable creates the target table from the columns of the first batch.
+func (w *Writer) createTable(ctx context.Context, rows []types.Row) error {
+	table := &catalog.TableSchema{
+		Table: catalog.Table{Name: w.options.Table, Type: catalog.TableTypeTable},
+	}
+	if schema, name, ok := strings.Cut(w.options.Table, "."); ok {
+		table.Schema, table.Name = schema, name
+	}
+
+	for i, column := range w.rowColumns {
+		values := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			value, _ := row.Get(column)
+			values = append(values, value)
+		}
+		isKey := contains(w.options.UpsertKey, column)
+		type_, ok := w.options.ColumnTypes[column]
+		if !ok {
+			type_ = InferType(values)
+		}
+		// mysql can't index text columns without a prefix length
+		if isKey && type_ == "text" && w.dialect == catalog.DialectMysql {
+			type_ = "varchar"
+		}
+		table.Columns = append(table.Columns, catalog.Column{
+			Name:       column,
+			Position:   i + 1,
+			Type:       type_,
+			Nullable:   !isKey,
+			PrimaryKey: isKey,
+		})
+	}
+	if len(w.options.UpsertKey) > 0 {
+		table.Indexes = []catalog.Index{{
+			Name:    table.Name + "_pkey",
+			Columns: w.options.UpsertKey,
+			Unique:  true,
+			Primary: true,
+		}}
+	}
+
+	ddl, err := catalog.CreateTableDDL(w.dialect, table)
+	if err != nil {
+		return err
+	}
+	if _, err := w.db.ExecContext(ctx, ddl); err != nil {
+		return errors.Wrapf(err, "could not create table %s", w.options.Table)
+	}
+
+	w.exists = true
+	w.created = true
+	w.columns = table.Columns
+	return nil
+}
+
+// InferType returns the dialect-neutral type of a column holding values: bigint,
+// double, boolean, timestamp, blob or text. NULLs are ignored, integers mixed with
+// floats are double, and any other mix is text.
+func InferType(values []interface{}) string {
+	ret := ""
+	for _, value := range values {
+		type_ := valueType(value)
+		switch {
+		case type_ == "":
+		case ret == "" || ret == type_:
+			ret = type_
+		case (ret == "bigint" && type_ == "double") || (ret == "double" && type_ == "bigint"):
+			ret = "double"
+		default:
+			return "text"
+		}
+	}
+	if ret == "" {
+		return "text"
+	}
+	return ret
+}
+
+func valueType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return ""
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "bigint"
+	case float32, float64:
+		return "double"
+	case bool:
+		return "boolean"
+	case time.Time, *time.Time:
+		return "timestamp"
+	case []byte:
+		return "blob"
+	default:
+		return "text"
+	}
+}
+
+// toArg converts a row value to a value the database drivers accept. Nested
+// values, as returned by some commands, are stored as JSON.
+func toArg(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, string, []byte, bool, time.Time,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v, nil
+	case *time.Time:
+		if v == nil {
+			return nil, nil
+		}
+		return *v, nil
+	case fmt.Stringer:
+		return v.String(), nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
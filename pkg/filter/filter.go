@@ -0,0 +1,175 @@
+// Package filter parses the filters of sqleton select, such as status=active or
+// name~foo%, into go-sqlbuilder conditions whose values are bound as arguments.
+package filter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+)
+
+// Operator is the comparison of a filter.
+type Operator string
+
+const (
+	Equal        Operator = "="
+	NotEqual     Operator = "!="
+	Greater      Operator = ">"
+	GreaterEqual Operator = ">="
+	Less         Operator = "<"
+	LessEqual    Operator = "<="
+	Like         Operator = "~"
+	NotLike      Operator = "!~"
+)
+
+// operators are matched in order, so that two-character operators come before
+// their prefixes. <> is an alias for !=.
+var operators = []struct {
+	token    string
+	operator Operator
+}{
+	{"!=", NotEqual},
+	{"<>", NotEqual},
+	{">=", GreaterEqual},
+	{"<=", LessEqual},
+	{"!~", NotLike},
+	{"=", Equal},
+	{">", Greater},
+	{"<", Less},
+	{"~", Like},
+}
+
+var columnRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// Filter is a column compared to one or more values.
+//
+// With = and !=, values separated by | are matched with IN and NOT IN, and an
+// empty value matches NULL.
+type Filter struct {
+	Column   string
+	Operator Operator
+	Values   []string
+}
+
+// Parse parses a filter of the form column<operator>value, e.g. created_at>=2025-01-01.
+func Parse(expr string) (*Filter, error) {
+	i := strings.IndexAny(expr, "!=<>~")
+	if i < 0 {
+		return nil, errors.Errorf("invalid filter %q, expected column, operator and value (e.g. status=active)", expr)
+	}
+	column := strings.TrimSpace(expr[:i])
+	if !columnRegexp.MatchString(column) {
+		return nil, errors.Errorf("invalid filter %q, %q is not a column name", expr, column)
+	}
+
+	rest := expr[i:]
+	for _, op := range operators {
+		if !strings.HasPrefix(rest, op.token) {
+			continue
+		}
+		value := strings.TrimSpace(rest[len(op.token):])
+		ret := &Filter{Column: column, Operator: op.operator, Values: []string{value}}
+		switch op.operator {
+		case Equal, NotEqual:
+			if strings.Contains(value, "|") {
+				ret.Values = strings.Split(value, "|")
+			}
+		default:
+			if value == "" {
+				return nil, errors.Errorf("invalid filter %q, %s needs a value", expr, op.token)
+			}
+		}
+		return ret, nil
+	}
+	return nil, errors.Errorf("invalid filter %q, unknown operator", expr)
+}
+
+// IsNull returns true if the filter compares its column to NULL.
+func (f *Filter) IsNull() bool {
+	return len(f.Values) == 1 && f.Values[0] == ""
+}
+
+// Condition adds the condition of the filter to cond and returns it. field is the
+// column as written in the query, e.g. quoted, and args are the values of the
+// filter, converted to the type of the column (see Args). Filters that were not
+// created by Parse can have an unknown operator, which is an error.
+func (f *Filter) Condition(cond *sqlbuilder.Cond, field string, args []interface{}) (string, error) {
+	switch f.Operator {
+	case Equal:
+		if f.IsNull() {
+			return cond.IsNull(field), nil
+		}
+		if len(args) > 1 {
+			return cond.In(field, args...), nil
+		}
+		return cond.Equal(field, args[0]), nil
+	case NotEqual:
+		if f.IsNull() {
+			return cond.IsNotNull(field), nil
+		}
+		if len(args) > 1 {
+			return cond.NotIn(field, args...), nil
+		}
+		return cond.NotEqual(field, args[0]), nil
+	case Greater:
+		return cond.GreaterThan(field, args[0]), nil
+	case GreaterEqual:
+		return cond.GreaterEqualThan(field, args[0]), nil
+	case Less:
+		return cond.LessThan(field, args[0]), nil
+	case LessEqual:
+		return cond.LessEqualThan(field, args[0]), nil
+	case Like:
+		return cond.Like(field, args[0]), nil
+	case NotLike:
+		return cond.NotLike(field, args[0]), nil
+	default:
+		return "", errors.Errorf("unknown filter operator %q", f.Operator)
+	}
+}
+
+// Args converts the values of the filter to the type of its column, which is a
+// type as listed by the database catalog. The patterns of LIKE filters are kept
+// as strings.
+func (f *Filter) Args(columnType string) ([]interface{}, error) {
+	ret := make([]interface{}, 0, len(f.Values))
+	for _, value := range f.Values {
+		if f.Operator == Like || f.Operator == NotLike {
+			ret = append(ret, value)
+			continue
+		}
+		v, err := ConvertValue(columnType, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value %q for column %s", value, f.Column)
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+var (
+	typeSizeRegexp = regexp.MustCompile(`\(.*\)|\bunsigned\b`)
+	integerRegexp  = regexp.MustCompile(`^(u?(tiny|small|medium|big|huge)?int(eger)?[0-9]*|(small|big)?serial[0-9]*)$`)
+	floatRegexp    = regexp.MustCompile(`^(real|float[0-9]*|double( precision)?|numeric|decimal)$`)
+	boolRegexp     = regexp.MustCompile(`^bool(ean)?$`)
+)
+
+// ConvertValue converts value to an int64, float64 or bool when columnType is an
+// integer, floating point or boolean type, so that drivers that bind arguments by
+// type accept it. Values of other columns are kept as strings.
+func ConvertValue(columnType string, value string) (interface{}, error) {
+	t := strings.TrimSpace(typeSizeRegexp.ReplaceAllString(strings.ToLower(columnType), ""))
+	switch {
+	case integerRegexp.MatchString(t):
+		return strconv.ParseInt(value, 10, 64)
+	case floatRegexp.MatchString(t):
+		return strconv.ParseFloat(value, 64)
+	case boolRegexp.MatchString(t):
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	for expr, expected := range map[string]Filter{
+		"status=active":            {Column: "status", Operator: Equal, Values: []string{"active"}},
+		"created_at>=2025-01-01":   {Column: "created_at", Operator: GreaterEqual, Values: []string{"2025-01-01"}},
+		"name~foo%":                {Column: "name", Operator: Like, Values: []string{"foo%"}},
+		"name!~%test%":             {Column: "name", Operator: NotLike, Values: []string{"%test%"}},
+		"o.total < 10":             {Column: "o.total", Operator: Less, Values: []string{"10"}},
+		"status<>open":             {Column: "status", Operator: NotEqual, Values: []string{"open"}},
+		"status=open|paid":         {Column: "status", Operator: Equal, Values: []string{"open", "paid"}},
+		"deleted_at=":              {Column: "deleted_at", Operator: Equal, Values: []string{""}},
+		"note=a=b":                 {Column: "note", Operator: Equal, Values: []string{"a=b"}},
+		"public.users.id<=3":       {Column: "public.users.id", Operator: LessEqual, Values: []string{"3"}},
+		"status!=open|paid|closed": {Column: "status", Operator: NotEqual, Values: []string{"open", "paid", "closed"}},
+	} {
+		f, err := Parse(expr)
+		require.NoError(t, err, expr)
+		require.Equal(t, expected, *f, expr)
+	}
+
+	for expr, expected := range map[string]string{
+		"status":        `invalid filter "status", expected column, operator and value (e.g. status=active)`,
+		"=active":       `invalid filter "=active", "" is not a column name`,
+		"1=1 OR 1=1":    `invalid filter "1=1 OR 1=1", "1" is not a column name`,
+		"a;drop=1":      `invalid filter "a;drop=1", "a;drop" is not a column name`,
+		"created_at>":   `invalid filter "created_at>", > needs a value`,
+		"status!active": `invalid filter "status!active", unknown operator`,
+	} {
+		_, err := Parse(expr)
+		require.EqualError(t, err, expected, expr)
+	}
+}
+
+func TestCondition(t *testing.T) {
+	for expr, expected := range map[string]string{
+		"status=active":  "status = ?",
+		"status!=active": "status <> ?",
+		"status=a|b":     "status IN (?, ?)",
+		"status!=a|b":    "status NOT IN (?, ?)",
+		"deleted_at=":    "deleted_at IS NULL",
+		"deleted_at!=":   "deleted_at IS NOT NULL",
+		"total>1":        "total > ?",
+		"total>=1":       "total >= ?",
+		"total<1":        "total < ?",
+		"total<=1":       "total <= ?",
+		"name~a%":        "name LIKE ?",
+		"name!~a%":       "name NOT LIKE ?",
+	} {
+		f, err := Parse(expr)
+		require.NoError(t, err)
+		args, err := f.Args("text")
+		require.NoError(t, err)
+
+		sb := sqlbuilder.NewSelectBuilder()
+		condition, err := f.Condition(&sb.Cond, f.Column, args)
+		require.NoError(t, err)
+		sb.Select("*").From("t").Where(condition)
+		query, queryArgs := sb.Build()
+		require.Equal(t, "SELECT * FROM t WHERE "+expected, query, expr)
+		if !f.IsNull() {
+			require.Equal(t, args, queryArgs, expr)
+		}
+	}
+
+	f := &Filter{Column: "id", Operator: "<>", Values: []string{"1"}}
+	_, err := f.Condition(sqlbuilder.NewCond(), f.Column, []interface{}{1})
+	require.EqualError(t, err, `unknown filter operator "<>"`)
+}
+
+func TestArgs(t *testing.T) {
+	f, err := Parse("id=1|2")
+	require.NoError(t, err)
+	args, err := f.Args("INTEGER")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{int64(1), int64(2)}, args)
+
+	for columnType, expected := range map[string]interface{}{
+		"bigint":           int64(5),
+		"int(11) unsigned": int64(5),
+		"numeric(10,2)":    5.0,
+		"double precision": 5.0,
+		"boolean":          nil,
+		"varchar(20)":      "5",
+		"interval":         "5",
+		"DATE":             "5",
+	} {
+		v, err := ConvertValue(columnType, "5")
+		if expected == nil {
+			require.Error(t, err, columnType)
+			continue
+		}
+		require.NoError(t, err, columnType)
+		require.Equal(t, expected, v, columnType)
+	}
+
+	f, err = Parse("id~1%")
+	require.NoError(t, err)
+	args, err = f.Args("integer")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"1%"}, args)
+
+	f, err = Parse("id>abc")
+	require.NoError(t, err)
+	_, err = f.Args("integer")
+	require.ErrorContains(t, err, `invalid value "abc" for column id`)
+}
@@ -9,13 +9,31 @@ import (
 //go:embed "helpers.yaml"
 var helpersFlagsYaml []byte
 
+//go:embed "attach.yaml"
+var attachFlagsYaml []byte
+
+//go:embed "save-as.yaml"
+var saveAsFlagsYaml []byte
+
 const SqlHelpersSlug = "sql-helpers"
+const SqlAttachSlug = "sql-attach"
+const SqlSaveAsSlug = "sql-save-as"
 
 type SqlHelpersSettings struct {
-	Explain    bool `glazed:"explain"`
-	PrintQuery bool `glazed:"print-query"`
+	Explain        bool     `glazed:"explain"`
+	PrintQuery     bool     `glazed:"print-query"`
+	Snapshot       string   `glazed:"snapshot"`
+	Watch          string   `glazed:"watch"`
+	WatchHighlight bool     `glazed:"watch-highlight"`
+	WatchDeltas    bool     `glazed:"watch-deltas"`
+	WatchKey       []string `glazed:"watch-key"`
 }
 
+// CLIOnlySqlHelpers are the sql-helpers flags that only make sense in a terminal:
+// watch mode keeps running and prints to stdout, and snapshots are written to the
+// config directory. serve and MCP don't take them from their clients.
+var CLIOnlySqlHelpers = []string{"snapshot", "watch", "watch-highlight", "watch-deltas", "watch-key"}
+
 func NewSqlHelpersParameterLayer(
 	options ...schema.SectionOption,
 ) (*schema.SectionImpl, error) {
@@ -25,3 +43,35 @@ func NewSqlHelpersParameterLayer(
 	}
 	return ret, nil
 }
+
+type SqlAttachSettings struct {
+	Attach []string `glazed:"attach"`
+}
+
+func NewSqlAttachParameterLayer(
+	options ...schema.SectionOption,
+) (*schema.SectionImpl, error) {
+	ret, err := schema.NewSectionFromYAML(attachFlagsYaml, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize attach parameter layer")
+	}
+	return ret, nil
+}
+
+type SqlSaveAsSettings struct {
+	SaveAs       string `glazed:"save-as"`
+	Short        string `glazed:"short"`
+	SaveTo       string `glazed:"save-to"`
+	Parameterize bool   `glazed:"parameterize"`
+	Force        bool   `glazed:"force"`
+}
+
+func NewSqlSaveAsParameterLayer(
+	options ...schema.SectionOption,
+) (*schema.SectionImpl, error) {
+	ret, err := schema.NewSectionFromYAML(saveAsFlagsYaml, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to initialize save-as parameter layer")
+	}
+	return ret, nil
+}
@@ -0,0 +1,221 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DBEnvVar overrides the path of the history database.
+const DBEnvVar = "SQLETON_HISTORY_DB"
+
+const timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// Entry is a single statement run by a sqleton command.
+type Entry struct {
+	ID         int64                  `json:"id"`
+	Timestamp  time.Time              `json:"timestamp"`
+	Command    string                 `json:"command"`
+	Profile    string                 `json:"profile,omitempty"`
+	Connection string                 `json:"connection,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Query      string                 `json:"query"`
+	Rows       int                    `json:"rows"`
+	DurationMs float64                `json:"duration_ms"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Config selects where the history is kept. The history is enabled by default.
+type Config struct {
+	Path     string `yaml:"path,omitempty"`
+	Disabled bool   `yaml:"disabled,omitempty"`
+}
+
+// DefaultPath returns sqleton/history.db in the user config directory.
+func DefaultPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "could not determine user config directory")
+	}
+	return filepath.Join(configDir, "sqleton", "history.db"), nil
+}
+
+// ResolvePath returns the path of the history database: $SQLETON_HISTORY_DB, the
+// configured path, or the default path, in that order.
+func (c *Config) ResolvePath() (string, error) {
+	if path := os.Getenv(DBEnvVar); path != "" {
+		return path, nil
+	}
+	if c != nil && strings.TrimSpace(c.Path) != "" {
+		return os.ExpandEnv(strings.TrimSpace(c.Path)), nil
+	}
+	return DefaultPath()
+}
+
+const createHistoryTableQuery = `
+CREATE TABLE IF NOT EXISTS history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp TEXT NOT NULL,
+	command TEXT NOT NULL,
+	profile TEXT,
+	connection TEXT,
+	parameters TEXT,
+	query TEXT,
+	rows INTEGER NOT NULL,
+	duration_ms REAL NOT NULL,
+	error TEXT
+)`
+
+// Store keeps the history in a history table of a sqlite database, created on
+// first use.
+type Store struct {
+	db *sqlx.DB
+}
+
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, errors.Wrap(err, "could not create history directory")
+	}
+	db, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open history database")
+	}
+	// sqlite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(createHistoryTableQuery); err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "could not create history table")
+	}
+	return &Store{db: db}, nil
+}
+
+// Add stores entry and sets its ID.
+func (s *Store) Add(ctx context.Context, entry *Entry) error {
+	parameters, err := json.Marshal(entry.Parameters)
+	if err != nil {
+		return errors.Wrap(err, "could not encode history parameters")
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO history (timestamp, command, profile, connection, parameters, query, rows, duration_ms, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Timestamp.UTC().Format(timestampFormat),
+		entry.Command,
+		entry.Profile,
+		entry.Connection,
+		string(parameters),
+		entry.Query,
+		entry.Rows,
+		entry.DurationMs,
+		entry.Error,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not insert history entry")
+	}
+	entry.ID, err = result.LastInsertId()
+	return err
+}
+
+// Get returns the entry with the given id.
+func (s *Store) Get(ctx context.Context, id int64) (*Entry, error) {
+	entries, err := s.query(ctx, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.Errorf("no history entry %d", id)
+	}
+	return entries[0], nil
+}
+
+// ListOptions filter the entries returned by List.
+type ListOptions struct {
+	// Command only keeps the entries of this command, e.g. mysql/ps.
+	Command string
+	// Search only keeps the entries whose command, parameters or query contain this
+	// text, ignoring case.
+	Search string
+	// Limit is the maximum number of entries returned, 0 returns all of them.
+	Limit int
+}
+
+// List returns the entries matching options, newest first.
+func (s *Store) List(ctx context.Context, options ListOptions) ([]*Entry, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if options.Command != "" {
+		conditions = append(conditions, "command = ?")
+		args = append(args, options.Command)
+	}
+	if options.Search != "" {
+		pattern := "%" + likeEscaper.Replace(options.Search) + "%"
+		conditions = append(conditions,
+			`(query LIKE ? ESCAPE '\' OR command LIKE ? ESCAPE '\' OR parameters LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	clauses := ""
+	if len(conditions) > 0 {
+		clauses = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	clauses += " ORDER BY id DESC"
+	if options.Limit > 0 {
+		clauses += " LIMIT ?"
+		args = append(args, options.Limit)
+	}
+	return s.query(ctx, clauses, args...)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *Store) query(ctx context.Context, clauses string, args ...interface{}) ([]*Entry, error) {
+	rows, err := s.db.QueryxContext(ctx,
+		`SELECT id, timestamp, command, profile, connection, parameters, query, rows, duration_ms, error
+		FROM history `+clauses,
+		args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read history")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	ret := []*Entry{}
+	for rows.Next() {
+		var (
+			entry                                                Entry
+			timestamp                                            string
+			profile, connection, parameters, query, errorMessage sql.NullString
+		)
+		if err := rows.Scan(&entry.ID, &timestamp, &entry.Command, &profile, &connection,
+			&parameters, &query, &entry.Rows, &entry.DurationMs, &errorMessage); err != nil {
+			return nil, errors.Wrap(err, "could not read history entry")
+		}
+		entry.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timestamp in history entry %d", entry.ID)
+		}
+		entry.Profile, entry.Connection, entry.Query, entry.Error = profile.String, connection.String, query.String, errorMessage.String
+		if parameters.String != "" {
+			if err := json.Unmarshal([]byte(parameters.String), &entry.Parameters); err != nil {
+				return nil, errors.Wrapf(err, "invalid parameters in history entry %d", entry.ID)
+			}
+		}
+		ret = append(ret, &entry)
+	}
+	return ret, rows.Err()
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
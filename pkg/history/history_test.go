@@ -0,0 +1,135 @@
+package history
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/sqleton/pkg/audit"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExecution(command string, query string) *sqleton_cmds.QueryExecution {
+	return &sqleton_cmds.QueryExecution{
+		Command: command,
+		Parameters: map[string]interface{}{
+			"user_like": "app%",
+			"password":  "hunter2",
+		},
+		Query:      query,
+		Connection: "mysql://reporter@db:3306/app",
+		Profile:    "production",
+		Rows:       3,
+		StartedAt:  time.Date(2025, 1, 2, 3, 4, 5, 123456000, time.UTC),
+		Duration:   1500 * time.Microsecond,
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sqleton", "history.db")
+	recorder := NewRecorder(path)
+	_, err := os.Stat(path)
+	require.True(t, os.IsNotExist(err), "the database is only created by the first query")
+
+	ctx := context.Background()
+	recorder.ObserveQuery(ctx, newTestExecution("mysql/ps", "SELECT * FROM information_schema.processlist"))
+	failed := newTestExecution("query", "SELECT * FROM nope")
+	failed.Err = errors.New("table not found")
+	recorder.ObserveQuery(ctx, failed)
+	// queries of serve and mcp clients are not recorded
+	recorder.ObserveQuery(audit.WithCaller(ctx, audit.OriginHTTP, "alice"), newTestExecution("mysql/ps", "SELECT 1"))
+	require.NoError(t, recorder.Close())
+
+	store, err := Open(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	entries, err := store.List(ctx, ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, int64(2), entries[0].ID)
+	require.Equal(t, "query", entries[0].Command)
+	require.Equal(t, "table not found", entries[0].Error)
+
+	entry, err := store.Get(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, &Entry{
+		ID:         1,
+		Timestamp:  time.Date(2025, 1, 2, 3, 4, 5, 123456000, time.UTC),
+		Command:    "mysql/ps",
+		Profile:    "production",
+		Connection: "mysql://reporter@db:3306/app",
+		Parameters: map[string]interface{}{
+			"user_like": "app%",
+			"password":  sqleton_cmds.RedactedValue,
+		},
+		Query:      "SELECT * FROM information_schema.processlist",
+		Rows:       3,
+		DurationMs: 1.5,
+	}, entry)
+
+	_, err = store.Get(ctx, 3)
+	require.EqualError(t, err, "no history entry 3")
+}
+
+func TestStoreList(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	ctx := context.Background()
+	for _, entry := range []*Entry{
+		{Command: "query", Query: "SELECT * FROM orders WHERE status = 'open'"},
+		{Command: "mysql/ps", Query: "SELECT * FROM processlist", Parameters: map[string]interface{}{"db": "orders_db"}},
+		{Command: "query", Query: "SELECT 100% FROM t"},
+		{Command: "query", Query: "SELECT name FROM customers"},
+	} {
+		entry.Timestamp = time.Now()
+		require.NoError(t, store.Add(ctx, entry))
+	}
+
+	ids := func(options ListOptions) []int64 {
+		entries, err := store.List(ctx, options)
+		require.NoError(t, err)
+		ret := []int64{}
+		for _, entry := range entries {
+			ret = append(ret, entry.ID)
+		}
+		return ret
+	}
+	require.Equal(t, []int64{4, 3, 2, 1}, ids(ListOptions{}))
+	require.Equal(t, []int64{4, 3}, ids(ListOptions{Limit: 2}))
+	require.Equal(t, []int64{4, 3, 1}, ids(ListOptions{Command: "query"}))
+	// the parameters are searched too, and the search ignores case
+	require.Equal(t, []int64{2, 1}, ids(ListOptions{Search: "ORDERS"}))
+	require.Equal(t, []int64{1}, ids(ListOptions{Search: "orders", Command: "query"}))
+	// % and _ are matched literally
+	require.Equal(t, []int64{3}, ids(ListOptions{Search: "100%"}))
+	require.Equal(t, []int64{2}, ids(ListOptions{Search: "orders_"}))
+}
+
+func TestResolvePath(t *testing.T) {
+	t.Setenv(DBEnvVar, "")
+	path, err := (&Config{Path: "/tmp/history.db"}).ResolvePath()
+	require.NoError(t, err)
+	require.Equal(t, "/tmp/history.db", path)
+
+	defaultPath, err := DefaultPath()
+	require.NoError(t, err)
+	path, err = (&Config{}).ResolvePath()
+	require.NoError(t, err)
+	require.Equal(t, defaultPath, path)
+
+	t.Setenv(DBEnvVar, "/var/history.db")
+	path, err = (&Config{Path: "/tmp/history.db"}).ResolvePath()
+	require.NoError(t, err)
+	require.Equal(t, "/var/history.db", path)
+}
@@ -0,0 +1,76 @@
+package history
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-go-golems/sqleton/pkg/audit"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/rs/zerolog/log"
+)
+
+// Recorder adds the statements run from the command line to the history. Statements
+// run for serve and mcp clients are left to the audit log.
+//
+// The store is only opened when the first statement is recorded, so that commands
+// which don't run queries don't touch the history database.
+type Recorder struct {
+	path string
+
+	mu    sync.Mutex
+	store *Store
+	err   error
+}
+
+var _ sqleton_cmds.QueryObserver = (*Recorder)(nil)
+
+func NewRecorder(path string) *Recorder {
+	return &Recorder{path: path}
+}
+
+func (r *Recorder) ObserveQuery(ctx context.Context, execution *sqleton_cmds.QueryExecution) {
+	if origin, _ := audit.CallerFromContext(ctx); origin != audit.OriginCLI {
+		return
+	}
+
+	entry := &Entry{
+		Timestamp:  execution.StartedAt,
+		Command:    execution.Command,
+		Profile:    execution.Profile,
+		Connection: execution.Connection,
+		Parameters: sqleton_cmds.RedactParameters(execution.Parameters),
+		Query:      execution.Query,
+		Rows:       execution.Rows,
+		DurationMs: float64(execution.Duration.Microseconds()) / 1000.0,
+	}
+	if execution.Err != nil {
+		entry.Error = execution.Err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.store == nil && r.err == nil {
+		r.store, r.err = Open(r.path)
+		if r.err != nil {
+			log.Error().Err(r.err).Str("path", r.path).Msg("could not open query history")
+		}
+	}
+	if r.store == nil {
+		return
+	}
+	// like the audit log, a failing history does not fail the command
+	if err := r.store.Add(context.WithoutCancel(ctx), entry); err != nil {
+		log.Error().Err(err).Str("command", execution.Command).Msg("could not add query to history")
+	}
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.store == nil {
+		return nil
+	}
+	err := r.store.Close()
+	r.store = nil
+	return err
+}
@@ -0,0 +1,95 @@
+package loader
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// csvReader reads CSV files with a header line. Empty fields are read as NULL.
+type csvReader struct {
+	file    *os.File
+	reader  *csv.Reader
+	columns []string
+}
+
+func openCSV(path string, delimiter rune) (*csvReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(file)
+	reader.Comma = delimiter
+	// the number of fields is checked by Read, to reject the record instead of failing
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		_ = file.Close()
+		if isEOF(err) {
+			return nil, errors.Errorf("%s is empty, expected a header line", path)
+		}
+		return nil, errors.Wrapf(err, "could not read the header of %s", path)
+	}
+
+	columns := make([]string, 0, len(header))
+	seen := map[string]bool{}
+	for i, column := range header {
+		if column == "" {
+			column = fmt.Sprintf("column_%d", i+1)
+		}
+		if seen[column] {
+			_ = file.Close()
+			return nil, errors.Errorf("column %s appears twice in the header of %s", column, path)
+		}
+		seen[column] = true
+		columns = append(columns, column)
+	}
+
+	return &csvReader{file: file, reader: reader, columns: columns}, nil
+}
+
+func (r *csvReader) Columns() []string {
+	return r.columns
+}
+
+func (r *csvReader) Read() (*Record, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return &Record{Position: parseError.StartLine, Err: parseError.Err}, nil
+		}
+		return nil, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	row := types.NewRow()
+	for i, field := range fields {
+		column := fmt.Sprintf("column_%d", i+1)
+		if i < len(r.columns) {
+			column = r.columns[i]
+		}
+		if field == "" {
+			row.Set(column, nil)
+		} else {
+			row.Set(column, field)
+		}
+	}
+	if len(fields) != len(r.columns) {
+		return &Record{
+			Position: line,
+			Row:      row,
+			Err:      errors.Errorf("expected %d fields, got %d", len(r.columns), len(fields)),
+		}, nil
+	}
+	return &Record{Position: line, Row: row}, nil
+}
+
+func (r *csvReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,141 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// jsonReader reads a JSON array of objects, or JSON lines (one object per line).
+// Keys are kept in the order of the file, and numbers as json.Number so that large
+// integers keep their precision.
+type jsonReader struct {
+	file   *os.File
+	reader *bufio.Reader
+
+	// decoder is set for arrays.
+	decoder  *json.Decoder
+	position int
+}
+
+func openJSON(path string) (*jsonReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := &jsonReader{file: file, reader: bufio.NewReader(file)}
+
+	// an array starts with [, JSON lines with {
+	for {
+		b, err := ret.reader.Peek(1)
+		if err != nil {
+			if isEOF(err) {
+				return ret, nil
+			}
+			_ = file.Close()
+			return nil, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = ret.reader.ReadByte()
+			if b[0] == '\n' {
+				ret.position++
+			}
+			continue
+		case '[':
+			ret.decoder = json.NewDecoder(ret.reader)
+			ret.decoder.UseNumber()
+			if _, err := ret.decoder.Token(); err != nil {
+				_ = file.Close()
+				return nil, errors.Wrapf(err, "could not read %s", path)
+			}
+			ret.position = 0
+		}
+		return ret, nil
+	}
+}
+
+func (r *jsonReader) Columns() []string {
+	return nil
+}
+
+func (r *jsonReader) Read() (*Record, error) {
+	if r.decoder != nil {
+		return r.readArrayElement()
+	}
+
+	for {
+		line, err := r.reader.ReadString('\n')
+		if line == "" && err != nil {
+			return nil, err
+		}
+		r.position++
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		row, parseErr := parseObject([]byte(line))
+		return &Record{Position: r.position, Row: row, Err: parseErr}, nil
+	}
+}
+
+func (r *jsonReader) readArrayElement() (*Record, error) {
+	if !r.decoder.More() {
+		return nil, io.EOF
+	}
+	r.position++
+	var element json.RawMessage
+	if err := r.decoder.Decode(&element); err != nil {
+		// the rest of the array can't be found after a syntax error
+		return nil, errors.Wrapf(err, "could not read element %d", r.position)
+	}
+	row, err := parseObject(element)
+	return &Record{Position: r.position, Row: row, Err: err}, nil
+}
+
+func (r *jsonReader) Close() error {
+	return r.file.Close()
+}
+
+// parseObject parses a JSON object into a row, keeping the order of its keys.
+func parseObject(data []byte) (types.Row, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("expected a JSON object")
+	}
+
+	row := types.NewRow()
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, errors.New("expected a JSON object")
+		}
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		row.Set(key, value)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !isEOF(err) {
+		return nil, errors.New("unexpected data after the JSON object")
+	}
+	return row, nil
+}
@@ -0,0 +1,354 @@
+// Package loader loads CSV, JSON and Parquet files into a database table. It backs
+// sqleton load.
+package loader
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	"github.com/go-go-golems/sqleton/pkg/copier"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatTSV     = "tsv"
+	FormatJSON    = "json"
+	FormatParquet = "parquet"
+)
+
+// DefaultInferRows is the number of records read to infer the column types of a
+// new table.
+const DefaultInferRows = 1000
+
+// Record is a record read from a file. Values are strings for CSV files, JSON
+// values for JSON files, and typed values for Parquet files. Err is set when the
+// record could not be read, for example when a CSV line has too many fields.
+type Record struct {
+	// Position is the line the record starts on for CSV files and JSON lines, and
+	// its index, starting at 1, for JSON arrays and Parquet files.
+	Position int
+	Row      types.Row
+	Err      error
+}
+
+// Reader reads the records of a file. Read returns io.EOF after the last record.
+type Reader interface {
+	// Columns returns the columns of the file, if the format declares them.
+	Columns() []string
+	Read() (*Record, error)
+	Close() error
+}
+
+// DetectFormat returns the format of a file from its extension.
+func DetectFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".tsv", ".tab":
+		return FormatTSV, nil
+	case ".json", ".jsonl", ".ndjson":
+		return FormatJSON, nil
+	case ".parquet":
+		return FormatParquet, nil
+	default:
+		return "", errors.Errorf("can't tell the format of %s from its extension, pass --format", path)
+	}
+}
+
+// Open returns a reader for the file at path, in the given format.
+func Open(ctx context.Context, path string, format string) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return openCSV(path, ',')
+	case FormatTSV:
+		return openCSV(path, '\t')
+	case FormatJSON:
+		return openJSON(path)
+	case FormatParquet:
+		return openParquet(ctx, path)
+	default:
+		return nil, errors.Errorf("unknown format %s", format)
+	}
+}
+
+type Options struct {
+	// Format is the format of the file, detected from its extension if empty.
+	Format string
+	// Table is the target table, which can be qualified with a schema.
+	Table string
+	// CreateTable creates the table if it doesn't exist, with column types
+	// inferred from the first InferRows records.
+	CreateTable bool
+	InferRows   int
+	// BatchSize is the number of rows inserted per transaction.
+	BatchSize int
+	// MaxRejected stops the load with an error once more records were rejected.
+	// Zero means no limit.
+	MaxRejected int
+}
+
+// Rejection is a record that was not loaded.
+type Rejection struct {
+	Position int
+	Reason   string
+	// Row holds the values as read from the file. It is nil if the record could
+	// not be parsed at all.
+	Row types.Row
+}
+
+type Result struct {
+	Rows     int
+	Rejected int
+	Created  bool
+}
+
+// Load loads the file at path into the table of options, calling onReject for
+// every record that is not loaded: records that can't be read, values that don't
+// match the type of their column, and rows the database refuses.
+func Load(
+	ctx context.Context,
+	db *sqlx.DB,
+	path string,
+	options Options,
+	onReject func(rejection Rejection) error,
+) (*Result, error) {
+	format := options.Format
+	if format == "" {
+		var err error
+		format, err = DetectFormat(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if options.InferRows <= 0 {
+		options.InferRows = DefaultInferRows
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = copier.DefaultBatchSize
+	}
+
+	reader, err := Open(ctx, path, format)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	sample, err := readSample(reader, options.InferRows)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := reader.Columns()
+	if columns == nil {
+		columns = sampleColumns(sample)
+	}
+
+	writer, err := copier.NewWriter(ctx, db, copier.Options{
+		Table:       options.Table,
+		CreateTable: options.CreateTable,
+		BatchSize:   options.BatchSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	columnTypes, err := columnTypes(writer, options.Table, columns, sample, format)
+	if err != nil {
+		return nil, err
+	}
+	if writer.Columns() == nil {
+		writer.SetColumnTypes(columnTypes)
+	}
+
+	l := &load{
+		writer:      writer,
+		options:     options,
+		columns:     columns,
+		columnTypes: columnTypes,
+		onReject:    onReject,
+		result:      &Result{},
+	}
+	for _, record := range sample {
+		if err := l.add(ctx, record); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if isEOF(err) {
+				break
+			}
+			return nil, err
+		}
+		if err := l.add(ctx, record); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.flush(ctx); err != nil {
+		return nil, err
+	}
+
+	l.result.Rows = writer.Rows()
+	l.result.Created = writer.Created()
+	return l.result, nil
+}
+
+func readSample(reader Reader, n int) ([]*Record, error) {
+	ret := []*Record{}
+	for len(ret) < n {
+		record, err := reader.Read()
+		if err != nil {
+			if isEOF(err) {
+				break
+			}
+			return nil, err
+		}
+		ret = append(ret, record)
+	}
+	return ret, nil
+}
+
+// sampleColumns returns the keys of the sample rows, in order of appearance.
+func sampleColumns(sample []*Record) []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	for _, record := range sample {
+		if record.Row == nil {
+			continue
+		}
+		for pair := record.Row.Oldest(); pair != nil; pair = pair.Next() {
+			if !seen[pair.Key] {
+				seen[pair.Key] = true
+				ret = append(ret, pair.Key)
+			}
+		}
+	}
+	return ret
+}
+
+// columnTypes returns the type each column is converted to: that of the column of
+// the table if it exists, or the type inferred from the sample.
+func columnTypes(
+	writer *copier.Writer,
+	table string,
+	columns []string,
+	sample []*Record,
+	format string,
+) (map[string]string, error) {
+	ret := map[string]string{}
+
+	if tableColumns := writer.Columns(); tableColumns != nil {
+		types_ := map[string]string{}
+		for _, column := range tableColumns {
+			types_[column.Name] = catalog.NormalizeType(column.Type)
+		}
+		for _, column := range columns {
+			type_, ok := types_[column]
+			if !ok {
+				return nil, errors.Errorf("column %s does not exist in table %s", column, table)
+			}
+			ret[column] = conversionType(type_)
+		}
+		return ret, nil
+	}
+
+	for _, column := range columns {
+		values := []interface{}{}
+		for _, record := range sample {
+			if record.Row == nil {
+				continue
+			}
+			if value, ok := record.Row.Get(column); ok && value != nil {
+				values = append(values, value)
+			}
+		}
+		if format == FormatCSV || format == FormatTSV {
+			ret[column] = inferStringType(values)
+		} else {
+			ret[column] = copier.InferType(naturalValues(values))
+		}
+	}
+	return ret, nil
+}
+
+// load batches the converted rows of a file, keeping the position of each row to
+// report rejections.
+type load struct {
+	writer      *copier.Writer
+	options     Options
+	columns     []string
+	columnTypes map[string]string
+	onReject    func(rejection Rejection) error
+	result      *Result
+
+	batch   []types.Row
+	records []*Record
+}
+
+func (l *load) add(ctx context.Context, record *Record) error {
+	if record.Err != nil {
+		return l.reject(record, record.Err)
+	}
+
+	row := types.NewRow()
+	for pair := record.Row.Oldest(); pair != nil; pair = pair.Next() {
+		if _, ok := l.columnTypes[pair.Key]; !ok {
+			return l.reject(record, errors.Errorf("unknown column %s", pair.Key))
+		}
+	}
+	for _, column := range l.columns {
+		value, _ := record.Row.Get(column)
+		converted, err := convert(value, l.columnTypes[column])
+		if err != nil {
+			return l.reject(record, errors.Wrapf(err, "column %s", column))
+		}
+		row.Set(column, converted)
+	}
+	if err := l.writer.CheckRow(row); err != nil {
+		return l.reject(record, err)
+	}
+
+	l.batch = append(l.batch, row)
+	l.records = append(l.records, record)
+	if len(l.batch) >= l.options.BatchSize {
+		return l.flush(ctx)
+	}
+	return nil
+}
+
+func (l *load) flush(ctx context.Context) error {
+	rejections, err := l.writer.WriteRejecting(ctx, l.batch)
+	if err != nil {
+		return err
+	}
+	records := l.records
+	l.batch, l.records = nil, nil
+	for _, rejection := range rejections {
+		if err := l.reject(records[rejection.Index], rejection.Err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *load) reject(record *Record, reason error) error {
+	l.result.Rejected++
+	if l.onReject != nil {
+		err := l.onReject(Rejection{Position: record.Position, Reason: reason.Error(), Row: record.Row})
+		if err != nil {
+			return err
+		}
+	}
+	if l.options.MaxRejected > 0 && l.result.Rejected > l.options.MaxRejected {
+		return errors.Errorf("more than %d records rejected, last at %d: %s",
+			l.options.MaxRejected, record.Position, reason)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package loader
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func openTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func loadFile(t *testing.T, db *sqlx.DB, path string, options Options) (*Result, []Rejection) {
+	t.Helper()
+	rejections := []Rejection{}
+	result, err := Load(context.Background(), db, path, options, func(rejection Rejection) error {
+		rejections = append(rejections, rejection)
+		return nil
+	})
+	require.NoError(t, err)
+	return result, rejections
+}
+
+func columnTypesOf(t *testing.T, db *sqlx.DB, table string) map[string]string {
+	t.Helper()
+	c, err := catalog.New(db)
+	require.NoError(t, err)
+	_, columns, err := c.Columns(context.Background(), table)
+	require.NoError(t, err)
+	ret := map[string]string{}
+	for _, column := range columns {
+		ret[column.Name] = catalog.NormalizeType(column.Type)
+	}
+	return ret
+}
+
+func reasons(rejections []Rejection) map[int]string {
+	ret := map[int]string{}
+	for _, rejection := range rejections {
+		ret[rejection.Position] = rejection.Reason
+	}
+	return ret
+}
+
+func TestLoadCSV(t *testing.T) {
+	db := openTestDB(t)
+	path := writeFile(t, "users.csv", `id,name,score,active,zip,joined
+1,ada,1.5,true,01234,2024-05-01
+2,bob,,false,98765,2024-05-02T10:00:00Z
+3,"cy, jr",3,TRUE,12345,
+4,dan,2
+x,eve,1,true,11111,2024-05-03
+`)
+
+	result, rejections := loadFile(t, db, path, Options{Table: "users", CreateTable: true, InferRows: 3, BatchSize: 2})
+	require.Equal(t, &Result{Rows: 3, Rejected: 2, Created: true}, result)
+	require.Equal(t, map[int]string{
+		5: "expected 6 fields, got 3",
+		6: `column id: invalid integer "x"`,
+	}, reasons(rejections))
+
+	require.Equal(t, map[string]string{
+		"id": "bigint", "name": "text", "score": "double", "active": "boolean", "zip": "text", "joined": "timestamp",
+	}, columnTypesOf(t, db, "users"))
+
+	var names []string
+	require.NoError(t, db.Select(&names, "SELECT name FROM users WHERE active ORDER BY id"))
+	require.Equal(t, []string{"ada", "cy, jr"}, names)
+	var zip string
+	require.NoError(t, db.Get(&zip, "SELECT zip FROM users WHERE id = 1"))
+	require.Equal(t, "01234", zip)
+}
+
+func TestLoadIntoExistingTable(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER)`)
+	require.NoError(t, err)
+	path := writeFile(t, "users.tsv", "id\tname\tage\n1\tada\t36\n2\t\t40\n1\tbob\t\n3\tcy\told\n")
+
+	result, rejections := loadFile(t, db, path, Options{Table: "users"})
+	require.Equal(t, &Result{Rows: 1, Rejected: 3}, result)
+	require.Equal(t, map[int]string{
+		3: "NOT NULL constraint failed: users.name",
+		4: "UNIQUE constraint failed: users.id",
+		5: `column age: invalid integer "old"`,
+	}, reasons(rejections))
+
+	path = writeFile(t, "other.csv", "id,email\n1,a@b.c\n")
+	_, err = Load(context.Background(), db, path, Options{Table: "users"}, nil)
+	require.EqualError(t, err, "column email does not exist in table users")
+
+	_, err = Load(context.Background(), db, path, Options{Table: "nope"}, nil)
+	var notFound *catalog.TableNotFoundError
+	require.ErrorAs(t, err, &notFound)
+}
+
+func TestLoadJSON(t *testing.T) {
+	for name, content := range map[string]string{
+		"events.json": `[
+  {"id": 9007199254740993, "kind": "click", "meta": {"x": 1}},
+  {"id": 2, "kind": "view", "amount": 2.5},
+  "nope"
+]`,
+		"events.jsonl": `{"id": 9007199254740993, "kind": "click", "meta": {"x": 1}}
+{"id": 2, "kind": "view", "amount": 2.5}
+"nope"
+`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			db := openTestDB(t)
+			result, rejections := loadFile(t, db, writeFile(t, name, content), Options{Table: "events", CreateTable: true})
+			require.Equal(t, &Result{Rows: 2, Rejected: 1, Created: true}, result)
+			require.Equal(t, map[int]string{3: "expected a JSON object"}, reasons(rejections))
+
+			require.Equal(t, map[string]string{
+				"id": "bigint", "kind": "text", "meta": "text", "amount": "double",
+			}, columnTypesOf(t, db, "events"))
+
+			var meta string
+			require.NoError(t, db.Get(&meta, "SELECT meta FROM events WHERE id = 9007199254740993"))
+			require.Equal(t, `{"x":1}`, meta)
+		})
+	}
+}
+
+func TestLoadParquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.parquet")
+	duck, err := sqlx.Open("duckdb", "")
+	require.NoError(t, err)
+	_, err = duck.Exec(`COPY (SELECT i AS id, 'player ' || i AS name, i * 1.5 AS score FROM range(1, 4) t(i)) TO '` +
+		path + `' (FORMAT parquet)`)
+	require.NoError(t, err)
+	require.NoError(t, duck.Close())
+
+	db := openTestDB(t)
+	result, rejections := loadFile(t, db, path, Options{Table: "scores", CreateTable: true})
+	require.Empty(t, rejections)
+	require.Equal(t, &Result{Rows: 3, Created: true}, result)
+
+	var names []string
+	require.NoError(t, db.Select(&names, "SELECT name FROM scores WHERE score > 2 ORDER BY id"))
+	require.Equal(t, []string{"player 2", "player 3"}, names)
+}
+
+func TestInferStringType(t *testing.T) {
+	for expected, values := range map[string][]interface{}{
+		"bigint":    {"1", "-2", "0"},
+		"double":    {"1", "2.5", "0.5"},
+		"boolean":   {"true", "FALSE"},
+		"timestamp": {"2024-05-01", "2024-05-01T10:00:00Z"},
+		"text":      {"1", "a"},
+	} {
+		require.Equal(t, expected, inferStringType(values), values)
+	}
+	require.Equal(t, "text", inferStringType([]interface{}{"007"}))
+	require.Equal(t, "text", inferStringType(nil))
+}
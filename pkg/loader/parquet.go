@@ -0,0 +1,78 @@
+package loader
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+
+	// registers the duckdb driver, which reads parquet files
+	_ "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// parquetReader reads parquet files through an in-memory duckdb database.
+type parquetReader struct {
+	db       *sqlx.DB
+	rows     *sql.Rows
+	columns  []string
+	position int
+}
+
+func openParquet(ctx context.Context, path string) (*parquetReader, error) {
+	db, err := sqlx.Open("duckdb", "")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open duckdb to read parquet files")
+	}
+
+	query := "SELECT * FROM read_parquet('" + strings.ReplaceAll(path, "'", "''") + "')"
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "could not read %s", path)
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		_ = rows.Close()
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &parquetReader{db: db, rows: rows, columns: columns}, nil
+}
+
+func (r *parquetReader) Columns() []string {
+	return r.columns
+}
+
+func (r *parquetReader) Read() (*Record, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	r.position++
+
+	values := make([]interface{}, len(r.columns))
+	pointers := make([]interface{}, len(r.columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := r.rows.Scan(pointers...); err != nil {
+		return &Record{Position: r.position, Err: err}, nil
+	}
+
+	row := types.NewRow()
+	for i, column := range r.columns {
+		row.Set(column, values[i])
+	}
+	return &Record{Position: r.position, Row: row}, nil
+}
+
+func (r *parquetReader) Close() error {
+	_ = r.rows.Close()
+	return r.db.Close()
+}
@@ -0,0 +1,236 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF)
+}
+
+// timeLayouts are the timestamp formats recognized in text values.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseBool(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "true", "t", "yes", "y", "1":
+		return true, true
+	case "false", "f", "no", "n", "0":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// isInteger is strconv.ParseInt, refusing numbers with leading zeros, which are
+// usually codes (zip codes, phone numbers) whose zeros matter.
+func isInteger(s string) bool {
+	if len(s) > 1 && (s[0] == '0' || (s[0] == '-' && s[1] == '0')) {
+		return false
+	}
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil
+}
+
+func isFloat(s string) bool {
+	if len(s) > 1 && s[0] == '0' && s[1] != '.' {
+		return false
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// inferStringType returns the type of a column of text values, as read from CSV
+// files: bigint, double, boolean (true and false only), timestamp or text.
+func inferStringType(values []interface{}) string {
+	checks := []struct {
+		type_ string
+		check func(string) bool
+	}{
+		{"bigint", isInteger},
+		{"double", isFloat},
+		{"boolean", func(s string) bool {
+			s = strings.ToLower(s)
+			return s == "true" || s == "false"
+		}},
+		{"timestamp", func(s string) bool {
+			_, ok := parseTime(s)
+			return ok
+		}},
+	}
+
+	if len(values) == 0 {
+		return "text"
+	}
+	for _, check := range checks {
+		matches := true
+		for _, value := range values {
+			if s, ok := value.(string); !ok || !check.check(s) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return check.type_
+		}
+	}
+	return "text"
+}
+
+// naturalValues replaces the JSON numbers of values by int64 or float64 values.
+func naturalValues(values []interface{}) []interface{} {
+	ret := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		ret = append(ret, naturalValue(value))
+	}
+	return ret
+}
+
+func naturalValue(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	if f, err := number.Float64(); err == nil {
+		return f
+	}
+	return number.String()
+}
+
+// conversionType returns the type values are converted to for a column of the
+// given normalized type. Values of other types are passed to the database as they
+// are, which parses text values itself.
+func conversionType(type_ string) string {
+	name, _, _ := strings.Cut(type_, "(")
+	switch name {
+	case "integer", "bigint", "smallint", "tinyint", "hugeint", "ubigint", "uinteger", "usmallint", "utinyint":
+		return "bigint"
+	case "double", "real":
+		return "double"
+	case "boolean":
+		return "boolean"
+	default:
+		return ""
+	}
+}
+
+// convert converts a value read from a file to the type of its column, see
+// inferStringType and conversionType.
+func convert(value interface{}, type_ string) (interface{}, error) {
+	value = naturalValue(value)
+	if value == nil {
+		return nil, nil
+	}
+	s, isString := value.(string)
+	if isString {
+		s = strings.TrimSpace(s)
+	}
+
+	switch type_ {
+	case "bigint":
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+				return int64(v), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+		default:
+			if i, err := strconv.ParseInt(fmt.Sprint(v), 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return nil, errors.Errorf("invalid integer %s", describe(value))
+
+	case "double":
+		switch v := value.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f, nil
+			}
+		default:
+			if f, err := strconv.ParseFloat(fmt.Sprint(v), 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, errors.Errorf("invalid number %s", describe(value))
+
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		case string:
+			if b, ok := parseBool(s); ok {
+				return b, nil
+			}
+		}
+		return nil, errors.Errorf("invalid boolean %s", describe(value))
+
+	case "timestamp":
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			if t, ok := parseTime(s); ok {
+				return t, nil
+			}
+		}
+		return nil, errors.Errorf("invalid timestamp %s", describe(value))
+
+	case "text":
+		switch v := value.(type) {
+		case string, []byte, map[string]interface{}, []interface{}:
+			return v, nil
+		default:
+			return fmt.Sprint(v), nil
+		}
+
+	default:
+		return value, nil
+	}
+}
+
+func describe(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,277 @@
+package mcpserver
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/go-go-golems/sqleton/pkg/sqlscan"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ReadOnlySQLToolName is the name of the tool running arbitrary read-only queries.
+const ReadOnlySQLToolName = "execute_readonly_sql"
+
+// ReadOnlySQLOptions guard the execute_readonly_sql tool.
+type ReadOnlySQLOptions struct {
+	// MaxRows is the maximum number of rows returned, further rows are dropped.
+	MaxRows int
+	// Timeout cancels queries running longer.
+	Timeout time.Duration
+}
+
+var readOnlyStatements = map[string]bool{
+	"SELECT":   true,
+	"WITH":     true,
+	"SHOW":     true,
+	"EXPLAIN":  true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"VALUES":   true,
+	"TABLE":    true,
+}
+
+// writeKeywords can't appear anywhere in a read-only query, outside of strings,
+// quoted identifiers and comments. INTO catches SELECT ... INTO, which creates a
+// table in postgres and writes a file in mysql.
+var writeKeywords = map[string]bool{
+	"INSERT":   true,
+	"UPDATE":   true,
+	"DELETE":   true,
+	"MERGE":    true,
+	"UPSERT":   true,
+	"DROP":     true,
+	"ALTER":    true,
+	"CREATE":   true,
+	"TRUNCATE": true,
+	"GRANT":    true,
+	"REVOKE":   true,
+	"ATTACH":   true,
+	"DETACH":   true,
+	"COPY":     true,
+	"CALL":     true,
+	"EXECUTE":  true,
+	"INTO":     true,
+	"LOCK":     true,
+	"VACUUM":   true,
+}
+
+// sideEffectFunctions are functions that act on the server, its files or other
+// sessions, or hold it up, even when called from a SELECT in a read-only transaction.
+// Like writeKeywords, they are rejected anywhere in the query, even when they are
+// not called.
+var sideEffectFunctions = map[string]bool{
+	// postgres
+	"PG_TERMINATE_BACKEND":    true,
+	"PG_CANCEL_BACKEND":       true,
+	"PG_RELOAD_CONF":          true,
+	"PG_ROTATE_LOGFILE":       true,
+	"SET_CONFIG":              true,
+	"LO_IMPORT":               true,
+	"LO_EXPORT":               true,
+	"LO_UNLINK":               true,
+	"PG_SLEEP":                true,
+	"PG_SLEEP_FOR":            true,
+	"PG_SLEEP_UNTIL":          true,
+	"PG_ADVISORY_LOCK":        true,
+	"PG_ADVISORY_LOCK_SHARED": true,
+	"PG_ADVISORY_XACT_LOCK":   true,
+	"PG_NOTIFY":               true,
+	"NEXTVAL":                 true,
+	"SETVAL":                  true,
+	"DBLINK":                  true,
+	"DBLINK_EXEC":             true,
+	// mysql
+	"SLEEP":        true,
+	"BENCHMARK":    true,
+	"GET_LOCK":     true,
+	"RELEASE_LOCK": true,
+	"LOAD_FILE":    true,
+	// sqlite
+	"LOAD_EXTENSION": true,
+	"WRITEFILE":      true,
+}
+
+// CheckReadOnlySQL accepts a single statement starting with SELECT, WITH, SHOW,
+// EXPLAIN, DESCRIBE, VALUES or TABLE and not containing any keyword that writes
+// or any function with side effects. The query is read the way each database
+// sqleton connects to reads it, so that text hidden in a string or a comment for
+// one of them is still checked. This is the first line of defense only, queries
+// are also run in a read-only transaction that is rolled back.
+func CheckReadOnlySQL(query string) error {
+	for _, dialect := range sqlscan.Databases {
+		if err := checkReadOnlySQL(query, dialect); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkReadOnlySQL(query string, dialect *sqlscan.Dialect) error {
+	words, err := sqlWords(query, dialect)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return errors.New("empty query")
+	}
+	if !readOnlyStatements[words[0]] {
+		return errors.Errorf("only SELECT, WITH, SHOW, EXPLAIN, DESCRIBE, VALUES and TABLE statements are allowed, got %s", words[0])
+	}
+	for _, word := range words {
+		if writeKeywords[word] {
+			return errors.Errorf("%s is not allowed in a read-only query", word)
+		}
+		if sideEffectFunctions[word] {
+			return errors.Errorf("function %s is not allowed in a read-only query", strings.ToLower(word))
+		}
+	}
+	return nil
+}
+
+// sqlWords returns the upper-cased bare words of query as read by dialect, skipping
+// strings, quoted identifiers and comments. It fails if the query contains more than
+// one statement, or a string, identifier or comment that isn't terminated.
+func sqlWords(query string, dialect *sqlscan.Dialect) ([]string, error) {
+	words := []string{}
+	ended := false
+	for i := 0; i < len(query); {
+		kind, end, ok := dialect.Scan(query, i)
+		switch {
+		case !ok && (kind == sqlscan.LineComment || kind == sqlscan.BlockComment):
+			return nil, errors.New("unterminated comment")
+		case !ok:
+			return nil, errors.New("unterminated string or identifier")
+		case kind == sqlscan.LineComment || kind == sqlscan.BlockComment:
+			i = end
+			continue
+		case kind != sqlscan.Code:
+			if ended {
+				return nil, errors.New("only a single statement is allowed")
+			}
+			i = end
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(query[i:])
+		switch {
+		case unicode.IsSpace(r):
+		case r == ';':
+			ended = true
+		default:
+			if ended {
+				return nil, errors.New("only a single statement is allowed")
+			}
+			if unicode.IsLetter(r) || r == '_' {
+				// identifiers can contain $, as in a$b, which is not a dollar quote
+				j := i + size
+				for j < len(query) {
+					r, size := utf8.DecodeRuneInString(query[j:])
+					if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '$' {
+						break
+					}
+					j += size
+				}
+				words = append(words, strings.ToUpper(query[i:j]))
+				size = j - i
+			}
+		}
+		i += size
+	}
+	return words, nil
+}
+
+// runReadOnlySQL runs query in a read-only transaction that is always rolled back,
+// and returns at most options.MaxRows rows. With sqlite, the connection is left in
+// query_only mode, so db should not be reused for writing.
+func runReadOnlySQL(
+	ctx context.Context,
+	db *sqlx.DB,
+	query string,
+	options ReadOnlySQLOptions,
+) (*snapshots.Snapshot, bool, error) {
+	if err := checkReadOnlyQueryArgument(query); err != nil {
+		return nil, false, err
+	}
+
+	snapshot, truncated, err := queryReadOnly(ctx, db, query, options)
+	if err != nil {
+		return nil, false, &sqleton_cmds.QueryError{Stage: sqleton_cmds.QueryStageExecute, Err: err}
+	}
+	return snapshot, truncated, nil
+}
+
+// checkReadOnlyQueryArgument runs CheckReadOnlySQL on the query argument of the
+// execute_readonly_sql tool.
+func checkReadOnlyQueryArgument(query string) error {
+	if err := CheckReadOnlySQL(query); err != nil {
+		return &ToolError{Kind: ErrorInvalidArguments, Message: err.Error(), Field: "query"}
+	}
+	return nil
+}
+
+func queryReadOnly(
+	ctx context.Context,
+	db *sqlx.DB,
+	query string,
+	options ReadOnlySQLOptions,
+) (*snapshots.Snapshot, bool, error) {
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, false, errors.Wrap(err, "could not start read-only transaction")
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// the sqlite driver ignores the read-only transaction option
+	if driver := strings.ToLower(db.DriverName()); driver == "sqlite3" || driver == "sqlite" {
+		if _, err := tx.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			return nil, false, errors.Wrap(err, "could not make the connection read-only")
+		}
+	}
+
+	recorder := snapshots.NewRecorder(nil)
+	limiter := &rowLimitProcessor{Processor: recorder, maxRows: options.MaxRows}
+	columns, err := sqleton_cmds.RunQueryIntoGlazeWithColumns(ctx, tx, query, limiter)
+	truncated := errors.Is(err, errRowLimit)
+	if err != nil && !truncated {
+		return nil, false, err
+	}
+
+	snapshot := recorder.Snapshot(ReadOnlySQLToolName, ReadOnlySQLToolName, nil)
+	snapshot.Columns = columns
+	return snapshot, truncated, nil
+}
+
+var errRowLimit = errors.New("row limit reached")
+
+// rowLimitProcessor stops the query with errRowLimit when a row comes in after
+// maxRows rows were added. A maxRows of 0 doesn't limit the rows.
+type rowLimitProcessor struct {
+	middlewares.Processor
+	maxRows int
+	rows    int
+}
+
+func (p *rowLimitProcessor) AddRow(ctx context.Context, row types.Row) error {
+	if p.maxRows > 0 && p.rows == p.maxRows {
+		return errRowLimit
+	}
+	p.rows++
+	return p.Processor.AddRow(ctx, row)
+}
@@ -0,0 +1,208 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReadOnlySQL(t *testing.T) {
+	for _, query := range []string{
+		"SELECT * FROM users",
+		"select id from users where name = 'DELETE me';",
+		"WITH x AS (SELECT 1) SELECT * FROM x",
+		"SHOW TABLES",
+		"EXPLAIN SELECT 1",
+		"SELECT \"update\" FROM t -- DROP TABLE t",
+		"/* comment */ SELECT 1",
+	} {
+		require.NoError(t, CheckReadOnlySQL(query), query)
+	}
+
+	for _, query := range []string{
+		"",
+		"DELETE FROM users",
+		"SELECT 1; DROP TABLE users",
+		"SELECT 1; SELECT 2",
+		"WITH x AS (DELETE FROM users RETURNING *) SELECT * FROM x",
+		"SELECT * INTO backup FROM users",
+		"SELECT 1 /*! ; DROP TABLE users */",
+		"SELECT 'a\\' ; DROP TABLE users; '",
+		"SELECT * FROM users FOR UPDATE",
+		"PRAGMA writable_schema = ON",
+		"SELECT 'unterminated",
+		"SELECT pg_terminate_backend(pid) FROM pg_stat_activity",
+		"SELECT pg_cancel_backend (42)",
+		"SELECT set_config('log_statement', 'none', false)",
+		"SELECT lo_import('/etc/passwd')",
+		"SELECT lo_export(16384, '/tmp/dump')",
+		"SELECT SLEEP(10)",
+		"SELECT GET_LOCK('migrations', 10)",
+		"SELECT load_extension('/tmp/evil.so')",
+	} {
+		require.Error(t, CheckReadOnlySQL(query), query)
+	}
+
+	// text that one of the databases reads as a string or a comment, and another one as code
+	for _, query := range []string{
+		// mysql: backslashes escape quotes
+		"SELECT 'a\\'' , SLEEP(10) -- '",
+		// postgres: dollar-quoted strings
+		"SELECT $$ ' $$, pg_sleep(10) -- '",
+		// postgres: nested comments
+		"SELECT 1 /* /* */ ' */, pg_sleep(10) -- '",
+		// mysql: # comments, and -- only starts a comment when followed by a space
+		"SELECT 1 # '\n, SLEEP(10) -- '",
+		"SELECT 1 --1, SLEEP(10)",
+		// sqlite: identifiers in brackets
+		"SELECT 1 AS [ ' ], load_extension('x') -- ']",
+	} {
+		require.Error(t, CheckReadOnlySQL(query), query)
+	}
+	for _, query := range []string{
+		"SELECT 'it''s', \"a\"\"b\", `c` FROM t",
+		"SELECT $1, a$b$ FROM t",
+		"SELECT 1 -- comment",
+		"SELECT /* a /* nested */ comment */ 1",
+	} {
+		require.NoError(t, CheckReadOnlySQL(query), query)
+	}
+
+	// function names are only words outside of strings and comments
+	require.NoError(t, CheckReadOnlySQL("SELECT 'sleep(10)' AS s -- pg_terminate_backend(1)"))
+	require.EqualError(t, CheckReadOnlySQL("SELECT sleep(10)"), "function sleep is not allowed in a read-only query")
+}
+
+func TestQueryReadOnlyRunsInAReadOnlyTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	// a single connection, so that query_only is also on for the rollback check
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT); INSERT INTO users (name) VALUES ('alice')")
+	require.NoError(t, err)
+
+	// queries that get past CheckReadOnlySQL still can't write
+	_, _, err = queryReadOnly(ctx, db, "DELETE FROM users RETURNING id", ReadOnlySQLOptions{})
+	require.ErrorContains(t, err, "readonly")
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM users"))
+	require.Equal(t, 1, count)
+}
+
+func connectWithDatabase(t *testing.T, options ...Option) (*mcp.ClientSession, string) {
+	t.Helper()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlx.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+INSERT INTO users (name) VALUES ('alice'), ('bob'), ('carol');
+`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	openDatabase := func(ctx context.Context, _ *values.Values) (*sqlx.DB, error) {
+		return sqlx.Open("sqlite3", path)
+	}
+	server, err := NewServer([]*repositories.Repository{repositories.NewRepository()},
+		append([]Option{WithDatabase(openDatabase, values.New())}, options...)...)
+	require.NoError(t, err)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err = server.MCPServer().Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1"}, nil).
+		Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = session.Close() })
+	return session, path
+}
+
+func TestSchemaResources(t *testing.T) {
+	ctx := context.Background()
+	session, _ := connectWithDatabase(t, WithSchemaResources())
+
+	result, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: TablesResourceURI})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"tables":[{"name":"users","type":"table"}]}`, result.Contents[0].Text)
+
+	result, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "schema://table/users"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"schema":"","name":"users","type":"table","columns":[
+		{"name":"id","position":1,"type":"INTEGER","nullable":true,"primary_key":true},
+		{"name":"name","position":2,"type":"TEXT","nullable":false,"primary_key":false}
+	]}`, result.Contents[0].Text)
+
+	_, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "schema://table/nope"})
+	require.Error(t, err)
+
+	tools, err := session.ListTools(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, tools.Tools)
+}
+
+func TestReadOnlySQLTool(t *testing.T) {
+	ctx := context.Background()
+	executions := []*sqleton_cmds.QueryExecution{}
+	session, path := connectWithDatabase(t,
+		WithReadOnlySQL(ReadOnlySQLOptions{MaxRows: 2}),
+		WithQueryObservers(sqleton_cmds.QueryObserverFunc(func(_ context.Context, execution *sqleton_cmds.QueryExecution) {
+			executions = append(executions, execution)
+		})),
+	)
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      ReadOnlySQLToolName,
+		Arguments: map[string]interface{}{"query": "SELECT id, name FROM users ORDER BY id"},
+	})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	text, err := json.Marshal(result.StructuredContent)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"columns":["id","name"],"rows":[{"id":1,"name":"alice"},{"id":2,"name":"bob"}],
+		"row_count":2,"truncated":true,"rendered_query":"SELECT id, name FROM users ORDER BY id"}`, string(text))
+	require.Len(t, executions, 1)
+	require.Equal(t, ReadOnlySQLToolName, executions[0].Command)
+	require.Equal(t, 2, executions[0].Rows)
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      ReadOnlySQLToolName,
+		Arguments: map[string]interface{}{"query": "DELETE FROM users"},
+	})
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	require.Equal(t, "invalid_arguments", toolErrorOf(t, result)["kind"])
+	require.Equal(t, "query", toolErrorOf(t, result)["field"])
+	require.Len(t, executions, 2)
+	require.Error(t, executions[1].Err)
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      ReadOnlySQLToolName,
+		Arguments: map[string]interface{}{"query": "SELECT * FROM missing"},
+	})
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	require.Equal(t, "database", toolErrorOf(t, result)["kind"])
+
+	// the transaction guard holds even when a query gets past the statement check
+	db, err := sqlx.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	_, _, err = runReadOnlySQL(ctx, db, "SELECT 1", ReadOnlySQLOptions{})
+	require.NoError(t, err)
+	_, err = db.Exec("DELETE FROM users")
+	require.Error(t, err)
+}
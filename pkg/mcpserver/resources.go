@@ -0,0 +1,178 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/go-go-golems/sqleton/pkg/audit"
+	"github.com/go-go-golems/sqleton/pkg/catalog"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/pkg/errors"
+)
+
+const (
+	TablesResourceURI         = "schema://tables"
+	TableResourceURITemplate  = "schema://table/{name}"
+	tableResourceURIPrefix    = "schema://table/"
+	schemaResourceContentType = "application/json"
+)
+
+// addSchemaResources publishes the tables of the database as schema://tables, and the
+// columns of each table as schema://table/<name>.
+func (s *Server) addSchemaResources() {
+	s.server.AddResource(&mcp.Resource{
+		URI:         TablesResourceURI,
+		Name:        "tables",
+		Title:       "Database tables",
+		Description: "The tables and views of the database. Read schema://table/<name> for the columns of a table.",
+		MIMEType:    schemaResourceContentType,
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		var tables []catalog.Table
+		err := s.withCatalog(ctx, func(c *catalog.Catalog) error {
+			var err error
+			tables, err = c.Tables(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return jsonResource(req.Params.URI, map[string]interface{}{"tables": tables})
+	})
+
+	s.server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: TableResourceURITemplate,
+		Name:        "table",
+		Title:       "Table columns",
+		Description: "The columns of a table, with their types, nullability, defaults and primary key. Qualify the name with its schema if it is ambiguous.",
+		MIMEType:    schemaResourceContentType,
+	}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		name, err := url.PathUnescape(strings.TrimPrefix(req.Params.URI, tableResourceURIPrefix))
+		if err != nil || name == "" {
+			return nil, mcp.ResourceNotFoundError(req.Params.URI)
+		}
+
+		var table *catalog.Table
+		var columns []catalog.Column
+		err = s.withCatalog(ctx, func(c *catalog.Catalog) error {
+			var err error
+			table, columns, err = c.Columns(ctx, name)
+			return err
+		})
+		if err != nil {
+			var notFound *catalog.TableNotFoundError
+			if errors.As(err, &notFound) {
+				return nil, mcp.ResourceNotFoundError(req.Params.URI)
+			}
+			return nil, err
+		}
+		return jsonResource(req.Params.URI, map[string]interface{}{
+			"schema":  table.Schema,
+			"name":    table.Name,
+			"type":    table.Type,
+			"columns": columns,
+		})
+	})
+}
+
+func (s *Server) withCatalog(ctx context.Context, f func(c *catalog.Catalog) error) error {
+	db, err := s.openDatabase(ctx, s.connectionValues)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	c, err := catalog.New(db)
+	if err != nil {
+		return err
+	}
+	return f(c)
+}
+
+func jsonResource(uri string, v interface{}) (*mcp.ReadResourceResult, error) {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not encode resource")
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{
+			URI:      uri,
+			MIMEType: schemaResourceContentType,
+			Text:     string(text),
+		}},
+	}, nil
+}
+
+// addReadOnlySQLTool adds the execute_readonly_sql tool, see runReadOnlySQL for the guards.
+func (s *Server) addReadOnlySQLTool() {
+	s.server.AddTool(&mcp.Tool{
+		Name:  ReadOnlySQLToolName,
+		Title: "Execute read-only SQL",
+		Description: "Run a single read-only SQL statement (SELECT, WITH, SHOW, EXPLAIN, DESCRIBE, VALUES or TABLE) " +
+			"and return the rows. Statements that write are rejected, and the query runs in a read-only transaction " +
+			"that is rolled back. Read the schema://tables resource to find the tables to query.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "The SQL query to run",
+				},
+			},
+			"required": []string{"query"},
+		},
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		arguments := struct {
+			Query string `json:"query"`
+		}{}
+		if err := json.Unmarshal(req.Params.Arguments, &arguments); err != nil {
+			return ErrorResult(ctx, NewToolError(ErrorInvalidArguments, errors.Wrap(err, "could not parse arguments"))).
+				CallToolResult()
+		}
+
+		ctx = audit.WithCaller(ctx, audit.OriginMCP, callerUser(req))
+		execution := sqleton_cmds.NewQueryExecution(ReadOnlySQLToolName, s.connectionValues)
+		execution.Query = arguments.Query
+		snapshot, truncated, err := s.runReadOnlySQL(ctx, arguments.Query)
+		rows := 0
+		if snapshot != nil {
+			rows = len(snapshot.Rows)
+		}
+		execution.Finish(nil, rows, err)
+		sqleton_cmds.NotifyQueryObservers(ctx, s.queryObservers, execution)
+		if err != nil {
+			result := ErrorResult(ctx, err)
+			result.RenderedQuery = arguments.Query
+			return result.CallToolResult()
+		}
+
+		return (&Result{
+			Columns:       snapshot.Columns,
+			Rows:          snapshot.Rows,
+			RowCount:      rows,
+			Truncated:     truncated,
+			RenderedQuery: arguments.Query,
+		}).CallToolResult()
+	})
+}
+
+func (s *Server) runReadOnlySQL(ctx context.Context, query string) (*snapshots.Snapshot, bool, error) {
+	// reject the query before connecting
+	if err := checkReadOnlyQueryArgument(query); err != nil {
+		return nil, false, err
+	}
+	db, err := s.openDatabase(ctx, s.connectionValues)
+	if err != nil {
+		return nil, false, &sqleton_cmds.QueryError{Stage: sqleton_cmds.QueryStageConnect, Err: err}
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	return runReadOnlySQL(ctx, db, query, *s.readOnlySQL)
+}
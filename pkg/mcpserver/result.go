@@ -0,0 +1,263 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/pkg/errors"
+)
+
+// Result is the envelope returned by tool calls, by mcp serve as well as by
+// mcp tools run. When the call failed, Error is set and there are no rows.
+type Result struct {
+	Columns  []string                 `json:"columns"`
+	Rows     []map[string]interface{} `json:"rows"`
+	RowCount int                      `json:"row_count"`
+	// Truncated is set when rows were dropped because of the row limit.
+	Truncated bool `json:"truncated"`
+	// RenderedQuery is the query sent to the database, when the tool ran one.
+	RenderedQuery string `json:"rendered_query,omitempty"`
+	// NextCursor is set when a paginated command returned a full page, to pass as
+	// its after argument for the next page.
+	NextCursor string     `json:"next_cursor,omitempty"`
+	Error      *ToolError `json:"error,omitempty"`
+}
+
+// ErrorKind tells a client what went wrong with a tool call, and whether changing the
+// arguments can fix it.
+type ErrorKind string
+
+const (
+	// ErrorInvalidArguments means the arguments don't match the tool input schema.
+	ErrorInvalidArguments ErrorKind = "invalid_arguments"
+	// ErrorNotFound means there is no tool with that name.
+	ErrorNotFound ErrorKind = "not_found"
+	// ErrorQueryRender means the query template could not be rendered with the arguments.
+	ErrorQueryRender ErrorKind = "query_render"
+	// ErrorConnection means the database could not be reached.
+	ErrorConnection ErrorKind = "connection"
+	// ErrorDatabase means the database rejected the query or failed running it.
+	ErrorDatabase ErrorKind = "database"
+	// ErrorCanceled means the call was canceled by the client.
+	ErrorCanceled ErrorKind = "canceled"
+	// ErrorTimeout means the call took longer than allowed.
+	ErrorTimeout ErrorKind = "timeout"
+	// ErrorInternal is any other error.
+	ErrorInternal ErrorKind = "internal"
+)
+
+// ToolError is the error object of a failed tool call.
+type ToolError struct {
+	Kind    ErrorKind `json:"kind"`
+	Message string    `json:"message"`
+	// Field is the invalid argument, when it is known.
+	Field string `json:"field,omitempty"`
+}
+
+func (e *ToolError) Error() string {
+	return e.Message
+}
+
+// NewToolError returns a ToolError of the given kind carrying the message of err.
+func NewToolError(kind ErrorKind, err error) *ToolError {
+	return &ToolError{Kind: kind, Message: err.Error()}
+}
+
+// ClassifyError turns the error of a tool call into a ToolError. ctx is the context
+// of the call, to tell cancellations and timeouts from database errors.
+func ClassifyError(ctx context.Context, err error) *ToolError {
+	var toolError *ToolError
+	if errors.As(err, &toolError) {
+		return toolError
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return NewToolError(ErrorTimeout, err)
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return NewToolError(ErrorCanceled, err)
+	}
+
+	var queryError *sqleton_cmds.QueryError
+	if errors.As(err, &queryError) {
+		switch queryError.Stage {
+		case sqleton_cmds.QueryStageConnect:
+			return NewToolError(ErrorConnection, err)
+		case sqleton_cmds.QueryStageRender:
+			return NewToolError(ErrorQueryRender, err)
+		case sqleton_cmds.QueryStageExecute:
+			return NewToolError(ErrorDatabase, err)
+		}
+	}
+	return NewToolError(ErrorInternal, err)
+}
+
+// ErrorResult returns the envelope of a call that failed with err.
+func ErrorResult(ctx context.Context, err error) *Result {
+	return &Result{
+		Columns: []string{},
+		Rows:    []map[string]interface{}{},
+		Error:   ClassifyError(ctx, err),
+	}
+}
+
+// ToolRunner runs repository commands for tool calls and collects their rows.
+type ToolRunner struct {
+	// ValuesForSections are applied to every call. The arguments set the default section.
+	ValuesForSections map[string]map[string]interface{}
+	// Middlewares are run on top of the values, see runner.WithAdditionalMiddlewares.
+	Middlewares []sources.Middleware
+	// MaxRows is the maximum number of rows returned, 0 for no limit.
+	MaxRows int
+}
+
+// Run runs command with the given arguments. Errors are returned in the envelope.
+func (r *ToolRunner) Run(
+	ctx context.Context,
+	command cmds.GlazeCommand,
+	arguments map[string]interface{},
+) *Result {
+	if err := CheckArguments(command.Description(), arguments); err != nil {
+		return ErrorResult(ctx, err)
+	}
+
+	valuesForSections := map[string]map[string]interface{}{}
+	for slug, values := range r.ValuesForSections {
+		valuesForSections[slug] = values
+	}
+	valuesForSections[schema.DefaultSlug] = arguments
+
+	parsedValues, err := runner.ParseCommandValues(command,
+		runner.WithValuesForSections(valuesForSections),
+		// the flags that keep the command running in a terminal, and the files it
+		// could run against instead of its connection, can't be set over MCP
+		runner.WithAdditionalMiddlewares(append([]sources.Middleware{
+			sources.BlacklistSectionFieldsFirst(map[string][]string{
+				flags.SqlHelpersSlug: flags.CLIOnlySqlHelpers,
+				flags.SqlAttachSlug:  {"attach"},
+			}),
+		}, r.Middlewares...)...),
+	)
+	if err != nil {
+		return ErrorResult(ctx, NewToolError(ErrorInvalidArguments, errors.Wrap(err, "invalid arguments")))
+	}
+
+	// the rendered query and the cursor are reported to the observers of the context
+	renderedQuery, nextCursor := "", ""
+	ctx = sqleton_cmds.ContextWithQueryObservers(ctx,
+		sqleton_cmds.QueryObserverFunc(func(_ context.Context, execution *sqleton_cmds.QueryExecution) {
+			renderedQuery = execution.Query
+			nextCursor = execution.NextCursor
+		}))
+
+	recorder := snapshots.NewRecorder(nil)
+	limiter := &rowLimiter{Processor: recorder, maxRows: r.MaxRows}
+	if err := command.RunIntoGlazeProcessor(ctx, parsedValues, limiter); err != nil {
+		ret := ErrorResult(ctx, err)
+		ret.RenderedQuery = renderedQuery
+		return ret
+	}
+
+	if limiter.truncated {
+		// the next page would skip the rows that were dropped
+		nextCursor = ""
+	}
+
+	description := command.Description()
+	snapshot := recorder.Snapshot(ToolName(description), description.FullPath(), arguments)
+	return &Result{
+		Columns:       snapshot.Columns,
+		Rows:          snapshot.Rows,
+		RowCount:      len(snapshot.Rows),
+		Truncated:     limiter.truncated,
+		RenderedQuery: renderedQuery,
+		NextCursor:    nextCursor,
+	}
+}
+
+// CheckArguments rejects arguments that are not flags or arguments of the command, and
+// missing required ones, naming the offending field so that a client can correct its call.
+func CheckArguments(description *cmds.CommandDescription, arguments map[string]interface{}) error {
+	known := map[string]*fields.Definition{}
+	collect := func(definition *fields.Definition) {
+		known[definition.Name] = definition
+	}
+	description.GetDefaultFlags().ForEach(collect)
+	description.GetDefaultArguments().ForEach(collect)
+
+	for name := range arguments {
+		if _, ok := known[name]; !ok {
+			names := make([]string, 0, len(known))
+			for name_ := range known {
+				names = append(names, name_)
+			}
+			sort.Strings(names)
+			expected := "the tool takes no arguments"
+			if len(names) > 0 {
+				expected = fmt.Sprintf("expected one of %s", strings.Join(names, ", "))
+			}
+			return &ToolError{
+				Kind:    ErrorInvalidArguments,
+				Message: fmt.Sprintf("unknown argument %s, %s", name, expected),
+				Field:   name,
+			}
+		}
+	}
+
+	for name, definition := range known {
+		if _, ok := arguments[name]; definition.Required && !ok {
+			return &ToolError{
+				Kind:    ErrorInvalidArguments,
+				Message: fmt.Sprintf("missing required argument %s", name),
+				Field:   name,
+			}
+		}
+	}
+	return nil
+}
+
+// CallToolResult returns result as structured content, with a JSON copy as text for
+// clients that don't read structured content.
+func (r *Result) CallToolResult() (*mcp.CallToolResult, error) {
+	text, err := json.Marshal(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not encode result")
+	}
+	return &mcp.CallToolResult{
+		Content:           []mcp.Content{&mcp.TextContent{Text: string(text)}},
+		StructuredContent: r,
+		IsError:           r.Error != nil,
+	}, nil
+}
+
+// rowLimiter drops the rows past maxRows. The query still runs to completion, so that
+// its execution is recorded with the total row count.
+type rowLimiter struct {
+	middlewares.Processor
+	maxRows   int
+	rows      int
+	truncated bool
+}
+
+func (l *rowLimiter) AddRow(ctx context.Context, row types.Row) error {
+	l.rows++
+	if l.maxRows > 0 && l.rows > l.maxRows {
+		l.truncated = true
+		return nil
+	}
+	return l.Processor.AddRow(ctx, row)
+}
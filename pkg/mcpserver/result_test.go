@@ -0,0 +1,144 @@
+package mcpserver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func newUsersCommand(t *testing.T, query string) *sqleton_cmds.SqlCommand {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlx.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+INSERT INTO users (name) VALUES ('alice'), ('bob'), ('carol');
+`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	command, err := sqleton_cmds.NewSqlCommand(
+		cmds.NewCommandDescription("users",
+			cmds.WithFlags(
+				fields.New("min", fields.TypeInteger, fields.WithDefault(0)),
+				fields.New("name", fields.TypeString, fields.WithRequired(true)),
+			),
+		),
+		sqleton_cmds.WithDbConnectionFactory(func(ctx context.Context, _ *values.Values) (*sqlx.DB, error) {
+			return sqlx.Open("sqlite3", path)
+		}),
+		sqleton_cmds.WithQuery(query),
+	)
+	require.NoError(t, err)
+	return command
+}
+
+func TestToolRunnerResult(t *testing.T) {
+	ctx := context.Background()
+	command := newUsersCommand(t,
+		"SELECT id, name FROM users WHERE id >= {{ .min }} AND name != {{ .name | sqlString }} ORDER BY id")
+
+	result := (&ToolRunner{}).Run(ctx, command, map[string]interface{}{"min": 1, "name": "bob"})
+	require.Nil(t, result.Error)
+	require.Equal(t, []string{"id", "name"}, result.Columns)
+	require.Equal(t, 2, result.RowCount)
+	require.False(t, result.Truncated)
+	require.Equal(t, "SELECT id, name FROM users WHERE id >= 1 AND name != 'bob' ORDER BY id", result.RenderedQuery)
+
+	result = (&ToolRunner{MaxRows: 1}).Run(ctx, command, map[string]interface{}{"name": "bob"})
+	require.Nil(t, result.Error)
+	require.Equal(t, 1, result.RowCount)
+	require.Equal(t, []map[string]interface{}{{"id": float64(1), "name": "alice"}}, result.Rows)
+	require.True(t, result.Truncated)
+}
+
+func TestToolRunnerErrors(t *testing.T) {
+	ctx := context.Background()
+	command := newUsersCommand(t, "SELECT * FROM users WHERE name = {{ .name | sqlString }}")
+
+	result := (&ToolRunner{}).Run(ctx, command, map[string]interface{}{})
+	require.Equal(t, &ToolError{Kind: ErrorInvalidArguments, Message: "missing required argument name", Field: "name"}, result.Error)
+	require.Empty(t, result.Rows)
+
+	result = (&ToolRunner{}).Run(ctx, command, map[string]interface{}{"name": "bob", "nme": "x"})
+	require.Equal(t, ErrorInvalidArguments, result.Error.Kind)
+	require.Equal(t, "nme", result.Error.Field)
+	require.Contains(t, result.Error.Message, "expected one of min, name")
+
+	result = (&ToolRunner{}).Run(ctx, command, map[string]interface{}{"name": "bob", "min": "many"})
+	require.Equal(t, ErrorInvalidArguments, result.Error.Kind)
+
+	broken := newUsersCommand(t, "SELECT * FROM missing WHERE name = {{ .name | sqlString }}")
+	result = (&ToolRunner{}).Run(ctx, broken, map[string]interface{}{"name": "bob"})
+	require.Equal(t, ErrorDatabase, result.Error.Kind)
+	require.Equal(t, "SELECT * FROM missing WHERE name = 'bob'", result.RenderedQuery)
+
+	broken = newUsersCommand(t, "SELECT * FROM users WHERE name = {{ .name | nope }}")
+	result = (&ToolRunner{}).Run(ctx, broken, map[string]interface{}{"name": "bob"})
+	require.Equal(t, ErrorQueryRender, result.Error.Kind)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	result = (&ToolRunner{}).Run(canceled, command, map[string]interface{}{"name": "bob"})
+	require.Equal(t, ErrorCanceled, result.Error.Kind)
+}
+
+func TestClassifyError(t *testing.T) {
+	ctx := context.Background()
+	require.Equal(t, ErrorConnection, ClassifyError(ctx, &sqleton_cmds.QueryError{
+		Stage: sqleton_cmds.QueryStageConnect,
+		Err:   errors.New("connection refused"),
+	}).Kind)
+	require.Equal(t, ErrorTimeout, ClassifyError(ctx, errors.Wrap(context.DeadlineExceeded, "could not run query")).Kind)
+	require.Equal(t, ErrorInternal, ClassifyError(ctx, errors.New("boom")).Kind)
+
+	toolError := &ToolError{Kind: ErrorNotFound, Message: "tool x not found"}
+	require.Same(t, toolError, ClassifyError(ctx, errors.Wrap(toolError, "wrapped")))
+}
+
+func TestToolRunnerIgnoresWatchAndSnapshot(t *testing.T) {
+	ctx := sqleton_cmds.ContextWithCaller(context.Background(), sqleton_cmds.OriginMCP, "bob")
+	command := newUsersCommand(t, "SELECT name FROM users WHERE name = {{ .name | sqlString }}")
+
+	runner_ := &ToolRunner{ValuesForSections: map[string]map[string]interface{}{
+		flags.SqlHelpersSlug: {"watch": "1s", "snapshot": "before"},
+	}}
+	result := runner_.Run(ctx, command, map[string]interface{}{"name": "bob"})
+	require.Nil(t, result.Error)
+	require.Equal(t, 1, result.RowCount)
+}
+
+func TestToolRunnerIgnoresAttachedFiles(t *testing.T) {
+	var connection string
+	ctx := sqleton_cmds.ContextWithQueryObservers(context.Background(),
+		sqleton_cmds.QueryObserverFunc(func(_ context.Context, execution *sqleton_cmds.QueryExecution) {
+			connection = execution.Connection
+		}))
+	command, err := sqleton_cmds.NewSqlCommand(
+		cmds.NewCommandDescription("users"),
+		sqleton_cmds.WithDbConnectionFactory(func(ctx context.Context, _ *values.Values) (*sqlx.DB, error) {
+			return sqlx.Open("sqlite3", ":memory:")
+		}),
+		sqleton_cmds.WithQuery("SELECT 1 AS one"),
+		sqleton_cmds.WithAttachSection(),
+	)
+	require.NoError(t, err)
+
+	runner_ := &ToolRunner{ValuesForSections: map[string]map[string]interface{}{
+		flags.SqlAttachSlug: {"attach": []string{"users.csv"}},
+	}}
+	result := runner_.Run(ctx, command, map[string]interface{}{})
+	require.Nil(t, result.Error)
+	require.Equal(t, 1, result.RowCount)
+	require.NotContains(t, connection, "attach")
+}
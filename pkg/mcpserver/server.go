@@ -0,0 +1,257 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	clay_sql "github.com/go-go-golems/clay/pkg/sql"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/sqleton/pkg/audit"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Server exposes the commands of sqleton repositories as MCP tools. Every command
+// producing rows and selected by the ToolsConfig becomes a tool named after its path, with the slashes replaced by
+// underscores (mysql/ps becomes mysql_ps), since MCP clients don't accept slashes in
+// tool names. Tool calls return the rows as structured content.
+type Server struct {
+	repositories      []*repositories.Repository
+	valuesForSections map[string]map[string]interface{}
+	version           string
+
+	// openDatabase and connectionValues are used to introspect the schema and to run
+	// read-only queries.
+	openDatabase     clay_sql.DBConnectionFactory
+	connectionValues *values.Values
+	queryObservers   []sqleton_cmds.QueryObserver
+	schemaResources  bool
+	readOnlySQL      *ReadOnlySQLOptions
+	toolsConfig      *ToolsConfig
+	maxRows          int
+
+	server *mcp.Server
+}
+
+type Option func(*Server)
+
+// WithValuesForSections sets values applied to every tool call, for example the
+// connection settings passed to mcp serve. The tool arguments set the default section.
+func WithValuesForSections(values map[string]map[string]interface{}) Option {
+	return func(s *Server) {
+		s.valuesForSections = values
+	}
+}
+
+// WithDatabase sets the database used by the schema resources and the read-only SQL
+// tool. It is opened with parsedValues for every request.
+func WithDatabase(openDatabase clay_sql.DBConnectionFactory, parsedValues *values.Values) Option {
+	return func(s *Server) {
+		s.openDatabase = openDatabase
+		s.connectionValues = parsedValues
+	}
+}
+
+// WithSchemaResources publishes the schema://tables and schema://table/<name>
+// resources. It requires WithDatabase.
+func WithSchemaResources() Option {
+	return func(s *Server) {
+		s.schemaResources = true
+	}
+}
+
+// WithReadOnlySQL adds the execute_readonly_sql tool. It requires WithDatabase.
+func WithReadOnlySQL(options ReadOnlySQLOptions) Option {
+	return func(s *Server) {
+		s.readOnlySQL = &options
+	}
+}
+
+// WithQueryObservers notifies observers of the queries run by execute_readonly_sql.
+// Repository commands notify the observers they were loaded with.
+func WithQueryObservers(observers ...sqleton_cmds.QueryObserver) Option {
+	return func(s *Server) {
+		s.queryObservers = append(s.queryObservers, observers...)
+	}
+}
+
+// WithToolsConfig selects the commands exposed as tools, and renames or describes them.
+func WithToolsConfig(config *ToolsConfig) Option {
+	return func(s *Server) {
+		s.toolsConfig = config
+	}
+}
+
+// WithMaxRows limits the number of rows returned by the repository tools, further
+// rows are dropped and the result is marked as truncated.
+func WithMaxRows(maxRows int) Option {
+	return func(s *Server) {
+		s.maxRows = maxRows
+	}
+}
+
+func WithVersion(version string) Option {
+	return func(s *Server) {
+		s.version = version
+	}
+}
+
+func NewServer(repositories_ []*repositories.Repository, options ...Option) (*Server, error) {
+	s := &Server{
+		repositories:      repositories_,
+		valuesForSections: map[string]map[string]interface{}{},
+		version:           "dev",
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	s.server = mcp.NewServer(&mcp.Implementation{Name: "sqleton", Version: s.version}, nil)
+
+	if (s.schemaResources || s.readOnlySQL != nil) && s.openDatabase == nil {
+		return nil, errors.New("schema resources and the read-only SQL tool require a database")
+	}
+	if s.schemaResources {
+		s.addSchemaResources()
+	}
+	if s.readOnlySQL != nil {
+		s.addReadOnlySQLTool()
+	}
+
+	tools, err := CollectTools(s.repositories, s.toolsConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, tool := range tools {
+		glazeCommand, ok := tool.Command.(cmds.GlazeCommand)
+		if !ok {
+			continue
+		}
+		description := tool.Command.Description()
+		if tool.Name == ReadOnlySQLToolName && s.readOnlySQL != nil {
+			log.Warn().Str("command", description.FullPath()).
+				Msg("skipping command, its tool name is taken by the read-only SQL tool")
+			continue
+		}
+
+		inputSchema, err := description.ToJsonSchema()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not create input schema for %s", description.FullPath())
+		}
+		s.server.AddTool(&mcp.Tool{
+			Name:        tool.Name,
+			Title:       description.FullPath(),
+			Description: tool.Description,
+			InputSchema: inputSchema,
+		}, s.toolHandler(glazeCommand))
+	}
+
+	return s, nil
+}
+
+// ToolName returns the MCP tool name of a command, its CommandPath with the slashes
+// and any other character MCP doesn't allow in tool names replaced by underscores.
+func ToolName(description *cmds.CommandDescription) string {
+	return strings.Map(func(r rune) rune {
+		if isToolNameRune(r) {
+			return r
+		}
+		return '_'
+	}, strings.ReplaceAll(CommandPath(description), "/", "_"))
+}
+
+func toolDescription(description *cmds.CommandDescription) string {
+	if description.Long == "" {
+		return description.Short
+	}
+	return description.Short + "\n\n" + description.Long
+}
+
+// MCPServer returns the underlying server, for example to serve it over a custom transport.
+func (s *Server) MCPServer() *mcp.Server {
+	return s.server
+}
+
+// ServeStdio serves a single client over stdin and stdout until ctx is canceled or the
+// client disconnects.
+func (s *Server) ServeStdio(ctx context.Context) error {
+	err := s.server.Run(ctx, &mcp.StdioTransport{})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP serves the streamable HTTP transport on address under path until ctx is canceled.
+func (s *Server) ServeHTTP(ctx context.Context, address string, path string) error {
+	mux := http.NewServeMux()
+	mux.Handle(path, mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+		return s.server
+	}, nil))
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 20 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info().Str("address", address).Str("path", path).Msg("serving MCP over streamable HTTP")
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+func (s *Server) toolHandler(command cmds.GlazeCommand) mcp.ToolHandler {
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		arguments := map[string]interface{}{}
+		if len(req.Params.Arguments) > 0 {
+			if err := json.Unmarshal(req.Params.Arguments, &arguments); err != nil {
+				return ErrorResult(ctx, NewToolError(ErrorInvalidArguments, errors.Wrap(err, "could not parse arguments"))).
+					CallToolResult()
+			}
+		}
+
+		// the context is canceled when the client cancels the call, which aborts the
+		// running query
+		ctx = audit.WithCaller(ctx, audit.OriginMCP, callerUser(req))
+		runner_ := &ToolRunner{
+			ValuesForSections: s.valuesForSections,
+			MaxRows:           s.maxRows,
+		}
+		return runner_.Run(ctx, command, arguments).CallToolResult()
+	}
+}
+
+// callerUser identifies the client for the audit log, using the user header set by an
+// authenticating proxy for HTTP clients, and the OS user for stdio clients.
+func callerUser(req *mcp.CallToolRequest) string {
+	if req.Extra == nil || req.Extra.Header == nil {
+		return audit.CurrentUser()
+	}
+	if req.Extra.TokenInfo != nil && req.Extra.TokenInfo.UserID != "" {
+		return req.Extra.TokenInfo.UserID
+	}
+	for _, header := range []string{"X-Forwarded-User", "X-Remote-User"} {
+		if user := req.Extra.Header.Get(header); user != "" {
+			return user
+		}
+	}
+	return "anonymous"
+}
@@ -0,0 +1,230 @@
+package mcpserver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCommand struct {
+	*cmds.CommandDescription
+	run func(ctx context.Context, limit int, gp middlewares.Processor) error
+}
+
+func (f *fakeCommand) RunIntoGlazeProcessor(ctx context.Context, parsedValues *values.Values, gp middlewares.Processor) error {
+	s := &struct {
+		Limit int `glazed:"limit"`
+	}{}
+	if err := parsedValues.DecodeSectionInto(schema.DefaultSlug, s); err != nil {
+		return err
+	}
+	return f.run(ctx, s.Limit, gp)
+}
+
+func newFakeCommand(run func(ctx context.Context, limit int, gp middlewares.Processor) error) *fakeCommand {
+	return &fakeCommand{
+		CommandDescription: cmds.NewCommandDescription("ps",
+			cmds.WithShort("Show processes"),
+			cmds.WithParents("mysql"),
+			cmds.WithFlags(fields.New("limit", fields.TypeInteger, fields.WithDefault(10))),
+		),
+		run: run,
+	}
+}
+
+func connect(t *testing.T, ctx context.Context, command cmds.Command) *mcp.ClientSession {
+	t.Helper()
+	repository := repositories.NewRepository()
+	repository.Add(command)
+	server, err := NewServer([]*repositories.Repository{repository})
+	require.NoError(t, err)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err = server.MCPServer().Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = session.Close() })
+	return session
+}
+
+func TestCallToolReturnsRows(t *testing.T) {
+	ctx := context.Background()
+	session := connect(t, ctx, newFakeCommand(func(ctx context.Context, limit int, gp middlewares.Processor) error {
+		for i := 1; i <= limit; i++ {
+			if err := gp.AddRow(ctx, types.NewRow(types.MRP("pid", i), types.MRP("state", "idle"))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	tools, err := session.ListTools(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, tools.Tools, 1)
+	require.Equal(t, "mysql_ps", tools.Tools[0].Name)
+	require.Equal(t, "Show processes", tools.Tools[0].Description)
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "mysql_ps",
+		Arguments: map[string]interface{}{"limit": 2},
+	})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	require.Equal(t, map[string]interface{}{
+		"columns": []interface{}{"pid", "state"},
+		"rows": []interface{}{
+			map[string]interface{}{"pid": float64(1), "state": "idle"},
+			map[string]interface{}{"pid": float64(2), "state": "idle"},
+		},
+		"row_count": float64(2),
+		"truncated": false,
+	}, result.StructuredContent)
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "mysql_ps",
+		Arguments: map[string]interface{}{"limit": "many"},
+	})
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	require.Equal(t, "invalid_arguments", toolErrorOf(t, result)["kind"])
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "mysql_ps",
+		Arguments: map[string]interface{}{"limitt": 2},
+	})
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	require.Equal(t, map[string]interface{}{
+		"kind":    "invalid_arguments",
+		"message": "unknown argument limitt, expected one of limit",
+		"field":   "limitt",
+	}, toolErrorOf(t, result))
+}
+
+func toolErrorOf(t *testing.T, result *mcp.CallToolResult) map[string]interface{} {
+	t.Helper()
+	structured, ok := result.StructuredContent.(map[string]interface{})
+	require.True(t, ok)
+	toolError, ok := structured["error"].(map[string]interface{})
+	require.True(t, ok)
+	return toolError
+}
+
+const pagedUsersCommand = `/* sqleton
+name: users
+short: List the users
+paginate-by: id
+flags:
+  - name: limit
+    type: int
+    default: 2
+  - name: after
+    type: string
+*/
+SELECT id, name FROM users
+WHERE 1=1
+{{ if .after }}  AND id > '{{ .after | sqlEscape }}'{{ end }}
+ORDER BY id
+LIMIT {{ .limit }}
+`
+
+func TestCallToolPagesThroughAResult(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlx.Open("sqlite3", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+INSERT INTO users (name) VALUES ('alice'), ('bob'), ('carol'), ('dave'), ('erin');
+`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	spec, err := sqleton_cmds.ParseSQLFileSpec("users.sql", []byte(pagedUsersCommand))
+	require.NoError(t, err)
+	compiler := &sqleton_cmds.SqlCommandCompiler{
+		DBConnectionFactory: func(ctx context.Context, _ *values.Values) (*sqlx.DB, error) {
+			return sqlx.Open("sqlite3", path)
+		},
+	}
+	command, err := compiler.Compile(spec)
+	require.NoError(t, err)
+	session := connect(t, ctx, command)
+
+	names := []interface{}{}
+	cursors := []interface{}{}
+	arguments := map[string]interface{}{}
+	for {
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "users", Arguments: arguments})
+		require.NoError(t, err)
+		require.False(t, result.IsError)
+		structured := result.StructuredContent.(map[string]interface{})
+		for _, row := range structured["rows"].([]interface{}) {
+			names = append(names, row.(map[string]interface{})["name"])
+		}
+		cursor, ok := structured["next_cursor"]
+		if !ok {
+			break
+		}
+		cursors = append(cursors, cursor)
+		arguments = map[string]interface{}{"after": cursor}
+	}
+	require.Equal(t, []interface{}{"alice", "bob", "carol", "dave", "erin"}, names)
+	require.Equal(t, []interface{}{"2", "4"}, cursors)
+
+	// a page that is not full is the last one
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "users",
+		Arguments: map[string]interface{}{"limit": 10},
+	})
+	require.NoError(t, err)
+	require.NotContains(t, result.StructuredContent, "next_cursor")
+	require.Equal(t, float64(5), result.StructuredContent.(map[string]interface{})["row_count"])
+
+	// the next page would skip the rows dropped by the row limit
+	truncated := (&ToolRunner{MaxRows: 1}).Run(ctx, command, map[string]interface{}{})
+	require.True(t, truncated.Truncated)
+	require.Empty(t, truncated.NextCursor)
+}
+
+func TestCallToolIsCanceled(t *testing.T) {
+	canceled := make(chan struct{})
+	session := connect(t, context.Background(), newFakeCommand(func(ctx context.Context, _ int, _ middlewares.Processor) error {
+		<-ctx.Done()
+		close(canceled)
+		return ctx.Err()
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "mysql_ps"})
+	require.Error(t, err)
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the running command was not canceled")
+	}
+}
+
+func TestToolName(t *testing.T) {
+	require.Equal(t, "mysql_ps", ToolName(cmds.NewCommandDescription("ps", cmds.WithParents("mysql"))))
+	require.Equal(t, "examples_ls-posts-type",
+		ToolName(cmds.NewCommandDescription("ls-posts-type [types...]", cmds.WithParents("examples"))))
+	require.Equal(t, "a_b_c", ToolName(cmds.NewCommandDescription("c", cmds.WithParents("a b"))))
+}
@@ -0,0 +1,282 @@
+package mcpserver
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// ToolsConfig selects the repository commands exposed as MCP tools, and how they are
+// presented to clients. An empty config exposes every command.
+//
+// Commands are referred to either by their tool name (mysql_ps) or by their command
+// path (mysql/ps).
+type ToolsConfig struct {
+	// Tags keeps the commands having at least one of these tags.
+	Tags []string `yaml:"tags,omitempty"`
+	// ExcludeTags drops the commands having any of these tags.
+	ExcludeTags []string `yaml:"exclude-tags,omitempty"`
+	// Directories keeps the commands below one of these repository directories,
+	// for example mysql or reports/daily.
+	Directories []string `yaml:"directories,omitempty"`
+	// ExcludeDirectories drops the commands below any of these repository directories.
+	ExcludeDirectories []string `yaml:"exclude-directories,omitempty"`
+	// Allow keeps only the listed commands. It is combined with the other filters.
+	Allow []string `yaml:"allow,omitempty"`
+	// Overrides renames commands and replaces their description.
+	Overrides map[string]ToolOverride `yaml:"overrides,omitempty"`
+}
+
+// ToolOverride changes how a command is presented as a tool. Empty fields keep the
+// name and description derived from the command.
+type ToolOverride struct {
+	Name        string `yaml:"name,omitempty"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// LoadToolsConfig reads a ToolsConfig from a YAML file.
+func LoadToolsConfig(path string) (*ToolsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read tools config")
+	}
+	ret := &ToolsConfig{}
+	if err := yaml.Unmarshal(data, ret); err != nil {
+		return nil, errors.Wrapf(err, "could not parse tools config %s", path)
+	}
+	return ret, nil
+}
+
+// Merge returns a copy of c where the fields set in other replace those of c, the way
+// a more local config file overrides a global one. The exclude lists are the exception:
+// they add up, so that a more local config can't expose commands excluded by a global
+// one. Overrides are merged per tool. Either config can be nil.
+func (c *ToolsConfig) Merge(other *ToolsConfig) *ToolsConfig {
+	ret := &ToolsConfig{}
+	for _, config := range []*ToolsConfig{c, other} {
+		if config == nil {
+			continue
+		}
+		for _, field := range []struct {
+			dst   *[]string
+			src   []string
+			union bool
+		}{
+			{&ret.Tags, config.Tags, false},
+			{&ret.ExcludeTags, config.ExcludeTags, true},
+			{&ret.Directories, config.Directories, false},
+			{&ret.ExcludeDirectories, config.ExcludeDirectories, true},
+			{&ret.Allow, config.Allow, false},
+		} {
+			if len(field.src) == 0 {
+				continue
+			}
+			if !field.union {
+				*field.dst = append([]string{}, field.src...)
+				continue
+			}
+			for _, value := range field.src {
+				if !slices.Contains(*field.dst, value) {
+					*field.dst = append(*field.dst, value)
+				}
+			}
+		}
+		for key, override := range config.Overrides {
+			if ret.Overrides == nil {
+				ret.Overrides = map[string]ToolOverride{}
+			}
+			ret.Overrides[key] = override
+		}
+	}
+	return ret
+}
+
+// Validate checks that renamed tools have names MCP clients accept.
+func (c *ToolsConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for key, override := range c.Overrides {
+		if override.Name != "" && !isValidToolName(override.Name) {
+			return errors.Errorf("invalid tool name %q for %s, only letters, digits, _, - and . are allowed", override.Name, key)
+		}
+	}
+	return nil
+}
+
+// Tool is a repository command selected by a ToolsConfig, with its tool name and description.
+type Tool struct {
+	Name        string
+	Description string
+	Command     cmds.Command
+}
+
+// CollectTools returns the commands of the repositories selected by config, sorted
+// like the repositories. Commands mapping to a tool name already taken are skipped
+// with a warning.
+func CollectTools(repositories_ []*repositories.Repository, config *ToolsConfig) ([]*Tool, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &ToolsConfig{}
+	}
+
+	ret := []*Tool{}
+	seen := map[string]string{}
+	usedAllow := map[string]bool{}
+	usedOverrides := map[string]bool{}
+	for _, repository := range repositories_ {
+		for _, command := range repository.CollectCommands([]string{}, true) {
+			description := command.Description()
+			name, path := ToolName(description), CommandPath(description)
+			if !config.selects(description, name, path, usedAllow) {
+				continue
+			}
+
+			tool := &Tool{
+				Name:        name,
+				Description: toolDescription(description),
+				Command:     command,
+			}
+			for _, key := range []string{path, name} {
+				override, ok := config.Overrides[key]
+				if !ok {
+					continue
+				}
+				usedOverrides[key] = true
+				if override.Name != "" {
+					tool.Name = override.Name
+				}
+				if override.Description != "" {
+					tool.Description = override.Description
+				}
+				break
+			}
+
+			if other, ok := seen[tool.Name]; ok {
+				log.Warn().Str("tool", tool.Name).Str("command", path).Str("other", other).
+					Msg("skipping command, another command maps to the same tool name")
+				continue
+			}
+			seen[tool.Name] = path
+			ret = append(ret, tool)
+		}
+	}
+
+	for _, entry := range config.Allow {
+		if !usedAllow[entry] {
+			log.Warn().Str("tool", entry).Msg("allowed tool doesn't match any command")
+		}
+	}
+	for key := range config.Overrides {
+		if !usedOverrides[key] {
+			log.Warn().Str("tool", key).Msg("tool override doesn't match any selected command")
+		}
+	}
+
+	return ret, nil
+}
+
+// FindTool returns the tool with the given tool name or command path.
+func FindTool(tools []*Tool, name string) (*Tool, bool) {
+	for _, tool := range tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	name = strings.Trim(name, "/")
+	for _, tool := range tools {
+		if CommandPath(tool.Command.Description()) == name {
+			return tool, true
+		}
+	}
+	return nil, false
+}
+
+// CommandPath returns the path of a command in its repository, without the usage
+// suffix of its name (mysql/ps).
+func CommandPath(description *cmds.CommandDescription) string {
+	name := description.Name
+	if fields_ := strings.Fields(name); len(fields_) > 0 {
+		name = fields_[0]
+	}
+	return strings.Join(append(append([]string{}, description.Parents...), name), "/")
+}
+
+func (c *ToolsConfig) selects(
+	description *cmds.CommandDescription,
+	name string,
+	path string,
+	usedAllow map[string]bool,
+) bool {
+	if len(c.Allow) > 0 {
+		allowed := false
+		for _, entry := range c.Allow {
+			if entry == name || strings.Trim(entry, "/") == path {
+				usedAllow[entry] = true
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if len(c.Tags) > 0 && !hasAnyTag(description.Tags, c.Tags) {
+		return false
+	}
+	if hasAnyTag(description.Tags, c.ExcludeTags) {
+		return false
+	}
+
+	directory := strings.Join(description.Parents, "/")
+	if len(c.Directories) > 0 && !inAnyDirectory(directory, c.Directories) {
+		return false
+	}
+	return !inAnyDirectory(directory, c.ExcludeDirectories)
+}
+
+func hasAnyTag(tags []string, wanted []string) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if tag == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inAnyDirectory(directory string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if prefix == "" || directory == prefix || strings.HasPrefix(directory, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidToolName(name string) bool {
+	if name == "" || len(name) > 128 {
+		return false
+	}
+	for _, r := range name {
+		if !isToolNameRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isToolNameRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		r == '_' || r == '-' || r == '.'
+}
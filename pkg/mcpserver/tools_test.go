@@ -0,0 +1,194 @@
+package mcpserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/clay/pkg/repositories"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func newTaggedCommand(name string, parents []string, tags ...string) *fakeCommand {
+	return &fakeCommand{
+		CommandDescription: cmds.NewCommandDescription(name,
+			cmds.WithShort("Show "+name),
+			cmds.WithParents(parents...),
+			cmds.WithTags(tags...),
+		),
+		run: func(ctx context.Context, limit int, gp middlewares.Processor) error { return nil },
+	}
+}
+
+func newToolsRepository() *repositories.Repository {
+	repository := repositories.NewRepository()
+	repository.Add(
+		newTaggedCommand("ps", []string{"mysql"}, "safe"),
+		newTaggedCommand("kill", []string{"mysql"}, "dangerous"),
+		newTaggedCommand("daily", []string{"reports", "sales"}, "safe"),
+		newTaggedCommand("weekly", []string{"reports", "sales"}),
+		newTaggedCommand("tables [types...]", []string{"sqlite"}),
+	)
+	return repository
+}
+
+func toolNames(t *testing.T, config *ToolsConfig) []string {
+	t.Helper()
+	tools, err := CollectTools([]*repositories.Repository{newToolsRepository()}, config)
+	require.NoError(t, err)
+	ret := []string{}
+	for _, tool := range tools {
+		ret = append(ret, tool.Name)
+	}
+	return ret
+}
+
+func TestCollectTools(t *testing.T) {
+	all := []string{"mysql_kill", "mysql_ps", "reports_sales_daily", "reports_sales_weekly", "sqlite_tables"}
+	require.ElementsMatch(t, all, toolNames(t, nil))
+	require.ElementsMatch(t, all, toolNames(t, &ToolsConfig{}))
+
+	require.ElementsMatch(t, []string{"mysql_ps", "reports_sales_daily"},
+		toolNames(t, &ToolsConfig{Tags: []string{"safe"}}))
+	require.ElementsMatch(t, []string{"mysql_ps", "reports_sales_daily", "reports_sales_weekly", "sqlite_tables"},
+		toolNames(t, &ToolsConfig{ExcludeTags: []string{"dangerous"}}))
+	require.ElementsMatch(t, []string{"reports_sales_daily", "reports_sales_weekly"},
+		toolNames(t, &ToolsConfig{Directories: []string{"reports/"}}))
+	require.ElementsMatch(t, []string{"reports_sales_daily", "reports_sales_weekly", "sqlite_tables"},
+		toolNames(t, &ToolsConfig{ExcludeDirectories: []string{"mysql"}}))
+	// a directory prefix matches whole path segments only
+	require.Empty(t, toolNames(t, &ToolsConfig{Directories: []string{"report"}}))
+
+	require.ElementsMatch(t, []string{"mysql_ps", "sqlite_tables"},
+		toolNames(t, &ToolsConfig{Allow: []string{"mysql_ps", "sqlite/tables", "missing"}}))
+	require.ElementsMatch(t, []string{"mysql_ps"},
+		toolNames(t, &ToolsConfig{Allow: []string{"mysql_ps", "mysql_kill"}, ExcludeTags: []string{"dangerous"}}))
+}
+
+func TestCollectToolsOverrides(t *testing.T) {
+	tools, err := CollectTools([]*repositories.Repository{newToolsRepository()}, &ToolsConfig{
+		Tags: []string{"safe"},
+		Overrides: map[string]ToolOverride{
+			"mysql/ps":            {Name: "list_processes", Description: "List the running queries"},
+			"reports_sales_daily": {Description: "Sales of the day"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+
+	tool, ok := FindTool(tools, "list_processes")
+	require.True(t, ok)
+	require.Equal(t, "List the running queries", tool.Description)
+	require.Equal(t, "mysql/ps", CommandPath(tool.Command.Description()))
+	// the command path keeps working after a rename
+	_, ok = FindTool(tools, "mysql/ps")
+	require.True(t, ok)
+	_, ok = FindTool(tools, "mysql_ps")
+	require.False(t, ok)
+
+	tool, ok = FindTool(tools, "reports_sales_daily")
+	require.True(t, ok)
+	require.Equal(t, "Sales of the day", tool.Description)
+
+	// a rename colliding with another tool keeps the first one
+	tools, err = CollectTools([]*repositories.Repository{newToolsRepository()}, &ToolsConfig{
+		Overrides: map[string]ToolOverride{"mysql_kill": {Name: "mysql_ps"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, tools, 4)
+
+	_, err = CollectTools([]*repositories.Repository{newToolsRepository()}, &ToolsConfig{
+		Overrides: map[string]ToolOverride{"mysql_ps": {Name: "mysql/ps"}},
+	})
+	require.Error(t, err)
+}
+
+func TestToolsConfigMerge(t *testing.T) {
+	base := &ToolsConfig{
+		Tags:      []string{"safe"},
+		Allow:     []string{"mysql_ps"},
+		Overrides: map[string]ToolOverride{"mysql_ps": {Name: "ps"}, "mysql_kill": {Name: "kill"}},
+	}
+	merged := base.Merge(&ToolsConfig{
+		Tags:      []string{"reports"},
+		Overrides: map[string]ToolOverride{"mysql_ps": {Name: "processes"}},
+	})
+	require.Equal(t, &ToolsConfig{
+		Tags:      []string{"reports"},
+		Allow:     []string{"mysql_ps"},
+		Overrides: map[string]ToolOverride{"mysql_ps": {Name: "processes"}, "mysql_kill": {Name: "kill"}},
+	}, merged)
+	require.Equal(t, []string{"safe"}, base.Tags)
+
+	var nilConfig *ToolsConfig
+	require.Equal(t, &ToolsConfig{}, nilConfig.Merge(nil))
+}
+
+func TestToolsConfigMergeAddsUpExcludes(t *testing.T) {
+	base := &ToolsConfig{
+		Directories:        []string{"mysql"},
+		ExcludeTags:        []string{"dangerous"},
+		ExcludeDirectories: []string{"mysql/admin"},
+	}
+	merged := base.Merge(&ToolsConfig{
+		Directories:        []string{"reports"},
+		ExcludeTags:        []string{"slow", "dangerous"},
+		ExcludeDirectories: []string{"reports/raw"},
+	})
+	require.Equal(t, &ToolsConfig{
+		Directories:        []string{"reports"},
+		ExcludeTags:        []string{"dangerous", "slow"},
+		ExcludeDirectories: []string{"mysql/admin", "reports/raw"},
+	}, merged)
+	require.Equal(t, []string{"dangerous"}, base.ExcludeTags)
+}
+
+func TestLoadToolsConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tools.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+tags: [safe]
+exclude-directories: [admin]
+overrides:
+  mysql/ps:
+    name: list_processes
+    description: List the running queries
+`), 0o644))
+
+	config, err := LoadToolsConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, &ToolsConfig{
+		Tags:               []string{"safe"},
+		ExcludeDirectories: []string{"admin"},
+		Overrides: map[string]ToolOverride{
+			"mysql/ps": {Name: "list_processes", Description: "List the running queries"},
+		},
+	}, config)
+}
+
+func TestServerAppliesToolsConfig(t *testing.T) {
+	ctx := context.Background()
+	server, err := NewServer([]*repositories.Repository{newToolsRepository()}, WithToolsConfig(&ToolsConfig{
+		Directories: []string{"mysql"},
+		ExcludeTags: []string{"dangerous"},
+		Overrides:   map[string]ToolOverride{"mysql_ps": {Name: "list_processes", Description: "List the running queries"}},
+	}))
+	require.NoError(t, err)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err = server.MCPServer().Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1"}, nil).
+		Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	defer func() { _ = session.Close() }()
+
+	tools, err := session.ListTools(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, tools.Tools, 1)
+	require.Equal(t, "list_processes", tools.Tools[0].Name)
+	require.Equal(t, "List the running queries", tools.Tools[0].Description)
+}
@@ -0,0 +1,188 @@
+package migrate
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// subQueryAction matches a template action that only inserts a subquery, such as
+// {{ subQuery "active_users" }}, along with its whitespace trimming markers.
+var subQueryAction = regexp.MustCompile(`\{\{(-?)\s*subQuery\s+"([^"\\]*)"\s*(-?)\}\}`)
+
+var subQueryCall = regexp.MustCompile(`\bsubQuery\b(\s+"([^"\\]*)")?`)
+
+var cteName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// InlineSubQueries turns the subqueries query inserts with {{ subQuery "name" }}
+// into CTEs, which the query selects from instead. It returns the new query, and
+// notes about the subqueries that were inlined, or left out because query
+// doesn't use them.
+//
+// Subqueries that the query runs while it is rendered, as in
+// sqlColumn (subQuery "name"), can't become CTEs, and neither can subqueries
+// that are not SELECTs, nor those of a query that doesn't start with SELECT or
+// WITH: an error says why.
+func InlineSubQueries(query string, subQueries map[string]string) (string, []string, error) {
+	if len(subQueries) == 0 {
+		return query, nil, nil
+	}
+
+	if remaining := subQueryCall.FindAllStringSubmatch(subQueryAction.ReplaceAllString(query, ""), -1); len(remaining) > 0 {
+		name := remaining[0][2]
+		if name == "" {
+			return "", nil, errors.New("the query calls subQuery with a name that is not a string, which can't become a CTE")
+		}
+		return "", nil, errors.Errorf("the query runs subquery %q while it is rendered, which can't become a CTE", name)
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, match := range subQueryAction.FindAllStringSubmatch(query, -1) {
+		name := match[2]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		subQuery, ok := subQueries[name]
+		if !ok {
+			return "", nil, errors.Errorf("the query uses subquery %q, which is not defined", name)
+		}
+		if !cteName.MatchString(name) {
+			return "", nil, errors.Errorf("subquery %q can't be the name of a CTE", name)
+		}
+		if strings.Contains(subQuery, "{{") {
+			return "", nil, errors.Errorf("subquery %q holds template actions, which are inserted as they are, but would be rendered in a CTE", name)
+		}
+		if word, _, _ := firstWord(subQuery); word != "SELECT" && word != "WITH" {
+			return "", nil, errors.Errorf("subquery %q is not a SELECT", name)
+		}
+		names = append(names, name)
+	}
+
+	notes := []string{}
+	for _, name := range names {
+		notes = append(notes, "inlined subquery "+name+" as a CTE")
+	}
+	for _, name := range sortedKeys(subQueries) {
+		if !seen[name] {
+			notes = append(notes, "left out unused subquery "+name)
+		}
+	}
+	if len(names) == 0 {
+		return query, notes, nil
+	}
+
+	word, start, end := firstWord(query)
+	switch word {
+	case "SELECT", "WITH":
+	case "":
+		return "", nil, errors.New("the query starts with a template block, so the subqueries can't become CTEs in front of it")
+	default:
+		return "", nil, errors.Errorf("the query starts with %s, so the subqueries can't become CTEs in front of it", word)
+	}
+
+	query = replaceSubQueryActions(query)
+
+	ctes := make([]string, 0, len(names))
+	for _, name := range names {
+		ctes = append(ctes, name+" AS (\n"+indent(strings.TrimRight(strings.TrimSpace(subQueries[name]), "; \t\r\n"))+"\n)")
+	}
+
+	if word == "SELECT" {
+		return query[:start] + "WITH " + strings.Join(ctes, ",\n") + "\n" + query[start:], notes, nil
+	}
+
+	// The query has CTEs of its own, which come after the subqueries, which can't
+	// refer to them.
+	if next, nextStart, nextEnd := firstWord(query[end:]); next == "RECURSIVE" && nextStart == skipSpace(query[end:], 0) {
+		end += nextEnd
+	}
+	rest := strings.TrimLeft(query[end:], " \t\r\n")
+	return query[:end] + " " + strings.Join(ctes, ",\n") + ",\n" + rest, notes, nil
+}
+
+// replaceSubQueryActions replaces each {{ subQuery "name" }} of query by a SELECT
+// from the CTE name, trimming the whitespace around it as the action would.
+func replaceSubQueryActions(query string) string {
+	var ret strings.Builder
+	last := 0
+	for _, match := range subQueryAction.FindAllStringSubmatchIndex(query, -1) {
+		before := query[last:match[0]]
+		if match[3] > match[2] {
+			before = strings.TrimRight(before, " \t\r\n")
+		}
+		ret.WriteString(before)
+		ret.WriteString("SELECT * FROM " + query[match[4]:match[5]])
+		last = match[1]
+		if match[7] > match[6] {
+			last = skipSpace(query, last)
+		}
+	}
+	ret.WriteString(query[last:])
+	return ret.String()
+}
+
+// firstWord returns the first SQL word of query in upper case, and where it
+// starts and ends, skipping whitespace, comments, and the template actions that
+// only assign variables. It returns an empty word if the query starts with
+// another template action, such as {{ if .name }}.
+func firstWord(query string) (string, int, int) {
+	i := 0
+	for {
+		i = skipSpace(query, i)
+		switch {
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				return "", len(query), len(query)
+			}
+			i += end + 1
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i:], "*/")
+			if end == -1 {
+				return "", len(query), len(query)
+			}
+			i += end + 2
+		case strings.HasPrefix(query[i:], "{{"):
+			end := strings.Index(query[i:], "}}")
+			if end == -1 {
+				return "", i, i
+			}
+			action := strings.Trim(query[i+2:i+end], "- \t\r\n")
+			if !strings.HasPrefix(action, "$") {
+				return "", i, i
+			}
+			i += end + 2
+		default:
+			end := i
+			for end < len(query) && isWordByte(query[end]) {
+				end++
+			}
+			return strings.ToUpper(query[i:end]), i, end
+		}
+	}
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && strings.IndexByte(" \t\r\n", s[i]) != -1 {
+		i++
+	}
+	return i
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func indent(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,99 @@
+// Package migrate converts the YAML commands of older sqleton repositories to
+// .sql commands with a /* sqleton ... */ preamble.
+package migrate
+
+import (
+	"sort"
+	"strings"
+
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotACommand is returned for YAML files that are not sqleton commands, such
+// as aliases and config files.
+var ErrNotACommand = errors.New("not a sqleton command")
+
+// Conversion is a YAML command converted to a .sql command.
+type Conversion struct {
+	Spec *sqleton_cmds.SqlCommandSpec
+	// SQL is the contents of the .sql file.
+	SQL []byte
+	// Notes lists what was changed or left out on the way.
+	Notes []string
+}
+
+// ConvertYAML converts the YAML command at path, with the given contents, to a
+// .sql command, inlining its subqueries as CTEs. It returns ErrNotACommand if
+// the file is not a command, and an error saying why if the command can't be
+// converted without changing what it does.
+func ConvertYAML(path string, contents []byte) (*Conversion, error) {
+	if sqleton_cmds.DetectSourceKind(path) == sqleton_cmds.SourceYAMLAlias {
+		return nil, ErrNotACommand
+	}
+
+	keys := map[string]interface{}{}
+	if err := yaml.Unmarshal(contents, &keys); err != nil {
+		return nil, errors.Wrapf(err, "could not parse %s", path)
+	}
+	if _, ok := keys["query"]; !ok {
+		return nil, ErrNotACommand
+	}
+
+	spec := &sqleton_cmds.SqlCommandSpec{}
+	decoder := yaml.NewDecoder(strings.NewReader(string(contents)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(spec); err != nil {
+		return nil, errors.Wrapf(err, "could not decode %s", path)
+	}
+
+	notes := []string{}
+	// Older commands put their usage in their name, as in order-summary [statuses...].
+	if name := strings.Fields(spec.Name); len(name) > 1 {
+		notes = append(notes, "dropped "+strings.Join(name[1:], " ")+" from the name")
+		spec.Name = name[0]
+	}
+
+	query, subQueryNotes, err := InlineSubQueries(strings.TrimSpace(spec.Query), spec.SubQueries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not convert %s", path)
+	}
+	notes = append(notes, subQueryNotes...)
+	spec.Query = query
+	spec.SubQueries = nil
+
+	sql, err := sqleton_cmds.MarshalSpecToSQLFile(spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not convert %s", path)
+	}
+	if _, err := sqleton_cmds.ParseSQLFileSpecStrict(path, []byte(sql)); err != nil {
+		return nil, errors.Wrapf(err, "could not convert %s", path)
+	}
+
+	return &Conversion{
+		Spec:  spec,
+		SQL:   []byte(sql),
+		Notes: notes,
+	}, nil
+}
+
+// SQLPath returns the path of the .sql command converted from the YAML command
+// at path, next to it.
+func SQLPath(path string) string {
+	for _, ext := range []string{".yaml", ".yml", ".YAML", ".YML"} {
+		if strings.HasSuffix(path, ext) {
+			return strings.TrimSuffix(path, ext) + ".sql"
+		}
+	}
+	return path + ".sql"
+}
+
+func sortedKeys(m map[string]string) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,205 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertYAML(t *testing.T) {
+	contents := `name: active-orders [status]
+short: List the orders of active customers
+flags:
+  - name: status
+    type: string
+    default: open
+subqueries:
+  active_customers: |
+    SELECT id FROM customers WHERE active = 1;
+  unused: SELECT 1
+query: |
+  SELECT id, total
+  FROM orders
+  WHERE customer_id IN ({{ subQuery "active_customers" }})
+  AND status = {{ .status | sqlString }}
+  ORDER BY id
+`
+	conversion, err := ConvertYAML("active-orders.yaml", []byte(contents))
+	require.NoError(t, err)
+	require.Equal(t, `/* sqleton
+name: active-orders
+short: List the orders of active customers
+flags:
+  - name: status
+    type: string
+    default: open
+*/
+WITH active_customers AS (
+  SELECT id FROM customers WHERE active = 1
+)
+SELECT id, total
+FROM orders
+WHERE customer_id IN (SELECT * FROM active_customers)
+AND status = {{ .status | sqlString }}
+ORDER BY id
+`, string(conversion.SQL))
+	require.Equal(t, []string{
+		"dropped [status] from the name",
+		"inlined subquery active_customers as a CTE",
+		"left out unused subquery unused",
+	}, conversion.Notes)
+
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func() {
+		_ = db.Close()
+	}()
+	db.MustExec(`
+CREATE TABLE customers (id INTEGER PRIMARY KEY, active INTEGER);
+CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER, status TEXT, total INTEGER);
+INSERT INTO customers VALUES (1, 1), (2, 0);
+INSERT INTO orders VALUES (1, 1, 'open', 10), (2, 2, 'open', 20), (3, 1, 'paid', 30), (4, 1, 'open', 40);
+`)
+	require.Equal(t, []int{1, 4}, orderIDs(t, db, conversion.Spec))
+}
+
+func TestConvertYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		contents string
+		err      string
+	}{
+		{
+			name:     "config",
+			path:     "sqleton-config.yaml",
+			contents: "db:\n  type: mysql\n",
+			err:      ErrNotACommand.Error(),
+		},
+		{
+			name:     "alias",
+			path:     "ls.alias.yaml",
+			contents: "name: ls\naliasFor: ls-posts\nquery: x\n",
+			err:      ErrNotACommand.Error(),
+		},
+		{
+			name:     "unknown key",
+			path:     "typo.yaml",
+			contents: "name: typo\nshort: Typo\nflgas: []\nquery: SELECT 1\n",
+			err:      "field flgas not found",
+		},
+		{
+			name: "rendered subquery",
+			path: "counts.yaml",
+			contents: `name: counts
+short: Count posts
+subqueries:
+  post_types: SELECT DISTINCT post_type FROM posts
+query: |
+  {{ $types := sqlColumn (subQuery "post_types") }}
+  SELECT {{ len $types }}
+`,
+			err: `the query runs subquery "post_types" while it is rendered`,
+		},
+		{
+			name: "template block",
+			path: "block.yaml",
+			contents: `name: block
+short: Block
+subqueries:
+  ids: SELECT id FROM t
+query: |
+  {{ if .all }}SELECT * FROM t{{ else }}SELECT * FROM u WHERE id IN ({{ subQuery "ids" }}){{ end }}
+`,
+			err: "the query starts with a template block",
+		},
+		{
+			name: "fragment",
+			path: "fragment.yaml",
+			contents: `name: fragment
+short: Fragment
+subqueries:
+  open: status = 'open'
+query: SELECT * FROM orders WHERE {{ subQuery "open" }}
+`,
+			err: `subquery "open" is not a SELECT`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConvertYAML(tt.path, []byte(tt.contents))
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestInlineSubQueriesIntoWith(t *testing.T) {
+	query, _, err := InlineSubQueries(`{{ $limit := 10 }}
+with recursive n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < {{ $limit }})
+SELECT i FROM n WHERE i IN ({{- subQuery "even" -}})`, map[string]string{
+		"even": "SELECT 2 UNION SELECT 4",
+	})
+	require.NoError(t, err)
+	require.Equal(t, `{{ $limit := 10 }}
+with recursive even AS (
+  SELECT 2 UNION SELECT 4
+),
+n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < {{ $limit }})
+SELECT i FROM n WHERE i IN (SELECT * FROM even)`, query)
+}
+
+// TestConvertYAMLExamples converts the YAML commands of ttmp, which have no
+// subqueries.
+func TestConvertYAMLExamples(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "ttmp", "*.yaml"))
+	require.NoError(t, err)
+	converted := 0
+	for _, path := range paths {
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		conversion, err := ConvertYAML(path, contents)
+		if err == ErrNotACommand {
+			continue
+		}
+		require.NoError(t, err, path)
+		spec, err := sqleton_cmds.ParseSQLFileSpecStrict(SQLPath(path), conversion.SQL)
+		require.NoError(t, err, path)
+		_, err = (&sqleton_cmds.SqlCommandCompiler{}).Compile(spec)
+		require.NoError(t, err, path)
+		converted++
+	}
+	require.NotZero(t, converted)
+}
+
+func orderIDs(t *testing.T, db *sqlx.DB, spec *sqleton_cmds.SqlCommandSpec) []int {
+	t.Helper()
+
+	command, err := (&sqleton_cmds.SqlCommandCompiler{}).Compile(spec)
+	require.NoError(t, err)
+	parsedValues, err := runner.ParseCommandValues(command)
+	require.NoError(t, err)
+	query, err := command.RenderQuery(context.Background(), db, parsedValues.GetDataMap())
+	require.NoError(t, err)
+
+	rows, err := db.Query(query)
+	require.NoError(t, err)
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	ret := []int{}
+	for rows.Next() {
+		var id, total int
+		require.NoError(t, rows.Scan(&id, &total))
+		ret = append(ret, id)
+	}
+	require.NoError(t, rows.Err())
+	return ret
+}
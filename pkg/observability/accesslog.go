@@ -0,0 +1,107 @@
+package observability
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// AccessLog writes one structured JSON line per HTTP request. When the request ran a
+// sqleton command, the line also carries the command path, the redacted command
+// parameters and the hash of the rendered query.
+//
+// The middleware stores a per-request record in the request context, and the AccessLog
+// itself is a QueryObserver that fills that record in, so it needs to be registered both
+// on the server and with the command loader.
+type AccessLog struct {
+	logger zerolog.Logger
+}
+
+var _ sqleton_cmds.QueryObserver = (*AccessLog)(nil)
+
+func NewAccessLog(w io.Writer) *AccessLog {
+	return &AccessLog{
+		logger: zerolog.New(w).With().Timestamp().Logger(),
+	}
+}
+
+type accessLogRecordKey struct{}
+
+type accessLogRecord struct {
+	mu         sync.Mutex
+	executions []*sqleton_cmds.QueryExecution
+}
+
+func (a *AccessLog) ObserveQuery(ctx context.Context, execution *sqleton_cmds.QueryExecution) {
+	record, ok := ctx.Value(accessLogRecordKey{}).(*accessLogRecord)
+	if !ok {
+		return
+	}
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	record.executions = append(record.executions, execution)
+}
+
+func (a *AccessLog) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			record := &accessLogRecord{}
+			req := c.Request()
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), accessLogRecordKey{}, record)))
+
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// let echo's error handler write the response so that we log the final status
+				c.Error(err)
+			}
+
+			a.log(c, record, start, err)
+			return nil
+		}
+	}
+}
+
+func (a *AccessLog) log(c echo.Context, record *accessLogRecord, start time.Time, err error) {
+	req := c.Request()
+	event := a.logger.Info()
+	if err != nil || c.Response().Status >= 500 {
+		event = a.logger.Error()
+	}
+
+	event = event.
+		Str("method", req.Method).
+		Str("path", req.URL.Path).
+		Int("status", c.Response().Status).
+		Str("remote_ip", c.RealIP()).
+		Int64("bytes_out", c.Response().Size).
+		Dur("latency", time.Since(start))
+	if err != nil {
+		event = event.AnErr("error", err)
+	}
+
+	record.mu.Lock()
+	executions := record.executions
+	record.mu.Unlock()
+
+	if len(executions) > 0 {
+		last := executions[len(executions)-1]
+		event = event.
+			Str("command", last.Command).
+			Interface("parameters", sqleton_cmds.RedactParameters(last.Parameters)).
+			Str("query_hash", last.QueryHash()).
+			Int("rows", last.Rows).
+			Dur("query_duration", last.Duration).
+			Int("queries", len(executions))
+		if last.Err != nil {
+			event = event.AnErr("query_error", last.Err)
+		}
+	}
+
+	event.Msg("access")
+}
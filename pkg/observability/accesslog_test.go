@@ -0,0 +1,100 @@
+package observability
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func accessLogLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	ret := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		entry := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		ret = append(ret, entry)
+	}
+	return ret
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+	accessLog := NewAccessLog(buf)
+
+	e := echo.New()
+	e.Use(accessLog.Middleware())
+	e.GET("/data/mysql/ps", func(c echo.Context) error {
+		ctx := c.Request().Context()
+		accessLog.ObserveQuery(ctx, &sqleton_cmds.QueryExecution{Command: "mysql/ps", Query: "SELECT 1"})
+		accessLog.ObserveQuery(ctx, &sqleton_cmds.QueryExecution{
+			Command:    "mysql/ps",
+			Parameters: map[string]interface{}{"user_like": "app%", "password": "hunter2"},
+			Query:      "SELECT * FROM information_schema.processlist",
+			Rows:       3,
+			Duration:   1500 * time.Microsecond,
+		})
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/data/broken", func(c echo.Context) error {
+		accessLog.ObserveQuery(c.Request().Context(), &sqleton_cmds.QueryExecution{
+			Command: "broken",
+			Query:   "SELECT * FROM missing",
+			Err:     errors.New("no such table: missing"),
+		})
+		return echo.NewHTTPError(http.StatusInternalServerError, "query failed")
+	})
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "index")
+	})
+
+	for _, target := range []string{"/data/mysql/ps", "/data/broken", "/"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	lines := accessLogLines(t, buf)
+	require.Len(t, lines, 3)
+
+	ps := lines[0]
+	require.Equal(t, "info", ps["level"])
+	require.Equal(t, "access", ps["message"])
+	require.Equal(t, "GET", ps["method"])
+	require.Equal(t, "/data/mysql/ps", ps["path"])
+	require.Equal(t, float64(http.StatusOK), ps["status"])
+	require.Equal(t, float64(2), ps["bytes_out"])
+	require.Equal(t, "mysql/ps", ps["command"])
+	require.Equal(t, map[string]interface{}{"user_like": "app%", "password": sqleton_cmds.RedactedValue}, ps["parameters"])
+	execution := &sqleton_cmds.QueryExecution{Query: "SELECT * FROM information_schema.processlist"}
+	require.Equal(t, execution.QueryHash(), ps["query_hash"])
+	require.Equal(t, float64(3), ps["rows"])
+	require.Equal(t, float64(2), ps["queries"])
+	require.Equal(t, 1.5, ps["query_duration"])
+
+	broken := lines[1]
+	require.Equal(t, "error", broken["level"])
+	require.Equal(t, float64(http.StatusInternalServerError), broken["status"])
+	require.Equal(t, "broken", broken["command"])
+	require.Equal(t, "no such table: missing", broken["query_error"])
+	require.Contains(t, broken["error"], "query failed")
+
+	// the executions of a request don't leak into the next one
+	index := lines[2]
+	require.Equal(t, "/", index["path"])
+	require.NotContains(t, index, "command")
+	require.NotContains(t, index, "query_hash")
+}
+
+func TestAccessLogIgnoresQueriesOutsideOfRequests(t *testing.T) {
+	buf := &bytes.Buffer{}
+	accessLog := NewAccessLog(buf)
+	accessLog.ObserveQuery(t.Context(), &sqleton_cmds.QueryExecution{Command: "mysql/ps"})
+	require.Empty(t, buf.String())
+}
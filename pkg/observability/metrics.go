@@ -0,0 +1,125 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "sqleton"
+
+// Metrics collects per-command prometheus metrics from executed queries.
+// It implements sqleton_cmds.QueryObserver and can be handed to the command loader.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	rows     *prometheus.CounterVec
+
+	openConnections  *prometheus.GaugeVec
+	inUseConnections *prometheus.GaugeVec
+	idleConnections  *prometheus.GaugeVec
+	waitCount        *prometheus.GaugeVec
+	waitDuration     *prometheus.GaugeVec
+}
+
+var _ sqleton_cmds.QueryObserver = (*Metrics)(nil)
+
+func NewMetrics() *Metrics {
+	commandLabels := []string{"command"}
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "command_requests_total",
+			Help:      "Number of executed command queries.",
+		}, commandLabels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "command_errors_total",
+			Help:      "Number of command queries that failed.",
+		}, commandLabels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "command_duration_seconds",
+			Help:      "Time spent rendering and running command queries.",
+			Buckets:   prometheus.DefBuckets,
+		}, commandLabels),
+		rows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "command_rows_total",
+			Help:      "Number of rows returned by command queries.",
+		}, commandLabels),
+		openConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_open_connections",
+			Help:      "Open connections in the database pool after the last query of a command.",
+		}, commandLabels),
+		inUseConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_in_use_connections",
+			Help:      "In-use connections in the database pool after the last query of a command.",
+		}, commandLabels),
+		idleConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_idle_connections",
+			Help:      "Idle connections in the database pool after the last query of a command.",
+		}, commandLabels),
+		waitCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_wait_count",
+			Help:      "Connections waited for in the database pool during the last query of a command.",
+		}, commandLabels),
+		waitDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "db_wait_duration_seconds",
+			Help:      "Time spent waiting for a pool connection during the last query of a command.",
+		}, commandLabels),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.errors,
+		m.duration,
+		m.rows,
+		m.openConnections,
+		m.inUseConnections,
+		m.idleConnections,
+		m.waitCount,
+		m.waitDuration,
+	)
+
+	return m
+}
+
+func (m *Metrics) ObserveQuery(_ context.Context, execution *sqleton_cmds.QueryExecution) {
+	command := execution.Command
+
+	m.requests.WithLabelValues(command).Inc()
+	if execution.Err != nil {
+		m.errors.WithLabelValues(command).Inc()
+	}
+	m.duration.WithLabelValues(command).Observe(execution.Duration.Seconds())
+	m.rows.WithLabelValues(command).Add(float64(execution.Rows))
+
+	stats := execution.DBStats
+	m.openConnections.WithLabelValues(command).Set(float64(stats.OpenConnections))
+	m.inUseConnections.WithLabelValues(command).Set(float64(stats.InUse))
+	m.idleConnections.WithLabelValues(command).Set(float64(stats.Idle))
+	m.waitCount.WithLabelValues(command).Set(float64(stats.WaitCount))
+	m.waitDuration.WithLabelValues(command).Set(stats.WaitDuration.Seconds())
+}
+
+// Handler returns the http handler exposing the collected metrics in the prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,67 @@
+package observability
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeMetrics(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetricsObserveQueries(t *testing.T) {
+	m := NewMetrics()
+	ctx := context.Background()
+	m.ObserveQuery(ctx, &sqleton_cmds.QueryExecution{
+		Command:  "mysql/ps",
+		Rows:     3,
+		Duration: 200 * time.Millisecond,
+		DBStats:  sql.DBStats{OpenConnections: 2, InUse: 1, Idle: 1, WaitCount: 4, WaitDuration: 500 * time.Millisecond},
+	})
+	m.ObserveQuery(ctx, &sqleton_cmds.QueryExecution{
+		Command:  "mysql/ps",
+		Duration: 50 * time.Millisecond,
+		Err:      errors.New("table not found"),
+	})
+	m.ObserveQuery(ctx, &sqleton_cmds.QueryExecution{
+		Command:  "reports/daily",
+		Rows:     10,
+		Duration: 2 * time.Second,
+	})
+
+	metrics := scrapeMetrics(t, m)
+	for _, line := range []string{
+		`sqleton_command_requests_total{command="mysql/ps"} 2`,
+		`sqleton_command_requests_total{command="reports/daily"} 1`,
+		`sqleton_command_errors_total{command="mysql/ps"} 1`,
+		`sqleton_command_rows_total{command="mysql/ps"} 3`,
+		`sqleton_command_rows_total{command="reports/daily"} 10`,
+		`sqleton_command_duration_seconds_count{command="mysql/ps"} 2`,
+		`sqleton_command_duration_seconds_sum{command="mysql/ps"} 0.25`,
+		`sqleton_command_duration_seconds_bucket{command="mysql/ps",le="0.1"} 1`,
+		`sqleton_command_duration_seconds_bucket{command="mysql/ps",le="0.25"} 2`,
+		`sqleton_command_duration_seconds_bucket{command="reports/daily",le="1"} 0`,
+		`sqleton_command_duration_seconds_bucket{command="reports/daily",le="2.5"} 1`,
+		// the pool gauges are those of the last query of the command
+		`sqleton_db_open_connections{command="mysql/ps"} 0`,
+		`sqleton_db_wait_count{command="mysql/ps"} 0`,
+	} {
+		require.Contains(t, metrics, line+"\n")
+	}
+	require.NotContains(t, metrics, `sqleton_command_errors_total{command="reports/daily"}`)
+}
@@ -0,0 +1,377 @@
+package promote
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/sqleton/pkg/sqlscan"
+)
+
+type tokenKind int
+
+const (
+	tokenIdentifier tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenSymbol
+	// tokenOther is a template action, which ends any pattern it appears in.
+	tokenOther
+)
+
+type token struct {
+	kind       tokenKind
+	text       string
+	start, end int
+}
+
+// tokenize splits query into identifiers (possibly qualified and quoted), string
+// and number literals and symbols, leaving out whitespace and comments.
+func tokenize(query string) []token {
+	ret := []token{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		start := i
+		kind, end, ok := sqlscan.Template.Scan(query, i)
+		switch {
+		case kind == sqlscan.LineComment || kind == sqlscan.BlockComment:
+			i = end
+			continue
+		case kind == sqlscan.String && c == '\'' && ok:
+			i = end
+			ret = append(ret, token{kind: tokenString, text: query[start:i], start: start, end: i})
+			continue
+		case kind == sqlscan.Action || kind == sqlscan.String:
+			// dollar-quoted and unterminated strings aren't turned into flags
+			i = end
+			ret = append(ret, token{kind: tokenOther, text: query[start:i], start: start, end: i})
+			continue
+		case unicode.IsSpace(rune(c)):
+			i++
+			continue
+		case isDigit(c):
+			for i < len(query) && isDigit(query[i]) {
+				i++
+			}
+			if i+1 < len(query) && query[i] == '.' && isDigit(query[i+1]) {
+				i++
+				for i < len(query) && isDigit(query[i]) {
+					i++
+				}
+			}
+			ret = append(ret, token{kind: tokenNumber, text: query[start:i], start: start, end: i})
+			continue
+		case isWordStart(c) || kind == sqlscan.QuotedIdentifier:
+			// a qualified name, such as o.status or "orders"."status"
+			for {
+				if kind, end, _ := sqlscan.Template.Scan(query, i); kind == sqlscan.QuotedIdentifier {
+					i = end
+				} else {
+					for i < len(query) && isWordPart(query[i]) {
+						i++
+					}
+				}
+				if i+1 < len(query) && query[i] == '.' && (isWordStart(query[i+1]) || query[i+1] == '"' || query[i+1] == '`') {
+					i++
+					continue
+				}
+				break
+			}
+			ret = append(ret, token{kind: tokenIdentifier, text: query[start:i], start: start, end: i})
+			continue
+		}
+
+		for _, symbol := range []string{"<=", ">=", "<>", "!=", "||", "::"} {
+			if strings.HasPrefix(query[i:], symbol) {
+				i += len(symbol)
+				break
+			}
+		}
+		if i == start {
+			i++
+		}
+		ret = append(ret, token{kind: tokenSymbol, text: query[start:i], start: start, end: i})
+	}
+	return ret
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || isDigit(c) || c == '$'
+}
+
+func (t token) is(keywords ...string) bool {
+	if t.kind != tokenIdentifier && t.kind != tokenSymbol {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(t.text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t token) isLiteral() bool {
+	return t.kind == tokenString || t.kind == tokenNumber
+}
+
+// keywords can't be the column of a comparison.
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "where": true, "when": true, "then": true,
+	"else": true, "case": true, "select": true, "on": true, "having": true, "is": true,
+	"null": true, "true": true, "false": true, "in": true, "like": true, "between": true,
+}
+
+func (t token) isColumn() bool {
+	return t.kind == tokenIdentifier && !keywords[strings.ToLower(t.text)]
+}
+
+// literalValue returns the value of a literal token, and the type of the flag
+// holding it.
+func literalValue(t token) (interface{}, fields.Type) {
+	if t.kind == tokenString {
+		return strings.ReplaceAll(t.text[1:len(t.text)-1], "''", "'"), fields.TypeString
+	}
+	if v, err := strconv.Atoi(t.text); err == nil {
+		return v, fields.TypeInteger
+	}
+	v, _ := strconv.ParseFloat(t.text, 64)
+	return v, fields.TypeFloat
+}
+
+type replacement struct {
+	start, end int
+	text       string
+}
+
+type parameterizer struct {
+	tokens       []token
+	flags        []*fields.Definition
+	replacements []replacement
+}
+
+// Parameterize replaces the literals that are compared to a column (with =, <>,
+// <, >, LIKE, IN or BETWEEN), and those of LIMIT and OFFSET, with template
+// actions rendering flags. It returns the new query and the flags, which default
+// to the literals, so that the query renders as it was.
+//
+// The flags are named after the columns, with a min_ or max_ prefix for lower
+// and upper bounds and a _like suffix for patterns. Other literals are left in
+// the query.
+func Parameterize(query string) (string, []*fields.Definition) {
+	p := &parameterizer{tokens: tokenize(query)}
+	for i := 0; i < len(p.tokens); {
+		i += p.match(i)
+	}
+	if len(p.replacements) == 0 {
+		return query, nil
+	}
+
+	sort.Slice(p.replacements, func(i, j int) bool {
+		return p.replacements[i].start < p.replacements[j].start
+	})
+	var ret strings.Builder
+	last := 0
+	for _, r := range p.replacements {
+		ret.WriteString(query[last:r.start])
+		ret.WriteString(r.text)
+		last = r.end
+	}
+	ret.WriteString(query[last:])
+	return ret.String(), p.flags
+}
+
+// match replaces the literals of the pattern starting at token i, if any, and
+// returns the number of tokens it spans.
+func (p *parameterizer) match(i int) int {
+	at := func(j int) token {
+		if i+j < len(p.tokens) {
+			return p.tokens[i+j]
+		}
+		return token{kind: tokenOther}
+	}
+	column := at(0)
+
+	switch {
+	case column.is("limit", "offset") && at(1).kind == tokenNumber && !at(2).is(","):
+		name, help := "limit", "Maximum number of rows"
+		if column.is("offset") {
+			name, help = "offset", "Number of rows to skip"
+		}
+		p.replaceLiteral(at(1), name, help)
+		return 2
+
+	case !column.isColumn():
+		return 1
+
+	case at(1).is("=", "<>", "!=", "<", "<=", ">", ">=") && at(2).isLiteral() && !isOperand(at(3)):
+		name, help := columnName(column.text), "Value compared to "+column.text
+		switch at(1).text {
+		case ">", ">=":
+			name, help = "min_"+name, "Lower bound of "+column.text
+		case "<", "<=":
+			name, help = "max_"+name, "Upper bound of "+column.text
+		}
+		p.replaceLiteral(at(2), name, help)
+		return 3
+	}
+
+	// the NOT of NOT LIKE, NOT IN and NOT BETWEEN
+	j := 1
+	if at(j).is("not") {
+		j++
+	}
+	switch {
+	case at(j).is("like", "ilike") && at(j+1).kind == tokenString && !isOperand(at(j+2)):
+		p.replaceLiteral(at(j+1), columnName(column.text)+"_like", "Pattern matched by "+column.text)
+		return j + 2
+
+	case at(j).is("between") && at(j+1).isLiteral() && at(j+2).is("and") && at(j+3).isLiteral() && !isOperand(at(j+4)):
+		p.replaceLiteral(at(j+1), "min_"+columnName(column.text), "Lower bound of "+column.text)
+		p.replaceLiteral(at(j+3), "max_"+columnName(column.text), "Upper bound of "+column.text)
+		return j + 4
+
+	case at(j).is("in") && at(j+1).is("("):
+		return j + p.replaceList(i+j+2, column)
+	}
+	return 1
+}
+
+// replaceList replaces a list of literals starting at token i and ending with a
+// closing parenthesis, when they are all strings or all integers.
+func (p *parameterizer) replaceList(i int, column token) int {
+	values := []interface{}{}
+	type_ := fields.Type("")
+	j := i
+	for ; j < len(p.tokens); j += 2 {
+		t := p.tokens[j]
+		if !t.isLiteral() {
+			return 1
+		}
+		v, literalType := literalValue(t)
+		if literalType == fields.TypeFloat || (type_ != "" && type_ != literalType) {
+			return 1
+		}
+		type_ = literalType
+		values = append(values, v)
+		if j+1 >= len(p.tokens) || p.tokens[j+1].is(")") {
+			break
+		}
+		if !p.tokens[j+1].is(",") {
+			return 1
+		}
+	}
+	if j+1 >= len(p.tokens) {
+		return 1
+	}
+
+	name, help := columnName(column.text), "Values of "+column.text
+	var (
+		listType fields.Type
+		default_ interface{}
+		template string
+	)
+	if type_ == fields.TypeString {
+		strings_ := []string{}
+		for _, v := range values {
+			strings_ = append(strings_, v.(string))
+		}
+		listType, default_, template = fields.TypeStringList, strings_, "{{ .%s | sqlStringIn }}"
+	} else {
+		ints := []int{}
+		for _, v := range values {
+			ints = append(ints, v.(int))
+		}
+		listType, default_, template = fields.TypeIntegerList, ints, "{{ .%s | sqlIntIn }}"
+	}
+	name = p.addFlag(name, listType, default_, help)
+	p.replacements = append(p.replacements, replacement{
+		start: p.tokens[i].start,
+		end:   p.tokens[j].end,
+		text:  fmt.Sprintf(template, name),
+	})
+	return j - i + 4
+}
+
+func (p *parameterizer) replaceLiteral(t token, name string, help string) {
+	v, type_ := literalValue(t)
+	name = p.addFlag(name, type_, v, help)
+	text := fmt.Sprintf("{{ .%s }}", name)
+	if type_ == fields.TypeString {
+		text = fmt.Sprintf("'{{ .%s | sqlEscape }}'", name)
+	}
+	p.replacements = append(p.replacements, replacement{start: t.start, end: t.end, text: text})
+}
+
+// addFlag adds a flag named after name and returns its name. A literal compared
+// to the same column again reuses the flag when it has the same value, and gets a
+// numbered flag otherwise.
+func (p *parameterizer) addFlag(name string, type_ fields.Type, default_ interface{}, help string) string {
+	for n := 1; ; n++ {
+		candidate := name
+		if n > 1 {
+			candidate = fmt.Sprintf("%s_%d", name, n)
+		}
+		var existing *fields.Definition
+		for _, flag := range p.flags {
+			if flag.Name == candidate {
+				existing = flag
+			}
+		}
+		if existing == nil {
+			p.flags = append(p.flags, fields.New(candidate, type_,
+				fields.WithHelp(help),
+				fields.WithDefault(default_),
+			))
+			return candidate
+		}
+		if existing.Type == type_ && reflect.DeepEqual(*existing.Default, default_) {
+			return candidate
+		}
+	}
+}
+
+// isOperand is true for tokens that continue an expression after a literal, in
+// which case the literal is not compared to the column on its own.
+func isOperand(t token) bool {
+	return t.is("+", "-", "*", "/", "%", "||", "::", ".", "(", "[")
+}
+
+var nonNameCharacters = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// columnName turns a column such as o."Order Status" into a flag name such as
+// order_status.
+func columnName(column string) string {
+	last, quote := 0, byte(0)
+	for i := 0; i < len(column); i++ {
+		switch c := column[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '`':
+			quote = c
+		case c == '.':
+			last = i + 1
+		}
+	}
+	name := nonNameCharacters.ReplaceAllString(strings.ToLower(strings.Trim(column[last:], "\"`")), "_")
+	name = strings.Trim(name, "_")
+	if name == "" || isDigit(name[0]) {
+		return "value"
+	}
+	return name
+}
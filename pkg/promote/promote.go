@@ -0,0 +1,109 @@
+package promote
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/pkg/errors"
+)
+
+var validSegment = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// checkCommandName returns an error if name, such as mysql/new-report, can't be
+// the path of a command in a repository.
+func checkCommandName(name string) error {
+	for _, segment := range strings.Split(name, "/") {
+		if !validSegment.MatchString(segment) {
+			return errors.Errorf("invalid command name %q, use directories and a name made of letters, digits, '-' and '_', e.g. mysql/new-report", name)
+		}
+	}
+	return nil
+}
+
+// ChooseRepository returns the directory of the repository to save a command to:
+// the one given by chosen, which is the path or the directory name of one of the
+// repositories, or the only repository when chosen is empty.
+func ChooseRepository(repositories []string, chosen string) (string, error) {
+	if len(repositories) == 0 {
+		return "", errors.New("there is no repository to save the command to, add one to app.repositories in the sqleton config")
+	}
+	if chosen == "" {
+		if len(repositories) > 1 {
+			return "", errors.Errorf("choose the repository to save the command to with --save-to: %s",
+				strings.Join(repositories, ", "))
+		}
+		return os.ExpandEnv(repositories[0]), nil
+	}
+
+	for _, repository := range repositories {
+		dir := os.ExpandEnv(repository)
+		if filepath.Clean(dir) == filepath.Clean(os.ExpandEnv(chosen)) || filepath.Base(dir) == chosen {
+			return dir, nil
+		}
+	}
+	return "", errors.Errorf("%s is not a repository, choose one of %s", chosen, strings.Join(repositories, ", "))
+}
+
+// NewSpec creates the spec of the command settings.SaveAs running query, turning
+// the literals of the query into flags with --parameterize.
+func NewSpec(query string, settings *flags.SqlSaveAsSettings) (*sqleton_cmds.SqlCommandSpec, error) {
+	if err := checkCommandName(settings.SaveAs); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(settings.Short) == "" {
+		return nil, errors.Errorf("pass a short description of %s with --short", settings.SaveAs)
+	}
+
+	query = strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+	spec := &sqleton_cmds.SqlCommandSpec{
+		Name:  filepath.Base(settings.SaveAs),
+		Short: strings.TrimSpace(settings.Short),
+		Query: query,
+	}
+	if settings.Parameterize {
+		spec.Query, spec.Flags = Parameterize(query)
+	}
+	return spec, nil
+}
+
+// Save writes query as a command of one of repositories, as chosen by settings,
+// and returns the path of the file.
+func Save(repositories []string, query string, settings *flags.SqlSaveAsSettings) (string, error) {
+	spec, err := NewSpec(query, settings)
+	if err != nil {
+		return "", err
+	}
+	repository, err := ChooseRepository(repositories, settings.SaveTo)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(repository, filepath.FromSlash(settings.SaveAs)+".sql")
+
+	contents, err := sqleton_cmds.MarshalSpecToSQLFile(spec)
+	if err != nil {
+		return "", err
+	}
+	// the file is loaded back, so that a command that doesn't load is never written
+	parsed, err := sqleton_cmds.ParseSQLFileSpec(path, []byte(contents))
+	if err != nil {
+		return "", err
+	}
+	if _, err := (&sqleton_cmds.SqlCommandCompiler{}).Compile(parsed); err != nil {
+		return "", errors.Wrapf(err, "could not compile %s", settings.SaveAs)
+	}
+
+	if _, err := os.Stat(path); err == nil && !settings.Force {
+		return "", errors.Errorf("%s already exists, pass --force to overwrite it", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", errors.Wrap(err, "could not create command directory")
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		return "", errors.Wrap(err, "could not write command")
+	}
+	return path, nil
+}
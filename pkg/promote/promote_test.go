@@ -0,0 +1,149 @@
+package promote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fields "github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParameterize(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+		flags map[string]interface{}
+	}{
+		{
+			name:  "comparisons",
+			query: "SELECT * FROM orders o WHERE o.status = 'open' AND total >= 10.5 AND total < 100 AND o.\"Customer Id\" <> 3 AND note = 'it''s'",
+			want:  "SELECT * FROM orders o WHERE o.status = '{{ .status | sqlEscape }}' AND total >= {{ .min_total }} AND total < {{ .max_total }} AND o.\"Customer Id\" <> {{ .customer_id }} AND note = '{{ .note | sqlEscape }}'",
+			flags: map[string]interface{}{"status": "open", "min_total": 10.5, "max_total": 100, "customer_id": 3, "note": "it's"},
+		},
+		{
+			name:  "like, in and between",
+			query: "SELECT * FROM t WHERE name NOT LIKE 'a%' AND status IN ('open','paid') AND id IN (1,2) AND created BETWEEN '2024-01-01' AND '2024-12-31'",
+			want:  "SELECT * FROM t WHERE name NOT LIKE '{{ .name_like | sqlEscape }}' AND status IN ({{ .status | sqlStringIn }}) AND id IN ({{ .id | sqlIntIn }}) AND created BETWEEN '{{ .min_created | sqlEscape }}' AND '{{ .max_created | sqlEscape }}'",
+			flags: map[string]interface{}{
+				"name_like":   "a%",
+				"status":      []string{"open", "paid"},
+				"id":          []int{1, 2},
+				"min_created": "2024-01-01",
+				"max_created": "2024-12-31",
+			},
+		},
+		{
+			name:  "limit and offset",
+			query: "SELECT * FROM t ORDER BY id LIMIT 10 OFFSET 20",
+			want:  "SELECT * FROM t ORDER BY id LIMIT {{ .limit }} OFFSET {{ .offset }}",
+			flags: map[string]interface{}{"limit": 10, "offset": 20},
+		},
+		{
+			name:  "same column",
+			query: "SELECT * FROM a WHERE status = 'open' UNION SELECT * FROM b WHERE status = 'open' OR status = 'paid'",
+			want:  "SELECT * FROM a WHERE status = '{{ .status | sqlEscape }}' UNION SELECT * FROM b WHERE status = '{{ .status | sqlEscape }}' OR status = '{{ .status_2 | sqlEscape }}'",
+			flags: map[string]interface{}{"status": "open", "status_2": "paid"},
+		},
+		{
+			name: "left alone",
+			query: `SELECT 'a = 1', total * 2 AS double -- x = 1
+FROM t /* y = 2 */
+WHERE total = 1 + tax AND lower(name) = 'bob' AND id IN (1, 'a') AND "x = 3" IS NULL
+LIMIT 5, 10`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, flags_ := Parameterize(tt.query)
+			if tt.want == "" {
+				require.Equal(t, tt.query, query)
+				require.Empty(t, flags_)
+				return
+			}
+			require.Equal(t, tt.want, query)
+
+			defaults := map[string]interface{}{}
+			for _, flag := range flags_ {
+				defaults[flag.Name] = *flag.Default
+			}
+			require.Equal(t, tt.flags, defaults)
+
+			// the command renders the original query with the defaults of its flags
+			spec := &sqleton_cmds.SqlCommandSpec{Name: "test", Short: "Test", Query: query, Flags: flags_}
+			require.Equal(t, tt.query, renderDefaults(t, spec))
+		})
+	}
+}
+
+func renderDefaults(t *testing.T, spec *sqleton_cmds.SqlCommandSpec) string {
+	t.Helper()
+	command, err := (&sqleton_cmds.SqlCommandCompiler{}).Compile(spec)
+	require.NoError(t, err)
+	parsedValues, err := runner.ParseCommandValues(command)
+	require.NoError(t, err)
+	query, err := command.RenderQuery(context.Background(), nil, parsedValues.GetDataMap())
+	require.NoError(t, err)
+	return query
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+	repositories := []string{filepath.Join(dir, "reports"), filepath.Join(dir, "queries")}
+	settings := &flags.SqlSaveAsSettings{
+		SaveAs:       "mysql/new-report",
+		Short:        "Open orders",
+		SaveTo:       "queries",
+		Parameterize: true,
+	}
+
+	path, err := Save(repositories, "SELECT id FROM orders WHERE status = 'open';\n", settings)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "queries", "mysql", "new-report.sql"), path)
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	spec, err := sqleton_cmds.ParseSQLFileSpec(path, contents)
+	require.NoError(t, err)
+	require.Equal(t, "new-report", spec.Name)
+	require.Equal(t, "Open orders", spec.Short)
+	require.Equal(t, "SELECT id FROM orders WHERE status = '{{ .status | sqlEscape }}'", spec.Query)
+	require.Len(t, spec.Flags, 1)
+	require.Equal(t, fields.TypeString, spec.Flags[0].Type)
+	require.Equal(t, "SELECT id FROM orders WHERE status = 'open'", renderDefaults(t, spec))
+
+	_, err = Save(repositories, "SELECT 1", settings)
+	require.ErrorContains(t, err, "already exists, pass --force")
+	settings.Force, settings.Parameterize = true, false
+	_, err = Save(repositories, "SELECT 1", settings)
+	require.NoError(t, err)
+	contents, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(string(contents), "*/\nSELECT 1\n"))
+}
+
+func TestSaveErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Save(nil, "SELECT 1", &flags.SqlSaveAsSettings{SaveAs: "report", Short: "Report"})
+	require.ErrorContains(t, err, "add one to app.repositories")
+	_, err = Save([]string{dir, dir + "2"}, "SELECT 1", &flags.SqlSaveAsSettings{SaveAs: "report", Short: "Report"})
+	require.ErrorContains(t, err, "choose the repository to save the command to with --save-to")
+	_, err = Save([]string{dir}, "SELECT 1", &flags.SqlSaveAsSettings{SaveAs: "report", Short: "Report", SaveTo: "nope"})
+	require.ErrorContains(t, err, "nope is not a repository")
+	_, err = Save([]string{dir}, "SELECT 1", &flags.SqlSaveAsSettings{SaveAs: "../report", Short: "Report"})
+	require.ErrorContains(t, err, "invalid command name")
+	_, err = Save([]string{dir}, "SELECT 1", &flags.SqlSaveAsSettings{SaveAs: "report"})
+	require.ErrorContains(t, err, "pass a short description of report with --short")
+
+	path, err := Save([]string{dir}, "SELECT 1", &flags.SqlSaveAsSettings{SaveAs: "report", Short: "Report"})
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "report.sql"), path)
+}
@@ -0,0 +1,230 @@
+package snapshots
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Diff compares two snapshots and returns one row per difference.
+//
+// Rows are matched by the values of the key columns. Added and removed rows are
+// returned whole, with a change column in front. For rows present in both
+// snapshots, every differing cell is returned as a row made of the change column,
+// the key columns, and column, old and new.
+//
+// Without key columns, whole rows are compared, so only added and removed rows
+// are reported.
+func Diff(from *Snapshot, to *Snapshot, keys []string) ([]types.Row, error) {
+	if len(keys) == 0 {
+		return diffWholeRows(from, to)
+	}
+
+	for _, snapshot := range []*Snapshot{from, to} {
+		if len(snapshot.Rows) == 0 {
+			continue
+		}
+		for _, key := range keys {
+			if !containsString(snapshot.Columns, key) {
+				return nil, errors.Errorf("key column %s not found in snapshot %s", key, snapshot.Name)
+			}
+		}
+	}
+
+	fromByKey, err := indexByKey(from, keys)
+	if err != nil {
+		return nil, err
+	}
+	toByKey, err := indexByKey(to, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := mergeColumns(to.Columns, from.Columns)
+	ret := []types.Row{}
+
+	for _, row := range from.Rows {
+		key, err := rowKey(row, keys)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := toByKey[key]; !ok {
+			ret = append(ret, wholeRow(ChangeRemoved, row, from.Columns))
+		}
+	}
+
+	for _, row := range to.Rows {
+		key, err := rowKey(row, keys)
+		if err != nil {
+			return nil, err
+		}
+		old, ok := fromByKey[key]
+		if !ok {
+			ret = append(ret, wholeRow(ChangeAdded, row, to.Columns))
+			continue
+		}
+
+		for _, column := range columns {
+			if containsString(keys, column) {
+				continue
+			}
+			if reflect.DeepEqual(old[column], row[column]) {
+				continue
+			}
+			changed := types.NewRow(types.MRP("change", ChangeChanged))
+			for _, k := range keys {
+				changed.Set(k, row[k])
+			}
+			changed.Set("column", column)
+			changed.Set("old", old[column])
+			changed.Set("new", row[column])
+			ret = append(ret, changed)
+		}
+	}
+
+	return ret, nil
+}
+
+func diffWholeRows(from *Snapshot, to *Snapshot) ([]types.Row, error) {
+	remaining := map[string]int{}
+	for _, row := range to.Rows {
+		key, err := canonical(row)
+		if err != nil {
+			return nil, err
+		}
+		remaining[key]++
+	}
+
+	ret := []types.Row{}
+	for _, row := range from.Rows {
+		key, err := canonical(row)
+		if err != nil {
+			return nil, err
+		}
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		ret = append(ret, wholeRow(ChangeRemoved, row, from.Columns))
+	}
+
+	// whatever is left over in the new snapshot has been added
+	for _, row := range to.Rows {
+		key, err := canonical(row)
+		if err != nil {
+			return nil, err
+		}
+		if remaining[key] == 0 {
+			continue
+		}
+		remaining[key]--
+		ret = append(ret, wholeRow(ChangeAdded, row, to.Columns))
+	}
+
+	return ret, nil
+}
+
+func indexByKey(snapshot *Snapshot, keys []string) (map[string]map[string]interface{}, error) {
+	ret := map[string]map[string]interface{}{}
+	for _, row := range snapshot.Rows {
+		key, err := rowKey(row, keys)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := ret[key]; ok {
+			return nil, errors.Errorf("key %s is not unique in snapshot %s", key, snapshot.Name)
+		}
+		ret[key] = row
+	}
+	return ret, nil
+}
+
+func rowKey(row map[string]interface{}, keys []string) (string, error) {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = row[key]
+	}
+	return canonical(values)
+}
+
+// canonical encodes v as JSON. Maps are encoded with sorted keys, which makes
+// the result usable as a comparison key.
+func canonical(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrap(err, "could not encode row")
+	}
+	return string(data), nil
+}
+
+func wholeRow(change string, row map[string]interface{}, columns []string) types.Row {
+	ret := types.NewRow(types.MRP("change", change))
+	for _, column := range columns {
+		ret.Set(column, row[column])
+	}
+	return ret
+}
+
+func mergeColumns(columns []string, others []string) []string {
+	ret := append([]string{}, columns...)
+	for _, column := range others {
+		if !containsString(ret, column) {
+			ret = append(ret, column)
+		}
+	}
+	return ret
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedCells returns, for every row of to, the columns whose value differs from
+// the matching row in from. Rows without a match have all their columns marked.
+// Rows are matched by the key columns, or by position when no keys are given.
+func ChangedCells(from *Snapshot, to *Snapshot, keys []string) ([]map[string]bool, error) {
+	var fromByKey map[string]map[string]interface{}
+	if len(keys) > 0 {
+		var err error
+		fromByKey, err = indexByKey(from, keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := make([]map[string]bool, len(to.Rows))
+	for i, row := range to.Rows {
+		var old map[string]interface{}
+		if len(keys) > 0 {
+			key, err := rowKey(row, keys)
+			if err != nil {
+				return nil, err
+			}
+			old = fromByKey[key]
+		} else if i < len(from.Rows) {
+			old = from.Rows[i]
+		}
+
+		changed := map[string]bool{}
+		for _, column := range to.Columns {
+			if old == nil || !reflect.DeepEqual(old[column], row[column]) {
+				changed[column] = true
+			}
+		}
+		ret[i] = changed
+	}
+	return ret, nil
+}
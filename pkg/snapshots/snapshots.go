@@ -0,0 +1,276 @@
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// SnapshotDirEnvVar overrides the directory snapshots are stored in.
+const SnapshotDirEnvVar = "SQLETON_SNAPSHOT_DIR"
+
+const timestampFormat = "20060102T150405.000000000Z"
+
+// Snapshot is the stored result of a single run, along with what is needed to run it again.
+type Snapshot struct {
+	Name       string                   `json:"name"`
+	Command    string                   `json:"command"`
+	Parameters map[string]interface{}   `json:"parameters,omitempty"`
+	CreatedAt  time.Time                `json:"created_at"`
+	Columns    []string                 `json:"columns"`
+	Rows       []map[string]interface{} `json:"rows"`
+
+	// Path is the file the snapshot was loaded from.
+	Path string `json:"-"`
+}
+
+// DefaultDir returns $SQLETON_SNAPSHOT_DIR, or sqleton/snapshots in the user config directory.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(SnapshotDirEnvVar); dir != "" {
+		return dir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "could not determine user config directory")
+	}
+	return filepath.Join(configDir, "sqleton", "snapshots"), nil
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Store keeps every snapshot of a name as a timestamped JSON file in <dir>/<name>/.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func NewDefaultStore() (*Store, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(dir), nil
+}
+
+// CheckName returns an error if name can't be used as a snapshot name.
+func CheckName(name string) error {
+	if !validName.MatchString(name) || strings.Trim(name, ".") == "" {
+		return errors.Errorf("invalid snapshot name %q, only letters, digits, '.', '_' and '-' are allowed", name)
+	}
+	return nil
+}
+
+// Save writes the snapshot and sets its Path.
+func (s *Store) Save(snapshot *Snapshot) error {
+	if err := CheckName(snapshot.Name); err != nil {
+		return err
+	}
+	if snapshot.CreatedAt.IsZero() {
+		snapshot.CreatedAt = time.Now()
+	}
+
+	dir := filepath.Join(s.dir, snapshot.Name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return errors.Wrap(err, "could not create snapshot directory")
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not encode snapshot")
+	}
+
+	path := filepath.Join(dir, snapshot.CreatedAt.UTC().Format(timestampFormat)+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return errors.Wrap(err, "could not write snapshot")
+	}
+	snapshot.Path = path
+	return nil
+}
+
+// History returns the files stored for name, oldest first.
+func (s *Store) History(name string) ([]string, error) {
+	if err := CheckName(name); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(s.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("no snapshot named %s", name)
+		}
+		return nil, errors.Wrapf(err, "could not read snapshots for %s", name)
+	}
+
+	ret := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		ret = append(ret, filepath.Join(s.dir, name, entry.Name()))
+	}
+	// the timestamp format sorts lexicographically
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// Names returns the names of all stored snapshots.
+func (s *Store) Names() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, errors.Wrap(err, "could not read snapshot directory")
+	}
+
+	ret := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() && validName.MatchString(entry.Name()) {
+			ret = append(ret, entry.Name())
+		}
+	}
+	return ret, nil
+}
+
+// Resolve loads a snapshot by reference. A reference is either a name, which
+// resolves to its latest snapshot, name~N for the Nth snapshot before the latest,
+// or the path of a snapshot file.
+func (s *Store) Resolve(ref string) (*Snapshot, error) {
+	if strings.HasSuffix(ref, ".json") {
+		if _, err := os.Stat(ref); err == nil {
+			return Load(ref)
+		}
+	}
+
+	name, back := ref, 0
+	if idx := strings.LastIndex(ref, "~"); idx >= 0 {
+		n, err := strconv.Atoi(ref[idx+1:])
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("invalid snapshot reference %q", ref)
+		}
+		name, back = ref[:idx], n
+	}
+
+	history, err := s.History(name)
+	if err != nil {
+		return nil, err
+	}
+	if back >= len(history) {
+		return nil, errors.Errorf("snapshot %s only has %d entries", name, len(history))
+	}
+	return Load(history[len(history)-1-back])
+}
+
+func Load(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read snapshot")
+	}
+	ret := &Snapshot{}
+	if err := json.Unmarshal(data, ret); err != nil {
+		return nil, errors.Wrapf(err, "could not parse snapshot %s", path)
+	}
+	ret.Path = path
+	return ret, nil
+}
+
+// Recorder is a processor that keeps a copy of every row before handing it to the
+// wrapped processor. The wrapped processor can be nil, in which case rows are only recorded.
+type Recorder struct {
+	middlewares.Processor
+	columns []string
+	seen    map[string]bool
+	rows    []map[string]interface{}
+}
+
+func NewRecorder(gp middlewares.Processor) *Recorder {
+	return &Recorder{Processor: gp, seen: map[string]bool{}}
+}
+
+func (r *Recorder) AddRow(ctx context.Context, row types.Row) error {
+	// copy before forwarding, downstream row middlewares are free to modify the row
+	values := map[string]interface{}{}
+	for pair := row.Oldest(); pair != nil; pair = pair.Next() {
+		if !r.seen[pair.Key] {
+			r.seen[pair.Key] = true
+			r.columns = append(r.columns, pair.Key)
+		}
+		values[pair.Key] = pair.Value
+	}
+	normalized, err := normalizeRow(values)
+	if err != nil {
+		return err
+	}
+	r.rows = append(r.rows, normalized)
+
+	if r.Processor == nil {
+		return nil
+	}
+	return r.Processor.AddRow(ctx, row)
+}
+
+func (r *Recorder) Close(ctx context.Context) error {
+	if r.Processor == nil {
+		return nil
+	}
+	return r.Processor.Close(ctx)
+}
+
+// Snapshot returns the recorded rows as a snapshot with the given name.
+func (r *Recorder) Snapshot(name string, command string, parameters map[string]interface{}) *Snapshot {
+	columns := r.columns
+	if columns == nil {
+		columns = []string{}
+	}
+	rows := r.rows
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	return &Snapshot{
+		Name:       name,
+		Command:    command,
+		Parameters: parameters,
+		CreatedAt:  time.Now(),
+		Columns:    columns,
+		Rows:       rows,
+	}
+}
+
+// Save stores the recorded rows as a new snapshot in the default store.
+func (r *Recorder) Save(name string, command string, parameters map[string]interface{}) (*Snapshot, error) {
+	store, err := NewDefaultStore()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := r.Snapshot(name, command, parameters)
+	if err := store.Save(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// normalizeRow round-trips the row through JSON, so that freshly recorded rows
+// compare equal to rows loaded from disk.
+func normalizeRow(row map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not encode row")
+	}
+	ret := map[string]interface{}{}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, errors.Wrap(err, "could not decode row")
+	}
+	return ret, nil
+}
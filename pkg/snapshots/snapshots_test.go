@@ -0,0 +1,138 @@
+package snapshots
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func newSnapshot(name string, rows ...map[string]interface{}) *Snapshot {
+	return &Snapshot{
+		Name:    name,
+		Command: "mysql/ps",
+		Columns: []string{"id", "user", "state"},
+		Rows:    rows,
+	}
+}
+
+func row(id float64, user string, state string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "user": user, "state": state}
+}
+
+func TestDiffByKey(t *testing.T) {
+	from := newSnapshot("ps", row(1, "alice", "idle"), row(2, "bob", "query"))
+	to := newSnapshot("ps", row(2, "bob", "sleep"), row(3, "carol", "idle"))
+
+	rows, err := Diff(from, to, []string{"id"})
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+
+	maps := []map[string]interface{}{}
+	for _, r := range rows {
+		maps = append(maps, types.RowToMap(r))
+	}
+	require.Equal(t, map[string]interface{}{
+		"change": ChangeRemoved, "id": 1.0, "user": "alice", "state": "idle",
+	}, maps[0])
+	require.Equal(t, map[string]interface{}{
+		"change": ChangeChanged, "id": 2.0, "column": "state", "old": "query", "new": "sleep",
+	}, maps[1])
+	require.Equal(t, map[string]interface{}{
+		"change": ChangeAdded, "id": 3.0, "user": "carol", "state": "idle",
+	}, maps[2])
+}
+
+func TestDiffWithoutKeyComparesWholeRows(t *testing.T) {
+	from := newSnapshot("ps", row(1, "alice", "idle"), row(1, "alice", "idle"), row(2, "bob", "query"))
+	to := newSnapshot("ps", row(1, "alice", "idle"), row(2, "bob", "sleep"))
+
+	rows, err := Diff(from, to, nil)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+
+	changes := []interface{}{}
+	for _, r := range rows {
+		change, _ := r.Get("change")
+		changes = append(changes, change)
+	}
+	require.Equal(t, []interface{}{ChangeRemoved, ChangeRemoved, ChangeAdded}, changes)
+}
+
+func TestDiffRejectsDuplicateKeys(t *testing.T) {
+	from := newSnapshot("ps", row(1, "alice", "idle"), row(1, "bob", "query"))
+	_, err := Diff(from, newSnapshot("ps"), []string{"id"})
+	require.Error(t, err)
+
+	_, err = Diff(from, newSnapshot("ps"), []string{"missing"})
+	require.Error(t, err)
+}
+
+func TestRecordAndResolveSnapshots(t *testing.T) {
+	store := NewStore(t.TempDir())
+	ctx := context.Background()
+
+	for i, user := range []string{"alice", "bob"} {
+		recorder := NewRecorder(nil)
+		require.NoError(t, recorder.AddRow(ctx, types.NewRow(
+			types.MRP("id", int64(1)),
+			types.MRP("user", user),
+		)))
+		require.NoError(t, recorder.Close(ctx))
+
+		snapshot := recorder.Snapshot("ps", "mysql/ps", map[string]interface{}{"limit": 10})
+		snapshot.CreatedAt = time.Date(2025, 1, 1, i, 0, 0, 0, time.UTC)
+		require.NoError(t, store.Save(snapshot))
+	}
+
+	latest, err := store.Resolve("ps")
+	require.NoError(t, err)
+	require.Equal(t, "mysql/ps", latest.Command)
+	require.Equal(t, []string{"id", "user"}, latest.Columns)
+	require.Equal(t, []map[string]interface{}{{"id": 1.0, "user": "bob"}}, latest.Rows)
+
+	previous, err := store.Resolve("ps~1")
+	require.NoError(t, err)
+	require.Equal(t, "alice", previous.Rows[0]["user"])
+
+	byPath, err := store.Resolve(previous.Path)
+	require.NoError(t, err)
+	require.Equal(t, previous.CreatedAt, byPath.CreatedAt)
+
+	_, err = store.Resolve("ps~2")
+	require.Error(t, err)
+	_, err = store.Resolve("other")
+	require.Error(t, err)
+
+	names, err := store.Names()
+	require.NoError(t, err)
+	require.Equal(t, []string{"ps"}, names)
+}
+
+func TestCheckName(t *testing.T) {
+	require.NoError(t, CheckName("daily-report_v2.1"))
+	require.Error(t, CheckName("../etc"))
+	require.Error(t, CheckName(".."))
+	require.Error(t, CheckName(""))
+}
+
+func TestChangedCells(t *testing.T) {
+	from := newSnapshot("ps", row(1, "alice", "idle"), row(2, "bob", "query"))
+	to := newSnapshot("ps", row(2, "bob", "sleep"), row(1, "alice", "idle"), row(3, "carol", "idle"))
+
+	changed, err := ChangedCells(from, to, []string{"id"})
+	require.NoError(t, err)
+	require.Equal(t, []map[string]bool{
+		{"state": true},
+		{},
+		{"id": true, "user": true, "state": true},
+	}, changed)
+
+	// without keys, rows are compared by position
+	changed, err = ChangedCells(from, to, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"id": true, "user": true, "state": true}, changed[0])
+	require.Equal(t, map[string]bool{"id": true, "user": true, "state": true}, changed[2])
+}
@@ -0,0 +1,474 @@
+package sqlfmt
+
+import (
+	"strings"
+
+	"github.com/go-go-golems/sqleton/pkg/sqlscan"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	// tokenQuoted is a string, a quoted identifier or a number, kept as it is.
+	tokenQuoted
+	tokenLineComment
+	tokenBlockComment
+	// tokenAction is a Go template action, such as {{ if .limit }}.
+	tokenAction
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// space is the whitespace before the token in the query.
+	space string
+}
+
+func (t token) is(words ...string) bool {
+	if t.kind != tokenWord && t.kind != tokenSymbol {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize splits query into tokens, each holding the whitespace before it. The
+// text of strings, quoted identifiers, comments and template actions is kept as
+// is, including template actions inside strings.
+func tokenize(query string) []token {
+	ret := []token{}
+	for i := 0; i < len(query); {
+		start := i
+		for i < len(query) && isSpace(query[i]) {
+			i++
+		}
+		if i == len(query) {
+			break
+		}
+		space := query[start:i]
+		start = i
+
+		kind := tokenSymbol
+		c := query[i]
+		region, end, _ := sqlscan.Template.Scan(query, i)
+		switch {
+		case region == sqlscan.Action:
+			kind, i = tokenAction, end
+		case region == sqlscan.LineComment:
+			kind, i = tokenLineComment, end
+		case region == sqlscan.BlockComment:
+			kind, i = tokenBlockComment, end
+		case region == sqlscan.String:
+			kind, i = tokenQuoted, end
+		case region == sqlscan.QuotedIdentifier:
+			kind, i = tokenQuoted, scanQualified(query, i)
+		case isDigit(c):
+			kind = tokenQuoted
+			for i < len(query) && (isWordPart(query[i]) || query[i] == '.') {
+				i++
+			}
+		case isWordStart(c):
+			kind, i = tokenWord, scanQualified(query, i)
+		case (c == ':' || c == '@' || c == '$' || c == '?') && i+1 < len(query) && isWordPart(query[i+1]):
+			// a bind parameter, such as :name, @name or $1
+			i++
+			for i < len(query) && isWordPart(query[i]) {
+				i++
+			}
+		default:
+			for _, symbol := range []string{"->>", "<=", ">=", "<>", "!=", "||", "::", "->", ":="} {
+				if strings.HasPrefix(query[i:], symbol) {
+					i += len(symbol)
+					break
+				}
+			}
+			if i == start {
+				i++
+			}
+		}
+		ret = append(ret, token{kind: kind, text: query[start:i], space: space})
+	}
+	return ret
+}
+
+// scanQualified returns the position after the possibly qualified and quoted name
+// starting at i, such as wp.ID, "orders"."status" or t.*.
+func scanQualified(query string, i int) int {
+	for {
+		switch kind, end, _ := sqlscan.Template.Scan(query, i); {
+		case kind == sqlscan.QuotedIdentifier:
+			i = end
+		case query[i] == '*':
+			i++
+		default:
+			for i < len(query) && isWordPart(query[i]) {
+				i++
+			}
+		}
+		if i+1 < len(query) && query[i] == '.' {
+			next := query[i+1]
+			if isWordStart(next) || next == '"' || next == '`' || next == '*' {
+				i++
+				continue
+			}
+		}
+		return i
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || isDigit(c) || c == '$'
+}
+
+// keywords are written in upper case.
+var keywords = map[string]bool{}
+
+func init() {
+	for _, keyword := range strings.Fields(`
+		SELECT DISTINCT FROM WHERE AND OR NOT IN IS NULL AS ON USING
+		JOIN LEFT RIGHT INNER OUTER FULL CROSS NATURAL
+		GROUP BY ORDER HAVING LIMIT OFFSET UNION ALL INTERSECT EXCEPT
+		CASE WHEN THEN ELSE END LIKE ILIKE BETWEEN EXISTS ASC DESC
+		WITH RECURSIVE EXPLAIN OVER PARTITION TRUE FALSE`) {
+		keywords[strings.ToLower(keyword)] = true
+	}
+}
+
+// clauseKeywords start a clause of a statement, on a line of its own.
+var clauseKeywords = map[string]bool{
+	"select": true, "from": true, "where": true, "group": true, "order": true,
+	"having": true, "limit": true, "offset": true, "union": true, "intersect": true,
+	"except": true, "join": true, "left": true, "right": true, "inner": true,
+	"full": true, "cross": true, "natural": true,
+}
+
+// level is a statement, or the contents of parentheses.
+type level struct {
+	// indent is the indentation of the lines of the level.
+	indent int
+	// statement is true when the level holds a query, whose clauses are laid out.
+	statement bool
+	clause    string
+	// clauseIndent is the indentation of the line starting the current clause,
+	// and clauseBlocks the number of template blocks it is in.
+	clauseIndent int
+	clauseBlocks int
+	between      bool
+	// breakColumns lays out the columns of the current SELECT one per line.
+	breakColumns bool
+	// firstColumn is true until the first column of a SELECT is laid out.
+	firstColumn bool
+	// multiline is true once a line break is written in the level.
+	multiline bool
+}
+
+// block is a template block, such as {{ if }} ... {{ end }}.
+type block struct {
+	// indent is the indentation of the line opening the block.
+	indent int
+}
+
+type formatter struct {
+	tokens []token
+	levels []*level
+	blocks []*block
+	out    strings.Builder
+	// lineIndent is the indentation of the current line, and lineStart is true
+	// until its first token is written.
+	lineIndent int
+	lineStart  bool
+}
+
+// FormatQuery lays out query: clauses start on lines of their own, the columns of
+// a SELECT and the conditions of a WHERE are written one per line, lines are
+// indented after parentheses and template blocks, and keywords are written in
+// upper case.
+//
+// Line breaks of the query are kept, and whitespace is only added or changed
+// where whitespace doesn't matter: never inside strings, quoted identifiers,
+// comments and template actions, and never next to a template action that isn't
+// followed or preceded by whitespace, so that the query renders the same.
+func FormatQuery(query string) string {
+	f := &formatter{
+		tokens: tokenize(query),
+		levels: []*level{{statement: true}},
+	}
+	for i := range f.tokens {
+		f.write(i)
+	}
+	return f.out.String()
+}
+
+func (f *formatter) level() *level {
+	return f.levels[len(f.levels)-1]
+}
+
+func (f *formatter) at(i int) token {
+	if i >= 0 && i < len(f.tokens) {
+		return f.tokens[i]
+	}
+	return token{kind: tokenSymbol}
+}
+
+// write writes token i, after the whitespace chosen for it.
+func (f *formatter) write(i int) {
+	t := f.tokens[i]
+	l := f.level()
+
+	newline := i > 0 && (strings.Contains(t.space, "\n") || f.at(i-1).kind == tokenLineComment)
+	if !newline && f.canBreak(i) && f.breaksBefore(i) {
+		newline = true
+	}
+
+	switch {
+	case i == 0:
+		f.lineStart = true
+	case newline:
+		l.multiline = true
+		f.out.WriteString("\n")
+		if strings.Count(t.space, "\n") > 1 {
+			f.out.WriteString("\n")
+		}
+		f.lineStart = true
+	case t.space != "":
+		f.out.WriteString(" ")
+	}
+
+	if f.lineStart {
+		f.lineIndent = f.indent(i)
+		f.out.WriteString(strings.Repeat(" ", f.lineIndent))
+	}
+
+	text := t.text
+	switch t.kind {
+	case tokenWord:
+		if keywords[strings.ToLower(text)] && !f.touchesAction(i) {
+			text = strings.ToUpper(text)
+		}
+	case tokenLineComment:
+		text = strings.TrimRight(text, " \t\r")
+	}
+	f.out.WriteString(text)
+	f.lineStart = false
+
+	// update the state after the token
+	switch {
+	case t.kind == tokenAction:
+		switch actionKeyword(t.text) {
+		case "if", "range", "with", "block", "define":
+			f.blocks = append(f.blocks, &block{indent: f.lineIndent})
+		case "end":
+			if len(f.blocks) > 0 {
+				f.blocks = f.blocks[:len(f.blocks)-1]
+			}
+			// the lines after the block of a clause are no longer indented after it
+			if l.clauseBlocks > len(f.blocks) {
+				l.clauseIndent, l.clauseBlocks = l.indent, len(f.blocks)
+			}
+		}
+
+	case t.is("("):
+		f.levels = append(f.levels, &level{indent: f.lineIndent + 2, clauseIndent: f.lineIndent + 2})
+
+	case t.is(")"):
+		if len(f.levels) > 1 {
+			f.levels = f.levels[:len(f.levels)-1]
+		}
+
+	case t.kind != tokenWord && t.kind != tokenSymbol:
+		// strings, comments and names in quotes don't change the layout
+
+	case t.is("select"):
+		l.statement = true
+		l.clause, l.clauseIndent, l.clauseBlocks = "select", f.lineIndent, len(f.blocks)
+		l.breakColumns = f.hasColumnList(i)
+		l.firstColumn = true
+
+	case t.is("with") && (i == 0 || f.at(i-1).is("(", ";")):
+		l.statement = true
+		l.clause, l.clauseIndent, l.clauseBlocks = "with", f.lineIndent, len(f.blocks)
+
+	case l.statement && f.startsClause(i):
+		l.clause, l.clauseIndent, l.clauseBlocks = strings.ToLower(t.text), f.lineIndent, len(f.blocks)
+
+	case t.is("between"):
+		l.between = true
+
+	case t.is("and") && l.between:
+		l.between = false
+	}
+	if !t.is("select", "distinct", "all") {
+		l.firstColumn = false
+	}
+}
+
+// canBreak is true if whitespace can be added before token i without changing
+// how the query renders.
+func (f *formatter) canBreak(i int) bool {
+	if i == 0 {
+		return false
+	}
+	previous, t := f.at(i-1), f.at(i)
+	return previous.kind != tokenAction && (t.space != "" || t.kind != tokenAction)
+}
+
+// breaksBefore is true if token i starts a line of its own.
+func (f *formatter) breaksBefore(i int) bool {
+	t, previous := f.at(i), f.at(i-1)
+	l := f.level()
+	if !l.statement {
+		return false
+	}
+
+	switch {
+	case t.is(")"):
+		// the parentheses of a query on several lines close on a line of their own
+		return l.multiline
+
+	case previous.is(";"):
+		return true
+
+	case t.is("select"):
+		return previous.is(")", "union", "all", "intersect", "except")
+
+	case f.startsClause(i):
+		return true
+
+	case t.is("and", "or"):
+		return (l.clause == "where" || l.clause == "having") && !(t.is("and") && l.between)
+
+	case l.clause == "select" && l.breakColumns:
+		if l.firstColumn {
+			return !t.is("distinct", "all")
+		}
+		return previous.is(",") && !f.startsLine(i-1)
+	}
+	return false
+}
+
+// startsClause is true if token i is the first keyword of a clause other than
+// SELECT, such as FROM, ORDER BY or LEFT JOIN.
+func (f *formatter) startsClause(i int) bool {
+	t, previous := f.at(i), f.at(i-1)
+	if t.kind != tokenWord || !clauseKeywords[strings.ToLower(t.text)] || t.is("select") {
+		return false
+	}
+	next := f.at(i + 1)
+	switch {
+	case t.is("group", "order"):
+		return next.is("by")
+	case t.is("join"):
+		return !previous.is("left", "right", "inner", "outer", "full", "cross", "natural")
+	case t.is("left", "right", "inner", "full", "cross", "natural"):
+		if next.is("outer") {
+			next = f.at(i + 2)
+		}
+		return next.is("join")
+	case t.is("from"):
+		return !previous.is("distinct", "delete")
+	}
+	return true
+}
+
+// startsLine is true if token i is the first of its line.
+func (f *formatter) startsLine(i int) bool {
+	return i == 0 || strings.Contains(f.at(i).space, "\n") || f.at(i-1).kind == tokenLineComment
+}
+
+// hasColumnList is true if the SELECT at token i has several columns.
+func (f *formatter) hasColumnList(i int) bool {
+	depth := 0
+	for j := i + 1; j < len(f.tokens); j++ {
+		t := f.tokens[j]
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+			if depth < 0 {
+				return false
+			}
+		case depth > 0:
+		case t.is(","):
+			return true
+		case t.is(";") || t.is("select") || (t.kind == tokenWord && clauseKeywords[strings.ToLower(t.text)] && f.startsClause(j)):
+			return false
+		}
+	}
+	return false
+}
+
+// indent returns the indentation of the line starting with token i.
+func (f *formatter) indent(i int) int {
+	l := f.level()
+	blockIndent := 0
+	if len(f.blocks) > 0 {
+		blockIndent = f.blocks[len(f.blocks)-1].indent + 2
+	}
+
+	// a line starting with template actions is indented like the first other
+	// token of the line, if any
+	j := i
+	for j < len(f.tokens) && f.tokens[j].kind == tokenAction && (j == i || !f.startsLine(j)) {
+		switch actionKeyword(f.tokens[j].text) {
+		case "end", "else":
+			if j == i && len(f.blocks) > 0 {
+				return f.blocks[len(f.blocks)-1].indent
+			}
+		}
+		j++
+	}
+	if j == len(f.tokens) || (j > i && f.startsLine(j)) {
+		return max(blockIndent, l.clauseIndent)
+	}
+
+	t := f.at(j)
+	switch {
+	case t.is(")") && len(f.levels) > 1:
+		// the indentation of the line opening the parentheses
+		return max(blockIndent, l.indent-2)
+
+	case t.is("select", "with") || (l.statement && f.startsClause(j)) || l.clause == "":
+		return max(blockIndent, l.indent)
+
+	case t.is("and", "or") && (l.clause == "where" || l.clause == "having"):
+		return max(blockIndent, l.clauseIndent)
+	}
+	return max(blockIndent, l.clauseIndent+2)
+}
+
+// touchesAction is true if token i is written right next to a template action,
+// in which case its text may be part of a longer name.
+func (f *formatter) touchesAction(i int) bool {
+	return (i > 0 && f.tokens[i].space == "" && f.tokens[i-1].kind == tokenAction) ||
+		(i+1 < len(f.tokens) && f.tokens[i+1].space == "" && f.tokens[i+1].kind == tokenAction)
+}
+
+// actionKeyword returns the keyword of a template action, such as if or end.
+func actionKeyword(action string) string {
+	action = strings.TrimPrefix(action, "{{")
+	action = strings.TrimPrefix(action, "-")
+	fields := strings.Fields(action)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(fields[0], "}}"), "-")
+}
@@ -0,0 +1,41 @@
+package sqlfmt
+
+import (
+	"reflect"
+
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/pkg/errors"
+)
+
+// Options are the options of FormatFile.
+type Options struct {
+	// Query also lays out the SQL query of the command with FormatQuery.
+	Query bool
+}
+
+// FormatFile returns the .sql command at path, whose contents are given, with its
+// preamble written by MarshalSpecToSQLFile: keys in canonical order, indented by
+// two spaces, and a single line break after the query.
+func FormatFile(path string, contents []byte, options Options) ([]byte, error) {
+	spec, err := sqleton_cmds.ParseSQLFileSpecStrict(path, contents)
+	if err != nil {
+		return nil, err
+	}
+	if options.Query {
+		spec.Query = FormatQuery(spec.Query)
+	}
+
+	ret, err := sqleton_cmds.MarshalSpecToSQLFile(spec)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not write %s", path)
+	}
+	// the file is only rewritten if it describes the same command
+	formatted, err := sqleton_cmds.ParseSQLFileSpecStrict(path, []byte(ret))
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not format %s", path)
+	}
+	if !reflect.DeepEqual(spec, formatted) {
+		return nil, errors.Errorf("could not format %s without changing the command", path)
+	}
+	return []byte(ret), nil
+}
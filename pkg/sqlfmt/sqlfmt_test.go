@@ -0,0 +1,192 @@
+package sqlfmt
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/runner"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatFile(t *testing.T) {
+	contents := `
+
+/*   sqleton
+short: "List posts"
+flags:
+    - type: int
+      default: 10
+      name: limit
+name: ls-posts
+tags: [wp]
+*/
+
+select id, title from posts limit {{ .limit }}
+
+
+`
+	formatted, err := FormatFile("ls-posts.sql", []byte(contents), Options{})
+	require.NoError(t, err)
+	require.Equal(t, `/* sqleton
+name: ls-posts
+short: List posts
+flags:
+  - name: limit
+    type: int
+    default: 10
+tags:
+  - wp
+*/
+select id, title from posts limit {{ .limit }}
+`, string(formatted))
+
+	again, err := FormatFile("ls-posts.sql", formatted, Options{})
+	require.NoError(t, err)
+	require.Equal(t, string(formatted), string(again))
+
+	formatted, err = FormatFile("ls-posts.sql", []byte(contents), Options{Query: true})
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(string(formatted), "*/\nSELECT\n  id,\n  title\nFROM posts\nLIMIT {{ .limit }}\n"))
+
+	_, err = FormatFile("typo.sql", []byte("/* sqleton\nname: typo\nshort: Typo\nflgas: []\n*/\nSELECT 1\n"), Options{})
+	require.ErrorContains(t, err, "field flgas not found")
+	_, err = FormatFile("plain.sql", []byte("SELECT 1\n"), Options{})
+	require.ErrorContains(t, err, "missing sqleton sql preamble")
+}
+
+func TestFormatQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "clauses",
+			query: "select distinct o.id, sum(o.total) as total from orders o left outer join customers c on c.id = o.customer_id and c.active where o.status = 'open' and o.total between 1 and 10 or o.id in (1, 2) group by o.id order by total desc limit 10 offset 5",
+			want: `SELECT DISTINCT
+  o.id,
+  sum(o.total) AS total
+FROM orders o
+LEFT OUTER JOIN customers c ON c.id = o.customer_id AND c.active
+WHERE o.status = 'open'
+AND o.total BETWEEN 1 AND 10
+OR o.id IN (1, 2)
+GROUP BY o.id
+ORDER BY total DESC
+LIMIT 10
+OFFSET 5`,
+		},
+		{
+			name: "subqueries",
+			query: `SELECT * FROM orders WHERE customer_id IN (
+select id from customers where active) UNION ALL select * from archive`,
+			want: `SELECT *
+FROM orders
+WHERE customer_id IN (
+  SELECT id
+  FROM customers
+  WHERE active
+)
+UNION ALL
+SELECT *
+FROM archive`,
+		},
+		{
+			name: "template blocks",
+			query: `select id,name from t
+where 1=1
+{{ if .name }}
+and name = {{ .name | sqlString }}
+{{ else if .names }}
+    and name in ({{ .names | sqlStringIn }})
+{{ end }}
+{{ if .limit -}}
+limit {{ .limit }}
+{{- end }}`,
+			want: `SELECT
+  id,
+  name
+FROM t
+WHERE 1=1
+{{ if .name }}
+  AND name = {{ .name | sqlString }}
+{{ else if .names }}
+  AND name IN ({{ .names | sqlStringIn }})
+{{ end }}
+{{ if .limit -}}
+  LIMIT {{ .limit }}
+{{- end }}`,
+		},
+		{
+			name: "text that renders the same",
+			query: `select  'a  from  b', "order  by", {{ .column }}_total, x{{ if .y }} and  y{{ end }} from {{ .prefix }}order -- where  x
+where a = 1 /* and  b */ and c like 'x  %'`,
+			want: `SELECT
+  'a  from  b',
+  "order  by",
+  {{ .column }}_total,
+  x{{ if .y }} AND y{{ end }} FROM {{ .prefix }}order -- where  x
+WHERE a = 1 /* and  b */
+AND c LIKE 'x  %'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formatted := FormatQuery(tt.query)
+			require.Equal(t, tt.want, formatted)
+			require.Equal(t, formatted, FormatQuery(formatted))
+		})
+	}
+}
+
+// TestFormatQueryRendersTheSame formats the queries of the embedded commands,
+// which render as they did, up to whitespace and the case of keywords.
+func TestFormatQueryRendersTheSame(t *testing.T) {
+	root := filepath.Join("..", "..", "cmd", "sqleton", "queries")
+	count := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".sql" {
+			return err
+		}
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		spec, err := sqleton_cmds.ParseSQLFileSpec(path, contents)
+		require.NoError(t, err)
+
+		formatted := FormatQuery(spec.Query)
+		require.Equal(t, formatted, FormatQuery(formatted), path)
+
+		original, err := renderDefaults(spec)
+		require.NoError(t, err, path)
+		spec.Query = formatted
+		rendered, err := renderDefaults(spec)
+		require.NoError(t, err, path)
+		require.Equal(t, strings.ToUpper(withoutSpace(original)), strings.ToUpper(withoutSpace(rendered)), path)
+		count++
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotZero(t, count)
+}
+
+func renderDefaults(spec *sqleton_cmds.SqlCommandSpec) (string, error) {
+	command, err := (&sqleton_cmds.SqlCommandCompiler{}).Compile(spec)
+	if err != nil {
+		return "", err
+	}
+	parsedValues, err := runner.ParseCommandValues(command)
+	if err != nil {
+		return "", err
+	}
+	return command.RenderQuery(context.Background(), nil, parsedValues.GetDataMap())
+}
+
+func withoutSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
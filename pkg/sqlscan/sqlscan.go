@@ -0,0 +1,235 @@
+// Package sqlscan finds the strings, quoted identifiers, comments and template
+// actions of SQL queries, which the tokenizers of sqleton skip over or keep whole.
+// Databases disagree on where these end, so scanning is done for a Dialect.
+package sqlscan
+
+import (
+	"strings"
+)
+
+// Kind is the kind of the region starting at a position of a query.
+type Kind int
+
+const (
+	// Code is anything that is not one of the regions below. Scan doesn't consume it.
+	Code Kind = iota
+	// String is a string literal, including dollar-quoted strings.
+	String
+	// QuotedIdentifier is an identifier in double quotes, backticks or brackets.
+	QuotedIdentifier
+	LineComment
+	BlockComment
+	// Action is a Go template action, such as {{ if .limit }}.
+	Action
+)
+
+// Dialect describes the lexical rules of a database.
+type Dialect struct {
+	Name string
+	// BackslashEscapes makes a backslash escape the next character in strings.
+	BackslashEscapes bool
+	// DoubleQuotedStrings makes "..." a string instead of a quoted identifier.
+	DoubleQuotedStrings bool
+	// BacktickIdentifiers makes `...` a quoted identifier.
+	BacktickIdentifiers bool
+	// BracketIdentifiers makes [...] a quoted identifier.
+	BracketIdentifiers bool
+	// DollarQuotes makes $$...$$ and $tag$...$tag$ strings.
+	DollarQuotes bool
+	// NestedComments makes /* ... */ comments nest.
+	NestedComments bool
+	// HashComments makes # start a line comment.
+	HashComments bool
+	// DashCommentsNeedSpace only starts a -- comment when it is followed by
+	// whitespace, so that 1--1 is a subtraction.
+	DashCommentsNeedSpace bool
+	// ExecutableComments makes /*! ... */ code instead of a comment.
+	ExecutableComments bool
+	// Templates skips Go template actions as a whole, also inside strings.
+	Templates bool
+}
+
+var (
+	MySQL = &Dialect{
+		Name:                  "mysql",
+		BackslashEscapes:      true,
+		DoubleQuotedStrings:   true,
+		BacktickIdentifiers:   true,
+		HashComments:          true,
+		DashCommentsNeedSpace: true,
+		ExecutableComments:    true,
+	}
+	PostgreSQL = &Dialect{
+		Name:           "postgresql",
+		DollarQuotes:   true,
+		NestedComments: true,
+	}
+	SQLite = &Dialect{
+		Name:                "sqlite",
+		BacktickIdentifiers: true,
+		BracketIdentifiers:  true,
+	}
+	// Template is the dialect of the query templates of sqleton commands, which can
+	// target any database. Where the databases disagree, it follows the most common
+	// reading: backslashes escape in strings, but comments don't nest.
+	Template = &Dialect{
+		Name:                "template",
+		BackslashEscapes:    true,
+		BacktickIdentifiers: true,
+		BracketIdentifiers:  true,
+		DollarQuotes:        true,
+		Templates:           true,
+	}
+)
+
+// Databases are the dialects of the databases sqleton connects to.
+var Databases = []*Dialect{MySQL, PostgreSQL, SQLite}
+
+// Scan returns the kind and the end of the region starting at query[i]. For Code,
+// the end is i. A region that isn't terminated ends at len(query), and Scan returns
+// false.
+func (d *Dialect) Scan(query string, i int) (Kind, int, bool) {
+	rest := query[i:]
+	if rest == "" {
+		return Code, i, true
+	}
+	switch c := rest[0]; {
+	case d.Templates && strings.HasPrefix(rest, "{{"):
+		end, ok := ScanAction(query, i)
+		return Action, end, ok
+	case strings.HasPrefix(rest, "--") && (!d.DashCommentsNeedSpace || len(rest) == 2 || isSpace(rest[2])):
+		return LineComment, scanLine(query, i), true
+	case d.HashComments && c == '#':
+		return LineComment, scanLine(query, i), true
+	case strings.HasPrefix(rest, "/*") && !(d.ExecutableComments && strings.HasPrefix(rest, "/*!")):
+		end, ok := d.scanBlockComment(query, i)
+		return BlockComment, end, ok
+	case c == '\'':
+		end, ok := d.scanQuoted(query, i, '\'', d.BackslashEscapes)
+		return String, end, ok
+	case c == '"' && d.DoubleQuotedStrings:
+		end, ok := d.scanQuoted(query, i, '"', d.BackslashEscapes)
+		return String, end, ok
+	case c == '"' || (c == '`' && d.BacktickIdentifiers):
+		end, ok := d.scanQuoted(query, i, c, false)
+		return QuotedIdentifier, end, ok
+	case c == '[' && d.BracketIdentifiers:
+		end, ok := d.scanQuoted(query, i, c, false)
+		return QuotedIdentifier, end, ok
+	case c == '$' && d.DollarQuotes && DollarTag(rest) != "":
+		tag := DollarTag(rest)
+		end := strings.Index(rest[len(tag):], tag)
+		if end < 0 {
+			return String, len(query), false
+		}
+		return String, i + len(tag) + end + len(tag), true
+	}
+	return Code, i, true
+}
+
+// scanQuoted returns the position after the quoted text starting at i, where a
+// doubled quote or, with backslashes, an escaped quote stands for the quote itself.
+// Text quoted with [ ends at the next ].
+func (d *Dialect) scanQuoted(query string, i int, quote byte, backslashes bool) (int, bool) {
+	closing := quote
+	if quote == '[' {
+		closing = ']'
+	}
+	for i++; i < len(query); i++ {
+		switch {
+		case d.Templates && strings.HasPrefix(query[i:], "{{"):
+			end, ok := ScanAction(query, i)
+			if !ok {
+				return end, false
+			}
+			i = end - 1
+		case backslashes && query[i] == '\\':
+			i++
+		case query[i] == closing:
+			if closing == quote && i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, true
+		}
+	}
+	return len(query), false
+}
+
+func (d *Dialect) scanBlockComment(query string, i int) (int, bool) {
+	depth := 0
+	for i < len(query) {
+		switch {
+		case strings.HasPrefix(query[i:], "/*"):
+			if depth == 0 || d.NestedComments {
+				depth++
+			}
+			i += 2
+		case strings.HasPrefix(query[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i, true
+			}
+		default:
+			i++
+		}
+	}
+	return len(query), false
+}
+
+// ScanAction returns the position after the Go template action starting at i,
+// skipping over the strings and comments it contains.
+func ScanAction(query string, i int) (int, bool) {
+	for i += 2; i < len(query); i++ {
+		switch {
+		case strings.HasPrefix(query[i:], "}}"):
+			return i + 2, true
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return len(query), false
+			}
+			i += end + 3
+		case query[i] == '"' || query[i] == '\'' || query[i] == '`':
+			// go strings, rune literals and raw strings
+			quote := query[i]
+			for i++; i < len(query) && query[i] != quote; i++ {
+				if quote != '`' && query[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return len(query), false
+}
+
+// DollarTag returns the tag of a dollar-quoted string at the start of s, such as
+// $$ or $body$, or "" if s doesn't start with one.
+func DollarTag(s string) string {
+	if s == "" || s[0] != '$' {
+		return ""
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] == '$' {
+			return s[:i+1]
+		}
+		c := s[i]
+		isDigit := c >= '0' && c <= '9'
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || isDigit) || (i == 1 && isDigit) {
+			return ""
+		}
+	}
+	return ""
+}
+
+func scanLine(query string, i int) int {
+	if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+		return i + end
+	}
+	return len(query)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,92 @@
+package sqlscan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect *Dialect
+		query   string
+		kind    Kind
+		region  string
+		ok      bool
+	}{
+		{"code", PostgreSQL, "SELECT 1", Code, "", true},
+		{"string", SQLite, "'it''s' AND", String, "'it''s'", true},
+		{"unterminated string", SQLite, "'it", String, "'it", false},
+		{"double quotes", PostgreSQL, `"a""b" AND`, QuotedIdentifier, `"a""b"`, true},
+
+		{"mysql backslash escape", MySQL, `'a\'' , b -- '`, String, `'a\''`, true},
+		{"postgres has no backslash escape", PostgreSQL, `'a\' , b -- '`, String, `'a\'`, true},
+		{"mysql escaped backslash", MySQL, `'a\\' b`, String, `'a\\'`, true},
+		{"mysql double quoted string", MySQL, `"a\"b" c`, String, `"a\"b"`, true},
+
+		{"dollar quotes", PostgreSQL, "$$ it's $$ AND", String, "$$ it's $$", true},
+		{"tagged dollar quotes", PostgreSQL, "$fn$ $$ $fn$ AND", String, "$fn$ $$ $fn$", true},
+		{"unterminated dollar quotes", PostgreSQL, "$a$ b", String, "$a$ b", false},
+		{"bind parameter", PostgreSQL, "$1 AND", Code, "", true},
+		{"mysql has no dollar quotes", MySQL, "$$ a $$", Code, "", true},
+
+		{"nested comments", PostgreSQL, "/* a /* b */ c */ d", BlockComment, "/* a /* b */ c */", true},
+		{"comments don't nest", SQLite, "/* a /* b */ c */ d", BlockComment, "/* a /* b */", true},
+		{"unterminated nested comment", PostgreSQL, "/* a /* b */ c", BlockComment, "/* a /* b */ c", false},
+		{"mysql executable comment", MySQL, "/*! SLEEP(1) */", Code, "", true},
+
+		{"line comment", SQLite, "-- a\nb", LineComment, "-- a", true},
+		{"mysql -- needs a space", MySQL, "--1", Code, "", true},
+		{"mysql -- at the end", MySQL, "--", LineComment, "--", true},
+		{"mysql hash comment", MySQL, "# a\nb", LineComment, "# a", true},
+		{"hash is code elsewhere", PostgreSQL, "# a", Code, "", true},
+
+		{"backticks", SQLite, "`a``b` c", QuotedIdentifier, "`a``b`", true},
+		{"brackets", SQLite, "[a ' b] c", QuotedIdentifier, "[a ' b]", true},
+		{"postgres has no brackets", PostgreSQL, "[a]", Code, "", true},
+
+		{"template action", Template, `{{ if eq .a "}}" }} b`, Action, `{{ if eq .a "}}" }}`, true},
+		{"template action in a string", Template, `'{{ "'" }}' b`, String, `'{{ "'" }}'`, true},
+		{"template in a quoted identifier", Template, "`{{ .table }}`.a", QuotedIdentifier, "`{{ .table }}`", true},
+		{"template in brackets", Template, `[{{ "]" }}] b`, QuotedIdentifier, `[{{ "]" }}]`, true},
+		{"unterminated template action", Template, "{{ .a", Action, "{{ .a", false},
+		{"templates are code elsewhere", SQLite, "{{ .a }}", Code, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, end, ok := tt.dialect.Scan(tt.query, 0)
+			require.Equal(t, tt.kind, kind)
+			require.Equal(t, tt.region, tt.query[:end])
+			require.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestScanFromTheMiddle(t *testing.T) {
+	query := "SELECT 'a', b"
+	kind, end, ok := SQLite.Scan(query, 7)
+	require.Equal(t, String, kind)
+	require.Equal(t, 10, end)
+	require.True(t, ok)
+
+	kind, end, _ = SQLite.Scan(query, len(query))
+	require.Equal(t, Code, kind)
+	require.Equal(t, len(query), end)
+}
+
+func TestDollarTag(t *testing.T) {
+	for s, tag := range map[string]string{
+		"$$":        "$$",
+		"$body$ x$": "$body$",
+		"$_1$":      "$_1$",
+		"$1":        "",
+		"$1$":       "",
+		"$a b$":     "",
+		"$a":        "",
+		"a$$":       "",
+		"":          "",
+	} {
+		require.Equal(t, tag, DollarTag(s), s)
+	}
+}
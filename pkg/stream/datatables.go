@@ -0,0 +1,81 @@
+package stream
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"sync"
+
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed live.js
+var liveJS string
+
+// LiveDataTablesLookup wraps the lookup of the DataTables page template so that the
+// rendered page can subscribe to the stream endpoint of the command it shows.
+// All other templates are returned unchanged.
+type LiveDataTablesLookup struct {
+	render.TemplateLookup
+	templateName string
+
+	mu     sync.Mutex
+	source *template.Template
+	live   *template.Template
+}
+
+var _ render.TemplateLookup = (*LiveDataTablesLookup)(nil)
+
+func NewLiveDataTablesLookup(lookup render.TemplateLookup, templateName string) *LiveDataTablesLookup {
+	ret := &LiveDataTablesLookup{
+		TemplateLookup: lookup,
+		templateName:   templateName,
+	}
+	// html/template can't clone a template set once one of its templates has been
+	// executed, so the wrapper is built before the page is first served.
+	if _, err := ret.Lookup(templateName); err != nil {
+		log.Warn().Err(err).Str("template", templateName).Msg("could not add live updates to template")
+	}
+	return ret
+}
+
+func (l *LiveDataTablesLookup) Lookup(name ...string) (*template.Template, error) {
+	t, err := l.TemplateLookup.Lookup(name...)
+	if err != nil {
+		return nil, err
+	}
+	if t.Name() != l.templateName {
+		return t, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the underlying lookup returns a new template after a reload in dev mode
+	if t == l.source && l.live != nil {
+		return l.live, nil
+	}
+
+	live, err := withLiveScript(t)
+	if err != nil {
+		log.Warn().Err(err).Str("template", l.templateName).Msg("could not add live updates to template")
+		return t, nil
+	}
+	l.source, l.live = t, live
+	return live, nil
+}
+
+func withLiveScript(t *template.Template) (*template.Template, error) {
+	clone, err := t.Clone()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not clone template")
+	}
+	ret, err := clone.New("sqleton-live-" + t.Name()).Parse(
+		fmt.Sprintf("{{ template %q . }}\n<script>\n%s</script>\n", t.Name(), liveJS))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse live template")
+	}
+	return ret, nil
+}
@@ -0,0 +1,39 @@
+package stream
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-go-golems/parka/pkg/render"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveDataTablesLookup(t *testing.T) {
+	lookup := render.NewLookupTemplateFromFS(
+		render.WithFS(fstest.MapFS{
+			"page.tmpl.html":  {Data: []byte(`<h1>{{ .Title }}</h1>`)},
+			"other.tmpl.html": {Data: []byte(`<p>{{ .Title }}</p>`)},
+		}),
+		render.WithPatterns("*.tmpl.html"),
+	)
+	live := NewLiveDataTablesLookup(lookup, "page.tmpl.html")
+
+	page, err := live.Lookup("page.tmpl.html")
+	require.NoError(t, err)
+	s := &strings.Builder{}
+	require.NoError(t, page.Execute(s, map[string]string{"Title": "ps"}))
+	require.True(t, strings.HasPrefix(s.String(), "<h1>ps</h1>\n<script>\n"))
+	require.Contains(t, s.String(), "live-toggle")
+
+	// the wrapper is built once, so it can be executed repeatedly
+	again, err := live.Lookup("page.tmpl.html")
+	require.NoError(t, err)
+	require.Same(t, page, again)
+
+	other, err := live.Lookup("other.tmpl.html")
+	require.NoError(t, err)
+	s.Reset()
+	require.NoError(t, other.Execute(s, map[string]string{"Title": "ps"}))
+	require.Equal(t, "<p>ps</p>", s.String())
+}
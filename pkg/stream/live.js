@@ -0,0 +1,157 @@
+// Live updates for the sqleton DataTables page.
+//
+// Adds a "Live" toggle to the page. When enabled, the page subscribes to the
+// /stream/ endpoint of the same command with the current form values, and
+// re-renders the table whenever rows are added, removed or changed.
+(function () {
+    const marker = '/datatables/';
+    const pathname = window.location.pathname;
+    const idx = pathname.lastIndexOf(marker);
+    if (idx < 0 || !window.EventSource) {
+        return;
+    }
+    const streamPath = pathname.substring(0, idx) + '/stream/' + pathname.substring(idx + marker.length);
+    const pageParams = new URLSearchParams(window.location.search);
+
+    let source = null;
+    let columns = [];
+    let rows = [];
+    let changed = new Set();
+
+    function rowKey(row, keys) {
+        return JSON.stringify(keys.map((k) => row[k]));
+    }
+
+    function sameRow(a, b) {
+        return columns.every((c) => JSON.stringify(a[c]) === JSON.stringify(b[c]));
+    }
+
+    function applyDelta(delta, keys) {
+        changed = new Set();
+        delta.forEach((d) => {
+            if (d.change === 'removed') {
+                const i = rows.findIndex((r) => keys.length > 0 ? rowKey(r, keys) === rowKey(d, keys) : sameRow(r, d));
+                if (i >= 0) {
+                    rows.splice(i, 1);
+                }
+            } else if (d.change === 'added') {
+                const row = {};
+                columns.forEach((c) => row[c] = d[c]);
+                rows.push(row);
+                changed.add(rowKey(row, keys.length > 0 ? keys : columns));
+            } else if (d.change === 'changed') {
+                const row = rows.find((r) => rowKey(r, keys) === rowKey(d, keys));
+                if (row) {
+                    row[d.column] = d.new;
+                    changed.add(rowKey(row, keys) + '/' + d.column);
+                }
+            }
+        });
+    }
+
+    function render(keys, status) {
+        const table = document.getElementById('dataTable');
+        if (!table) {
+            return;
+        }
+        const grid = document.getElementById('tableContainer');
+        if (grid) {
+            grid.style.display = 'none';
+        }
+
+        const thead = '<thead><tr>' + columns.map((c) => '<th>' + escape(c) + '</th>').join('') + '</tr></thead>';
+        const tbody = rows.map((row) => {
+            const key = rowKey(row, keys.length > 0 ? keys : columns);
+            const rowChanged = changed.has(key);
+            return '<tr>' + columns.map((c) => {
+                const highlight = rowChanged || changed.has(rowKey(row, keys) + '/' + c);
+                const value = row[c] === null || row[c] === undefined ? '' : row[c];
+                return '<td' + (highlight ? ' class="live-changed"' : '') + '>' + escape(String(value)) + '</td>';
+            }).join('') + '</tr>';
+        }).join('');
+        table.innerHTML = thead + '<tbody>' + tbody + '</tbody>';
+        document.getElementById('live-status').textContent = status;
+    }
+
+    function escape(s) {
+        return s.replace(/[&<>"']/g, (ch) => ({
+            '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;',
+        })[ch]);
+    }
+
+    function start(interval, keys) {
+        stop();
+        const params = new URLSearchParams(window.location.search);
+        params.set('_interval', interval);
+        params.delete('_key');
+        keys.forEach((k) => params.append('_key', k));
+
+        source = new EventSource(streamPath + '?' + params.toString());
+        source.addEventListener('rows', (e) => {
+            const data = JSON.parse(e.data);
+            columns = data.columns;
+            rows = data.rows;
+            changed = new Set();
+            render(keys, 'Updated ' + new Date().toLocaleTimeString());
+        });
+        source.addEventListener('delta', (e) => {
+            applyDelta(JSON.parse(e.data), keys);
+            render(keys, 'Updated ' + new Date().toLocaleTimeString());
+        });
+        source.addEventListener('error', (e) => {
+            const status = document.getElementById('live-status');
+            if (e.data) {
+                status.textContent = 'Error: ' + JSON.parse(e.data).error;
+            } else if (source.readyState === EventSource.CLOSED) {
+                status.textContent = 'Disconnected';
+            }
+        });
+    }
+
+    function stop() {
+        if (source !== null) {
+            source.close();
+            source = null;
+        }
+    }
+
+    document.addEventListener('DOMContentLoaded', () => {
+        const widgets = document.getElementById('additionalWidgets');
+        if (!widgets) {
+            return;
+        }
+        widgets.insertAdjacentHTML('beforeend',
+            '<style>td.live-changed { background-color: #fff3b0; }</style>' +
+            '<div class="row">' +
+            '<div class="column"><label class="label-inline"><input type="checkbox" id="live-toggle"> Live</label></div>' +
+            '<div class="column"><input type="text" id="live-interval" placeholder="interval, e.g. 5s"></div>' +
+            '<div class="column"><input type="text" id="live-key" placeholder="key columns, e.g. pid"></div>' +
+            '<div class="column"><span id="live-status"></span></div>' +
+            '</div>');
+
+        const toggle = document.getElementById('live-toggle');
+        const interval = document.getElementById('live-interval');
+        const key = document.getElementById('live-key');
+        interval.value = pageParams.get('_interval') || '5s';
+        key.value = pageParams.getAll('_key').join(',');
+
+        const restart = () => {
+            if (!toggle.checked) {
+                stop();
+                document.getElementById('live-status').textContent = '';
+                return;
+            }
+            const keys = key.value.split(',').map((k) => k.trim()).filter((k) => k !== '');
+            start(interval.value, keys);
+        };
+        toggle.addEventListener('change', restart);
+        interval.addEventListener('change', restart);
+        key.addEventListener('change', restart);
+
+        // ?_interval=5s in the page URL turns live mode on right away
+        if (pageParams.has('_interval')) {
+            toggle.checked = true;
+            restart();
+        }
+    });
+})();
@@ -0,0 +1,200 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/cmds/sources"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	parka_middlewares "github.com/go-go-golems/parka/pkg/glazed/middlewares"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/go-go-golems/sqleton/pkg/watch"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+const (
+	// IntervalParameter and KeyParameter are the query parameters controlling the stream.
+	// They are prefixed with an underscore so they don't clash with command flags.
+	IntervalParameter = "_interval"
+	KeyParameter      = "_key"
+
+	EventRows  = "rows"
+	EventDelta = "delta"
+	EventError = "error"
+)
+
+// CommandLookup returns the command served under path, e.g. mysql/ps.
+type CommandLookup func(path string) (cmds.Command, bool)
+
+// Handler re-runs a command on an interval and pushes the results to the client as
+// server-sent events. The first successful run is sent as a rows event containing all
+// columns and rows, every following run as a delta event with the added, removed and
+// changed rows, in the format of snapshots.Diff. Failed runs are sent as error events.
+type Handler struct {
+	lookup          CommandLookup
+	middlewares     []sources.Middleware
+	defaultInterval time.Duration
+	minInterval     time.Duration
+}
+
+type HandlerOption func(*Handler)
+
+// WithMiddlewares adds middlewares that are run after the query parameters have been
+// parsed, for example to set the connection settings.
+func WithMiddlewares(middlewares ...sources.Middleware) HandlerOption {
+	return func(h *Handler) {
+		h.middlewares = append(h.middlewares, middlewares...)
+	}
+}
+
+func WithDefaultInterval(interval time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.defaultInterval = interval
+	}
+}
+
+// WithMinInterval sets the shortest interval a client can ask for, to protect the database.
+func WithMinInterval(interval time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.minInterval = interval
+	}
+}
+
+func NewHandler(lookup CommandLookup, options ...HandlerOption) *Handler {
+	h := &Handler{
+		lookup:          lookup,
+		defaultInterval: 5 * time.Second,
+		minInterval:     time.Second,
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+// Handle serves /stream/<command>. It expects the command path as the * route parameter.
+func (h *Handler) Handle(c echo.Context) error {
+	path := strings.Trim(c.Param("*"), "/")
+	command, ok := h.lookup(path)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("command %s not found", path))
+	}
+	glazeCommand, ok := command.(cmds.GlazeCommand)
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("command %s does not produce rows", path))
+	}
+
+	interval := h.defaultInterval
+	if s := c.QueryParam(IntervalParameter); s != "" {
+		interval_, err := watch.ParseInterval(s)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		interval = interval_
+	}
+	if interval < h.minInterval {
+		return echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("interval %s is shorter than the minimum of %s", interval, h.minInterval))
+	}
+	keys := parseKeys(c.QueryParams()[KeyParameter])
+
+	parsedValues, err := h.parseValues(c, command)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// disable response buffering in nginx
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	ctx := c.Request().Context()
+	sentRows := false
+	return watch.Loop(ctx, path, interval,
+		func(ctx context.Context, gp middlewares.Processor) error {
+			return glazeCommand.RunIntoGlazeProcessor(ctx, parsedValues, gp)
+		},
+		func(previous *snapshots.Snapshot, current *snapshots.Snapshot, _ time.Time, err error) error {
+			if err != nil {
+				return writeEvent(res, EventError, map[string]string{"error": err.Error()})
+			}
+			if !sentRows {
+				sentRows = true
+				return writeEvent(res, EventRows, map[string]interface{}{
+					"columns": current.Columns,
+					"rows":    current.Rows,
+				})
+			}
+
+			delta, err := snapshots.Diff(previous, current, keys)
+			if err != nil {
+				return writeEvent(res, EventError, map[string]string{"error": err.Error()})
+			}
+			if len(delta) == 0 {
+				// keep the connection alive through proxies
+				if _, err := fmt.Fprint(res, ": no changes\n\n"); err != nil {
+					return err
+				}
+				res.Flush()
+				return nil
+			}
+			return writeEvent(res, EventDelta, delta)
+		})
+}
+
+// parseValues parses the command flags from the query parameters. Only the default
+// section can be set by the client.
+func (h *Handler) parseValues(c echo.Context, command cmds.Command) (*values.Values, error) {
+	parsedValues := values.New()
+	middlewares_ := []sources.Middleware{
+		sources.WrapWithWhitelistedSections(
+			[]string{schema.DefaultSlug},
+			parka_middlewares.UpdateFromQueryParameters(c, fields.WithSource("query")),
+		),
+	}
+	middlewares_ = append(middlewares_, h.middlewares...)
+	middlewares_ = append(middlewares_, sources.FromDefaults(fields.WithSource(fields.SourceDefaults)))
+
+	err := sources.Execute(command.Description().Schema.Clone(), parsedValues, middlewares_...)
+	if err != nil {
+		return nil, err
+	}
+	return parsedValues, nil
+}
+
+func parseKeys(params []string) []string {
+	ret := []string{}
+	for _, param := range params {
+		for _, key := range strings.Split(param, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				ret = append(ret, key)
+			}
+		}
+	}
+	return ret
+}
+
+func writeEvent(res *echo.Response, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "could not encode event")
+	}
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCommand struct {
+	*cmds.CommandDescription
+	runs   [][]types.Row
+	calls  int
+	cancel context.CancelFunc
+}
+
+func (f *fakeCommand) RunIntoGlazeProcessor(ctx context.Context, _ *values.Values, gp middlewares.Processor) error {
+	if f.calls == len(f.runs) {
+		f.cancel()
+		return ctx.Err()
+	}
+	for _, row := range f.runs[f.calls] {
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+	f.calls++
+	return nil
+}
+
+func serve(t *testing.T, command cmds.Command, ctx context.Context, target string, options ...HandlerOption) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("*")
+	c.SetParamValues(strings.TrimPrefix(strings.SplitN(target, "?", 2)[0], "/stream/"))
+
+	h := NewHandler(func(path string) (cmds.Command, bool) {
+		if path != command.Description().FullPath() {
+			return nil, false
+		}
+		return command, true
+	}, options...)
+	return rec, h.Handle(c)
+}
+
+func TestHandleSendsRowsThenDeltas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	command := &fakeCommand{
+		CommandDescription: cmds.NewCommandDescription("ps", cmds.WithParents("mysql")),
+		runs: [][]types.Row{
+			{types.NewRow(types.MRP("pid", 1), types.MRP("state", "idle"))},
+			{types.NewRow(types.MRP("pid", 1), types.MRP("state", "idle"))},
+			{types.NewRow(types.MRP("pid", 1), types.MRP("state", "lock"))},
+		},
+		cancel: cancel,
+	}
+
+	rec, err := serve(t, command, ctx, "/stream/mysql/ps?_interval=1ms&_key=pid", WithMinInterval(time.Millisecond))
+	require.NoError(t, err)
+	require.Equal(t, "text/event-stream", rec.Header().Get(echo.HeaderContentType))
+	require.Equal(t, strings.Join([]string{
+		"event: rows",
+		`data: {"columns":["pid","state"],"rows":[{"pid":1,"state":"idle"}]}`,
+		"",
+		": no changes",
+		"",
+		"event: delta",
+		`data: [{"change":"changed","pid":1,"column":"state","old":"idle","new":"lock"}]`,
+		"",
+		"",
+	}, "\n"), rec.Body.String())
+}
+
+func TestHandleRejectsBadRequests(t *testing.T) {
+	command := &fakeCommand{
+		CommandDescription: cmds.NewCommandDescription("ps", cmds.WithParents("mysql")),
+	}
+
+	_, err := serve(t, command, context.Background(), "/stream/mysql/nope")
+	require.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+
+	_, err = serve(t, command, context.Background(), "/stream/mysql/ps?_interval=10ms")
+	require.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+	_, err = serve(t, command, context.Background(), "/stream/mysql/ps?_interval=soon")
+	require.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
+}
+
+func TestParseKeys(t *testing.T) {
+	require.Equal(t, []string{"a", "b", "c"}, parseKeys([]string{"a, b", "", "c"}))
+}
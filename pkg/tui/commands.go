@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+)
+
+// commandItem is a line of the command list: the heading of a directory when
+// Command is nil, or a command of the directory.
+type commandItem struct {
+	Directory string
+	Command   *sqleton_cmds.SqlCommand
+}
+
+// groupCommands sorts the SQL commands by directory and name, and puts the heading
+// of each directory before its commands. Commands that are not SQL commands, such
+// as aliases, have no query to preview and are left out.
+func groupCommands(commands []cmds.Command) []commandItem {
+	sqlCommands := []*sqleton_cmds.SqlCommand{}
+	for _, command := range commands {
+		if sqlCommand, ok := command.(*sqleton_cmds.SqlCommand); ok {
+			sqlCommands = append(sqlCommands, sqlCommand)
+		}
+	}
+	sort.SliceStable(sqlCommands, func(i, j int) bool {
+		di, dj := commandDirectory(sqlCommands[i]), commandDirectory(sqlCommands[j])
+		if di != dj {
+			return di < dj
+		}
+		return sqlCommands[i].Name < sqlCommands[j].Name
+	})
+
+	ret := []commandItem{}
+	for i, command := range sqlCommands {
+		directory := commandDirectory(command)
+		if i == 0 || directory != commandDirectory(sqlCommands[i-1]) {
+			ret = append(ret, commandItem{Directory: directory})
+		}
+		ret = append(ret, commandItem{Directory: directory, Command: command})
+	}
+	return ret
+}
+
+func commandDirectory(command *sqleton_cmds.SqlCommand) string {
+	return strings.Join(command.Parents, "/")
+}
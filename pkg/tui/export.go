@@ -0,0 +1,89 @@
+package tui
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/schema"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/pkg/errors"
+)
+
+// exportFormats are the glazed output and table formats of the extensions of the
+// export files.
+var exportFormats = map[string][2]string{
+	".csv":      {"csv", ""},
+	".tsv":      {"tsv", ""},
+	".json":     {"json", ""},
+	".yaml":     {"yaml", ""},
+	".yml":      {"yaml", ""},
+	".md":       {"markdown", ""},
+	".markdown": {"markdown", ""},
+	".html":     {"table", "html"},
+	".sql":      {"sql", ""},
+	".txt":      {"table", "ascii"},
+}
+
+// exportRows writes the rows to path, in the format given by its extension, with
+// the glazed formatters used by the other commands.
+func exportRows(ctx context.Context, path string, columns []types.FieldName, rows []types.Row) error {
+	format, ok := exportFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return errors.Errorf("can't export to %s, the file must end with .csv, .tsv, .json, .yaml, .md, .html, .sql or .txt", path)
+	}
+
+	glazedSection, err := settings.NewGlazedSection()
+	if err != nil {
+		return err
+	}
+	parsedValues, err := schema.NewSchema(schema.WithSections(glazedSection)).InitializeFromDefaults()
+	if err != nil {
+		return err
+	}
+	glazedValues, ok := parsedValues.Get(settings.GlazedSlug)
+	if !ok {
+		return errors.New("glazed section not found")
+	}
+	if _, err := glazedValues.Fields.UpdateExistingValue("output", format[0]); err != nil {
+		return err
+	}
+	if format[1] != "" {
+		if _, err := glazedValues.Fields.UpdateExistingValue("table-format", format[1]); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	gp, err := settings.SetupTableProcessor(glazedValues)
+	if err != nil {
+		return err
+	}
+	if _, err := settings.SetupProcessorOutput(gp, glazedValues, f); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		// rows missing a column get an empty cell, so that every row has all the columns
+		complete := types.NewRow()
+		for _, column := range columns {
+			v, _ := row.Get(column)
+			complete.Set(column, v)
+		}
+		if err := gp.AddRow(ctx, complete); err != nil {
+			return err
+		}
+	}
+	if err := gp.Close(ctx); err != nil {
+		return err
+	}
+	return f.Close()
+}
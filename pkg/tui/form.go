@@ -0,0 +1,137 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/glazed/pkg/cmds/fields"
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+)
+
+// flagField is an input of the form, for a flag or an argument of the command.
+type flagField struct {
+	Definition *fields.Definition
+	Input      textinput.Model
+}
+
+// flagForm edits the flags and arguments of a command. Empty inputs keep the
+// default value, which is shown as placeholder. The values are written as on the
+// command line: lists are separated by commas, and list arguments by spaces.
+type flagForm struct {
+	command *sqleton_cmds.SqlCommand
+	fields  []*flagField
+	focus   int
+}
+
+func newFlagForm(command *sqleton_cmds.SqlCommand) *flagForm {
+	ret := &flagForm{command: command}
+	add := func(definition *fields.Definition) {
+		input := textinput.New()
+		input.Prompt = ""
+		input.Placeholder = placeholder(definition)
+		ret.fields = append(ret.fields, &flagField{Definition: definition, Input: input})
+	}
+	command.GetDefaultFlags().ForEach(add)
+	command.GetDefaultArguments().ForEach(add)
+	if len(ret.fields) > 0 {
+		ret.fields[0].Input.Focus()
+	}
+	return ret
+}
+
+func placeholder(definition *fields.Definition) string {
+	if definition.Default == nil {
+		return "<" + string(definition.Type) + ">"
+	}
+	switch v := (*definition.Default).(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case []interface{}:
+		parts := []string{}
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Label is the name of the field as given on the command line.
+func (f *flagField) Label() string {
+	if f.Definition.IsArgument {
+		return f.Definition.Name
+	}
+	return "--" + strings.ReplaceAll(f.Definition.Name, "_", "-")
+}
+
+// Move moves the focus by delta fields.
+func (f *flagForm) Move(delta int) {
+	if len(f.fields) == 0 {
+		return
+	}
+	f.fields[f.focus].Input.Blur()
+	f.focus = (f.focus + delta + len(f.fields)) % len(f.fields)
+	f.fields[f.focus].Input.Focus()
+}
+
+// Focused returns the field that has the focus, or nil if the command has none.
+func (f *flagForm) Focused() *flagField {
+	if len(f.fields) == 0 {
+		return nil
+	}
+	return f.fields[f.focus]
+}
+
+// Update passes msg to the input that has the focus.
+func (f *flagForm) Update(msg tea.Msg) tea.Cmd {
+	field := f.Focused()
+	if field == nil {
+		return nil
+	}
+	var cmd tea.Cmd
+	field.Input, cmd = field.Input.Update(msg)
+	return cmd
+}
+
+// SetValue sets the input of a flag or argument.
+func (f *flagForm) SetValue(name string, value string) bool {
+	for _, field := range f.fields {
+		if field.Definition.Name == name {
+			field.Input.SetValue(value)
+			return true
+		}
+	}
+	return false
+}
+
+// Args returns the flags and arguments that were filled in, as command line
+// arguments.
+func (f *flagForm) Args() []string {
+	flags, arguments := []string{}, []string{}
+	for _, field := range f.fields {
+		value := field.Input.Value()
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		if !field.Definition.IsArgument {
+			flags = append(flags, field.Label()+"="+value)
+			continue
+		}
+		if field.Definition.Type.IsList() {
+			arguments = append(arguments, strings.Fields(value)...)
+		} else {
+			arguments = append(arguments, value)
+		}
+	}
+	return append(append(flags, "--"), arguments...)
+}
+
+// Values parses the flags and arguments, like they are parsed on the command line.
+func (f *flagForm) Values() (*values.Values, error) {
+	parsedValues, _, err := sqleton_cmds.ParseCommandArgs(f.command, f.Args())
+	return parsedValues, err
+}
@@ -0,0 +1,467 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/middlewares/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+)
+
+type pane int
+
+const (
+	paneCommands pane = iota
+	paneForm
+	paneResults
+)
+
+// commandListWidth is the width of the command list, including its border.
+const commandListWidth = 32
+
+var (
+	paneStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("240")).
+			Padding(0, 1)
+	focusedPaneStyle = paneStyle.BorderForeground(lipgloss.Color("62"))
+	titleStyle       = lipgloss.NewStyle().Bold(true)
+	directoryStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
+	selectedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("212")).Bold(true)
+	helpStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	errorStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+)
+
+// queryResultMsg is sent when a command run by the model has returned its rows.
+type queryResultMsg struct {
+	command  string
+	columns  []types.FieldName
+	rows     []types.Row
+	duration time.Duration
+	err      error
+}
+
+// Model is the bubbletea model of sqleton tui. It lists the SQL commands grouped
+// by directory, edits the flags of the selected command in a form while showing
+// its rendered query, and runs it on db, showing the rows in a table that can be
+// sorted and exported.
+type Model struct {
+	ctx   context.Context
+	db    *sqlx.DB
+	items []commandItem
+	// cursor is the index of the selected command in items.
+	cursor int
+	focus  pane
+
+	form       *flagForm
+	preview    string
+	previewErr error
+
+	results *results
+	running bool
+	export  *textinput.Model
+	status  string
+	err     error
+
+	width  int
+	height int
+}
+
+var _ tea.Model = (*Model)(nil)
+
+func NewModel(ctx context.Context, db *sqlx.DB, commands []cmds.Command) *Model {
+	ret := &Model{
+		ctx:    ctx,
+		db:     db,
+		items:  groupCommands(commands),
+		width:  100,
+		height: 30,
+	}
+	ret.moveCursor(0)
+	return ret
+}
+
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+// selected returns the selected command, or nil when there are no commands.
+func (m *Model) selected() *sqleton_cmds.SqlCommand {
+	if m.cursor >= len(m.items) {
+		return nil
+	}
+	return m.items[m.cursor].Command
+}
+
+// moveCursor selects the command delta commands away from the selected one,
+// skipping the directory headings, and resets the form to its flags.
+func (m *Model) moveCursor(delta int) {
+	commands := []int{}
+	current := 0
+	for i, item := range m.items {
+		if item.Command == nil {
+			continue
+		}
+		if i == m.cursor {
+			current = len(commands)
+		}
+		commands = append(commands, i)
+	}
+	if len(commands) == 0 {
+		m.cursor = len(m.items)
+		return
+	}
+
+	next := min(max(current+delta, 0), len(commands)-1)
+	if m.form != nil && commands[next] == m.cursor {
+		return
+	}
+	m.cursor = commands[next]
+	m.form = newFlagForm(m.selected())
+	m.renderPreview()
+}
+
+// renderPreview renders the query of the selected command with the flags of the
+// form.
+func (m *Model) renderPreview() {
+	m.preview, m.previewErr = "", nil
+	if m.form == nil {
+		return
+	}
+	parsedValues, err := m.form.Values()
+	if err != nil {
+		m.previewErr = err
+		return
+	}
+	m.preview, m.previewErr = m.form.command.RenderQuery(m.ctx, m.db, parsedValues.GetDataMap())
+}
+
+// run runs the selected command with the flags of the form.
+func (m *Model) run() tea.Cmd {
+	if m.form == nil || m.running {
+		return nil
+	}
+	parsedValues, err := m.form.Values()
+	if err != nil {
+		m.err = err
+		return nil
+	}
+	m.running, m.err, m.status = true, nil, ""
+
+	command := m.form.command
+	ctx, db := m.ctx, m.db
+	return func() tea.Msg {
+		startedAt := time.Now()
+		// the processor only keeps the rows when it has a table middleware
+		gp := middlewares.NewTableProcessor(middlewares.WithTableMiddleware(&table.NullTableMiddleware{}))
+		err := command.RunIntoGlazeProcessorWithDB(ctx, db, parsedValues.GetDataMap(), gp)
+		if err == nil {
+			err = gp.Close(ctx)
+		}
+		result := gp.GetTable()
+		return queryResultMsg{
+			command:  strings.ReplaceAll(command.FullPath(), "/", " "),
+			columns:  result.Columns,
+			rows:     result.Rows,
+			duration: time.Since(startedAt),
+			err:      err,
+		}
+	}
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case queryResultMsg:
+		m.running = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.results = newResults(msg.command, msg.columns, msg.rows, msg.duration)
+		m.focus = paneResults
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.export != nil {
+			return m, m.updateExport(msg)
+		}
+		switch msg.String() {
+		case "tab":
+			m.cycleFocus(1)
+			return m, nil
+		case "shift+tab":
+			m.cycleFocus(-1)
+			return m, nil
+		}
+		switch m.focus {
+		case paneCommands:
+			return m, m.updateCommands(msg)
+		case paneForm:
+			return m, m.updateForm(msg)
+		case paneResults:
+			return m, m.updateResults(msg)
+		}
+	}
+
+	if m.focus == paneForm && m.form != nil {
+		return m, m.form.Update(msg)
+	}
+	return m, nil
+}
+
+func (m *Model) cycleFocus(delta int) {
+	panes := []pane{paneCommands, paneForm}
+	if m.results != nil {
+		panes = append(panes, paneResults)
+	}
+	current := 0
+	for i, p := range panes {
+		if p == m.focus {
+			current = i
+		}
+	}
+	m.focus = panes[(current+delta+len(panes))%len(panes)]
+}
+
+func (m *Model) updateCommands(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q", "esc":
+		return tea.Quit
+	case "up", "k":
+		m.moveCursor(-1)
+	case "down", "j":
+		m.moveCursor(1)
+	case "pgup":
+		m.moveCursor(-10)
+	case "pgdown":
+		m.moveCursor(10)
+	case "home", "g":
+		m.moveCursor(-len(m.items))
+	case "end", "G":
+		m.moveCursor(len(m.items))
+	case "enter", "right", "l":
+		if m.form != nil {
+			m.focus = paneForm
+		}
+	case "ctrl+r":
+		return m.run()
+	}
+	return nil
+}
+
+func (m *Model) updateForm(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.focus = paneCommands
+		return nil
+	case "up":
+		m.form.Move(-1)
+		return nil
+	case "down":
+		m.form.Move(1)
+		return nil
+	case "enter", "ctrl+r":
+		return m.run()
+	}
+	before := m.form.Args()
+	cmd := m.form.Update(msg)
+	if strings.Join(m.form.Args(), "\x00") != strings.Join(before, "\x00") {
+		m.renderPreview()
+	}
+	return cmd
+}
+
+func (m *Model) updateResults(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q":
+		return tea.Quit
+	case "esc":
+		m.focus = paneForm
+		return nil
+	case "left", "h":
+		m.results.SelectColumn(-1)
+		return nil
+	case "right", "l":
+		m.results.SelectColumn(1)
+		return nil
+	case "s":
+		m.results.ToggleSort()
+		return nil
+	case "e":
+		input := textinput.New()
+		input.Prompt = "Export to: "
+		input.Placeholder = "results.csv"
+		input.Focus()
+		m.export = &input
+		m.status = ""
+		return textinput.Blink
+	case "ctrl+r":
+		return m.run()
+	}
+	var cmd tea.Cmd
+	m.results.table, cmd = m.results.table.Update(msg)
+	return cmd
+}
+
+func (m *Model) updateExport(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc":
+		m.export = nil
+		return nil
+	case "enter":
+		path := strings.TrimSpace(m.export.Value())
+		if path == "" {
+			path = m.export.Placeholder
+		}
+		m.export = nil
+		if err := exportRows(m.ctx, path, m.results.Columns, m.results.SortedRows()); err != nil {
+			m.err = err
+			return nil
+		}
+		m.err = nil
+		m.status = fmt.Sprintf("Exported %d rows to %s", len(m.results.Rows), path)
+		return nil
+	}
+	var cmd tea.Cmd
+	*m.export, cmd = m.export.Update(msg)
+	return cmd
+}
+
+func (m *Model) View() string {
+	bodyHeight := max(m.height-3, 5)
+	rightWidth := max(m.width-commandListWidth, 20)
+
+	var right string
+	if m.focus == paneResults && m.results != nil {
+		right = m.resultsView(rightWidth, bodyHeight)
+	} else {
+		right = m.formView(rightWidth, bodyHeight)
+	}
+	body := lipgloss.JoinHorizontal(lipgloss.Top, m.commandsView(bodyHeight), right)
+
+	return lipgloss.JoinVertical(lipgloss.Left, body, m.statusView(), helpStyle.Render(m.helpView()))
+}
+
+func (m *Model) paneStyle(p pane, width int, height int) lipgloss.Style {
+	style := paneStyle
+	if m.focus == p {
+		style = focusedPaneStyle
+	}
+	// the size of a lipgloss style includes the padding, but not the border
+	return style.Width(width - 2).Height(height - 2)
+}
+
+func (m *Model) commandsView(height int) string {
+	lines := []string{}
+	for i, item := range m.items {
+		switch {
+		case item.Command == nil:
+			directory := item.Directory
+			if directory == "" {
+				directory = "."
+			}
+			lines = append(lines, directoryStyle.Render(directory+"/"))
+		case i == m.cursor:
+			lines = append(lines, selectedStyle.Render("› "+item.Command.Name))
+		default:
+			lines = append(lines, "  "+item.Command.Name)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "no SQL commands")
+	}
+
+	// scroll the list so that the selected command is visible
+	visible := max(height-2, 1)
+	start := 0
+	if m.cursor >= visible {
+		start = m.cursor - visible + 1
+	}
+	end := min(start+visible, len(lines))
+	return m.paneStyle(paneCommands, commandListWidth, height).Render(strings.Join(lines[start:end], "\n"))
+}
+
+func (m *Model) formView(width int, height int) string {
+	style := m.paneStyle(paneForm, width, height)
+	command := m.selected()
+	if command == nil || m.form == nil {
+		return style.Render("")
+	}
+
+	lines := []string{titleStyle.Render(strings.ReplaceAll(command.FullPath(), "/", " ")) + "  " + command.Short, ""}
+	labelWidth := 0
+	for _, field := range m.form.fields {
+		labelWidth = max(labelWidth, len(field.Label()))
+	}
+	for _, field := range m.form.fields {
+		field.Input.Width = max(width-labelWidth-8, 10)
+		label := fmt.Sprintf("%-*s ", labelWidth, field.Label())
+		if m.focus == paneForm && field == m.form.Focused() {
+			label = selectedStyle.Render(label)
+		}
+		lines = append(lines, label+field.Input.View())
+	}
+	if field := m.form.Focused(); field != nil && field.Definition.Help != "" {
+		lines = append(lines, helpStyle.Render(field.Definition.Help))
+	}
+
+	lines = append(lines, "", titleStyle.Render("Query"))
+	if m.previewErr != nil {
+		lines = append(lines, errorStyle.Render(m.previewErr.Error()))
+	} else {
+		lines = append(lines, strings.Split(m.preview, "\n")...)
+	}
+	if visible := height - 2; len(lines) > visible {
+		lines = append(lines[:visible-1], helpStyle.Render("…"))
+	}
+	return style.Render(strings.Join(lines, "\n"))
+}
+
+func (m *Model) resultsView(width int, height int) string {
+	title := fmt.Sprintf("%s  %d rows in %s", titleStyle.Render(m.results.Command),
+		len(m.results.Rows), m.results.Duration.Round(time.Millisecond))
+	m.results.SetSize(width-4, height-3)
+	return m.paneStyle(paneResults, width, height).Render(title + "\n" + m.results.View())
+}
+
+func (m *Model) statusView() string {
+	switch {
+	case m.export != nil:
+		return m.export.View()
+	case m.running:
+		return "Running…"
+	case m.err != nil:
+		return errorStyle.Render("Error: " + m.err.Error())
+	default:
+		return m.status
+	}
+}
+
+func (m *Model) helpView() string {
+	switch {
+	case m.export != nil:
+		return "enter export (.csv, .tsv, .json, .yaml, .md, .html, .sql, .txt) • esc cancel"
+	case m.focus == paneForm:
+		return "↑/↓ field • enter run • esc commands • tab switch pane • ctrl+c quit"
+	case m.focus == paneResults:
+		return "↑/↓ scroll • ←/→ column • s sort • e export • ctrl+r run again • esc flags • q quit"
+	default:
+		return "↑/↓ select • enter edit flags • ctrl+r run • tab switch pane • q quit"
+	}
+}
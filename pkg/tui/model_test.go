@@ -0,0 +1,222 @@
+package tui
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/glazed/pkg/cmds"
+	sqleton_cmds "github.com/go-go-golems/sqleton/pkg/cmds"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const ordersCommand = `/* sqleton
+name: orders
+short: List the orders
+flags:
+  - name: status
+    type: stringList
+    help: Only the orders of these statuses
+  - name: min_total
+    type: int
+    default: 0
+*/
+SELECT id, status, total FROM orders
+WHERE total >= {{ .min_total }}
+{{ if .status }}AND status IN ({{ .status | sqlStringIn }}){{ end }}
+ORDER BY id
+`
+
+const customersCommand = `/* sqleton
+name: customers
+short: List the customers
+arguments:
+  - name: names
+    type: stringList
+*/
+SELECT name FROM customers
+{{ if .names }}WHERE name IN ({{ .names | sqlStringIn }}){{ end }}
+`
+
+func compileTestCommand(t *testing.T, source string, parents ...string) *sqleton_cmds.SqlCommand {
+	t.Helper()
+	spec, err := sqleton_cmds.ParseSQLFileSpec("test.sql", []byte(source))
+	require.NoError(t, err)
+	command, err := (&sqleton_cmds.SqlCommandCompiler{}).Compile(spec, cmds.WithParents(parents...))
+	require.NoError(t, err)
+	return command
+}
+
+func newTestModel(t *testing.T) *Model {
+	t.Helper()
+	db, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	for _, statement := range []string{
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT, total REAL)",
+		"INSERT INTO orders VALUES (1, 'open', 10.5), (2, 'paid', 4), (3, 'open', 7), (4, 'paid', 12)",
+		"CREATE TABLE customers (name TEXT)",
+	} {
+		_, err := db.Exec(statement)
+		require.NoError(t, err)
+	}
+
+	return NewModel(context.Background(), db, []cmds.Command{
+		compileTestCommand(t, ordersCommand, "shop"),
+		compileTestCommand(t, customersCommand, "shop"),
+		compileTestCommand(t, "/* sqleton\nname: now\nshort: Select one\n*/\nSELECT 1", "misc"),
+	})
+}
+
+func sendKeys(m *Model, keys ...string) tea.Cmd {
+	var cmd tea.Cmd
+	for _, k := range keys {
+		var msg tea.KeyMsg
+		switch k {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "tab":
+			msg = tea.KeyMsg{Type: tea.KeyTab}
+		case "up":
+			msg = tea.KeyMsg{Type: tea.KeyUp}
+		case "down":
+			msg = tea.KeyMsg{Type: tea.KeyDown}
+		case "left":
+			msg = tea.KeyMsg{Type: tea.KeyLeft}
+		case "right":
+			msg = tea.KeyMsg{Type: tea.KeyRight}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		}
+		_, cmd = m.Update(msg)
+	}
+	return cmd
+}
+
+// runQuery runs the query started by cmd, and hands its result to the model.
+func runQuery(t *testing.T, m *Model, cmd tea.Cmd) {
+	t.Helper()
+	require.NotNil(t, cmd)
+	msg := cmd()
+	_, ok := msg.(queryResultMsg)
+	require.True(t, ok, "%T", msg)
+	m.Update(msg)
+}
+
+func TestGroupCommands(t *testing.T) {
+	m := newTestModel(t)
+	names := []string{}
+	for _, item := range m.items {
+		if item.Command == nil {
+			names = append(names, item.Directory+"/")
+		} else {
+			names = append(names, item.Command.Name)
+		}
+	}
+	require.Equal(t, []string{"misc/", "now", "shop/", "customers", "orders"}, names)
+	require.Equal(t, "now", m.selected().Name)
+}
+
+func TestFormPreview(t *testing.T) {
+	m := newTestModel(t)
+	sendKeys(m, "down", "down")
+	require.Equal(t, "orders", m.selected().Name)
+	require.Contains(t, m.preview, "WHERE total >= 0")
+	require.NotContains(t, m.preview, "AND status")
+
+	sendKeys(m, "enter")
+	require.Equal(t, paneForm, m.focus)
+	sendKeys(m, "o", "p", "e", "n", ",", "p", "a", "i", "d")
+	require.Equal(t, []string{"--status=open,paid", "--"}, m.form.Args())
+	require.Contains(t, m.preview, "AND status IN ('open','paid')")
+
+	sendKeys(m, "down", "x")
+	require.Error(t, m.previewErr)
+	require.Contains(t, m.View(), `invalid argument "x" for "--min-total" flag`)
+
+	// the form is reset when another command is selected
+	sendKeys(m, "esc", "up")
+	require.Equal(t, "customers", m.selected().Name)
+	sendKeys(m, "enter", "a", "l", "i", "c", "e", " ", "b", "o", "b")
+	require.Equal(t, []string{"--", "alice", "bob"}, m.form.Args())
+	require.Contains(t, m.preview, "WHERE name IN ('alice','bob')")
+}
+
+func TestRunSortExport(t *testing.T) {
+	m := newTestModel(t)
+	sendKeys(m, "down", "down", "enter", "t", "a", "b")
+	require.Equal(t, "--status=tab", m.form.Args()[0])
+	sendKeys(m, "down", "5")
+
+	runQuery(t, m, sendKeys(m, "enter"))
+	require.NoError(t, m.err)
+	require.Equal(t, paneResults, m.focus)
+	require.Empty(t, m.results.Rows)
+
+	sendKeys(m, "esc", "up")
+	for range 3 {
+		m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	}
+	require.Equal(t, []string{"--min-total=5", "--"}, m.form.Args())
+	runQuery(t, m, sendKeys(m, "enter"))
+	require.NoError(t, m.err)
+	require.Equal(t, []string{"id", "status", "total"}, m.results.Columns)
+	ids := func() []interface{} {
+		ret := []interface{}{}
+		for _, row := range m.results.SortedRows() {
+			id, _ := row.Get("id")
+			ret = append(ret, id)
+		}
+		return ret
+	}
+	require.Equal(t, []interface{}{int64(1), int64(3), int64(4)}, ids())
+	view := m.View()
+	require.Contains(t, view, "shop orders  3 rows")
+	require.Contains(t, view, "[id]")
+
+	// sort by total, ascending, descending, then in the order of the query
+	sendKeys(m, "right", "right", "s")
+	require.Equal(t, []interface{}{int64(3), int64(1), int64(4)}, ids())
+	require.Contains(t, m.View(), "[total ▲]")
+	sendKeys(m, "s")
+	require.Equal(t, []interface{}{int64(4), int64(1), int64(3)}, ids())
+	sendKeys(m, "s")
+	require.Equal(t, []interface{}{int64(1), int64(3), int64(4)}, ids())
+	sendKeys(m, "s", "s")
+
+	path := filepath.Join(t.TempDir(), "orders.csv")
+	sendKeys(m, "e")
+	require.NotNil(t, m.export)
+	sendKeys(m, path, "enter")
+	require.Nil(t, m.export)
+	require.NoError(t, m.err)
+	require.Equal(t, "Exported 3 rows to "+path, m.status)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "id,status,total\n4,paid,12\n1,open,10.5\n3,open,7\n", string(data))
+
+	sendKeys(m, "e", filepath.Join(t.TempDir(), "orders.pdf"), "enter")
+	require.ErrorContains(t, m.err, "can't export to")
+	require.Contains(t, m.View(), "Error: can't export to")
+}
+
+func TestRunError(t *testing.T) {
+	m := newTestModel(t)
+	sendKeys(m, "down", "enter")
+	require.Equal(t, "customers", m.selected().Name)
+	_, err := m.db.Exec("DROP TABLE customers")
+	require.NoError(t, err)
+
+	runQuery(t, m, sendKeys(m, "enter"))
+	require.ErrorContains(t, m.err, "no such table: customers")
+	require.Nil(t, m.results)
+	require.True(t, strings.Contains(m.View(), "Error:"))
+}
@@ -0,0 +1,218 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/go-go-golems/glazed/pkg/types"
+)
+
+// maxColumnWidth is the width above which the cells of the result table are cut.
+const maxColumnWidth = 40
+
+type sortOrder int
+
+const (
+	sortNone sortOrder = iota
+	sortAscending
+	sortDescending
+)
+
+// results are the rows returned by a run of a command, shown in a scrollable
+// table that can be sorted by one column.
+type results struct {
+	Command  string
+	Columns  []types.FieldName
+	Rows     []types.Row
+	Duration time.Duration
+
+	// Selected is the column that s sorts by.
+	Selected  int
+	SortBy    int
+	SortOrder sortOrder
+
+	order []int
+	table table.Model
+}
+
+func newResults(command string, columns []types.FieldName, rows []types.Row, duration time.Duration) *results {
+	ret := &results{
+		Command:  command,
+		Columns:  columns,
+		Rows:     rows,
+		Duration: duration,
+		table:    table.New(table.WithFocused(true)),
+	}
+	ret.sort()
+	return ret
+}
+
+// SelectColumn moves the selected column by delta.
+func (r *results) SelectColumn(delta int) {
+	if len(r.Columns) == 0 {
+		return
+	}
+	r.Selected = (r.Selected + delta + len(r.Columns)) % len(r.Columns)
+	r.refresh()
+}
+
+// ToggleSort sorts by the selected column, in ascending order, then descending
+// order, then in the order of the query.
+func (r *results) ToggleSort() {
+	if r.SortBy != r.Selected || r.SortOrder == sortNone {
+		r.SortBy, r.SortOrder = r.Selected, sortAscending
+	} else if r.SortOrder == sortAscending {
+		r.SortOrder = sortDescending
+	} else {
+		r.SortOrder = sortNone
+	}
+	r.sort()
+}
+
+// SortedRows returns the rows in the order they are shown.
+func (r *results) SortedRows() []types.Row {
+	ret := make([]types.Row, 0, len(r.order))
+	for _, i := range r.order {
+		ret = append(ret, r.Rows[i])
+	}
+	return ret
+}
+
+func (r *results) sort() {
+	r.order = make([]int, len(r.Rows))
+	for i := range r.order {
+		r.order[i] = i
+	}
+	if r.SortOrder != sortNone && r.SortBy < len(r.Columns) {
+		column := r.Columns[r.SortBy]
+		sort.SliceStable(r.order, func(i, j int) bool {
+			a, _ := r.Rows[r.order[i]].Get(column)
+			b, _ := r.Rows[r.order[j]].Get(column)
+			if r.SortOrder == sortDescending {
+				return compareValues(b, a) < 0
+			}
+			return compareValues(a, b) < 0
+		})
+	}
+	r.refresh()
+}
+
+// refresh updates the table after the rows, their order or the selected column
+// changed.
+func (r *results) refresh() {
+	widths := make([]int, len(r.Columns))
+	cells := make([]table.Row, 0, len(r.order))
+	for _, i := range r.order {
+		row := make(table.Row, len(r.Columns))
+		for c, column := range r.Columns {
+			v, _ := r.Rows[i].Get(column)
+			row[c] = formatCell(v)
+			widths[c] = max(widths[c], len([]rune(row[c])))
+		}
+		cells = append(cells, row)
+	}
+
+	columns := make([]table.Column, len(r.Columns))
+	for c, name := range r.Columns {
+		title := name
+		if c == r.SortBy && r.SortOrder == sortAscending {
+			title += " ▲"
+		} else if c == r.SortBy && r.SortOrder == sortDescending {
+			title += " ▼"
+		}
+		if c == r.Selected {
+			title = "[" + title + "]"
+		}
+		columns[c] = table.Column{Title: title, Width: min(max(widths[c], len([]rune(title))), maxColumnWidth)}
+	}
+
+	// the rows are replaced first, so that they always have a cell per column
+	r.table.SetRows(nil)
+	r.table.SetColumns(columns)
+	r.table.SetRows(cells)
+}
+
+// SetSize sets the size of the table, including its header.
+func (r *results) SetSize(width int, height int) {
+	r.table.SetWidth(width)
+	r.table.SetHeight(max(height, 2))
+}
+
+func (r *results) View() string {
+	return r.table.View()
+}
+
+func formatCell(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	s := fmt.Sprint(v)
+	return strings.NewReplacer("\n", " ", "\t", " ").Replace(s)
+}
+
+// compareValues orders NULL first, numbers by value, times by date, and other
+// values by their text.
+func compareValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,244 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/settings"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/go-go-golems/sqleton/pkg/snapshots"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
+)
+
+const (
+	clearScreen    = "\x1b[H\x1b[2J"
+	highlightStart = "\x1b[7m"
+	highlightEnd   = "\x1b[0m"
+)
+
+// Options configures how a command is re-run.
+type Options struct {
+	Interval time.Duration
+	// Highlight marks cells that changed since the previous run.
+	Highlight bool
+	// Deltas prints only the rows that changed since the previous run as JSON lines,
+	// instead of re-rendering the full output.
+	Deltas bool
+	// Keys are the columns used to match rows between runs. Without keys, rows are
+	// matched by position for highlighting and compared whole for deltas.
+	Keys []string
+}
+
+// ParseInterval parses the value of a --watch flag. An empty string disables watching.
+func ParseInterval(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid watch interval %q", s)
+	}
+	if interval <= 0 {
+		return 0, errors.Errorf("watch interval must be positive, got %s", s)
+	}
+	return interval, nil
+}
+
+// OptionsFromSqlHelpers returns the watch options set by the sql-helpers flags,
+// or nil if --watch wasn't passed.
+func OptionsFromSqlHelpers(s *flags.SqlHelpersSettings) (*Options, error) {
+	interval, err := ParseInterval(s.Watch)
+	if err != nil {
+		return nil, err
+	}
+	if interval == 0 {
+		return nil, nil
+	}
+	if s.Snapshot != "" {
+		return nil, errors.New("--snapshot can't be combined with --watch")
+	}
+	return &Options{
+		Interval:  interval,
+		Highlight: s.WatchHighlight,
+		Deltas:    s.WatchDeltas,
+		Keys:      s.WatchKey,
+	}, nil
+}
+
+// RunFunc executes the watched command once, sending its rows to gp.
+type RunFunc func(ctx context.Context, gp middlewares.Processor) error
+
+// ResultFunc is called after every run of a Loop with the rows of the previous
+// successful run and the rows of the current run, or the error of the current run.
+// Before the first successful run, previous has no rows.
+type ResultFunc func(previous *snapshots.Snapshot, current *snapshots.Snapshot, startedAt time.Time, err error) error
+
+// Loop calls run every interval until ctx is canceled or onResult returns an error.
+func Loop(
+	ctx context.Context,
+	name string,
+	interval time.Duration,
+	run RunFunc,
+	onResult ResultFunc,
+) error {
+	previous := &snapshots.Snapshot{Name: name, Columns: []string{}}
+	for {
+		startedAt := time.Now()
+		recorder := snapshots.NewRecorder(nil)
+		err := run(ctx, recorder)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err != nil {
+			if err := onResult(previous, nil, startedAt, err); err != nil {
+				return err
+			}
+		} else {
+			current := recorder.Snapshot(name, name, nil)
+			if err := onResult(previous, current, startedAt, nil); err != nil {
+				return err
+			}
+			previous = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Run calls run every interval until ctx is canceled. After every run, the output
+// is re-rendered to w using the glazed settings of the command, or, in deltas mode,
+// the changes are written to w as JSON lines.
+func Run(
+	ctx context.Context,
+	name string,
+	parsedValues *values.Values,
+	options Options,
+	run RunFunc,
+	w io.Writer,
+) error {
+	glazedValues, ok := parsedValues.Get(settings.GlazedSlug)
+	if !ok && !options.Deltas {
+		return errors.New("glazed section not found")
+	}
+
+	interactive := false
+	if f, ok := w.(*os.File); ok {
+		interactive = term.IsTerminal(int(f.Fd()))
+	}
+
+	return Loop(ctx, name, options.Interval, run,
+		func(previous *snapshots.Snapshot, current *snapshots.Snapshot, startedAt time.Time, err error) error {
+			if options.Deltas {
+				if err != nil {
+					log.Error().Err(err).Str("command", name).Msg("watched command failed")
+					return nil
+				}
+				return writeDeltas(w, previous, current, options.Keys)
+			}
+
+			if interactive {
+				_, _ = fmt.Fprint(w, clearScreen)
+				printHeader(w, name, options.Interval, startedAt)
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(w, "Error: %v\n", err)
+				return nil
+			}
+			return render(ctx, glazedValues, w, previous, current, options)
+		})
+}
+
+func printHeader(w io.Writer, name string, interval time.Duration, at time.Time) {
+	_, _ = fmt.Fprintf(w, "Every %s: %s    %s\n\n", interval, name, at.Format(time.DateTime))
+}
+
+func writeDeltas(w io.Writer, previous *snapshots.Snapshot, current *snapshots.Snapshot, keys []string) error {
+	rows, err := snapshots.Diff(previous, current, keys)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return errors.Wrap(err, "could not encode delta")
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func render(
+	ctx context.Context,
+	glazedValues *values.SectionValues,
+	w io.Writer,
+	previous *snapshots.Snapshot,
+	current *snapshots.Snapshot,
+	options Options,
+) error {
+	gp, err := settings.SetupTableProcessor(glazedValues)
+	if err != nil {
+		return errors.Wrap(err, "could not setup processor")
+	}
+	if _, err := settings.SetupProcessorOutput(gp, glazedValues, w); err != nil {
+		return errors.Wrap(err, "could not setup processor output")
+	}
+
+	var changed []map[string]bool
+	// nothing to compare against on the first run
+	if options.Highlight && previous.Rows != nil {
+		changed, err = snapshots.ChangedCells(previous, current, options.Keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, values_ := range current.Rows {
+		row := types.NewRow()
+		for _, column := range current.Columns {
+			v, ok := values_[column]
+			if !ok {
+				continue
+			}
+			if changed != nil && changed[i][column] {
+				v = highlightStart + formatValue(v) + highlightEnd
+			}
+			row.Set(column, v)
+		}
+		if err := gp.AddRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return gp.Close(ctx)
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(string(data))
+}
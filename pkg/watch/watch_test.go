@@ -0,0 +1,82 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-go-golems/glazed/pkg/cmds/values"
+	"github.com/go-go-golems/glazed/pkg/middlewares"
+	"github.com/go-go-golems/glazed/pkg/types"
+	"github.com/go-go-golems/sqleton/pkg/flags"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunWritesDeltas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := [][]types.Row{
+		{
+			types.NewRow(types.MRP("pid", 1), types.MRP("state", "idle")),
+			types.NewRow(types.MRP("pid", 2), types.MRP("state", "query")),
+		},
+		{
+			types.NewRow(types.MRP("pid", 2), types.MRP("state", "lock")),
+			types.NewRow(types.MRP("pid", 3), types.MRP("state", "idle")),
+		},
+	}
+	calls := 0
+	run := func(ctx context.Context, gp middlewares.Processor) error {
+		if calls == len(runs) {
+			cancel()
+			return ctx.Err()
+		}
+		for _, row := range runs[calls] {
+			if err := gp.AddRow(ctx, row); err != nil {
+				return err
+			}
+		}
+		calls++
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	err := Run(ctx, "mysql/ps", values.New(), Options{
+		Interval: time.Millisecond,
+		Deltas:   true,
+		Keys:     []string{"pid"},
+	}, run, buf)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		`{"change":"added","pid":1,"state":"idle"}`,
+		`{"change":"added","pid":2,"state":"query"}`,
+		`{"change":"removed","pid":1,"state":"idle"}`,
+		`{"change":"changed","pid":2,"column":"state","old":"query","new":"lock"}`,
+		`{"change":"added","pid":3,"state":"idle"}`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
+
+func TestOptionsFromSqlHelpers(t *testing.T) {
+	options, err := OptionsFromSqlHelpers(&flags.SqlHelpersSettings{})
+	require.NoError(t, err)
+	require.Nil(t, options)
+
+	options, err = OptionsFromSqlHelpers(&flags.SqlHelpersSettings{
+		Watch:       "2s",
+		WatchDeltas: true,
+		WatchKey:    []string{"pid"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &Options{Interval: 2 * time.Second, Deltas: true, Keys: []string{"pid"}}, options)
+
+	_, err = OptionsFromSqlHelpers(&flags.SqlHelpersSettings{Watch: "soon"})
+	require.Error(t, err)
+	_, err = OptionsFromSqlHelpers(&flags.SqlHelpersSettings{Watch: "-1s"})
+	require.Error(t, err)
+	_, err = OptionsFromSqlHelpers(&flags.SqlHelpersSettings{Watch: "1s", Snapshot: "ps"})
+	require.Error(t, err)
+}